@@ -0,0 +1,169 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"mirage-backend/config"
+)
+
+// Hook runs when the application starts or stops
+type Hook func(ctx context.Context) error
+
+// App owns the HTTP server and the background workers and ties their lifetime together.
+//
+// Start hooks run before the server accepts connections; on Stop the server stops accepting
+// connections and waits for in-flight requests, workers are cancelled and waited for, then the
+// stop hooks run in reverse order, so that resources such as the database outlive their users.
+type App struct {
+	cfg    config.ServerConfig
+	server *http.Server
+
+	onStart []Hook
+	onStop  []Hook
+
+	workersCtx    context.Context
+	cancelWorkers context.CancelFunc
+	workers       sync.WaitGroup
+
+	listener net.Listener
+	serveErr chan error
+}
+
+// New returns an application serving handler with the given settings
+func New(cfg config.ServerConfig, handler http.Handler) *App {
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+
+	return &App{
+		cfg: cfg,
+		server: &http.Server{
+			Addr:         ":" + cfg.Port,
+			Handler:      handler,
+			ReadTimeout:  time.Duration(cfg.ReadTimeout),
+			WriteTimeout: time.Duration(cfg.WriteTimeout),
+			IdleTimeout:  time.Duration(cfg.IdleTimeout),
+		},
+		workersCtx:    workersCtx,
+		cancelWorkers: cancelWorkers,
+		serveErr:      make(chan error, 1),
+	}
+}
+
+// OnStart registers a hook run by Start before the server listens
+func (a *App) OnStart(hook Hook) {
+	a.onStart = append(a.onStart, hook)
+}
+
+// OnStop registers a hook run by Stop once requests and workers are done
+func (a *App) OnStop(hook Hook) {
+	a.onStop = append(a.onStop, hook)
+}
+
+// OnShutdown registers a function run as soon as Stop begins, to end long-lived connections such as event streams
+// that would otherwise keep the server from draining
+func (a *App) OnShutdown(f func()) {
+	a.server.RegisterOnShutdown(f)
+}
+
+// Go runs a background worker; its context is cancelled on Stop, which then waits for it to return
+func (a *App) Go(worker func(ctx context.Context)) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		worker(a.workersCtx)
+	}()
+}
+
+// Start runs the start hooks and starts serving, it returns once the server is listening
+func (a *App) Start(ctx context.Context) error {
+	for _, hook := range a.onStart {
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", a.server.Addr, err)
+	}
+	a.listener = listener
+
+	go func() {
+		if err := a.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.serveErr <- err
+		}
+		close(a.serveErr)
+	}()
+
+	slog.Info("Listening", "address", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the address the server listens on, useful when the port is 0
+func (a *App) Addr() string {
+	if a.listener == nil {
+		return ""
+	}
+	return a.listener.Addr().String()
+}
+
+// Stop shuts the application down, giving up on whatever is still running when ctx is done
+func (a *App) Stop(ctx context.Context) error {
+	var errs []error
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to drain HTTP requests: %v", err))
+	}
+
+	a.cancelWorkers()
+	done := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, errors.New("background workers did not stop in time"))
+	}
+
+	for i := len(a.onStop) - 1; i >= 0; i-- {
+		if err := a.onStop[i](ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Run starts the application and stops it on SIGINT or SIGTERM, or when the server fails
+func (a *App) Run() error {
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	if err := a.Start(signals); err != nil {
+		return err
+	}
+
+	var serveErr error
+	select {
+	case <-signals.Done():
+		slog.Info("Shutting down")
+	case serveErr = <-a.serveErr:
+		slog.Error("Server failed", "error", serveErr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.cfg.ShutdownTimeout))
+	defer cancel()
+
+	return errors.Join(serveErr, a.Stop(ctx))
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"mirage-backend/config"
+)
+
+// testConfig listens on a free port
+func testConfig() config.ServerConfig {
+	cfg := config.Default().Server
+	cfg.Port = "0"
+	return cfg
+}
+
+func TestStopDrainsRequestsThenRunsStopHooksInReverse(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	a := New(testConfig(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}))
+
+	var order []string
+	a.OnStart(func(ctx context.Context) error {
+		order = append(order, "start")
+		return nil
+	})
+	for _, name := range []string{"database", "cache"} {
+		a.OnStop(func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+	workerStopped := make(chan struct{})
+	a.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if a.Addr() == "" {
+		t.Fatal("no address once started")
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	requested := make(chan result, 1)
+	go func() {
+		res, err := http.Get("http://" + a.Addr())
+		if err != nil {
+			requested <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		requested <- result{body: string(body), err: err}
+	}()
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- a.Stop(context.Background())
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop() = %v before the in-flight request completed", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if r := <-requested; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request = %q, %v, want it completed", r.body, r.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-workerStopped:
+	default:
+		t.Error("worker not cancelled by Stop")
+	}
+	if want := []string{"start", "cache", "database"}; !slices.Equal(order, want) {
+		t.Errorf("hooks ran in order %v, want %v", order, want)
+	}
+
+	if _, err := http.Get("http://" + a.Addr()); err == nil {
+		t.Error("server still accepting connections after Stop")
+	}
+}
+
+func TestStopReportsEveryFailure(t *testing.T) {
+	a := New(testConfig(), http.NotFoundHandler())
+	first, second := errors.New("first"), errors.New("second")
+	a.OnStop(func(ctx context.Context) error { return first })
+	a.OnStop(func(ctx context.Context) error { return second })
+	a.Go(func(ctx context.Context) {
+		// ignores the cancellation
+		time.Sleep(time.Second)
+	})
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := a.Stop(ctx)
+	if !errors.Is(err, first) || !errors.Is(err, second) {
+		t.Errorf("Stop() = %v, want both hook errors", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "background workers did not stop in time") {
+		t.Errorf("Stop() = %v, want the workers reported", err)
+	}
+}
+
+func TestStartHookFailurePreventsListening(t *testing.T) {
+	a := New(testConfig(), http.NotFoundHandler())
+	failure := errors.New("database unreachable")
+	a.OnStart(func(ctx context.Context) error { return failure })
+
+	if err := a.Start(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("Start() = %v, want %v", err, failure)
+	}
+	if a.Addr() != "" {
+		t.Errorf("listening on %s after a failed start hook", a.Addr())
+	}
+}
@@ -0,0 +1,110 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Stable error codes, clients can rely on them not changing
+const (
+	CodeInvalidInput         = "invalid_input"
+	CodeInvalidPagination    = "invalid_pagination"
+	CodeInvalidCursor        = "invalid_cursor"
+	CodeInvalidFile          = "invalid_file"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRouteNotFound        = "route_not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeImmutableField       = "immutable_field"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeForbidden            = "forbidden"
+	CodeInternal             = "internal_error"
+)
+
+// Error is an application error carrying everything needed to answer the client.
+// The cause is logged but never sent to the client.
+type Error struct {
+	Status int
+	Code   string
+	Title  string
+	Detail string
+	Cause  error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// New returns an error with the given status, code and detail, titled after the status
+func New(status int, code, detail string) *Error {
+	return &Error{Status: status, Code: code, Title: http.StatusText(status), Detail: detail}
+}
+
+// BadRequest reports invalid input
+func BadRequest(code, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+// InvalidInput reports a request body that could not be bound or validated
+func InvalidInput(err error) *Error {
+	return BadRequest(CodeInvalidInput, err.Error())
+}
+
+// InvalidID reports a malformed identifier of the given resource, e.g. InvalidID("album") has code invalid_album_id
+func InvalidID(resource string) *Error {
+	return BadRequest("invalid_"+codeName(resource)+"_id", "Invalid "+resource+" ID")
+}
+
+// NotFound reports a missing resource, e.g. NotFound("album") has code album_not_found
+func NotFound(resource string) *Error {
+	e := New(http.StatusNotFound, codeName(resource)+"_not_found", capitalize(resource)+" not found")
+	e.Title = e.Detail
+	return e
+}
+
+// Conflict reports a request clashing with the current state of a resource
+func Conflict(code, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// Forbidden reports an acting user lacking the right to do what was requested
+func Forbidden(detail string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// Internal wraps an unexpected failure, detail describes what was attempted without exposing the cause
+func Internal(detail string, cause error) *Error {
+	e := New(http.StatusInternalServerError, CodeInternal, detail)
+	e.Cause = cause
+	return e
+}
+
+// From converts any error into an application error, unknown errors become internal errors
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal("An unexpected error occurred", err)
+}
+
+// codeName turns a resource name such as "profile picture" into "profile_picture"
+func codeName(resource string) string {
+	return strings.ReplaceAll(strings.ToLower(resource), " ", "_")
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
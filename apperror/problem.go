@@ -0,0 +1,99 @@
+package apperror
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"mirage-backend/logging"
+)
+
+// ContentType is the media type of problem responses (RFC 7807)
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the error code to form the problem type URI
+const typeBase = "/problems/"
+
+// Problem is the body of every error response, following RFC 7807
+type Problem struct {
+	Type      string `json:"type" example:"/problems/album_not_found"`
+	Title     string `json:"title" example:"Album not found"`
+	Status    int    `json:"status" example:"404"`
+	Detail    string `json:"detail,omitempty" example:"Album not found"`
+	Instance  string `json:"instance,omitempty" example:"/api/v1/albums/6790c4f4e13e5f1d2a6d3b0a"`
+	Code      string `json:"code" example:"album_not_found"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Abort records err as the outcome of the request and stops the handler chain.
+// The response is written by Middleware once the handlers return.
+func Abort(c *gin.Context, err error) {
+	_ = c.Error(err)
+	c.Abort()
+}
+
+// Middleware turns the error recorded with Abort into a problem response.
+// Only the first error produces a response, and only if the handler didn't write one already.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+
+		if c.Writer.Written() {
+			slog.WarnContext(c.Request.Context(), "Error recorded after the response was written",
+				"error", c.Errors.String())
+			return
+		}
+
+		Write(c, From(c.Errors[0].Err))
+	}
+}
+
+// Write sends err as a problem response, internal causes are logged instead of returned
+func Write(c *gin.Context, err *Error) {
+	if err.Status >= http.StatusInternalServerError {
+		slog.ErrorContext(c.Request.Context(), err.Detail, "code", err.Code, "error", err.Cause)
+	}
+
+	problem := Problem{
+		Type:      typeBase + err.Code,
+		Title:     err.Title,
+		Status:    err.Status,
+		Detail:    err.Detail,
+		Instance:  c.Request.URL.Path,
+		Code:      err.Code,
+		RequestID: logging.RequestIDFromContext(c.Request.Context()),
+	}
+
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(err.Status, problem)
+}
+
+// Recovery answers requests whose handler panicked with an internal error problem
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		Write(c, Internal("An unexpected error occurred", panicError{recovered}))
+	})
+}
+
+// NoRoute answers requests matching no route
+func NoRoute(c *gin.Context) {
+	Write(c, New(http.StatusNotFound, CodeRouteNotFound, "No route matches "+c.Request.URL.Path))
+}
+
+// NoMethod answers requests using a method the route doesn't support
+func NoMethod(c *gin.Context) {
+	Write(c, New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, c.Request.Method+" is not allowed on "+c.Request.URL.Path))
+}
+
+type panicError struct {
+	value any
+}
+
+func (p panicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
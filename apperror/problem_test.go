@@ -0,0 +1,134 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"mirage-backend/logging"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve sends a request for path to a router whose handlers abort with err, or panic when err is nil
+func serve(t *testing.T, method, path string, err error) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(NoRoute)
+	router.NoMethod(NoMethod)
+	router.Use(logging.RequestID(), Recovery(), Middleware())
+	router.GET("/api/albums/:id", func(c *gin.Context) {
+		if err == nil {
+			panic("nil album")
+		}
+		Abort(c, err)
+	})
+
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("response is not a problem: %v: %s", err, w.Body.String())
+	}
+	return w, problem
+}
+
+func TestProblemResponses(t *testing.T) {
+	tests := []struct {
+		name         string
+		method, path string
+		err          error
+		want         Problem
+	}{
+		{
+			name: "not found", method: http.MethodGet, path: "/api/albums/1", err: NotFound("profile picture"),
+			want: Problem{Status: http.StatusNotFound, Code: "profile_picture_not_found", Title: "Profile picture not found", Detail: "Profile picture not found"},
+		},
+		{
+			name: "invalid id", method: http.MethodGet, path: "/api/albums/1", err: InvalidID("album"),
+			want: Problem{Status: http.StatusBadRequest, Code: "invalid_album_id", Title: "Bad Request", Detail: "Invalid album ID"},
+		},
+		{
+			name: "wrapped", method: http.MethodGet, path: "/api/albums/1", err: fmt.Errorf("loading: %w", Conflict("album_exists", "Album exists")),
+			want: Problem{Status: http.StatusConflict, Code: "album_exists", Title: "Conflict", Detail: "Album exists"},
+		},
+		{
+			name: "forbidden", method: http.MethodGet, path: "/api/albums/1", err: Forbidden("Not allowed to view this album"),
+			want: Problem{Status: http.StatusForbidden, Code: CodeForbidden, Title: "Forbidden", Detail: "Not allowed to view this album"},
+		},
+		{
+			name: "internal", method: http.MethodGet, path: "/api/albums/1", err: Internal("Failed to load the album", errors.New("connection refused")),
+			want: Problem{Status: http.StatusInternalServerError, Code: CodeInternal, Title: "Internal Server Error", Detail: "Failed to load the album"},
+		},
+		{
+			name: "unknown", method: http.MethodGet, path: "/api/albums/1", err: errors.New("connection refused"),
+			want: Problem{Status: http.StatusInternalServerError, Code: CodeInternal, Title: "Internal Server Error", Detail: "An unexpected error occurred"},
+		},
+		{
+			name: "panic", method: http.MethodGet, path: "/api/albums/1",
+			want: Problem{Status: http.StatusInternalServerError, Code: CodeInternal, Title: "Internal Server Error", Detail: "An unexpected error occurred"},
+		},
+		{
+			name: "no route", method: http.MethodGet, path: "/api/nope",
+			want: Problem{Status: http.StatusNotFound, Code: CodeRouteNotFound, Title: "Not Found", Detail: "No route matches /api/nope"},
+		},
+		{
+			name: "no method", method: http.MethodDelete, path: "/api/albums/1",
+			want: Problem{Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed, Title: "Method Not Allowed", Detail: "DELETE is not allowed on /api/albums/1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := serve(t, tt.method, tt.path, tt.err)
+
+			want := tt.want
+			want.Type, want.Instance, want.RequestID = "/problems/"+want.Code, tt.path, "req-1"
+			if w.Code != want.Status || problem != want {
+				t.Errorf("%d %+v, want %+v", w.Code, problem, want)
+			}
+			if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, ContentType) {
+				t.Errorf("content type %q, want %q", contentType, ContentType)
+			}
+			if strings.Contains(w.Body.String(), "connection refused") || strings.Contains(w.Body.String(), "nil album") {
+				t.Errorf("cause sent to the client: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeepsWrittenResponses(t *testing.T) {
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusAccepted, "queued")
+		Abort(c, errors.New("late failure"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted || w.Body.String() != "queued" {
+		t.Errorf("%d %q, want the response written by the handler", w.Code, w.Body.String())
+	}
+}
+
+func TestFromKeepsApplicationErrors(t *testing.T) {
+	notFound := NotFound("album")
+	if got := From(fmt.Errorf("loading: %w", notFound)); got != notFound {
+		t.Errorf("From() = %v, want %v", got, notFound)
+	}
+	cause := errors.New("connection refused")
+	if got := From(cause); got.Status != http.StatusInternalServerError || !errors.Is(got, cause) {
+		t.Errorf("From() = %v, want an internal error caused by %v", got, cause)
+	}
+}
@@ -1,14 +1,231 @@
 package config
 
 import (
-	"github.com/joho/godotenv"
-	"log"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"mirage-backend/logging"
+)
+
+// Config holds every setting of the backend
+type Config struct {
+	// Environment is reported by the health endpoint, e.g. development or production
+	Environment string            `yaml:"environment" toml:"environment"`
+	Server      ServerConfig      `yaml:"server" toml:"server"`
+	Database    DatabaseConfig    `yaml:"database" toml:"database"`
+	Log         LogConfig         `yaml:"log" toml:"log"`
+	Tracing     TracingConfig     `yaml:"tracing" toml:"tracing"`
+	Firmware    FirmwareConfig    `yaml:"firmware" toml:"firmware"`
+	Recognition RecognitionConfig `yaml:"recognition" toml:"recognition"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Port string `yaml:"port" toml:"port"`
+	// ReadTimeout bounds reading a whole request, uploads included
+	ReadTimeout  Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests and background workers are waited for on shutdown
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// DatabaseConfig holds the MongoDB connection settings
+type DatabaseConfig struct {
+	URI  string `yaml:"uri" toml:"uri"`
+	Name string `yaml:"name" toml:"name"`
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `yaml:"level" toml:"level"`
+	// Format is text or json
+	Format string `yaml:"format" toml:"format"`
+}
+
+// Tracing exporters
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
 )
 
-func init() {
-	// load env file
-	err := godotenv.Load()
+// TracingConfig holds the OpenTelemetry tracing settings
+type TracingConfig struct {
+	// Exporter is none, otlp (OTLP over HTTP) or stdout
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// Endpoint is the host:port of the OTLP collector, empty uses the OTEL_EXPORTER_OTLP_* variables
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// Insecure disables TLS towards the collector
+	Insecure bool `yaml:"insecure" toml:"insecure"`
+	// SampleRatio is the fraction of new traces recorded, between 0 and 1
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// MinPublisherTokenLength is the shortest firmware publisher token accepted
+const MinPublisherTokenLength = 32
+
+// FirmwareConfig holds the over-the-air firmware update settings
+type FirmwareConfig struct {
+	// PublisherToken authenticates the release pipeline publishing firmware, empty disables publishing
+	PublisherToken string `yaml:"publisher_token" toml:"publisher_token"`
+}
+
+// Face recognition backends
+const (
+	RecognitionBackendNone = "none"
+	RecognitionBackendHTTP = "http"
+)
+
+// RecognitionConfig holds the face detection settings
+type RecognitionConfig struct {
+	// Backend is none, which disables face detection, or http (a detection service reached at Endpoint)
+	Backend string `yaml:"backend" toml:"backend"`
+	// Endpoint is the URL the pictures are posted to by the http backend
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// Timeout bounds the detection of a single picture
+	Timeout Duration `yaml:"timeout" toml:"timeout"`
+	// Workers is how many pictures are processed at the same time
+	Workers int `yaml:"workers" toml:"workers"`
+	// QueueSize is how many pictures can wait for detection, the readiness probe fails when it is nearly full
+	QueueSize int `yaml:"queue_size" toml:"queue_size"`
+	// MinConfidence drops the detections the backend is less sure of, between 0 and 1
+	MinConfidence float64 `yaml:"min_confidence" toml:"min_confidence"`
+	// Similarity is the cosine similarity, between -1 and 1, a face must have with a person to be grouped into it
+	Similarity float64 `yaml:"similarity" toml:"similarity"`
+}
+
+// Default returns the configuration used for every setting no source overrides
+func Default() Config {
+	return Config{
+		Environment: "development",
+		Server: ServerConfig{
+			Port:            "8080",
+			ReadTimeout:     Duration(time.Minute),
+			WriteTimeout:    Duration(time.Minute),
+			IdleTimeout:     Duration(2 * time.Minute),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: TracingConfig{
+			Exporter:    TracingExporterNone,
+			SampleRatio: 1,
+		},
+		Recognition: RecognitionConfig{
+			Backend:       RecognitionBackendNone,
+			Timeout:       Duration(30 * time.Second),
+			Workers:       2,
+			QueueSize:     1000,
+			MinConfidence: 0.5,
+			Similarity:    0.6,
+		},
+	}
+}
+
+// Validate checks every setting and reports all the problems at once
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Environment == "" {
+		errs = append(errs, errors.New("environment must not be empty"))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port %q must be a number between 1 and 65535", c.Server.Port))
+	}
+
+	timeouts := []struct {
+		name  string
+		value Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", timeout.name))
+		}
+	}
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %v", err))
+	}
+	if format := strings.ToLower(c.Log.Format); format != logging.FormatText && format != logging.FormatJSON {
+		errs = append(errs, fmt.Errorf("log.format %q must be text or json", c.Log.Format))
+	}
+
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterOTLP, TracingExporterStdout:
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter %q must be none, otlp or stdout", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio %v must be between 0 and 1", c.Tracing.SampleRatio))
+	}
+
+	if token := c.Firmware.PublisherToken; token != "" && len(token) < MinPublisherTokenLength {
+		errs = append(errs, fmt.Errorf("firmware.publisher_token must be at least %d characters", MinPublisherTokenLength))
+	}
+
+	switch c.Recognition.Backend {
+	case RecognitionBackendNone:
+	case RecognitionBackendHTTP:
+		if endpoint, err := url.Parse(c.Recognition.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			errs = append(errs, fmt.Errorf("recognition.endpoint %q must be an http or https URL", c.Recognition.Endpoint))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("recognition.backend %q must be none or http", c.Recognition.Backend))
+	}
+	if c.Recognition.Timeout <= 0 {
+		errs = append(errs, errors.New("recognition.timeout must be positive"))
+	}
+	if c.Recognition.Workers < 1 {
+		errs = append(errs, fmt.Errorf("recognition.workers %d must be at least 1", c.Recognition.Workers))
+	}
+	if c.Recognition.QueueSize < 1 {
+		errs = append(errs, fmt.Errorf("recognition.queue_size %d must be at least 1", c.Recognition.QueueSize))
+	}
+	if c.Recognition.MinConfidence < 0 || c.Recognition.MinConfidence > 1 {
+		errs = append(errs, fmt.Errorf("recognition.min_confidence %v must be between 0 and 1", c.Recognition.MinConfidence))
+	}
+	if c.Recognition.Similarity < -1 || c.Recognition.Similarity > 1 {
+		errs = append(errs, fmt.Errorf("recognition.similarity %v must be between -1 and 1", c.Recognition.Similarity))
+	}
+
+	if c.Database.URI == "" {
+		errs = append(errs, errors.New("database.uri is required (DB_URI)"))
+	}
+	if c.Database.Name == "" {
+		errs = append(errs, errors.New("database.name is required (DB_DATABASE)"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Duration is a time.Duration written as a string such as "30s" or "2m" in files and variables
+type Duration time.Duration
+
+// UnmarshalText parses the duration, it is used by the YAML and TOML decoders
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return err
 	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText formats the duration the way UnmarshalText reads it
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
 }
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// valid returns the defaults completed with the settings that have none
+func valid() Config {
+	cfg := Default()
+	cfg.Database = DatabaseConfig{URI: "mongodb://localhost:27017", Name: "mirage"}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		// errs are found in the error, in the order the settings are checked
+		errs []string
+	}{
+		{name: "valid", change: func(c *Config) {}},
+		{name: "http recognition", change: func(c *Config) {
+			c.Recognition.Backend, c.Recognition.Endpoint = RecognitionBackendHTTP, "http://faces:5000/detect"
+		}},
+		{name: "port", change: func(c *Config) { c.Server.Port = "80a" }, errs: []string{`server.port "80a"`}},
+		{name: "timeouts", change: func(c *Config) { c.Server.ReadTimeout, c.Server.ShutdownTimeout = 0, Duration(-time.Second) },
+			errs: []string{"server.read_timeout must be positive", "server.shutdown_timeout must be positive"}},
+		{name: "log", change: func(c *Config) { c.Log.Level, c.Log.Format = "loud", "xml" }, errs: []string{"log.level", `log.format "xml"`}},
+		{name: "tracing", change: func(c *Config) { c.Tracing.Exporter, c.Tracing.SampleRatio = "zipkin", 2 },
+			errs: []string{`tracing.exporter "zipkin"`, "tracing.sample_ratio 2"}},
+		{name: "short publisher token", change: func(c *Config) { c.Firmware.PublisherToken = "secret" }, errs: []string{"firmware.publisher_token"}},
+		{name: "recognition endpoint", change: func(c *Config) {
+			c.Recognition.Backend, c.Recognition.Endpoint = RecognitionBackendHTTP, "faces:5000"
+		}, errs: []string{`recognition.endpoint "faces:5000"`}},
+		{name: "recognition", change: func(c *Config) {
+			c.Recognition = RecognitionConfig{Backend: "grpc", MinConfidence: 1.5, Similarity: -2}
+		}, errs: []string{`recognition.backend "grpc"`, "recognition.timeout", "recognition.workers 0", "recognition.queue_size 0",
+			"recognition.min_confidence 1.5", "recognition.similarity -2"}},
+		{name: "everything missing", change: func(c *Config) { *c = Config{} }, errs: []string{"environment", "server.port",
+			"server.read_timeout", "log.level", "log.format", "tracing.exporter", "recognition.backend", "database.uri", "database.name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %d errors", len(tt.errs))
+			}
+
+			// every problem is reported, one per line
+			message := err.Error()
+			for _, want := range tt.errs {
+				i := strings.Index(message, want)
+				if i < 0 {
+					t.Fatalf("Validate() = %q, want %q after the previous errors", err, want)
+				}
+				message = message[i+len(want):]
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; tt.name != "everything missing" && lines != len(tt.errs) {
+				t.Errorf("Validate() reported %d errors, want %d: %v", lines, len(tt.errs), err)
+			}
+		})
+	}
+}
+
+// writeFile writes the content to the file named name in a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// environment looks the variables up in vars
+func environment(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func TestLoaderPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+environment: staging
+server:
+  port: "9000"
+  read_timeout: 10s
+log:
+  level: debug
+database:
+  uri: mongodb://file:27017
+  name: file
+`)
+	tomlFile := writeFile(t, "config.toml", `
+environment = "staging"
+
+[server]
+port = "9000"
+read_timeout = "10s"
+
+[log]
+level = "debug"
+
+[database]
+uri = "mongodb://file:27017"
+name = "file"
+`)
+	envFile := writeFile(t, ".env", "BACKEND_PORT=9100\nLOG_LEVEL=warn\nDB_DATABASE=dotenv\n")
+
+	tests := []struct {
+		name    string
+		loader  Loader
+		want    func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			loader: Loader{LookupEnv: environment(map[string]string{"DB_URI": "mongodb://env:27017", "DB_DATABASE": "env"})},
+			want: func(c *Config) {
+				c.Database = DatabaseConfig{URI: "mongodb://env:27017", Name: "env"}
+			},
+		},
+		{
+			name:   "yaml file over defaults",
+			loader: Loader{File: yamlFile},
+			want: func(c *Config) {
+				c.Environment, c.Server.Port, c.Server.ReadTimeout, c.Log.Level = "staging", "9000", Duration(10*time.Second), "debug"
+				c.Database = DatabaseConfig{URI: "mongodb://file:27017", Name: "file"}
+			},
+		},
+		{
+			name:   "toml file over defaults",
+			loader: Loader{File: tomlFile},
+			want: func(c *Config) {
+				c.Environment, c.Server.Port, c.Server.ReadTimeout, c.Log.Level = "staging", "9000", Duration(10*time.Second), "debug"
+				c.Database = DatabaseConfig{URI: "mongodb://file:27017", Name: "file"}
+			},
+		},
+		{
+			name:   ".env over file",
+			loader: Loader{File: yamlFile, EnvFile: envFile},
+			want: func(c *Config) {
+				c.Environment, c.Server.Port, c.Server.ReadTimeout, c.Log.Level = "staging", "9100", Duration(10*time.Second), "warn"
+				c.Database = DatabaseConfig{URI: "mongodb://file:27017", Name: "dotenv"}
+			},
+		},
+		{
+			name: "environment over .env",
+			loader: Loader{File: yamlFile, EnvFile: envFile, LookupEnv: environment(map[string]string{
+				"LOG_LEVEL":   "error",
+				"DB_DATABASE": "",
+				"APP_ENV":     "production",
+			})},
+			want: func(c *Config) {
+				// empty variables are ignored
+				c.Environment, c.Server.Port, c.Server.ReadTimeout, c.Log.Level = "production", "9100", Duration(10*time.Second), "error"
+				c.Database = DatabaseConfig{URI: "mongodb://file:27017", Name: "dotenv"}
+			},
+		},
+		{
+			name:   "missing .env",
+			loader: Loader{File: yamlFile, EnvFile: filepath.Join(t.TempDir(), ".env")},
+			want: func(c *Config) {
+				c.Environment, c.Server.Port, c.Server.ReadTimeout, c.Log.Level = "staging", "9000", Duration(10*time.Second), "debug"
+				c.Database = DatabaseConfig{URI: "mongodb://file:27017", Name: "file"}
+			},
+		},
+		{
+			name:    "missing file",
+			loader:  Loader{File: filepath.Join(t.TempDir(), "config.yaml")},
+			wantErr: "failed to read config file",
+		},
+		{
+			name:    "unsupported file",
+			loader:  Loader{File: writeFile(t, "config.json", "{}")},
+			wantErr: `unsupported config file format ".json"`,
+		},
+		{
+			name:    "invalid variables",
+			loader:  Loader{File: yamlFile, LookupEnv: environment(map[string]string{"SERVER_IDLE_TIMEOUT": "soon", "RECOGNITION_WORKERS": "many"})},
+			wantErr: "invalid configuration in environment",
+		},
+		{
+			name:    "invalid result",
+			loader:  Loader{File: yamlFile, LookupEnv: environment(map[string]string{"TRACING_SAMPLE_RATIO": "3"})},
+			wantErr: "tracing.sample_ratio 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.loader.Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := Default()
+			tt.want(&want)
+			if cfg != want {
+				t.Errorf("Load() = %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestInvalidVariablesAreAllReported(t *testing.T) {
+	_, err := Loader{LookupEnv: environment(map[string]string{"SERVER_IDLE_TIMEOUT": "soon", "RECOGNITION_WORKERS": "many"})}.Load()
+	if err == nil || !strings.Contains(err.Error(), "SERVER_IDLE_TIMEOUT") || !strings.Contains(err.Error(), "RECOGNITION_WORKERS") {
+		t.Errorf("Load() = %v, want both invalid variables reported", err)
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnvVar names the environment variable pointing at an optional configuration file
+const FileEnvVar = "CONFIG_FILE"
+
+// envBindings maps environment variables onto settings
+var envBindings = map[string]func(c *Config, value string) error{
+	"APP_ENV":                    setString(func(c *Config) *string { return &c.Environment }),
+	"BACKEND_PORT":               setString(func(c *Config) *string { return &c.Server.Port }),
+	"SERVER_READ_TIMEOUT":        setDuration(func(c *Config) *Duration { return &c.Server.ReadTimeout }),
+	"SERVER_WRITE_TIMEOUT":       setDuration(func(c *Config) *Duration { return &c.Server.WriteTimeout }),
+	"SERVER_IDLE_TIMEOUT":        setDuration(func(c *Config) *Duration { return &c.Server.IdleTimeout }),
+	"SERVER_SHUTDOWN_TIMEOUT":    setDuration(func(c *Config) *Duration { return &c.Server.ShutdownTimeout }),
+	"DB_URI":                     setString(func(c *Config) *string { return &c.Database.URI }),
+	"DB_DATABASE":                setString(func(c *Config) *string { return &c.Database.Name }),
+	"LOG_LEVEL":                  setString(func(c *Config) *string { return &c.Log.Level }),
+	"LOG_FORMAT":                 setString(func(c *Config) *string { return &c.Log.Format }),
+	"TRACING_EXPORTER":           setString(func(c *Config) *string { return &c.Tracing.Exporter }),
+	"TRACING_ENDPOINT":           setString(func(c *Config) *string { return &c.Tracing.Endpoint }),
+	"TRACING_INSECURE":           setBool(func(c *Config) *bool { return &c.Tracing.Insecure }),
+	"TRACING_SAMPLE_RATIO":       setFloat(func(c *Config) *float64 { return &c.Tracing.SampleRatio }),
+	"FIRMWARE_PUBLISHER_TOKEN":   setString(func(c *Config) *string { return &c.Firmware.PublisherToken }),
+	"RECOGNITION_BACKEND":        setString(func(c *Config) *string { return &c.Recognition.Backend }),
+	"RECOGNITION_ENDPOINT":       setString(func(c *Config) *string { return &c.Recognition.Endpoint }),
+	"RECOGNITION_TIMEOUT":        setDuration(func(c *Config) *Duration { return &c.Recognition.Timeout }),
+	"RECOGNITION_WORKERS":        setInt(func(c *Config) *int { return &c.Recognition.Workers }),
+	"RECOGNITION_QUEUE_SIZE":     setInt(func(c *Config) *int { return &c.Recognition.QueueSize }),
+	"RECOGNITION_MIN_CONFIDENCE": setFloat(func(c *Config) *float64 { return &c.Recognition.MinConfidence }),
+	"RECOGNITION_SIMILARITY":     setFloat(func(c *Config) *float64 { return &c.Recognition.Similarity }),
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setBool(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func setFloat(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func setDuration(field func(c *Config) *Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		return field(c).UnmarshalText([]byte(value))
+	}
+}
+
+// Loader builds a Config from layered sources, each one overriding the previous:
+// defaults, the configuration file, the .env file and finally the process environment.
+type Loader struct {
+	// File is a YAML (.yaml, .yml) or TOML (.toml) file; empty means no file
+	File string
+	// EnvFile is a dotenv file; a missing file is not an error
+	EnvFile string
+	// LookupEnv reads the process environment, nil disables it
+	LookupEnv func(key string) (string, bool)
+}
+
+// Load reads the configuration from the file named by CONFIG_FILE, .env and the environment
+func Load() (Config, error) {
+	return Loader{
+		File:      os.Getenv(FileEnvVar),
+		EnvFile:   ".env",
+		LookupEnv: os.LookupEnv,
+	}.Load()
+}
+
+// Load builds and validates the configuration
+func (l Loader) Load() (Config, error) {
+	cfg := Default()
+
+	if l.File != "" {
+		if err := loadFile(l.File, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if l.EnvFile != "" {
+		values, err := godotenv.Read(l.EnvFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return Config{}, fmt.Errorf("failed to read %s: %v", l.EnvFile, err)
+		}
+		err = applyEnv(&cfg, func(key string) (string, bool) {
+			value, ok := values[key]
+			return value, ok
+		})
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid configuration in %s:\n%v", l.EnvFile, err)
+		}
+	}
+
+	if l.LookupEnv != nil {
+		if err := applyEnv(&cfg, l.LookupEnv); err != nil {
+			return Config{}, fmt.Errorf("invalid configuration in environment:\n%v", err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%v", err)
+	}
+	return cfg, nil
+}
+
+// loadFile decodes the configuration file over cfg, keeping the settings it doesn't mention
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides the settings whose variable is set and not empty
+func applyEnv(cfg *Config, lookup func(key string) (string, bool)) error {
+	var errs []error
+	for key, apply := range envBindings {
+		if value, ok := lookup(key); ok && value != "" {
+			if err := apply(cfg, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", key, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// roleOwner is the role of the owner of an album, who holds every right
+const roleOwner = "owner"
+
+// albumRight is something a user may do to an album
+type albumRight string
+
+const (
+	rightView      albumRight = "view"
+	rightUpload    albumRight = "upload pictures to"
+	rightRemoveOwn albumRight = "remove their pictures from"
+	rightRemoveAny albumRight = "remove pictures from"
+	rightEdit      albumRight = "edit"
+	rightManage    albumRight = "manage the sharing of"
+	rightDelete    albumRight = "delete"
+)
+
+// roleRights lists the rights of every role, each role holding the rights of the previous one
+var roleRights = map[string][]albumRight{
+	models.RoleViewer:      {rightView},
+	models.RoleContributor: {rightView, rightUpload, rightRemoveOwn},
+	models.RoleCoOwner:     {rightView, rightUpload, rightRemoveOwn, rightRemoveAny, rightEdit, rightManage},
+	roleOwner:              {rightView, rightUpload, rightRemoveOwn, rightRemoveAny, rightEdit, rightManage, rightDelete},
+}
+
+// can tells whether role holds right
+func can(role string, right albumRight) bool {
+	return slices.Contains(roleRights[role], right)
+}
+
+// albumRole returns the role of the user in the album: roleOwner, the role of an accepted invitation or "" for strangers
+func albumRole(ctx context.Context, invitations repository.InvitationRepository, album models.Album, userID primitive.ObjectID) (string, error) {
+	if album.OwnerID == userID {
+		return roleOwner, nil
+	}
+
+	invitation, err := invitations.GetByAlbumAndUser(ctx, album.ID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if invitation.Status != models.InvitationAccepted {
+		return "", nil
+	}
+	return invitation.Role, nil
+}
+
+// authorizeAlbum checks that the user acting on behalf of the request holds right on the album.
+// Anonymous requests are rejected, callers only let them view public albums.
+func authorizeAlbum(c *gin.Context, ctx context.Context, invitations repository.InvitationRepository, album models.Album, right albumRight) error {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		return err
+	}
+
+	role, err := albumRole(ctx, invitations, album, userID)
+	if err != nil {
+		return apperror.Internal("Failed to check album membership", err)
+	}
+	if !can(role, right) {
+		return apperror.Forbidden("Not allowed to " + string(right) + " this album")
+	}
+	return nil
+}
+
+// authorizePictureRemoval checks that the acting user may remove the picture from the album,
+// contributors may only remove the pictures they uploaded
+func authorizePictureRemoval(c *gin.Context, ctx context.Context, invitations repository.InvitationRepository, album models.Album, picture models.Picture) error {
+	right := rightRemoveAny
+	if userID, ok, _ := actingUser(c); ok && picture.UserID == userID {
+		right = rightRemoveOwn
+	}
+	return authorizeAlbum(c, ctx, invitations, album, right)
+}
+
+// authorizeUploader checks that the acting user uploaded the picture, the only one with rights on a picture outside any album
+func authorizeUploader(c *gin.Context, picture models.Picture) error {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		return err
+	}
+	if userID != picture.UserID {
+		return apperror.Forbidden("Not allowed to manage this picture")
+	}
+	return nil
+}
+
+// authorizePictureView checks that the acting user may view the picture: its uploader always may, other users only when
+// its album is public or shared with them. Pictures outside any album are public.
+func authorizePictureView(c *gin.Context, ctx context.Context, albums repository.AlbumRepository, invitations repository.InvitationRepository, picture models.Picture) error {
+	if picture.AlbumID.IsZero() {
+		return nil
+	}
+	if userID, ok, _ := actingUser(c); ok && picture.UserID == userID {
+		return nil
+	}
+
+	album, err := albums.Get(ctx, picture.AlbumID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve album", err)
+	}
+	if album.IsPrivate {
+		return authorizeAlbum(c, ctx, invitations, album, rightView)
+	}
+	return nil
+}
@@ -2,49 +2,88 @@ package controllers
 
 import (
 	"context"
-	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"mirage-backend/database"
+	"mirage-backend/apperror"
 	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
 )
 
+// AlbumHandler serves the album endpoints
+type AlbumHandler struct {
+	albums      repository.AlbumRepository
+	invitations repository.InvitationRepository
+	people      repository.PersonRepository
+}
+
+// NewAlbumHandler returns an AlbumHandler storing albums in the given repository, checking rights against the invitations
+// and the people selected by smart albums against the people of their owner
+func NewAlbumHandler(albums repository.AlbumRepository, invitations repository.InvitationRepository, people repository.PersonRepository) *AlbumHandler {
+	return &AlbumHandler{albums: albums, invitations: invitations, people: people}
+}
+
 // CreateAlbum godoc
 // @Summary Create a new album
-// @Description Creates a new album with the provided details
+// @Description Creates a new album owned by the acting user with the provided details, it is shared through invitations so TargetUserIDs is ignored.
+// @Description An album with Criteria is a smart album: its pictures are the ones matching the criteria among the pictures
+// @Description its owner uploaded to an album or may view, it is always private and cannot be shared.
 // @Tags albums
 // @Accept json
 // @Produce json
-// @Param album body models.Album true "Album to create"
+// @Param X-User-ID header string true "Acting user, who owns the album"
+// @Param album body models.Album true "Album to create, its OwnerID is the acting user when set"
 // @Success 201 {object} map[string]interface{} "Album created successfully"
-// @Failure 400 {object} map[string]string "Invalid input"
-// @Failure 500 {object} map[string]string "Failed to create album"
+// @Failure 400 {object} apperror.Problem "Invalid input"
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem "OwnerID is another user"
+// @Failure 500 {object} apperror.Problem "Failed to create album"
 // @Router /albums [post]
-func CreateAlbum(c *gin.Context) {
+func (h *AlbumHandler) CreateAlbum(c *gin.Context) {
+	ownerID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
 	var album models.Album
 
 	// Validate JSON input
 	if err := c.ShouldBindJSON(&album); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	if !album.OwnerID.IsZero() && album.OwnerID != ownerID {
+		apperror.Abort(c, apperror.Forbidden("Not allowed to create an album for another user"))
 		return
 	}
 
 	// Set album properties
 	album.ID = primitive.NewObjectID()
+	album.OwnerID = ownerID
+	album.TargetUserIDs = nil
 	album.CreatedAt = time.Now()
+	album.UpdatedAt = album.CreatedAt
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
+	if album.Criteria != nil {
+		if err := normalizeCriteria(ctx, h.people, album.OwnerID, album.Criteria); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		album.IsPrivate = true
+	}
+
 	// Insert album into the database
-	_, err := database.AlbumCollection.InsertOne(ctx, album)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create album", "details": err.Error()})
+	if err := h.albums.Create(ctx, &album); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to create album", err))
 		return
 	}
 
@@ -53,272 +92,398 @@ func CreateAlbum(c *gin.Context) {
 
 // GetAllAlbums godoc
 // @Summary Retrieve all albums
-// @Description Fetches a list of all albums in the database
+// @Description Fetches a page of the albums the acting user may view: the public ones, their own and the ones shared with them
 // @Tags albums
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, title, created_at, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
 // @Success 200 {object} map[string]interface{} "Albums retrieved successfully"
-// @Failure 500 {object} map[string]string "Failed to retrieve albums"
+// @Failure 400 {object} apperror.Problem "Invalid user ID or pagination parameters"
+// @Failure 500 {object} apperror.Problem "Failed to retrieve albums"
 // @Router /albums [get]
-func GetAllAlbums(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cursor, err := database.AlbumCollection.Find(ctx, bson.M{})
+func (h *AlbumHandler) GetAllAlbums(c *gin.Context) {
+	viewerID, _, err := actingUser(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve albums", "details": err.Error()})
+		apperror.Abort(c, err)
 		return
 	}
 
-	defer func(cursor *mongo.Cursor, ctx context.Context) {
-		if err := cursor.Close(ctx); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close cursor", "details": err.Error()})
-		}
-	}(cursor, ctx)
-
-	// Collect albums into a slice
-	var albums []models.Album
-	for cursor.Next(ctx) {
-		var album models.Album
-		if err := cursor.Decode(&album); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode album", "details": err.Error()})
-			return
-		}
-		albums = append(albums, album)
+	query, err := parsePageQuery(c, albumListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
 	}
 
-	if err := cursor.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cursor error", "details": err.Error()})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	page, err := h.albums.List(ctx, repository.AlbumFilter{VisibleTo: &viewerID}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve albums", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Albums retrieved successfully", "data": albums})
+	respondWithPage(c, "Albums retrieved successfully", query, page)
 }
 
 // GetAlbumByID godoc
 // @Summary Retrieve a specific album
-// @Description Fetches a single album by its unique identifier
+// @Description Fetches a single album by its unique identifier, private albums only to their members
 // @Tags albums
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
 // @Param albumId path string true "Album Unique Identifier"
 // @Success 200 {object} map[string]interface{} "Album retrieved successfully"
-// @Failure 400 {object} map[string]string "Invalid album ID"
-// @Failure 404 {object} map[string]string "Album not found"
-// @Failure 500 {object} map[string]string "Failed to retrieve album"
+// @Header 200 {string} ETag "Version of the album, to send as If-Match when updating it"
+// @Failure 400 {object} apperror.Problem "Invalid album ID"
+// @Failure 401 {object} apperror.Problem "No acting user for a private album"
+// @Failure 403 {object} apperror.Problem "Private album the acting user is not a member of"
+// @Failure 404 {object} apperror.Problem "Album not found"
+// @Failure 500 {object} apperror.Problem "Failed to retrieve album"
 // @Router /albums/{albumId} [get]
-func GetAlbumByID(c *gin.Context) {
+func (h *AlbumHandler) GetAlbumByID(c *gin.Context) {
 	albumID := c.Param("albumId")
 
 	// Validate and convert album ID
 	albumObjectID, err := primitive.ObjectIDFromHex(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apperror.Abort(c, apperror.InvalidID("album"))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Query the albums collection
-	var album models.Album
-	filter := bson.M{"_id": albumObjectID}
-	err = database.AlbumCollection.FindOne(ctx, filter).Decode(&album)
+	album, err := h.albums.Get(ctx, albumObjectID)
 	if err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve album", "details": err.Error()})
-		}
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
 		return
 	}
+	if album.IsPrivate {
+		if err := authorizeAlbum(c, ctx, h.invitations, album, rightView); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+	}
 
+	setETag(c, album.UpdatedAt)
 	c.JSON(http.StatusOK, gin.H{"message": "Album retrieved successfully", "data": album})
 }
 
 // GetAlbumsByUserID godoc
 // @Summary Retrieve albums for a specific user
-// @Description Fetches all albums associated with a given user ID
+// @Description Fetches a page of the albums owned by a given user ID, the private ones only for their members
 // @Tags albums
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
 // @Param userId path string true "User Unique Identifier"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, title, created_at, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
 // @Success 200 {object} map[string]interface{} "Albums retrieved successfully"
-// @Failure 400 {object} map[string]string "Invalid user ID"
-// @Failure 500 {object} map[string]string "Failed to retrieve albums"
+// @Failure 400 {object} apperror.Problem "Invalid user ID or pagination parameters"
+// @Failure 500 {object} apperror.Problem "Failed to retrieve albums"
 // @Router /albums/user/{userId} [get]
-func GetAlbumsByUserID(c *gin.Context) {
+func (h *AlbumHandler) GetAlbumsByUserID(c *gin.Context) {
 	userID := c.Param("userId")
 
 	// Validate and convert user ID if necessary (e.g., ensure it's a valid ObjectID)
 	userObjectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
+	}
+	viewerID, _, err := actingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	query, err := parsePageQuery(c, albumListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	// Query albums collection to find albums by user ID
-	filter := bson.M{"user_id": userObjectID}
-	cursor, err := database.AlbumCollection.Find(ctx, filter)
+	page, err := h.albums.List(ctx, repository.AlbumFilter{OwnerID: &userObjectID, VisibleTo: &viewerID}, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve albums", "details": err.Error()})
+		respondWithPageError(c, "Failed to retrieve albums", err)
 		return
 	}
 
-	defer func(cursor *mongo.Cursor, ctx context.Context) {
-		if err := cursor.Close(ctx); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close cursor", "details": err.Error()})
-		}
-	}(cursor, ctx)
-
-	// Collect albums into a slice
-	var albums []models.Album
-	for cursor.Next(ctx) {
-		var album models.Album
-		if err := cursor.Decode(&album); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode album", "details": err.Error()})
-			return
-		}
-		albums = append(albums, album)
+	respondWithPage(c, "Albums retrieved successfully", query, page)
+}
+
+// GetSharedAlbums godoc
+// @Summary Retrieve the albums shared with the acting user
+// @Description Fetches a page of the albums the acting user accepted an invitation to
+// @Tags albums
+// @Produce json
+// @Param X-User-ID header string true "Acting user"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, title, created_at, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{} "Albums retrieved successfully"
+// @Failure 400 {object} apperror.Problem "Invalid user ID or pagination parameters"
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 500 {object} apperror.Problem "Failed to retrieve albums"
+// @Router /albums/shared [get]
+func (h *AlbumHandler) GetSharedAlbums(c *gin.Context) {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	query, err := parsePageQuery(c, albumListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
 	}
 
-	if err := cursor.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cursor error", "details": err.Error()})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	page, err := h.albums.List(ctx, repository.AlbumFilter{MemberID: &userID}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve albums", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Albums retrieved successfully", "data": albums})
+	respondWithPage(c, "Albums retrieved successfully", query, page)
 }
 
 // UpdateAlbum godoc
 // @Summary Update an existing album
-// @Description Updates the details of a specific album by its ID
+// @Description Replaces the title, description, tags and privacy of a specific album by its ID, the owner, members and creation date are kept
 // @Tags albums
 // @Accept json
 // @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
 // @Param albumId path string true "Album Unique Identifier"
+// @Param If-Match header string false "ETag of the album version being replaced"
 // @Param album body models.Album true "Album update information"
-// @Success 200 {object} map[string]string "Album updated successfully"
-// @Failure 400 {object} map[string]string "Invalid input or album ID"
-// @Failure 404 {object} map[string]string "Album not found"
-// @Failure 500 {object} map[string]string "Failed to update album"
+// @Success 200 {object} map[string]interface{} "Album updated successfully"
+// @Header 200 {string} ETag "Version of the updated album"
+// @Failure 400 {object} apperror.Problem "Invalid input or album ID"
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem "Acting user not allowed to edit the album"
+// @Failure 404 {object} apperror.Problem "Album not found"
+// @Failure 409 {object} apperror.Problem "Album turned into a smart album or back"
+// @Failure 412 {object} apperror.Problem "Album modified since it was read"
+// @Failure 500 {object} apperror.Problem "Failed to update album"
 // @Router /albums/{albumId} [put]
-func UpdateAlbum(c *gin.Context) {
+func (h *AlbumHandler) UpdateAlbum(c *gin.Context) {
 	albumID := c.Param("albumId")
 	var updatedAlbum models.Album
 
 	// Bind JSON payload to the album struct
 	if err := c.ShouldBindJSON(&updatedAlbum); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		apperror.Abort(c, apperror.InvalidInput(err))
 		return
 	}
 
 	// Validate album ID
 	albumObjectID, err := primitive.ObjectIDFromHex(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apperror.Abort(c, apperror.InvalidID("album"))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
+	album, err := h.albums.Get(ctx, albumObjectID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+	if err := authorizeAlbum(c, ctx, h.invitations, album, rightEdit); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := checkIfMatch(c, album.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if err := h.checkCriteria(ctx, album, &updatedAlbum); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	previousUpdate := album.UpdatedAt
+	album.Title = updatedAlbum.Title
+	album.Description = updatedAlbum.Description
+	album.Tags = updatedAlbum.Tags
+	album.IsPrivate = updatedAlbum.IsPrivate
+	album.Criteria = updatedAlbum.Criteria
+	album.UpdatedAt = versioning.NextUpdatedAt(previousUpdate)
+
+	fields := repository.Fields{
+		"title":       album.Title,
+		"description": album.Description,
+		"tags":        nonNil(album.Tags),
+		"is_private":  album.IsPrivate,
+		"updated_at":  album.UpdatedAt,
+	}
+	if album.Criteria != nil {
+		fields["criteria"] = album.Criteria
+	}
+
 	// Update album in the database
-	filter := bson.M{"_id": albumObjectID}
-	update := bson.M{"$set": updatedAlbum}
-	result, err := database.AlbumCollection.UpdateOne(ctx, filter, update)
+	if err := h.albums.UpdateIfUnmodified(ctx, albumObjectID, previousUpdate, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to update album"))
+		return
+	}
+
+	setETag(c, album.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Album updated successfully", "data": album})
+}
+
+// PatchAlbum godoc
+// @Summary Partially update an album
+// @Description Applies a JSON Merge Patch (RFC 7396) to an album; Title, Description, Tags and IsPrivate can be changed,
+// @Description as well as the Criteria of a smart album
+// @Tags albums
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
+// @Param albumId path string true "Album Unique Identifier"
+// @Param If-Match header string false "ETag of the album version being patched"
+// @Param patch body object true "Merge patch, null removes a field"
+// @Success 200 {object} map[string]interface{} "Album updated successfully"
+// @Header 200 {string} ETag "Version of the updated album"
+// @Failure 400 {object} apperror.Problem "Invalid patch or album ID"
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem "Acting user not allowed to edit the album"
+// @Failure 404 {object} apperror.Problem "Album not found"
+// @Failure 409 {object} apperror.Problem "Album turned into a smart album or back"
+// @Failure 412 {object} apperror.Problem "Album modified since it was read"
+// @Failure 415 {object} apperror.Problem "Not a merge patch"
+// @Failure 500 {object} apperror.Problem "Failed to update album"
+// @Router /albums/{albumId} [patch]
+func (h *AlbumHandler) PatchAlbum(c *gin.Context) {
+	albumObjectID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("album"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	album, err := h.albums.Get(ctx, albumObjectID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+	if err := authorizeAlbum(c, ctx, h.invitations, album, rightEdit); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := checkIfMatch(c, album.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	patched, fields, err := applyMergePatch(c, album, albumPatchSpec)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update album", "details": err.Error()})
+		apperror.Abort(c, err)
+		return
+	}
+	if err := h.checkCriteria(ctx, album, &patched); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
+	if _, ok := fields["criteria"]; ok {
+		fields["criteria"] = patched.Criteria
+	}
+	if _, ok := fields["is_private"]; ok {
+		fields["is_private"] = patched.IsPrivate
+	}
+	patched.UpdatedAt = versioning.NextUpdatedAt(album.UpdatedAt)
+	fields["updated_at"] = patched.UpdatedAt
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	if err := h.albums.UpdateIfUnmodified(ctx, albumObjectID, album.UpdatedAt, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to update album"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Album updated successfully"})
+	setETag(c, patched.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Album updated successfully", "data": patched})
 }
 
 // DeleteAlbum godoc
 // @Summary Delete an album
-// @Description Permanently removes an album from the database by its ID
+// @Description Permanently removes an album from the database by its ID, together with its invitations
 // @Tags albums
 // @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner"
 // @Param albumId path string true "Album Unique Identifier"
 // @Success 200 {object} map[string]string "Album deleted successfully"
-// @Failure 400 {object} map[string]string "Invalid album ID"
-// @Failure 404 {object} map[string]string "Album not found"
-// @Failure 500 {object} map[string]string "Failed to delete album"
+// @Failure 400 {object} apperror.Problem "Invalid album ID"
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem "Acting user not the album owner"
+// @Failure 404 {object} apperror.Problem "Album not found"
+// @Failure 500 {object} apperror.Problem "Failed to delete album"
 // @Router /albums/{albumId} [delete]
-func DeleteAlbum(c *gin.Context) {
+func (h *AlbumHandler) DeleteAlbum(c *gin.Context) {
 	albumID := c.Param("albumId")
 
 	// Validate album ID
 	albumObjectID, err := primitive.ObjectIDFromHex(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apperror.Abort(c, apperror.InvalidID("album"))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Delete album
-	filter := bson.M{"_id": albumObjectID}
-	result, err := database.AlbumCollection.DeleteOne(ctx, filter)
+	album, err := h.albums.Get(ctx, albumObjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete album", "details": err.Error()})
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+	if err := authorizeAlbum(c, ctx, h.invitations, album, rightDelete); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	// Delete album
+	if err := h.albums.Delete(ctx, albumObjectID); err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to delete album"))
 		return
 	}
 
+	// Members lose their access along with the album
+	if err := h.invitations.DeleteByAlbum(ctx, albumObjectID); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove invitations of deleted album", "album_id", albumObjectID.Hex(), "error", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Album deleted successfully"})
 }
 
-// SearchAlbums godoc
-// @Summary Search albums
-// @Description Searches albums by title using case-insensitive partial matching
-// @Tags albums
-// @Produce json
-// @Param q query string true "Search query"
-// @Success 200 {object} map[string]interface{} "Albums retrieved successfully"
-// @Failure 500 {object} map[string]string "Failed to search albums"
-// @Router /albums/search [get]
-func SearchAlbums(c *gin.Context) {
-	query := c.Query("q")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Search query using case-insensitive regex
-	filter := bson.M{"title": bson.M{"$regex": query, "$options": "i"}}
-	cursor, err := database.AlbumCollection.Find(ctx, filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search albums", "details": err.Error()})
-		return
+// checkCriteria validates the criteria of the updated version of album, which must stay a smart album if it is one
+// and a regular album otherwise. Smart albums stay private.
+func (h *AlbumHandler) checkCriteria(ctx context.Context, album models.Album, updated *models.Album) error {
+	if (album.Criteria == nil) != (updated.Criteria == nil) {
+		return errAlbumKind
 	}
-
-	defer func(cursor *mongo.Cursor, ctx context.Context) {
-		err := cursor.Close(ctx)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close cursor", "details": err.Error()})
-		}
-	}(cursor, ctx)
-
-	// Collect albums into a slice
-	var albums []models.Album
-	for cursor.Next(ctx) {
-		var album models.Album
-		if err := cursor.Decode(&album); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode album", "details": err.Error()})
-			return
-		}
-		albums = append(albums, album)
+	if updated.Criteria == nil {
+		return nil
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Albums retrieved successfully", "data": albums})
+	updated.IsPrivate = true
+	return normalizeCriteria(ctx, h.people, album.OwnerID, updated.Criteria)
 }
@@ -0,0 +1,150 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+)
+
+func TestCreateAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, otherID := api.createUser("alice"), api.createUser("bob")
+
+	album := api.createAlbum(ownerID, false)
+	if album.ID.IsZero() || album.OwnerID.Hex() != ownerID || album.CreatedAt.IsZero() || !album.UpdatedAt.Equal(album.CreatedAt) {
+		t.Errorf("album = %+v, want an ID, the owner and the creation time", album)
+	}
+
+	// the owner is the acting user, members only join through invitations
+	body := `{"Title":"Holidays","OwnerID":"` + ownerID + `","TargetUserIDs":["` + otherID + `"]}`
+	if album := data[models.Album](api.request(http.MethodPost, "/api/albums/", ownerID, body).expect(http.StatusCreated)); len(album.TargetUserIDs) != 0 {
+		t.Errorf("album created with members %v, want none", album.TargetUserIDs)
+	}
+	api.request(http.MethodPost, "/api/albums/", otherID, body).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, "/api/albums/", "", `{"Title":"Holidays"}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPost, "/api/albums/", "nope", `{"Title":"Holidays"}`).expectProblem(http.StatusBadRequest, "invalid_user_id")
+	api.request(http.MethodPost, "/api/albums/", ownerID, `{"Description":"untitled"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+}
+
+func TestGetAlbumByID(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, viewerID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album, private := api.createAlbum(ownerID, false), api.createAlbum(ownerID, true)
+	api.share(private, viewerID, "bob", models.RoleViewer)
+
+	r := api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), "", "").expect(http.StatusOK)
+	if data[models.Album](r).ID != album.ID || r.Header().Get("ETag") == "" {
+		t.Errorf("album not returned with its ETag: %s", r.Body.String())
+	}
+	api.request(http.MethodGet, "/api/albums/"+private.ID.Hex(), ownerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/albums/"+private.ID.Hex(), viewerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/albums/"+private.ID.Hex(), strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, "/api/albums/"+private.ID.Hex(), "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodGet, "/api/albums/"+private.ID.Hex(), "nope", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+
+	api.request(http.MethodGet, "/api/albums/nope", "", "").expectProblem(http.StatusBadRequest, "invalid_album_id")
+	api.request(http.MethodGet, "/api/albums/"+primitive.NewObjectID().Hex(), "", "").expectProblem(http.StatusNotFound, "album_not_found")
+}
+
+func TestListAlbums(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, memberID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	first, second := api.createAlbum(ownerID, false), api.createAlbum(ownerID, true)
+	api.createAlbum(memberID, false)
+	api.share(second, memberID, "bob", models.RoleViewer)
+
+	// private albums are only listed for their members
+	for userID, want := range map[string]int{"": 2, strangerID: 2, ownerID: 3, memberID: 3} {
+		if albums := data[[]models.Album](api.request(http.MethodGet, "/api/albums/", userID, "").expect(http.StatusOK)); len(albums) != want {
+			t.Errorf("%d albums listed for %q, want %d", len(albums), userID, want)
+		}
+	}
+	api.request(http.MethodGet, "/api/albums/", "nope", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+
+	owned := data[[]models.Album](api.request(http.MethodGet, "/api/albums/user/"+ownerID+"?sort=-created_at", memberID, "").expect(http.StatusOK))
+	if len(owned) != 2 || owned[0].ID != second.ID || owned[1].ID != first.ID {
+		t.Errorf("albums of the owner = %+v, want the second then the first", owned)
+	}
+	for _, userID := range []string{"", strangerID} {
+		if owned := data[[]models.Album](api.request(http.MethodGet, "/api/albums/user/"+ownerID, userID, "").expect(http.StatusOK)); len(owned) != 1 || owned[0].ID != first.ID {
+			t.Errorf("albums of the owner listed for %q = %+v, want only the public one", userID, owned)
+		}
+	}
+	api.request(http.MethodGet, "/api/albums/user/nope", "", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+	api.request(http.MethodGet, "/api/albums/user/"+ownerID, "nope", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+	api.request(http.MethodGet, "/api/albums/?sort=nope", "", "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+
+	shared := data[[]models.Album](api.request(http.MethodGet, "/api/albums/shared", memberID, "").expect(http.StatusOK))
+	if len(shared) != 1 || shared[0].ID != second.ID {
+		t.Errorf("shared albums = %+v, want the second album", shared)
+	}
+	api.request(http.MethodGet, "/api/albums/shared", "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestUpdateAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, coOwnerID, contributorID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, coOwnerID, "bob", models.RoleCoOwner)
+	api.share(album, contributorID, "carol", models.RoleContributor)
+	etag := api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), ownerID, "").expect(http.StatusOK).Header().Get("ETag")
+
+	body := `{"Title":"Summer","Tags":["sea"],"IsPrivate":false,"OwnerID":"` + contributorID + `"}`
+	updated := data[models.Album](api.request(http.MethodPut, "/api/albums/"+album.ID.Hex(), coOwnerID, body, "If-Match", etag).expect(http.StatusOK))
+	if updated.Title != "Summer" || updated.IsPrivate || len(updated.Tags) != 1 || updated.OwnerID != album.OwnerID || len(updated.TargetUserIDs) != 2 {
+		t.Errorf("updated album = %+v, want the new title, tags and privacy with the owner and members kept", updated)
+	}
+
+	api.request(http.MethodPut, "/api/albums/"+album.ID.Hex(), ownerID, body, "If-Match", etag).expectProblem(http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+	api.request(http.MethodPut, "/api/albums/"+album.ID.Hex(), contributorID, body).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPut, "/api/albums/"+album.ID.Hex(), "", body).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+
+	api.request(http.MethodPut, "/api/albums/"+album.ID.Hex(), ownerID, `{"Description":"untitled"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPut, "/api/albums/"+primitive.NewObjectID().Hex(), ownerID, body).expectProblem(http.StatusNotFound, "album_not_found")
+}
+
+func TestPatchAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, viewerID := api.createUser("alice"), api.createUser("bob")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, viewerID, "bob", models.RoleViewer)
+
+	patched := data[models.Album](api.request(http.MethodPatch, "/api/albums/"+album.ID.Hex(), ownerID, `{"Description":"By the sea","IsPrivate":false}`).
+		expect(http.StatusOK))
+	if patched.Title != album.Title || patched.Description != "By the sea" || patched.IsPrivate {
+		t.Errorf("patched album = %+v", patched)
+	}
+	stored := data[models.Album](api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), "", "").expect(http.StatusOK))
+	if stored.Description != "By the sea" || stored.IsPrivate {
+		t.Errorf("stored album = %+v, want the patch applied", stored)
+	}
+
+	api.request(http.MethodPatch, "/api/albums/"+album.ID.Hex(), ownerID, `{"OwnerID":"`+viewerID+`"}`).
+		expectProblem(http.StatusBadRequest, apperror.CodeImmutableField)
+	api.request(http.MethodPatch, "/api/albums/"+album.ID.Hex(), viewerID, `{"Title":"Mine"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPatch, "/api/albums/"+album.ID.Hex(), "", `{"Title":"Mine"}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPatch, "/api/albums/"+album.ID.Hex(), ownerID, `{"Title":null}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPatch, "/api/albums/"+primitive.NewObjectID().Hex(), ownerID, `{"Title":"Mine"}`).expectProblem(http.StatusNotFound, "album_not_found")
+}
+
+func TestDeleteAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, coOwnerID := api.createUser("alice"), api.createUser("bob")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, coOwnerID, "bob", models.RoleCoOwner)
+
+	api.request(http.MethodDelete, "/api/albums/"+album.ID.Hex(), "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodDelete, "/api/albums/"+album.ID.Hex(), coOwnerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodDelete, "/api/albums/"+album.ID.Hex(), ownerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "album_not_found")
+	if shared := data[[]models.Album](api.request(http.MethodGet, "/api/albums/shared", coOwnerID, "").expect(http.StatusOK)); len(shared) != 0 {
+		t.Errorf("deleted album still shared: %+v", shared)
+	}
+	if invitations := data[[]models.AlbumInvitation](api.request(http.MethodGet, "/api/invitations/", coOwnerID, "").expect(http.StatusOK)); len(invitations) != 0 {
+		t.Errorf("invitations to the deleted album kept: %+v", invitations)
+	}
+	api.request(http.MethodDelete, "/api/albums/"+album.ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "album_not_found")
+}
@@ -0,0 +1,677 @@
+package controllers
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+// PublisherTokenHeader carries the token the release pipeline authenticates with on the firmware endpoints
+const PublisherTokenHeader = "X-Publisher-Token"
+
+// MaxFirmwareSize is the largest firmware image accepted, it has to fit in a single blob
+const MaxFirmwareSize = 15 << 20
+
+var (
+	errPublishingDisabled    = apperror.Forbidden("Firmware publishing is disabled, no publisher token is configured")
+	errInvalidPublisherToken = apperror.New(http.StatusUnauthorized, "invalid_publisher_token",
+		PublisherTokenHeader+" header is missing or invalid")
+	errFirmwareTooLarge = apperror.New(http.StatusRequestEntityTooLarge, "firmware_too_large",
+		"The firmware image must not exceed "+strconv.Itoa(MaxFirmwareSize>>20)+" MiB")
+	errChecksumMismatch = apperror.BadRequest("checksum_mismatch",
+		"The SHA-256 of the uploaded image doesn't match the given checksum")
+)
+
+// RolloutRequest is the body changing the share of the frames offered a release
+type RolloutRequest struct {
+	Percent *int `binding:"required,min=0,max=100"`
+}
+
+// FirmwareReportRequest is the body a frame reports the outcome of an update with
+type FirmwareReportRequest struct {
+	ReleaseID   primitive.ObjectID `binding:"required"`
+	Outcome     string             `binding:"required,oneof=succeeded failed"`
+	FromVersion string             `binding:"max=64"`
+	Error       string             `binding:"max=1000"` // Only kept for failed updates
+}
+
+// FirmwareUpdateCheck tells a frame whether a firmware update is available, and which
+type FirmwareUpdateCheck struct {
+	UpdateAvailable bool
+	ReleaseID       primitive.ObjectID
+	Version         string
+	Size            int64
+	Checksum        string // Hex SHA-256 of the image
+	Signature       string // Verified by the frame before installing
+	Notes           string
+}
+
+// FirmwareHandler serves the firmware releases to the release pipeline and the frames
+type FirmwareHandler struct {
+	releases       repository.FirmwareRepository
+	reports        repository.FirmwareReportRepository
+	frames         repository.FrameRepository
+	blobs          repository.BlobRepository
+	publisherToken string
+}
+
+// NewFirmwareHandler returns a FirmwareHandler using the given repositories; releases are published with
+// publisherToken, publishing is disabled when it is empty
+func NewFirmwareHandler(
+	releases repository.FirmwareRepository,
+	reports repository.FirmwareReportRepository,
+	frames repository.FrameRepository,
+	blobs repository.BlobRepository,
+	publisherToken string,
+) *FirmwareHandler {
+	return &FirmwareHandler{releases: releases, reports: reports, frames: frames, blobs: blobs, publisherToken: publisherToken}
+}
+
+// CreateRelease godoc
+// @Summary Publish a firmware release
+// @Description Uploads a firmware image with its version and signature. The release starts offered to the share of the frames of its channel given by rollout_percent, none by default.
+// @Tags firmware
+// @Accept multipart/form-data
+// @Produce json
+// @Param X-Publisher-Token header string true "Publisher token"
+// @Param file formData file true "Firmware image"
+// @Param version formData string true "Version, MAJOR.MINOR.PATCH"
+// @Param channel formData string false "Channel (stable, beta), stable by default"
+// @Param signature formData string true "Signature of the image, verified by the frames"
+// @Param checksum formData string false "Expected hex SHA-256 of the image, checked against the upload"
+// @Param rollout_percent formData int false "Share of the frames offered the release (0-100), 0 by default"
+// @Param notes formData string false "Release notes"
+// @Success 201 {object} models.FirmwareRelease
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 413 {object} apperror.Problem
+// @Failure 415 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /firmware/releases [post]
+func (h *FirmwareHandler) CreateRelease(c *gin.Context) {
+	if err := h.authorizePublisher(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if c.ContentType() != "multipart/form-data" {
+		apperror.Abort(c, errNotMultipart)
+		return
+	}
+
+	// Leave room for the other fields of the form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxFirmwareSize+1<<20)
+
+	release, err := releaseFromForm(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	data, err := firmwareImage(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	release.Checksum = hex.EncodeToString(sum[:])
+	if expected := c.PostForm("checksum"); expected != "" && !strings.EqualFold(expected, release.Checksum) {
+		apperror.Abort(c, errChecksumMismatch)
+		return
+	}
+	release.Size = int64(len(data))
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	release.BlobID, err = h.blobs.Save(ctx, data)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to store firmware image", err))
+		return
+	}
+
+	if err := h.releases.Create(ctx, &release); err != nil {
+		if cleanupErr := h.blobs.Delete(ctx, release.BlobID); cleanupErr != nil {
+			slog.ErrorContext(ctx, "Failed to remove orphaned firmware image", "blob_id", release.BlobID.Hex(), "error", cleanupErr)
+		}
+		if errors.Is(err, repository.ErrDuplicate) {
+			apperror.Abort(c, apperror.Conflict("firmware_version_exists", "Version "+release.Version+" was already released on the "+release.Channel+" channel"))
+			return
+		}
+		apperror.Abort(c, apperror.Internal("Failed to create firmware release", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Firmware release created successfully", "data": release})
+}
+
+// GetReleases godoc
+// @Summary List the firmware releases
+// @Description Fetches a page of the firmware releases, the most recent first
+// @Tags firmware
+// @Produce json
+// @Param X-Publisher-Token header string true "Publisher token"
+// @Param channel query string false "Only the releases of the channel (stable, beta)"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /firmware/releases [get]
+func (h *FirmwareHandler) GetReleases(c *gin.Context) {
+	if err := h.authorizePublisher(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	channel := c.Query("channel")
+	if channel != "" && !isFirmwareChannel(channel) {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "channel must be stable or beta"))
+		return
+	}
+
+	query, err := parsePageQuery(c, firmwareListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	page, err := h.releases.List(ctx, repository.FirmwareFilter{Channel: channel}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve firmware releases", err)
+		return
+	}
+
+	respondWithPage(c, "Firmware releases retrieved successfully", query, page)
+}
+
+// GetRelease godoc
+// @Summary Get a firmware release
+// @Description Fetches a firmware release with the number of successful and failed updates reported by the frames
+// @Tags firmware
+// @Produce json
+// @Param X-Publisher-Token header string true "Publisher token"
+// @Param releaseId path string true "Release ID"
+// @Success 200 {object} models.FirmwareRelease
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /firmware/releases/{releaseId} [get]
+func (h *FirmwareHandler) GetRelease(c *gin.Context) {
+	if err := h.authorizePublisher(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	release, err := h.release(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Firmware release retrieved successfully", "data": release})
+}
+
+// UpdateRollout godoc
+// @Summary Change the rollout of a firmware release
+// @Description Sets the share of the frames of the channel offered the release. Raising it keeps offering the release to the frames it was already offered to; 0 halts the rollout.
+// @Tags firmware
+// @Accept json
+// @Produce json
+// @Param X-Publisher-Token header string true "Publisher token"
+// @Param releaseId path string true "Release ID"
+// @Param rollout body RolloutRequest true "Rollout"
+// @Success 200 {object} models.FirmwareRelease
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /firmware/releases/{releaseId}/rollout [put]
+func (h *FirmwareHandler) UpdateRollout(c *gin.Context) {
+	if err := h.authorizePublisher(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var request RolloutRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	release, err := h.release(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	release.RolloutPercent = *request.Percent
+	release.UpdatedAt = versioning.NextUpdatedAt(release.UpdatedAt)
+	fields := repository.Fields{"rollout_percent": release.RolloutPercent, "updated_at": release.UpdatedAt}
+	if err := h.releases.Update(ctx, release.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "release", "Failed to update firmware rollout"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Firmware rollout updated successfully", "data": release})
+}
+
+// GetReleaseReports godoc
+// @Summary List the update reports of a firmware release
+// @Description Fetches a page of the outcomes of the updates to the release reported by the frames, the most recent first
+// @Tags firmware
+// @Produce json
+// @Param X-Publisher-Token header string true "Publisher token"
+// @Param releaseId path string true "Release ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, reported_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /firmware/releases/{releaseId}/reports [get]
+func (h *FirmwareHandler) GetReleaseReports(c *gin.Context) {
+	if err := h.authorizePublisher(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	query, err := parsePageQuery(c, firmwareReportListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	release, err := h.release(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	page, err := h.reports.ListByRelease(ctx, release.ID, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve firmware reports", err)
+		return
+	}
+
+	respondWithPage(c, "Firmware reports retrieved successfully", query, page)
+}
+
+// CheckForUpdate godoc
+// @Summary Check for a firmware update, as the device
+// @Description Answers the newest release of the frame's channel above its version whose rollout includes the frame, skipping the releases the frame failed to install. Frames on the beta channel are offered the stable releases too.
+// @Tags devices
+// @Produce json
+// @Param X-Frame-Token header string true "Device token of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param version query string false "Version the frame runs, the one of its last heartbeat by default"
+// @Success 200 {object} FirmwareUpdateCheck
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/firmware/update [get]
+func (h *FirmwareHandler) CheckForUpdate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := authenticateFrame(c, ctx, h.frames)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	// A frame that never reported a version it can be compared with is offered the newest release
+	current, _ := parseFirmwareVersion(frame.Status.FirmwareVersion)
+	if reported, ok := c.GetQuery("version"); ok {
+		if current, ok = parseFirmwareVersion(reported); !ok {
+			apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "version must be MAJOR.MINOR.PATCH"))
+			return
+		}
+	}
+
+	releases, err := h.releases.ListByChannels(ctx, firmwareChannels(frame))
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve firmware releases", err))
+		return
+	}
+	failed, err := h.reports.FailedReleaseIDs(ctx, frame.ID)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve firmware reports", err))
+		return
+	}
+
+	var check FirmwareUpdateCheck
+	var newest firmwareVersion
+	for _, release := range releases {
+		version, ok := parseFirmwareVersion(release.Version)
+		if !ok || version.compare(current) <= 0 || (check.UpdateAvailable && version.compare(newest) <= 0) {
+			continue
+		}
+		if !inRollout(release, frame.ID) || slices.Contains(failed, release.ID) {
+			continue
+		}
+		newest = version
+		check = FirmwareUpdateCheck{
+			UpdateAvailable: true,
+			ReleaseID:       release.ID,
+			Version:         release.Version,
+			Size:            release.Size,
+			Checksum:        release.Checksum,
+			Signature:       release.Signature,
+			Notes:           release.Notes,
+		}
+	}
+
+	message := "Firmware is up to date"
+	if check.UpdateAvailable {
+		message = "Firmware update available"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "data": check})
+}
+
+// DownloadRelease godoc
+// @Summary Download a firmware image, as the device
+// @Description Answers the image of a release of the frame's channels. Its SHA-256 is given as the ETag.
+// @Tags devices
+// @Produce octet-stream
+// @Param X-Frame-Token header string true "Device token of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param releaseId path string true "Release ID"
+// @Success 200 {file} binary
+// @Header 200 {string} ETag "Hex SHA-256 of the image"
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/firmware/releases/{releaseId} [get]
+func (h *FirmwareHandler) DownloadRelease(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := authenticateFrame(c, ctx, h.frames)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	release, err := h.release(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	// Releases of other channels are not disclosed
+	if !slices.Contains(firmwareChannels(frame), release.Channel) {
+		apperror.Abort(c, apperror.NotFound("release"))
+		return
+	}
+
+	data, err := h.blobs.Get(ctx, release.BlobID)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve firmware image", err))
+		return
+	}
+
+	c.Header("ETag", `"`+release.Checksum+`"`)
+	c.Header("Content-Disposition", `attachment; filename="firmware-`+release.Version+`.bin"`)
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
+
+// ReportUpdate godoc
+// @Summary Report the outcome of a firmware update, as the device
+// @Description Records whether the frame installed a release. A release the frame failed to install is no longer offered to it.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Frame-Token header string true "Device token of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param report body FirmwareReportRequest true "Outcome of the update"
+// @Success 201 {object} models.FirmwareUpdateReport
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/firmware/reports [post]
+func (h *FirmwareHandler) ReportUpdate(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := authenticateFrame(c, ctx, h.frames)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var request FirmwareReportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	release, err := h.releases.Get(ctx, request.ReleaseID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "release", "Failed to retrieve firmware release"))
+		return
+	}
+
+	report := models.FirmwareUpdateReport{
+		FrameID:     frame.ID,
+		ReleaseID:   release.ID,
+		FromVersion: request.FromVersion,
+		Outcome:     request.Outcome,
+		ReportedAt:  time.Now(),
+	}
+	if report.Outcome == models.FirmwareUpdateFailed {
+		report.Error = request.Error
+	}
+	if err := h.reports.Create(ctx, &report); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to record firmware report", err))
+		return
+	}
+	if err := h.releases.RecordOutcome(ctx, release.ID, report.Outcome); err != nil {
+		apperror.Abort(c, fromRepository(err, "release", "Failed to record firmware report"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Firmware report recorded successfully", "data": report})
+}
+
+// authorizePublisher checks the publisher token of the request
+func (h *FirmwareHandler) authorizePublisher(c *gin.Context) error {
+	if h.publisherToken == "" {
+		return errPublishingDisabled
+	}
+	if subtle.ConstantTimeCompare([]byte(c.GetHeader(PublisherTokenHeader)), []byte(h.publisherToken)) != 1 {
+		return errInvalidPublisherToken
+	}
+	return nil
+}
+
+// release returns the release named by the releaseId parameter
+func (h *FirmwareHandler) release(c *gin.Context, ctx context.Context) (models.FirmwareRelease, error) {
+	releaseID, err := primitive.ObjectIDFromHex(c.Param("releaseId"))
+	if err != nil {
+		return models.FirmwareRelease{}, apperror.InvalidID("release")
+	}
+
+	release, err := h.releases.Get(ctx, releaseID)
+	if err != nil {
+		return release, fromRepository(err, "release", "Failed to retrieve firmware release")
+	}
+	return release, nil
+}
+
+// releaseFromForm reads the description of a new release from the upload form
+func releaseFromForm(c *gin.Context) (models.FirmwareRelease, error) {
+	if err := c.Request.ParseMultipartForm(MaxFirmwareSize); err != nil {
+		return models.FirmwareRelease{}, firmwareFormError(err)
+	}
+
+	version, ok := parseFirmwareVersion(c.PostForm("version"))
+	if !ok {
+		return models.FirmwareRelease{}, apperror.BadRequest(apperror.CodeInvalidInput, "version must be MAJOR.MINOR.PATCH")
+	}
+
+	now := time.Now()
+	release := models.FirmwareRelease{
+		ID:        primitive.NewObjectID(),
+		Version:   version.String(),
+		Channel:   c.DefaultPostForm("channel", models.FirmwareChannelStable),
+		Signature: c.PostForm("signature"),
+		Notes:     c.PostForm("notes"),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !isFirmwareChannel(release.Channel) {
+		return release, apperror.BadRequest(apperror.CodeInvalidInput, "channel must be stable or beta")
+	}
+	if release.Signature == "" {
+		return release, apperror.BadRequest(apperror.CodeInvalidInput, "signature is required")
+	}
+	if percent := c.PostForm("rollout_percent"); percent != "" {
+		value, err := strconv.Atoi(percent)
+		if err != nil || value < 0 || value > 100 {
+			return release, apperror.BadRequest(apperror.CodeInvalidInput, "rollout_percent must be a number between 0 and 100")
+		}
+		release.RolloutPercent = value
+	}
+	return release, nil
+}
+
+// firmwareImage reads the uploaded firmware image
+func firmwareImage(c *gin.Context) ([]byte, error) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		return nil, firmwareFormError(err)
+	}
+	defer func(file multipart.File) {
+		if err := file.Close(); err != nil {
+			slog.WarnContext(c.Request.Context(), "Failed to close uploaded file", "error", err)
+		}
+	}(file)
+
+	if header.Size > MaxFirmwareSize {
+		return nil, errFirmwareTooLarge
+	}
+	if header.Size == 0 {
+		return nil, apperror.BadRequest(apperror.CodeInvalidFile, "The firmware image is empty")
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, apperror.Internal("Failed to read file", err)
+	}
+	return data, nil
+}
+
+// firmwareFormError maps a failure to read the upload form to an application error
+func firmwareFormError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errFirmwareTooLarge
+	}
+	return apperror.BadRequest(apperror.CodeInvalidFile, "Failed to retrieve file: "+err.Error())
+}
+
+// isFirmwareChannel tells whether channel is a known release channel
+func isFirmwareChannel(channel string) bool {
+	return channel == models.FirmwareChannelStable || channel == models.FirmwareChannelBeta
+}
+
+// firmwareChannels returns the channels whose releases the frame is offered
+func firmwareChannels(frame models.SmartFrame) []string {
+	if frame.FirmwareChannel == models.FirmwareChannelBeta {
+		return []string{models.FirmwareChannelBeta, models.FirmwareChannelStable}
+	}
+	return []string{models.FirmwareChannelStable}
+}
+
+// inRollout tells whether the rollout of the release includes the frame. Each frame falls into a bucket
+// from 0 to 99 of the release, derived from both IDs, so that the frames offered the release stay offered
+// when the percentage is raised and a different subset goes first with every release.
+func inRollout(release models.FirmwareRelease, frameID primitive.ObjectID) bool {
+	hash := fnv.New32a()
+	hash.Write(release.ID[:])
+	hash.Write(frameID[:])
+	return int(hash.Sum32()%100) < release.RolloutPercent
+}
+
+// firmwareVersion is a MAJOR.MINOR.PATCH version
+type firmwareVersion [3]int
+
+// parseFirmwareVersion parses a MAJOR.MINOR.PATCH version, optionally prefixed with v
+func parseFirmwareVersion(value string) (firmwareVersion, bool) {
+	var version firmwareVersion
+	parts := strings.Split(strings.TrimPrefix(value, "v"), ".")
+	if len(parts) != len(version) {
+		return version, false
+	}
+	for i, part := range parts {
+		if part == "" || strings.Trim(part, "0123456789") != "" {
+			return firmwareVersion{}, false
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return firmwareVersion{}, false
+		}
+		version[i] = number
+	}
+	return version, true
+}
+
+// String formats the version the way it is stored, without leading zeros
+func (v firmwareVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// compare returns -1, 0 or 1 when v is older than, the same as or newer than other
+func (v firmwareVersion) compare(other firmwareVersion) int {
+	for i := range v {
+		if c := cmp.Compare(v[i], other[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,202 @@
+package controllers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+)
+
+// publishRelease uploads a firmware image with the given form fields as the release pipeline
+func (a *testAPI) publishRelease(token string, image []byte, fields map[string]string) response {
+	a.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	if image != nil {
+		file, err := form.CreateFormFile("file", "firmware.bin")
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		if _, err := file.Write(image); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		a.t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/firmware/releases", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set(controllers.PublisherTokenHeader, token)
+	return a.serve(req)
+}
+
+// createRelease publishes a release of version on channel, offered to every frame of the channel
+func (a *testAPI) createRelease(version, channel string) models.FirmwareRelease {
+	a.t.Helper()
+	fields := map[string]string{"version": version, "channel": channel, "signature": "signed", "rollout_percent": "100"}
+	return data[models.FirmwareRelease](a.publishRelease(publisherToken, []byte("firmware "+version), fields).expect(http.StatusCreated))
+}
+
+func TestCreateRelease(t *testing.T) {
+	api := newTestAPI(t)
+	image := []byte("firmware image")
+	sum := sha256.Sum256(image)
+
+	release := data[models.FirmwareRelease](api.publishRelease(publisherToken, image, map[string]string{
+		"version": "v1.02.3", "signature": "signed", "notes": "Faster", "checksum": hex.EncodeToString(sum[:]),
+	}).expect(http.StatusCreated))
+	if release.Version != "1.2.3" || release.Channel != models.FirmwareChannelStable || release.Size != int64(len(image)) || release.RolloutPercent != 0 {
+		t.Errorf("release = %+v, want a normalized stable release not rolled out", release)
+	}
+
+	fields := map[string]string{"version": "1.2.3", "signature": "signed"}
+	api.publishRelease(publisherToken, image, fields).expectProblem(http.StatusConflict, "firmware_version_exists")
+	api.publishRelease("wrong", image, fields).expectProblem(http.StatusUnauthorized, "invalid_publisher_token")
+	api.publishRelease(publisherToken, nil, map[string]string{"version": "1.2.4", "signature": "signed"}).
+		expectProblem(http.StatusBadRequest, apperror.CodeInvalidFile)
+	api.publishRelease(publisherToken, image, map[string]string{"version": "1.2.4", "signature": "signed", "checksum": "00"}).
+		expectProblem(http.StatusBadRequest, "checksum_mismatch")
+	invalid := []map[string]string{
+		{"version": "1.2", "signature": "signed"},
+		{"version": "1.2.4"},
+		{"version": "1.2.4", "signature": "signed", "channel": "nightly"},
+		{"version": "1.2.4", "signature": "signed", "rollout_percent": "101"},
+	}
+	for _, fields := range invalid {
+		api.publishRelease(publisherToken, image, fields).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	}
+	api.request(http.MethodPost, "/api/firmware/releases", "", `{}`, controllers.PublisherTokenHeader, publisherToken).
+		expectProblem(http.StatusUnsupportedMediaType, apperror.CodeUnsupportedMediaType)
+}
+
+func TestManageReleases(t *testing.T) {
+	api := newTestAPI(t)
+	stable, beta := api.createRelease("1.0.0", models.FirmwareChannelStable), api.createRelease("1.1.0", models.FirmwareChannelBeta)
+	publisher := []string{controllers.PublisherTokenHeader, publisherToken}
+
+	if releases := data[[]models.FirmwareRelease](api.request(http.MethodGet, "/api/firmware/releases", "", "", publisher...).expect(http.StatusOK)); len(releases) != 2 {
+		t.Errorf("%d releases, want 2", len(releases))
+	}
+	betas := data[[]models.FirmwareRelease](api.request(http.MethodGet, "/api/firmware/releases?channel=beta", "", "", publisher...).expect(http.StatusOK))
+	if len(betas) != 1 || betas[0].ID != beta.ID {
+		t.Errorf("beta releases = %+v", betas)
+	}
+	api.request(http.MethodGet, "/api/firmware/releases?channel=nightly", "", "", publisher...).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodGet, "/api/firmware/releases", "", "").expectProblem(http.StatusUnauthorized, "invalid_publisher_token")
+
+	path := "/api/firmware/releases/" + stable.ID.Hex()
+	if release := data[models.FirmwareRelease](api.request(http.MethodGet, path, "", "", publisher...).expect(http.StatusOK)); release.ID != stable.ID {
+		t.Errorf("release = %+v, want %s", release, stable.ID.Hex())
+	}
+	api.request(http.MethodGet, "/api/firmware/releases/"+primitive.NewObjectID().Hex(), "", "", publisher...).expectProblem(http.StatusNotFound, "release_not_found")
+	api.request(http.MethodGet, "/api/firmware/releases/nope", "", "", publisher...).expectProblem(http.StatusBadRequest, "invalid_release_id")
+
+	if release := data[models.FirmwareRelease](api.request(http.MethodPut, path+"/rollout", "", `{"Percent":0}`, publisher...).expect(http.StatusOK)); release.RolloutPercent != 0 {
+		t.Errorf("rollout = %d%%, want 0%%", release.RolloutPercent)
+	}
+	api.request(http.MethodPut, path+"/rollout", "", `{}`, publisher...).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPut, path+"/rollout", "", `{"Percent":101}`, publisher...).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPut, path+"/rollout", "", `{"Percent":50}`).expectProblem(http.StatusUnauthorized, "invalid_publisher_token")
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	frame := api.createFrame(ownerID)
+	token := api.issueDeviceToken(frame)
+	device := []string{controllers.FrameTokenHeader, token}
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/firmware/update"
+
+	if check := data[controllers.FirmwareUpdateCheck](api.request(http.MethodGet, path, "", "", device...).expect(http.StatusOK)); check.UpdateAvailable {
+		t.Errorf("check = %+v, want no update without releases", check)
+	}
+
+	older, newer := api.createRelease("1.0.0", models.FirmwareChannelStable), api.createRelease("1.1.0", models.FirmwareChannelStable)
+	beta := api.createRelease("2.0.0", models.FirmwareChannelBeta)
+	check := data[controllers.FirmwareUpdateCheck](api.request(http.MethodGet, path, "", "", device...).expect(http.StatusOK))
+	if !check.UpdateAvailable || check.ReleaseID != newer.ID || check.Checksum != newer.Checksum {
+		t.Errorf("check = %+v, want the newest stable release", check)
+	}
+	if check := data[controllers.FirmwareUpdateCheck](api.request(http.MethodGet, path+"?version=1.1.0", "", "", device...).expect(http.StatusOK)); check.UpdateAvailable {
+		t.Errorf("check = %+v, want the frame up to date", check)
+	}
+	api.request(http.MethodGet, path+"?version=latest", "", "", device...).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+
+	// frames on the beta channel also get the beta releases
+	api.request(http.MethodPut, "/api/smart-frames/"+frame.ID.Hex()+"/firmware-channel", ownerID, `{"Channel":"beta"}`).expect(http.StatusOK)
+	if check := data[controllers.FirmwareUpdateCheck](api.request(http.MethodGet, path, "", "", device...).expect(http.StatusOK)); check.ReleaseID != beta.ID {
+		t.Errorf("check = %+v, want the beta release", check)
+	}
+
+	// releases not rolled out or which failed on the frame are skipped
+	publisher := []string{controllers.PublisherTokenHeader, publisherToken}
+	api.request(http.MethodPut, "/api/firmware/releases/"+beta.ID.Hex()+"/rollout", "", `{"Percent":0}`, publisher...).expect(http.StatusOK)
+	api.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/firmware/reports", "", `{"ReleaseID":"`+newer.ID.Hex()+`","Outcome":"failed"}`, device...).
+		expect(http.StatusCreated)
+	if check := data[controllers.FirmwareUpdateCheck](api.request(http.MethodGet, path, "", "", device...).expect(http.StatusOK)); check.ReleaseID != older.ID {
+		t.Errorf("check = %+v, want the older release", check)
+	}
+
+	api.request(http.MethodGet, path, ownerID, "").expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+}
+
+func TestDownloadRelease(t *testing.T) {
+	api := newTestAPI(t)
+	frame := api.createFrame(api.createUser("alice"))
+	device := []string{controllers.FrameTokenHeader, api.issueDeviceToken(frame)}
+	stable, beta := api.createRelease("1.0.0", models.FirmwareChannelStable), api.createRelease("2.0.0", models.FirmwareChannelBeta)
+	releases := "/api/smart-frames/" + frame.ID.Hex() + "/firmware/releases/"
+
+	r := api.request(http.MethodGet, releases+stable.ID.Hex(), "", "", device...).expect(http.StatusOK)
+	if r.Body.String() != "firmware 1.0.0" || r.Header().Get("ETag") != `"`+stable.Checksum+`"` {
+		t.Errorf("image %q with ETag %s", r.Body.String(), r.Header().Get("ETag"))
+	}
+	// releases of other channels are not disclosed
+	api.request(http.MethodGet, releases+beta.ID.Hex(), "", "", device...).expectProblem(http.StatusNotFound, "release_not_found")
+	api.request(http.MethodGet, releases+stable.ID.Hex(), "", "").expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+}
+
+func TestReportUpdate(t *testing.T) {
+	api := newTestAPI(t)
+	frame := api.createFrame(api.createUser("alice"))
+	device := []string{controllers.FrameTokenHeader, api.issueDeviceToken(frame)}
+	release := api.createRelease("1.0.0", models.FirmwareChannelStable)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/firmware/reports"
+
+	succeeded := data[models.FirmwareUpdateReport](api.request(http.MethodPost, path, "", `{"ReleaseID":"`+release.ID.Hex()+`","Outcome":"succeeded","Error":"none"}`, device...).
+		expect(http.StatusCreated))
+	if succeeded.FrameID != frame.ID || succeeded.Error != "" {
+		t.Errorf("report = %+v, want the frame without error", succeeded)
+	}
+	api.request(http.MethodPost, path, "", `{"ReleaseID":"`+release.ID.Hex()+`","Outcome":"failed","Error":"bad block"}`, device...).expect(http.StatusCreated)
+
+	publisher := []string{controllers.PublisherTokenHeader, publisherToken}
+	stored := data[models.FirmwareRelease](api.request(http.MethodGet, "/api/firmware/releases/"+release.ID.Hex(), "", "", publisher...).expect(http.StatusOK))
+	if stored.SucceededCount != 1 || stored.FailedCount != 1 {
+		t.Errorf("release counted %d successes and %d failures, want 1 and 1", stored.SucceededCount, stored.FailedCount)
+	}
+	reports := data[[]models.FirmwareUpdateReport](api.request(http.MethodGet, "/api/firmware/releases/"+release.ID.Hex()+"/reports", "", "", publisher...).
+		expect(http.StatusOK))
+	if len(reports) != 2 {
+		t.Errorf("%d reports, want 2", len(reports))
+	}
+
+	api.request(http.MethodPost, path, "", `{"ReleaseID":"`+release.ID.Hex()+`","Outcome":"maybe"}`, device...).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, "", `{"ReleaseID":"`+primitive.NewObjectID().Hex()+`","Outcome":"failed"}`, device...).
+		expectProblem(http.StatusNotFound, "release_not_found")
+	api.request(http.MethodPost, path, "", `{"ReleaseID":"`+release.ID.Hex()+`","Outcome":"failed"}`).expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+}
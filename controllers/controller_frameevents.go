@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/events"
+	"mirage-backend/repository"
+)
+
+// Timing of the frame event streams
+const (
+	// streamKeepAlive is how often an idle stream sends a comment, so that proxies don't close it
+	streamKeepAlive = 25 * time.Second
+	// streamRetry is how long a disconnected frame waits before reconnecting
+	streamRetry = 5 * time.Second
+)
+
+// Commands the owner can send to a frame
+const (
+	CommandReboot  = "reboot"
+	CommandRefresh = "refresh"
+)
+
+// FrameCommandRequest is the body of a command sent to a frame
+type FrameCommandRequest struct {
+	Command string `binding:"required,oneof=reboot refresh"` // One of the Command* values
+}
+
+// FrameCommandResponse tells what became of a command sent to a frame
+type FrameCommandResponse struct {
+	EventID string
+	// Delivered is how many open connections of the frame received the command, 0 when it is offline;
+	// an offline frame still gets it if it reconnects before the event is forgotten
+	Delivered int
+}
+
+// StreamFrameEvents godoc
+// @Summary Stream the events of a smart frame, as the device
+// @Description Server-Sent Events stream pushing picture_added, album_removed, settings_changed, reboot and refresh events to the frame. A frame reconnecting with Last-Event-ID first receives the events it missed, or a refresh event when they are no longer known.
+// @Tags devices
+// @Produce text/event-stream
+// @Param X-Frame-Token header string true "Device token of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param Last-Event-ID header string false "ID of the last event received, to resume from"
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/events [get]
+func (h *SmartFrameHandler) StreamFrameEvents(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	frame, err := authenticateFrame(c, ctx, h.frames)
+	cancel()
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	subscription, missed, resync := h.events.Subscribe(frame.ID, c.GetHeader("Last-Event-ID"))
+	defer subscription.Close()
+	if resync {
+		missed[0].Data = events.ConfigChanged{Version: frame.ConfigVersion}
+	}
+
+	// The stream is meant to outlive the write timeout of the server
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(c.Request.Context(), "Failed to lift the write deadline of an event stream", "error", err)
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if _, err := fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+	for _, event := range missed {
+		if err := writeEvent(c.Writer, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-subscription.Events():
+			// Closed when the server shuts down or the frame lags too far behind, it then reconnects and resumes
+			if !ok {
+				return
+			}
+			if err := writeEvent(c.Writer, event); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+// SendFrameCommand godoc
+// @Summary Send a command to a smart frame
+// @Description Pushes a reboot or refresh command to the frame through its event stream
+// @Tags smart-frames
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param command body FrameCommandRequest true "Command"
+// @Success 202 {object} FrameCommandResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/commands [post]
+func (h *SmartFrameHandler) SendFrameCommand(c *gin.Context) {
+	var request FrameCommandRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var event events.Event
+	var delivered int
+	switch request.Command {
+	case CommandReboot:
+		event, delivered = h.events.Publish(frame.ID, events.TypeReboot, nil)
+	case CommandRefresh:
+		event, delivered = h.events.Publish(frame.ID, events.TypeRefresh, events.ConfigChanged{Version: frame.ConfigVersion})
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Command sent to the frame",
+		"data":    FrameCommandResponse{EventID: event.ID, Delivered: delivered},
+	})
+}
+
+// writeEvent writes an event in the Server-Sent Events format, its data as JSON
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// publishToAlbumFrames pushes an event to every frame the album is loaded onto.
+// Failing to find them is logged, the frames catch up when they next fetch their configuration.
+func publishToAlbumFrames(ctx context.Context, frames repository.FrameRepository, broker *events.Broker, albumID primitive.ObjectID, eventType string, data any) {
+	frameIDs, err := frames.IDsWithAlbum(ctx, albumID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to find the frames showing an album", "album_id", albumID.Hex(), "error", err)
+		return
+	}
+	for _, frameID := range frameIDs {
+		broker.Publish(frameID, eventType, data)
+	}
+}
@@ -0,0 +1,85 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/events"
+)
+
+// streamEvents opens the event stream of the frame for the given duration and returns what was streamed
+func (a *testAPI) streamEvents(frameID, token, lastEventID string, duration time.Duration) response {
+	a.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	defer cancel()
+
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/smart-frames/"+frameID+"/events", nil)
+	req.Header.Set(controllers.FrameTokenHeader, token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	return a.serve(req)
+}
+
+func TestSendFrameCommand(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/commands"
+
+	// an offline frame gets the command once it connects again
+	command := data[controllers.FrameCommandResponse](api.request(http.MethodPost, path, ownerID, `{"Command":"reboot"}`).expect(http.StatusAccepted))
+	if command.EventID == "" || command.Delivered != 0 {
+		t.Errorf("command = %+v, want an event delivered to no connection", command)
+	}
+
+	api.request(http.MethodPost, path, ownerID, `{"Command":"explode"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, strangerID, `{"Command":"refresh"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", `{"Command":"refresh"}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestStreamFrameEvents(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	frame := api.createFrame(ownerID)
+	token := api.issueDeviceToken(frame)
+	commands := "/api/smart-frames/" + frame.ID.Hex() + "/commands"
+
+	first := data[controllers.FrameCommandResponse](api.request(http.MethodPost, commands, ownerID, `{"Command":"refresh"}`).expect(http.StatusAccepted))
+	api.request(http.MethodPost, commands, ownerID, `{"Command":"reboot"}`).expect(http.StatusAccepted)
+
+	// the events missed since the last one received are replayed
+	r := api.streamEvents(frame.ID.Hex(), token, first.EventID, 50*time.Millisecond).expect(http.StatusOK)
+	if r.Header().Get("Content-Type") != "text/event-stream" || !strings.Contains(r.Body.String(), "event: "+events.TypeReboot+"\n") ||
+		strings.Contains(r.Body.String(), "id: "+first.EventID+"\n") {
+		t.Errorf("stream = %q, want only the reboot replayed", r.Body.String())
+	}
+	// an unknown resumption point asks the frame to refresh
+	if r := api.streamEvents(frame.ID.Hex(), token, "unknown", 50*time.Millisecond).expect(http.StatusOK); !strings.Contains(r.Body.String(), "event: "+events.TypeRefresh+"\n") {
+		t.Errorf("stream = %q, want a refresh", r.Body.String())
+	}
+
+	// events are pushed to the connected frame
+	streamed := make(chan response)
+	go func() { streamed <- api.streamEvents(frame.ID.Hex(), token, "", time.Second) }()
+	for api.events.Connected(frame.ID) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	album := api.createAlbum(ownerID, true)
+	api.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/albums", ownerID, `{"AlbumID":"`+album.ID.Hex()+`"}`).expect(http.StatusOK)
+	command := data[controllers.FrameCommandResponse](api.request(http.MethodPost, commands, ownerID, `{"Command":"reboot"}`).expect(http.StatusAccepted))
+	if command.Delivered != 1 {
+		t.Errorf("command delivered to %d connections, want 1", command.Delivered)
+	}
+	if body := (<-streamed).Body.String(); !strings.Contains(body, "event: "+events.TypeSettingsChanged+"\n") || !strings.Contains(body, "id: "+command.EventID+"\n") {
+		t.Errorf("stream = %q, want the settings change and the reboot", body)
+	}
+
+	api.streamEvents(frame.ID.Hex(), "nope", "", time.Second).expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+}
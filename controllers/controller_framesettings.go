@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/events"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+// FrameTokenHeader carries the token a smart frame authenticates with on the device endpoints
+const FrameTokenHeader = "X-Frame-Token"
+
+// Display settings used when the owner didn't choose any
+const (
+	DefaultSlideInterval = 60
+	DefaultTransition    = models.TransitionFade
+	DefaultOrder         = models.OrderShuffle
+	DefaultQuietMode     = models.QuietModeOff
+	DefaultTimezone      = "UTC"
+	DefaultAlbumWeight   = 1
+)
+
+var errInvalidFrameToken = apperror.New(http.StatusUnauthorized, "invalid_frame_token",
+	FrameTokenHeader+" header is missing or invalid")
+
+// DeviceTokenResponse is returned when issuing a device token; the token is only ever returned there
+type DeviceTokenResponse struct {
+	DeviceToken string
+}
+
+// FrameConfig is the configuration a smart frame applies, as delivered to the device
+type FrameConfig struct {
+	FrameID primitive.ObjectID
+	// Version increases whenever the settings or the loaded albums change
+	Version  int64
+	Settings models.DisplaySettings
+	// Albums are the loaded albums with the weight they are shown with
+	Albums []models.AlbumWeight
+}
+
+// IssueDeviceToken godoc
+// @Summary Issue the device token of a smart frame
+// @Description Generates the token the frame authenticates with on the device endpoints, replacing and revoking any previous one. The token is only returned here.
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 201 {object} DeviceTokenResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/device-token [post]
+func (h *SmartFrameHandler) IssueDeviceToken(c *gin.Context) {
+	if _, err := requireActingUser(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to issue device token", err))
+		return
+	}
+
+	fields := repository.Fields{"device_token_hash": hashToken(token), "updated_at": versioning.NextUpdatedAt(frame.UpdatedAt)}
+	if err := h.frames.Update(ctx, frame.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to issue device token"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Device token issued successfully", "data": DeviceTokenResponse{DeviceToken: token}})
+}
+
+// GetFrameSettings godoc
+// @Summary Get the display settings of a smart frame
+// @Description Get the slideshow interval, transition, order, quiet hours and album weights of a frame, defaults filled in
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the frame, to send as If-Match when updating the settings"
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/settings [get]
+func (h *SmartFrameHandler) GetFrameSettings(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	setETag(c, frame.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Frame settings retrieved successfully", "data": withDefaults(frame.Settings)})
+}
+
+// UpdateFrameSettings godoc
+// @Summary Update the display settings of a smart frame
+// @Description Replaces the display settings of a frame, omitted values fall back to the defaults. The frame picks them up from its device configuration.
+// @Tags smart-frames
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param If-Match header string false "ETag of the frame version being changed"
+// @Param settings body models.DisplaySettings true "Display settings"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the updated frame"
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/settings [put]
+func (h *SmartFrameHandler) UpdateFrameSettings(c *gin.Context) {
+	var settings models.DisplaySettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := checkIfMatch(c, frame.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	settings = withDefaults(settings)
+	if err := validateSettings(settings, frame.LoadedAlbums); err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, err.Error()))
+		return
+	}
+
+	previousUpdate := frame.UpdatedAt
+	frame.Settings = settings
+	frame.ConfigVersion++
+	frame.UpdatedAt = versioning.NextUpdatedAt(previousUpdate)
+
+	fields := repository.Fields{"settings": frame.Settings, "config_version": frame.ConfigVersion, "updated_at": frame.UpdatedAt}
+	if err := h.frames.UpdateIfUnmodified(ctx, frame.ID, previousUpdate, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to update frame settings"))
+		return
+	}
+
+	h.events.Publish(frame.ID, events.TypeSettingsChanged, events.ConfigChanged{Version: frame.ConfigVersion})
+
+	setETag(c, frame.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Frame settings updated successfully", "data": frame.Settings})
+}
+
+// FirmwareChannelRequest is the body choosing the firmware releases a frame receives
+type FirmwareChannelRequest struct {
+	Channel string `binding:"required,oneof=stable beta"`
+}
+
+// UpdateFirmwareChannel godoc
+// @Summary Choose the firmware channel of a smart frame
+// @Description Sets whether the frame receives the stable releases only or the beta releases too
+// @Tags smart-frames
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param If-Match header string false "ETag of the frame version being changed"
+// @Param channel body FirmwareChannelRequest true "Firmware channel"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the updated frame"
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/firmware-channel [put]
+func (h *SmartFrameHandler) UpdateFirmwareChannel(c *gin.Context) {
+	var request FirmwareChannelRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := checkIfMatch(c, frame.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	previousUpdate := frame.UpdatedAt
+	frame.FirmwareChannel = request.Channel
+	frame.UpdatedAt = versioning.NextUpdatedAt(previousUpdate)
+
+	fields := repository.Fields{"firmware_channel": frame.FirmwareChannel, "updated_at": frame.UpdatedAt}
+	if err := h.frames.UpdateIfUnmodified(ctx, frame.ID, previousUpdate, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to update firmware channel"))
+		return
+	}
+
+	setETag(c, frame.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Firmware channel updated successfully", "data": frame})
+}
+
+// GetDeviceConfig godoc
+// @Summary Get the configuration of a smart frame, as the device
+// @Description Called by the frame itself with its device token. Answers 304 when the If-None-Match version is still current.
+// @Tags devices
+// @Produce json
+// @Param X-Frame-Token header string true "Device token of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param If-None-Match header string false "ETag of the configuration version the frame applies"
+// @Success 200 {object} FrameConfig
+// @Success 304 "Configuration unchanged"
+// @Header 200 {string} ETag "Version of the configuration"
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/config [get]
+func (h *SmartFrameHandler) GetDeviceConfig(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := authenticateFrame(c, ctx, h.frames)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	tag := configETag(frame.ConfigVersion)
+	c.Header("ETag", tag)
+	for _, candidate := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		if strings.TrimSpace(candidate) == tag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Frame configuration retrieved successfully", "data": frameConfig(frame)})
+}
+
+// authenticateFrame returns the frame in the path once checked that the request carries its device token.
+// Unknown frames are reported as invalid tokens, so that frame IDs can't be probed.
+func authenticateFrame(c *gin.Context, ctx context.Context, frames repository.FrameRepository) (models.SmartFrame, error) {
+	token := c.GetHeader(FrameTokenHeader)
+	frameID, err := primitive.ObjectIDFromHex(c.Param("frameId"))
+	if token == "" || err != nil {
+		return models.SmartFrame{}, errInvalidFrameToken
+	}
+
+	frame, err := frames.Get(ctx, frameID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return frame, errInvalidFrameToken
+		}
+		return frame, apperror.Internal("Failed to retrieve frame", err)
+	}
+	if frame.DeviceTokenHash == "" || subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(frame.DeviceTokenHash)) != 1 {
+		return frame, errInvalidFrameToken
+	}
+	return frame, nil
+}
+
+// frameConfig assembles the configuration delivered to the frame
+func frameConfig(frame models.SmartFrame) FrameConfig {
+	settings := withDefaults(frame.Settings)
+
+	albums := make([]models.AlbumWeight, 0, len(frame.LoadedAlbums))
+	for _, albumID := range frame.LoadedAlbums {
+		weight := DefaultAlbumWeight
+		if index := slices.IndexFunc(settings.AlbumWeights, func(w models.AlbumWeight) bool { return w.AlbumID == albumID }); index >= 0 {
+			weight = settings.AlbumWeights[index].Weight
+		}
+		albums = append(albums, models.AlbumWeight{AlbumID: albumID, Weight: weight})
+	}
+
+	return FrameConfig{FrameID: frame.ID, Version: frame.ConfigVersion, Settings: settings, Albums: albums}
+}
+
+// configETag is the entity tag of a version of the device configuration
+func configETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// withDefaults fills in the settings the owner left out
+func withDefaults(settings models.DisplaySettings) models.DisplaySettings {
+	if settings.SlideInterval == 0 {
+		settings.SlideInterval = DefaultSlideInterval
+	}
+	if settings.Transition == "" {
+		settings.Transition = DefaultTransition
+	}
+	if settings.Order == "" {
+		settings.Order = DefaultOrder
+	}
+	if settings.QuietHours.Mode == "" {
+		settings.QuietHours.Mode = DefaultQuietMode
+	}
+	if settings.QuietHours.Timezone == "" {
+		settings.QuietHours.Timezone = DefaultTimezone
+	}
+	settings.AlbumWeights = nonNil(settings.AlbumWeights)
+	return settings
+}
+
+// validateSettings checks what binding can't: the quiet hours schedule and that weighted albums are loaded
+func validateSettings(settings models.DisplaySettings, loadedAlbums []primitive.ObjectID) error {
+	quiet := settings.QuietHours
+	if _, err := time.LoadLocation(quiet.Timezone); err != nil {
+		return fmt.Errorf("unknown time zone %q", quiet.Timezone)
+	}
+	if quiet.Enabled || quiet.Start != "" || quiet.End != "" {
+		start, err := time.Parse("15:04", quiet.Start)
+		if err != nil {
+			return fmt.Errorf("quiet hours start must be a HH:MM time")
+		}
+		end, err := time.Parse("15:04", quiet.End)
+		if err != nil {
+			return fmt.Errorf("quiet hours end must be a HH:MM time")
+		}
+		if start.Equal(end) {
+			return fmt.Errorf("quiet hours must start and end at different times")
+		}
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(settings.AlbumWeights))
+	for _, weight := range settings.AlbumWeights {
+		if !slices.Contains(loadedAlbums, weight.AlbumID) {
+			return fmt.Errorf("album %s is not loaded onto the frame", weight.AlbumID.Hex())
+		}
+		if seen[weight.AlbumID] {
+			return fmt.Errorf("album %s is weighted twice", weight.AlbumID.Hex())
+		}
+		seen[weight.AlbumID] = true
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+)
+
+// issueDeviceToken issues the token the frame authenticates with
+func (a *testAPI) issueDeviceToken(frame models.SmartFrame) string {
+	a.t.Helper()
+	return data[controllers.DeviceTokenResponse](a.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/device-token", frame.OwnerID.Hex(), "").
+		expect(http.StatusCreated)).DeviceToken
+}
+
+func TestIssueDeviceToken(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	config := "/api/smart-frames/" + frame.ID.Hex() + "/config"
+
+	first := api.issueDeviceToken(frame)
+	api.request(http.MethodGet, config, "", "", controllers.FrameTokenHeader, first).expect(http.StatusOK)
+
+	// a new token revokes the previous one
+	second := api.issueDeviceToken(frame)
+	api.request(http.MethodGet, config, "", "", controllers.FrameTokenHeader, first).expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+	api.request(http.MethodGet, config, "", "", controllers.FrameTokenHeader, second).expect(http.StatusOK)
+
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/device-token"
+	api.request(http.MethodPost, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestFrameSettings(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	album, other := api.createAlbum(ownerID, true), api.createAlbum(ownerID, true)
+	api.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/albums", ownerID, `{"AlbumID":"`+album.ID.Hex()+`"}`).expect(http.StatusOK)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/settings"
+
+	r := api.request(http.MethodGet, path, ownerID, "").expect(http.StatusOK)
+	if settings := data[models.DisplaySettings](r); settings.Transition != controllers.DefaultTransition || settings.QuietHours.Timezone != controllers.DefaultTimezone {
+		t.Errorf("settings = %+v, want the defaults", settings)
+	}
+	etag := r.Header().Get("ETag")
+
+	body := `{"SlideInterval":30,"Transition":"slide","QuietHours":{"Enabled":true,"Start":"22:00","End":"07:00","Timezone":"Europe/Paris","Mode":"dim"},` +
+		`"AlbumWeights":[{"AlbumID":"` + album.ID.Hex() + `","Weight":3}]}`
+	settings := data[models.DisplaySettings](api.request(http.MethodPut, path, ownerID, body, "If-Match", etag).expect(http.StatusOK))
+	if settings.SlideInterval != 30 || settings.Order != controllers.DefaultOrder || settings.QuietHours.Mode != models.QuietModeDim {
+		t.Errorf("settings = %+v, want the new settings completed with the defaults", settings)
+	}
+	api.request(http.MethodPut, path, ownerID, body, "If-Match", etag).expectProblem(http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+
+	invalid := []string{
+		`{"SlideInterval":1}`,
+		`{"Transition":"spin"}`,
+		`{"QuietHours":{"Timezone":"Mars/Olympus"}}`,
+		`{"QuietHours":{"Enabled":true,"Start":"22:00"}}`,
+		`{"QuietHours":{"Enabled":true,"Start":"22:00","End":"22:00"}}`,
+		`{"AlbumWeights":[{"AlbumID":"` + other.ID.Hex() + `","Weight":2}]}`,
+		`{"AlbumWeights":[{"AlbumID":"` + album.ID.Hex() + `","Weight":2},{"AlbumID":"` + album.ID.Hex() + `","Weight":3}]}`,
+	}
+	for _, body := range invalid {
+		api.request(http.MethodPut, path, ownerID, body).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	}
+	api.request(http.MethodGet, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPut, path, strangerID, `{}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPut, path, "", `{}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestUpdateFirmwareChannel(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/firmware-channel"
+
+	updated := data[models.SmartFrame](api.request(http.MethodPut, path, ownerID, `{"Channel":"beta"}`).expect(http.StatusOK))
+	if updated.FirmwareChannel != "beta" {
+		t.Errorf("firmware channel = %q, want beta", updated.FirmwareChannel)
+	}
+
+	api.request(http.MethodPut, path, ownerID, `{"Channel":"nightly"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPut, path, ownerID, `{"Channel":"stable"}`, "If-Match", `"stale"`).expectProblem(http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+	api.request(http.MethodPut, path, strangerID, `{"Channel":"stable"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+}
+
+func TestGetDeviceConfig(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	frame := api.createFrame(ownerID)
+	album := api.createAlbum(ownerID, true)
+	token := api.issueDeviceToken(frame)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/config"
+
+	api.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/albums", ownerID, `{"AlbumID":"`+album.ID.Hex()+`"}`).expect(http.StatusOK)
+	r := api.request(http.MethodGet, path, "", "", controllers.FrameTokenHeader, token).expect(http.StatusOK)
+	config := data[controllers.FrameConfig](r)
+	if config.FrameID != frame.ID || len(config.Albums) != 1 || config.Albums[0].Weight != controllers.DefaultAlbumWeight || config.Version != frame.ConfigVersion+1 {
+		t.Errorf("config = %+v, want the loaded album with the default weight", config)
+	}
+
+	// the frame only downloads its configuration again once changed
+	api.request(http.MethodGet, path, "", "", controllers.FrameTokenHeader, token, "If-None-Match", r.Header().Get("ETag")).expect(http.StatusNotModified)
+	api.request(http.MethodPut, "/api/smart-frames/"+frame.ID.Hex()+"/settings", ownerID, `{"SlideInterval":10}`).expect(http.StatusOK)
+	api.request(http.MethodGet, path, "", "", controllers.FrameTokenHeader, token, "If-None-Match", r.Header().Get("ETag")).expect(http.StatusOK)
+
+	api.request(http.MethodGet, path, ownerID, "").expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+	api.request(http.MethodGet, "/api/smart-frames/"+primitive.NewObjectID().Hex()+"/config", "", "", controllers.FrameTokenHeader, token).
+		expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// HeartbeatInterval is how often frames are asked to send a heartbeat
+const HeartbeatInterval = time.Minute
+
+// offlineAfter is how long after its last heartbeat a frame is considered offline, a couple of missed heartbeats
+const offlineAfter = 3 * HeartbeatInterval
+
+// HeartbeatRequest is the body of a frame heartbeat
+type HeartbeatRequest struct {
+	FirmwareVersion  string `binding:"required,max=64"`
+	FreeStorage      int64  `binding:"min=0"` // Bytes
+	CurrentPictureID primitive.ObjectID
+	// Displays counts the pictures displayed since the previous heartbeat
+	Displays []DisplayCount `binding:"max=1000,dive"`
+}
+
+// DisplayCount is how many times a frame displayed a picture
+type DisplayCount struct {
+	PictureID primitive.ObjectID `binding:"required"`
+	Count     int64              `binding:"required,min=1,max=100000"`
+}
+
+// HeartbeatResponse tells the frame what to do after its heartbeat
+type HeartbeatResponse struct {
+	// ConfigVersion is the current version of the configuration, to fetch again when the frame has another one
+	ConfigVersion int64
+	// HeartbeatInterval is the number of seconds until the next heartbeat
+	HeartbeatInterval int
+}
+
+// FrameStatusResponse is the status of a frame as shown to its owner
+type FrameStatusResponse struct {
+	Online        bool // Whether a heartbeat was received recently
+	FirstBoot     time.Time
+	ConfigVersion int64
+	Status        models.FrameStatus
+}
+
+// RecordHeartbeat godoc
+// @Summary Send a heartbeat, as the device
+// @Description Called by the frame every HeartbeatInterval with its firmware version, free storage, the picture on screen and the pictures displayed since the previous heartbeat
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Frame-Token header string true "Device token of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param heartbeat body HeartbeatRequest true "Heartbeat"
+// @Success 200 {object} HeartbeatResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/heartbeat [post]
+func (h *SmartFrameHandler) RecordHeartbeat(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := authenticateFrame(c, ctx, h.frames)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var request HeartbeatRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	now := time.Now()
+	status := models.FrameStatus{
+		LastSeenAt:       now,
+		FirmwareVersion:  request.FirmwareVersion,
+		FreeStorage:      request.FreeStorage,
+		IPAddress:        c.ClientIP(),
+		CurrentPictureID: request.CurrentPictureID,
+	}
+
+	// The status is not a change of the frame made by its owner, updated_at and with it the ETag are kept
+	fields := repository.Fields{"status": status}
+	if frame.FirstBoot.IsZero() {
+		fields["first_boot"] = now
+	}
+	if err := h.frames.Update(ctx, frame.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to record heartbeat"))
+		return
+	}
+
+	heartbeat := models.FrameHeartbeat{
+		FrameID:          frame.ID,
+		ReceivedAt:       now,
+		FirmwareVersion:  status.FirmwareVersion,
+		FreeStorage:      status.FreeStorage,
+		IPAddress:        status.IPAddress,
+		CurrentPictureID: status.CurrentPictureID,
+	}
+	if err := h.heartbeats.Create(ctx, &heartbeat); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to record heartbeat", err))
+		return
+	}
+
+	counts := make(map[primitive.ObjectID]int64, len(request.Displays))
+	for _, display := range request.Displays {
+		counts[display.PictureID] += display.Count
+	}
+	if err := h.displayStats.Record(ctx, frame.ID, counts, now); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to record display counts", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Heartbeat recorded successfully",
+		"data":    HeartbeatResponse{ConfigVersion: frame.ConfigVersion, HeartbeatInterval: int(HeartbeatInterval.Seconds())},
+	})
+}
+
+// GetFrameStatus godoc
+// @Summary Get the status of a smart frame
+// @Description Tells whether the frame is online and what it reported in its last heartbeat
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 200 {object} FrameStatusResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/status [get]
+func (h *SmartFrameHandler) GetFrameStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	lastSeen := frame.Status.LastSeenAt
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Frame status retrieved successfully",
+		"data": FrameStatusResponse{
+			Online:        !lastSeen.IsZero() && time.Since(lastSeen) < offlineAfter,
+			FirstBoot:     frame.FirstBoot,
+			ConfigVersion: frame.ConfigVersion,
+			Status:        frame.Status,
+		},
+	})
+}
+
+// GetFrameHeartbeats godoc
+// @Summary List the heartbeats of a smart frame
+// @Description Fetches a page of the status history of the frame, the most recent first. Heartbeats are kept 30 days.
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, received_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/heartbeats [get]
+func (h *SmartFrameHandler) GetFrameHeartbeats(c *gin.Context) {
+	query, err := parsePageQuery(c, heartbeatListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	page, err := h.heartbeats.ListByFrame(ctx, frame.ID, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve heartbeats", err)
+		return
+	}
+
+	respondWithPage(c, "Heartbeats retrieved successfully", query, page)
+}
+
+// GetFrameDisplayStats godoc
+// @Summary List how often a smart frame displayed each picture
+// @Description Fetches a page of the display counts of the pictures shown by the frame, the most displayed first
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, count, last_displayed_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/display-stats [get]
+func (h *SmartFrameHandler) GetFrameDisplayStats(c *gin.Context) {
+	query, err := parsePageQuery(c, displayStatListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	page, err := h.displayStats.ListByFrame(ctx, frame.ID, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve display stats", err)
+		return
+	}
+
+	respondWithPage(c, "Display stats retrieved successfully", query, page)
+}
@@ -0,0 +1,85 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+func TestRecordHeartbeat(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	frame := api.createFrame(ownerID)
+	token := api.issueDeviceToken(frame)
+	path, settings := "/api/smart-frames/"+frame.ID.Hex()+"/heartbeat", "/api/smart-frames/"+frame.ID.Hex()+"/settings"
+	picture := api.uploadPicture(api.createAlbum(ownerID, true).ID.Hex(), ownerID)
+	body := `{"FirmwareVersion":"1.2.0","FreeStorage":1000,"CurrentPictureID":"` + picture.ID.Hex() + `",` +
+		`"Displays":[{"PictureID":"` + picture.ID.Hex() + `","Count":2},{"PictureID":"` + picture.ID.Hex() + `","Count":3}]}`
+
+	before := api.request(http.MethodGet, settings, ownerID, "").expect(http.StatusOK).Header().Get("ETag")
+	response := data[controllers.HeartbeatResponse](api.request(http.MethodPost, path, "", body, controllers.FrameTokenHeader, token).expect(http.StatusOK))
+	if response.ConfigVersion != frame.ConfigVersion || response.HeartbeatInterval != int(controllers.HeartbeatInterval.Seconds()) {
+		t.Errorf("heartbeat response = %+v", response)
+	}
+	// the heartbeat is no change of the owner, the settings keep their ETag
+	if after := api.request(http.MethodGet, settings, ownerID, "").expect(http.StatusOK).Header().Get("ETag"); after != before {
+		t.Errorf("ETag moved from %s to %s", before, after)
+	}
+
+	api.request(http.MethodPost, path, "", `{"FreeStorage":1000}`, controllers.FrameTokenHeader, token).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, "", `{"FirmwareVersion":"1.2.0","FreeStorage":-1}`, controllers.FrameTokenHeader, token).
+		expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, ownerID, body).expectProblem(http.StatusUnauthorized, "invalid_frame_token")
+}
+
+func TestFrameTelemetry(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	token := api.issueDeviceToken(frame)
+	frames := "/api/smart-frames/" + frame.ID.Hex()
+	album := api.createAlbum(ownerID, true)
+	first, second := api.uploadPicture(album.ID.Hex(), ownerID), api.uploadPicture(album.ID.Hex(), ownerID)
+
+	if status := data[controllers.FrameStatusResponse](api.request(http.MethodGet, frames+"/status", ownerID, "").expect(http.StatusOK)); status.Online || !status.FirstBoot.IsZero() {
+		t.Errorf("status = %+v, want offline before any heartbeat", status)
+	}
+
+	for _, version := range []string{"1.2.0", "1.3.0"} {
+		body := `{"FirmwareVersion":"` + version + `","FreeStorage":1000,"CurrentPictureID":"` + second.ID.Hex() + `",` +
+			`"Displays":[{"PictureID":"` + first.ID.Hex() + `","Count":1},{"PictureID":"` + second.ID.Hex() + `","Count":2}]}`
+		api.request(http.MethodPost, frames+"/heartbeat", "", body, controllers.FrameTokenHeader, token).expect(http.StatusOK)
+	}
+
+	status := data[controllers.FrameStatusResponse](api.request(http.MethodGet, frames+"/status", ownerID, "").expect(http.StatusOK))
+	if !status.Online || status.FirstBoot.IsZero() || status.Status.FirmwareVersion != "1.3.0" || status.Status.CurrentPictureID != second.ID {
+		t.Errorf("status = %+v, want online with the last heartbeat", status)
+	}
+
+	page := api.request(http.MethodGet, frames+"/heartbeats?limit=1", ownerID, "").expect(http.StatusOK)
+	if heartbeats := data[[]models.FrameHeartbeat](page); len(heartbeats) != 1 || heartbeats[0].FirmwareVersion != "1.3.0" || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the last heartbeat and more", page.Body.String())
+	}
+
+	stats := data[[]models.PictureDisplayStat](api.request(http.MethodGet, frames+"/display-stats", ownerID, "").expect(http.StatusOK))
+	if len(stats) != 2 || stats[0].PictureID != second.ID || stats[0].Count != 4 || stats[1].Count != 2 {
+		t.Errorf("display stats = %+v, want the displays summed per picture, most displayed first", stats)
+	}
+
+	for _, endpoint := range []string{"/status", "/heartbeats", "/display-stats"} {
+		api.request(http.MethodGet, frames+endpoint, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+		api.request(http.MethodGet, frames+endpoint, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	}
+	api.request(http.MethodGet, frames+"/heartbeats?sort=nope", ownerID, "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+
+	// the telemetry goes with the frame
+	api.request(http.MethodDelete, frames, ownerID, "").expect(http.StatusOK)
+	if page, err := api.repos.DisplayStats.ListByFrame(context.Background(), frame.ID, repository.PageQuery{Limit: 10, SortField: "count"}); err != nil || len(page.Items) != 0 {
+		t.Errorf("display stats kept: %+v, %v", page.Items, err)
+	}
+}
@@ -0,0 +1,531 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+// InvitationRequest is the body of an album invitation
+type InvitationRequest struct {
+	Invitee string `binding:"required"`                                   // Username or email of the invited user
+	Role    string `binding:"required,oneof=viewer contributor co_owner"` // Role granted once the invitation is accepted
+}
+
+// MemberRoleRequest is the body of a change of a member's role
+type MemberRoleRequest struct {
+	Role string `binding:"required,oneof=viewer contributor co_owner"`
+}
+
+// InvitationHandler serves the album sharing endpoints: invitations, their answers and the album members
+type InvitationHandler struct {
+	albums      repository.AlbumRepository
+	users       repository.UserRepository
+	invitations repository.InvitationRepository
+}
+
+// NewInvitationHandler returns an InvitationHandler using the given repositories
+func NewInvitationHandler(
+	albums repository.AlbumRepository,
+	users repository.UserRepository,
+	invitations repository.InvitationRepository,
+) *InvitationHandler {
+	return &InvitationHandler{albums: albums, users: users, invitations: invitations}
+}
+
+// InviteToAlbum godoc
+// @Summary Invite a user to an album
+// @Description Invites a user, found by username or email, to an album with a role: viewer, contributor (can also upload and remove their own pictures) or co_owner (can also edit the album, remove any picture and manage members). A declined or revoked invitation is sent again.
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
+// @Param albumId path string true "Album ID"
+// @Param invitation body InvitationRequest true "Invitee and role"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/invitations [post]
+func (h *InvitationHandler) InviteToAlbum(c *gin.Context) {
+	inviterID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	albumID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("album"))
+		return
+	}
+
+	var request InvitationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, err := h.albums.Get(ctx, albumID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+	if err := authorizeAlbum(c, ctx, h.invitations, album, rightManage); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	// The pictures of a smart album depend on what its owner may view, they cannot be shared
+	if album.Criteria != nil {
+		apperror.Abort(c, errSmartAlbum)
+		return
+	}
+
+	invitee, err := h.users.FindByLogin(ctx, request.Invitee)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "user", "Failed to find invited user"))
+		return
+	}
+	if invitee.ID == album.OwnerID {
+		apperror.Abort(c, apperror.Conflict("already_member", "User owns the album"))
+		return
+	}
+
+	invitation, err := h.invitations.GetByAlbumAndUser(ctx, albumID, invitee.ID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apperror.Abort(c, apperror.Internal("Failed to invite user", err))
+		return
+	}
+	switch {
+	case err == nil && invitation.Status == models.InvitationAccepted:
+		apperror.Abort(c, apperror.Conflict("already_member", "User is already a member of the album"))
+		return
+	case err == nil && invitation.Status == models.InvitationPending:
+		apperror.Abort(c, errInvitationExists)
+		return
+	}
+
+	now := time.Now()
+	if err != nil {
+		invitation = models.AlbumInvitation{
+			ID:          primitive.NewObjectID(),
+			AlbumID:     albumID,
+			UserID:      invitee.ID,
+			InvitedByID: inviterID,
+			Role:        request.Role,
+			Status:      models.InvitationPending,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if err := h.invitations.Create(ctx, &invitation); err != nil {
+			if errors.Is(err, repository.ErrDuplicate) {
+				apperror.Abort(c, errInvitationExists)
+				return
+			}
+			apperror.Abort(c, apperror.Internal("Failed to invite user", err))
+			return
+		}
+	} else {
+		// Declined and revoked invitations are sent again
+		invitation.InvitedByID = inviterID
+		invitation.Role = request.Role
+		invitation.Status = models.InvitationPending
+		invitation.CreatedAt = now
+		invitation.RespondedAt = time.Time{}
+		invitation.UpdatedAt = now
+		fields := repository.Fields{
+			"invited_by_id": invitation.InvitedByID,
+			"role":          invitation.Role,
+			"status":        invitation.Status,
+			"created_at":    invitation.CreatedAt,
+			"responded_at":  invitation.RespondedAt,
+			"updated_at":    invitation.UpdatedAt,
+		}
+		if err := h.invitations.Update(ctx, invitation.ID, fields); err != nil {
+			apperror.Abort(c, fromRepository(err, "invitation", "Failed to invite user"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "User invited successfully", "data": invitation})
+}
+
+// GetAlbumInvitations godoc
+// @Summary List the invitations of an album
+// @Description Fetches a page of the invitations sent for an album, whatever their state unless status is given
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
+// @Param albumId path string true "Album ID"
+// @Param status query string false "Only invitations in this state (pending, accepted, declined, revoked)"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/invitations [get]
+func (h *InvitationHandler) GetAlbumInvitations(c *gin.Context) {
+	h.listAlbumInvitations(c, rightManage, c.Query("status"))
+}
+
+// GetAlbumMembers godoc
+// @Summary List the members of an album
+// @Description Fetches a page of the accepted invitations of an album, which carry the role of each member besides the owner
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, a member of the album"
+// @Param albumId path string true "Album ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/members [get]
+func (h *InvitationHandler) GetAlbumMembers(c *gin.Context) {
+	h.listAlbumInvitations(c, rightView, models.InvitationAccepted)
+}
+
+// UpdateMemberRole godoc
+// @Summary Change the role of an album member
+// @Description Changes the role of a user who accepted an invitation to the album
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
+// @Param albumId path string true "Album ID"
+// @Param userId path string true "Member user ID"
+// @Param role body MemberRoleRequest true "New role"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/members/{userId} [put]
+func (h *InvitationHandler) UpdateMemberRole(c *gin.Context) {
+	var request MemberRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	_, invitation, err := h.membership(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if invitation.Status != models.InvitationAccepted {
+		apperror.Abort(c, apperror.NotFound("member"))
+		return
+	}
+
+	invitation.Role = request.Role
+	invitation.UpdatedAt = time.Now()
+	fields := repository.Fields{"role": invitation.Role, "updated_at": invitation.UpdatedAt}
+	if err := h.invitations.Update(ctx, invitation.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "member", "Failed to update member"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated successfully", "data": invitation})
+}
+
+// RemoveMember godoc
+// @Summary Revoke access to an album
+// @Description Revokes the invitation of a user to an album, removing their access if they had accepted it. Members can also remove themselves to leave the album.
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner, a co-owner or the member leaving"
+// @Param albumId path string true "Album ID"
+// @Param userId path string true "Invited user ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/members/{userId} [delete]
+func (h *InvitationHandler) RemoveMember(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, invitation, err := h.membership(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if invitation.Status == models.InvitationRevoked || invitation.Status == models.InvitationDeclined {
+		apperror.Abort(c, apperror.Conflict("invitation_not_active", "Invitation was already "+invitation.Status))
+		return
+	}
+
+	wasMember := invitation.Status == models.InvitationAccepted
+	invitation.Status = models.InvitationRevoked
+	invitation.UpdatedAt = time.Now()
+	fields := repository.Fields{"status": invitation.Status, "updated_at": invitation.UpdatedAt}
+	if err := h.invitations.Update(ctx, invitation.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "invitation", "Failed to revoke access"))
+		return
+	}
+	if wasMember {
+		if err := syncAlbumMembers(ctx, h.albums, h.invitations, album); err != nil {
+			apperror.Abort(c, apperror.Internal("Failed to revoke access", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access revoked successfully", "data": invitation})
+}
+
+// GetMyInvitations godoc
+// @Summary List the invitations received by the acting user
+// @Description Fetches a page of the album invitations sent to the acting user, whatever their state unless status is given
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user"
+// @Param status query string false "Only invitations in this state (pending, accepted, declined, revoked)"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /invitations [get]
+func (h *InvitationHandler) GetMyInvitations(c *gin.Context) {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	query, err := parsePageQuery(c, invitationListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	filter := repository.InvitationFilter{UserID: &userID, Status: c.Query("status")}
+	page, err := h.invitations.List(ctx, filter, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve invitations", err)
+		return
+	}
+
+	respondWithPage(c, "Invitations retrieved successfully", query, page)
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an album invitation
+// @Description Accepts a pending invitation of the acting user, who becomes a member of the album with the invitation's role
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the invited user"
+// @Param invitationId path string true "Invitation ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /invitations/{invitationId}/accept [post]
+func (h *InvitationHandler) AcceptInvitation(c *gin.Context) {
+	h.respond(c, models.InvitationAccepted, "Invitation accepted successfully")
+}
+
+// DeclineInvitation godoc
+// @Summary Decline an album invitation
+// @Description Declines a pending invitation of the acting user
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the invited user"
+// @Param invitationId path string true "Invitation ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /invitations/{invitationId}/decline [post]
+func (h *InvitationHandler) DeclineInvitation(c *gin.Context) {
+	h.respond(c, models.InvitationDeclined, "Invitation declined successfully")
+}
+
+// respond answers a pending invitation of the acting user with status
+func (h *InvitationHandler) respond(c *gin.Context, status, message string) {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	invitationID, err := primitive.ObjectIDFromHex(c.Param("invitationId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("invitation"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	invitation, err := h.invitations.Get(ctx, invitationID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "invitation", "Failed to retrieve invitation"))
+		return
+	}
+	// Invitations of other users are not disclosed
+	if invitation.UserID != userID {
+		apperror.Abort(c, apperror.NotFound("invitation"))
+		return
+	}
+	if invitation.Status != models.InvitationPending {
+		apperror.Abort(c, apperror.Conflict("invitation_not_pending", "Invitation was already "+invitation.Status))
+		return
+	}
+
+	album, err := h.albums.Get(ctx, invitation.AlbumID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+
+	invitation.Status = status
+	invitation.RespondedAt = time.Now()
+	invitation.UpdatedAt = invitation.RespondedAt
+	fields := repository.Fields{
+		"status":       invitation.Status,
+		"responded_at": invitation.RespondedAt,
+		"updated_at":   invitation.UpdatedAt,
+	}
+	if err := h.invitations.Update(ctx, invitation.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "invitation", "Failed to answer invitation"))
+		return
+	}
+	if status == models.InvitationAccepted {
+		if err := syncAlbumMembers(ctx, h.albums, h.invitations, album); err != nil {
+			apperror.Abort(c, apperror.Internal("Failed to add member to album", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message, "data": invitation})
+}
+
+// listAlbumInvitations lists the invitations of the album in the path with the given status, after checking right
+func (h *InvitationHandler) listAlbumInvitations(c *gin.Context, right albumRight, status string) {
+	albumID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("album"))
+		return
+	}
+
+	query, err := parsePageQuery(c, invitationListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, err := h.albums.Get(ctx, albumID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+	if err := authorizeAlbum(c, ctx, h.invitations, album, right); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	page, err := h.invitations.List(ctx, repository.InvitationFilter{AlbumID: &albumID, Status: status}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve invitations", err)
+		return
+	}
+
+	respondWithPage(c, "Invitations retrieved successfully", query, page)
+}
+
+// membership returns the album and the invitation of the user in the path, once the acting user is allowed to
+// manage them: managers of the album can, and so can members about themselves except to change their role
+func (h *InvitationHandler) membership(c *gin.Context, ctx context.Context) (models.Album, models.AlbumInvitation, error) {
+	albumID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		return models.Album{}, models.AlbumInvitation{}, apperror.InvalidID("album")
+	}
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		return models.Album{}, models.AlbumInvitation{}, apperror.InvalidID("user")
+	}
+
+	album, err := h.albums.Get(ctx, albumID)
+	if err != nil {
+		return album, models.AlbumInvitation{}, fromRepository(err, "album", "Failed to retrieve album")
+	}
+
+	actingID, _, err := actingUser(c)
+	if err != nil {
+		return album, models.AlbumInvitation{}, err
+	}
+	leaving := actingID == userID && c.Request.Method == http.MethodDelete
+	if !leaving {
+		if err := authorizeAlbum(c, ctx, h.invitations, album, rightManage); err != nil {
+			return album, models.AlbumInvitation{}, err
+		}
+	}
+
+	invitation, err := h.invitations.GetByAlbumAndUser(ctx, albumID, userID)
+	if err != nil {
+		return album, invitation, fromRepository(err, "member", "Failed to retrieve member")
+	}
+	return album, invitation, nil
+}
+
+// errInvitationExists answers invitations of users who were already invited and did not answer yet
+var errInvitationExists = apperror.Conflict("invitation_exists", "User already has a pending invitation to the album")
+
+// syncAlbumMembers copies the users who accepted an invitation to the album into its TargetUserIDs,
+// which the shared albums are looked up by
+func syncAlbumMembers(ctx context.Context, albums repository.AlbumRepository, invitations repository.InvitationRepository, album models.Album) error {
+	memberIDs, err := invitations.MemberIDs(ctx, album.ID)
+	if err != nil {
+		return err
+	}
+	return albums.Update(ctx, album.ID, repository.Fields{
+		"target_user_ids": memberIDs,
+		"updated_at":      versioning.NextUpdatedAt(album.UpdatedAt),
+	})
+}
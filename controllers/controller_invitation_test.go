@@ -0,0 +1,140 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+)
+
+func TestInviteToAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, inviteeID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	path := "/api/albums/" + album.ID.Hex() + "/invitations"
+
+	invitation := data[models.AlbumInvitation](api.request(http.MethodPost, path, ownerID, `{"Invitee":"bob@example.com","Role":"viewer"}`).
+		expect(http.StatusCreated))
+	if invitation.UserID.Hex() != inviteeID || invitation.InvitedByID.Hex() != ownerID || invitation.Status != models.InvitationPending {
+		t.Errorf("invitation = %+v", invitation)
+	}
+
+	api.request(http.MethodPost, path, ownerID, `{"Invitee":"bob","Role":"contributor"}`).expectProblem(http.StatusConflict, "invitation_exists")
+	api.request(http.MethodPost, path, ownerID, `{"Invitee":"alice","Role":"viewer"}`).expectProblem(http.StatusConflict, "already_member")
+	api.request(http.MethodPost, path, ownerID, `{"Invitee":"nobody","Role":"viewer"}`).expectProblem(http.StatusNotFound, "user_not_found")
+	api.request(http.MethodPost, path, ownerID, `{"Invitee":"carol","Role":"owner"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, strangerID, `{"Invitee":"carol","Role":"viewer"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", `{"Invitee":"carol","Role":"viewer"}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+
+	// a declined invitation is sent again
+	api.request(http.MethodPost, "/api/invitations/"+invitation.ID.Hex()+"/decline", inviteeID, "").expect(http.StatusOK)
+	again := data[models.AlbumInvitation](api.request(http.MethodPost, path, ownerID, `{"Invitee":"bob","Role":"contributor"}`).expect(http.StatusCreated))
+	if again.ID != invitation.ID || again.Status != models.InvitationPending || again.Role != models.RoleContributor {
+		t.Errorf("invitation sent again = %+v", again)
+	}
+	api.request(http.MethodPost, "/api/invitations/"+invitation.ID.Hex()+"/accept", inviteeID, "").expect(http.StatusOK)
+	api.request(http.MethodPost, path, ownerID, `{"Invitee":"bob","Role":"viewer"}`).expectProblem(http.StatusConflict, "already_member")
+}
+
+func TestAnswerInvitation(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, inviteeID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	invitation := data[models.AlbumInvitation](api.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/invitations", ownerID,
+		`{"Invitee":"bob","Role":"viewer"}`).expect(http.StatusCreated))
+	accept := "/api/invitations/" + invitation.ID.Hex() + "/accept"
+
+	received := data[[]models.AlbumInvitation](api.request(http.MethodGet, "/api/invitations/?status=pending", inviteeID, "").expect(http.StatusOK))
+	if len(received) != 1 || received[0].ID != invitation.ID {
+		t.Errorf("received invitations = %+v", received)
+	}
+
+	// the invitations of other users are not disclosed
+	api.request(http.MethodPost, accept, strangerID, "").expectProblem(http.StatusNotFound, "invitation_not_found")
+	api.request(http.MethodPost, accept, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), inviteeID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+
+	accepted := data[models.AlbumInvitation](api.request(http.MethodPost, accept, inviteeID, "").expect(http.StatusOK))
+	if accepted.Status != models.InvitationAccepted || accepted.RespondedAt.IsZero() {
+		t.Errorf("accepted invitation = %+v", accepted)
+	}
+	api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), inviteeID, "").expect(http.StatusOK)
+	api.request(http.MethodPost, "/api/invitations/"+invitation.ID.Hex()+"/decline", inviteeID, "").
+		expectProblem(http.StatusConflict, "invitation_not_pending")
+	api.request(http.MethodPost, "/api/invitations/nope/accept", inviteeID, "").expectProblem(http.StatusBadRequest, "invalid_invitation_id")
+}
+
+func TestAlbumInvitationsAndMembers(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, viewerID, invitedID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol"), api.createUser("dave")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, viewerID, "bob", models.RoleViewer)
+	api.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/invitations", ownerID, `{"Invitee":"carol","Role":"viewer"}`).expect(http.StatusCreated)
+
+	invitations := "/api/albums/" + album.ID.Hex() + "/invitations"
+	if all := data[[]models.AlbumInvitation](api.request(http.MethodGet, invitations, ownerID, "").expect(http.StatusOK)); len(all) != 2 {
+		t.Errorf("%d invitations, want 2", len(all))
+	}
+	pending := data[[]models.AlbumInvitation](api.request(http.MethodGet, invitations+"?status=pending", ownerID, "").expect(http.StatusOK))
+	if len(pending) != 1 || pending[0].UserID.Hex() != invitedID {
+		t.Errorf("pending invitations = %+v", pending)
+	}
+	api.request(http.MethodGet, invitations, viewerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+
+	members := "/api/albums/" + album.ID.Hex() + "/members"
+	if list := data[[]models.AlbumInvitation](api.request(http.MethodGet, members, viewerID, "").expect(http.StatusOK)); len(list) != 1 || list[0].UserID.Hex() != viewerID {
+		t.Errorf("members = %+v", list)
+	}
+	api.request(http.MethodGet, members, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, members, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, memberID, invitedID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, memberID, "bob", models.RoleViewer)
+	api.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/invitations", ownerID, `{"Invitee":"carol","Role":"viewer"}`).expect(http.StatusCreated)
+	member := "/api/albums/" + album.ID.Hex() + "/members/" + memberID
+
+	// members cannot promote themselves
+	api.request(http.MethodPut, member, memberID, `{"Role":"co_owner"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	updated := data[models.AlbumInvitation](api.request(http.MethodPut, member, ownerID, `{"Role":"co_owner"}`).expect(http.StatusOK))
+	if updated.Role != models.RoleCoOwner {
+		t.Errorf("role = %s, want co_owner", updated.Role)
+	}
+	// the promoted member now manages the album
+	api.request(http.MethodGet, "/api/albums/"+album.ID.Hex()+"/invitations", memberID, "").expect(http.StatusOK)
+
+	api.request(http.MethodPut, "/api/albums/"+album.ID.Hex()+"/members/"+invitedID, ownerID, `{"Role":"contributor"}`).
+		expectProblem(http.StatusNotFound, "member_not_found")
+	api.request(http.MethodPut, member, ownerID, `{"Role":"owner"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPut, "/api/albums/"+album.ID.Hex()+"/members/nope", ownerID, `{"Role":"viewer"}`).
+		expectProblem(http.StatusBadRequest, "invalid_user_id")
+}
+
+func TestRemoveMember(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, leavingID, removedID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, leavingID, "bob", models.RoleViewer)
+	api.share(album, removedID, "carol", models.RoleViewer)
+	members := "/api/albums/" + album.ID.Hex() + "/members/"
+
+	// members may leave but not remove others
+	api.request(http.MethodDelete, members+removedID, leavingID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodDelete, members+leavingID, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodDelete, members+leavingID, leavingID, "").expect(http.StatusOK)
+	api.request(http.MethodDelete, members+removedID, ownerID, "").expect(http.StatusOK)
+
+	for _, userID := range []string{leavingID, removedID} {
+		api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), userID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	}
+	if stored := data[models.Album](api.request(http.MethodGet, "/api/albums/"+album.ID.Hex(), ownerID, "").expect(http.StatusOK)); len(stored.TargetUserIDs) != 0 {
+		t.Errorf("members %v kept in the album", stored.TargetUserIDs)
+	}
+	api.request(http.MethodDelete, members+removedID, ownerID, "").expectProblem(http.StatusConflict, "invitation_not_active")
+	api.request(http.MethodDelete, members+primitive.NewObjectID().Hex(), ownerID, "").expectProblem(http.StatusNotFound, "member_not_found")
+}
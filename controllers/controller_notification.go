@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// NotificationHandler serves the notifications of the acting user
+type NotificationHandler struct {
+	notifications repository.NotificationRepository
+}
+
+// NewNotificationHandler returns a NotificationHandler using the given repository
+func NewNotificationHandler(notifications repository.NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications}
+}
+
+// GetMyNotifications godoc
+// @Summary List the notifications of the acting user
+// @Description Fetches a page of the notifications of the acting user, the most recent first
+// @Tags notifications
+// @Produce json
+// @Param X-User-ID header string true "Acting user"
+// @Param unread query bool false "Only the notifications not read yet"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /notifications [get]
+func (h *NotificationHandler) GetMyNotifications(c *gin.Context) {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	unreadOnly, err := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "unread must be a boolean"))
+		return
+	}
+
+	query, err := parsePageQuery(c, notificationListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	page, err := h.notifications.List(ctx, repository.NotificationFilter{UserID: userID, UnreadOnly: unreadOnly}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve notifications", err)
+		return
+	}
+
+	respondWithPage(c, "Notifications retrieved successfully", query, page)
+}
+
+// MarkNotificationRead godoc
+// @Summary Mark a notification as read
+// @Description Marks a notification of the acting user as read, reading it again keeps the first read time
+// @Tags notifications
+// @Produce json
+// @Param X-User-ID header string true "Acting user"
+// @Param notificationId path string true "Notification ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /notifications/{notificationId}/read [post]
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	userID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	notificationID, err := primitive.ObjectIDFromHex(c.Param("notificationId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("notification"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	notification, err := h.notifications.Get(ctx, notificationID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "notification", "Failed to retrieve notification"))
+		return
+	}
+	// Notifications of other users are not disclosed
+	if notification.UserID != userID {
+		apperror.Abort(c, apperror.NotFound("notification"))
+		return
+	}
+
+	if notification.ReadAt.IsZero() {
+		notification.ReadAt = time.Now()
+		if err := h.notifications.Update(ctx, notificationID, repository.Fields{"read_at": notification.ReadAt}); err != nil {
+			apperror.Abort(c, fromRepository(err, "notification", "Failed to update notification"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read", "data": notification})
+}
+
+// notify records a notification, failing to do so is logged but does not fail the action it is about
+func notify(ctx context.Context, notifications repository.NotificationRepository, notification models.Notification) {
+	notification.ID = primitive.NewObjectID()
+	notification.CreatedAt = time.Now()
+
+	if err := notifications.Create(ctx, &notification); err != nil {
+		slog.ErrorContext(ctx, "Failed to record notification", "type", notification.Type,
+			"user_id", notification.UserID.Hex(), "error", err)
+	}
+}
@@ -0,0 +1,54 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+)
+
+func TestNotifications(t *testing.T) {
+	api := newTestAPI(t)
+	gifterID, recipientID := api.createUser("alice"), api.createUser("bob")
+	first, second := api.createFrame(gifterID), api.createFrame(gifterID)
+	for _, frame := range []models.SmartFrame{first, second} {
+		api.request(http.MethodPost, "/api/smart-frames/claim", recipientID, `{"ClaimToken":"`+api.giftFrame(frame)+`"}`).expect(http.StatusOK)
+	}
+
+	page := api.request(http.MethodGet, "/api/notifications/?limit=1", gifterID, "").expect(http.StatusOK)
+	notifications := data[[]models.Notification](page)
+	if len(notifications) != 1 || notifications[0].FrameID != second.ID || notifications[0].Type != models.NotificationFrameClaimed ||
+		notifications[0].ActorID.Hex() != recipientID || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the claim of the second frame and more", page.Body.String())
+	}
+	if others := data[[]models.Notification](api.request(http.MethodGet, "/api/notifications/", recipientID, "").expect(http.StatusOK)); len(others) != 0 {
+		t.Errorf("notifications of the recipient = %+v", others)
+	}
+
+	read := "/api/notifications/" + notifications[0].ID.Hex() + "/read"
+	// the notifications of other users are not disclosed
+	api.request(http.MethodPost, read, recipientID, "").expectProblem(http.StatusNotFound, "notification_not_found")
+	marked := data[models.Notification](api.request(http.MethodPost, read, gifterID, "").expect(http.StatusOK))
+	if marked.ReadAt.IsZero() {
+		t.Error("notification not marked as read")
+	}
+	// marking it again keeps the first reading time, as stored to the millisecond
+	if again := data[models.Notification](api.request(http.MethodPost, read, gifterID, "").expect(http.StatusOK)); !again.ReadAt.Equal(marked.ReadAt.Truncate(time.Millisecond)) {
+		t.Errorf("read at %v, want %v", again.ReadAt, marked.ReadAt)
+	}
+
+	unread := data[[]models.Notification](api.request(http.MethodGet, "/api/notifications/?unread=true", gifterID, "").expect(http.StatusOK))
+	if len(unread) != 1 || unread[0].FrameID != first.ID {
+		t.Errorf("unread notifications = %+v, want the claim of the first frame", unread)
+	}
+
+	api.request(http.MethodGet, "/api/notifications/?unread=maybe", gifterID, "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodGet, "/api/notifications/?sort=nope", gifterID, "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+	api.request(http.MethodGet, "/api/notifications/", "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPost, "/api/notifications/nope/read", gifterID, "").expectProblem(http.StatusBadRequest, "invalid_notification_id")
+	api.request(http.MethodPost, "/api/notifications/"+primitive.NewObjectID().Hex()+"/read", gifterID, "").
+		expectProblem(http.StatusNotFound, "notification_not_found")
+}
@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/recognition"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+// MergePeopleRequest is the body of a merge of people into another
+type MergePeopleRequest struct {
+	PersonIDs []primitive.ObjectID `binding:"required,min=1,max=100"` // People whose faces join the person, then deleted
+}
+
+// SplitPersonRequest is the body of a split of faces off a person
+type SplitPersonRequest struct {
+	FaceIDs []primitive.ObjectID `binding:"required,min=1,max=1000"` // Faces moved into the new person
+	Name    string               `binding:"max=100"`                 // Name of the new person
+}
+
+// PeopleHandler serves the people the recognized faces of the pictures are grouped into
+type PeopleHandler struct {
+	people   repository.PersonRepository
+	faces    repository.FaceRepository
+	pictures repository.PictureRepository
+	grouping *recognition.People
+}
+
+// NewPeopleHandler returns a PeopleHandler using the given repositories, changing the people through grouping
+func NewPeopleHandler(
+	people repository.PersonRepository,
+	faces repository.FaceRepository,
+	pictures repository.PictureRepository,
+	grouping *recognition.People,
+) *PeopleHandler {
+	return &PeopleHandler{people: people, faces: faces, pictures: pictures, grouping: grouping}
+}
+
+// GetMyPeople godoc
+// @Summary List my people
+// @Description Fetches a page of the people recognized in the pictures the acting user uploaded, the ones showing up the most first
+// @Tags people
+// @Produce json
+// @Param X-User-ID header string true "Acting user"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, name, face_count, updated_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people [get]
+func (h *PeopleHandler) GetMyPeople(c *gin.Context) {
+	ownerID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	query, err := parsePageQuery(c, personListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	page, err := h.people.List(ctx, repository.PersonFilter{OwnerID: &ownerID}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve people", err)
+		return
+	}
+
+	respondWithPage(c, "People retrieved successfully", query, page)
+}
+
+// GetPerson godoc
+// @Summary Get a person
+// @Description Get a person recognized in the pictures of the acting user
+// @Tags people
+// @Produce json
+// @Param X-User-ID header string true "Acting user, whose pictures show the person"
+// @Param personId path string true "Person ID"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the person"
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people/{personId} [get]
+func (h *PeopleHandler) GetPerson(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	person, err := h.ownedPerson(c, ctx, c.Param("personId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	setETag(c, person.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Person retrieved successfully", "data": person})
+}
+
+// PatchPerson godoc
+// @Summary Name a person
+// @Description Applies a JSON Merge Patch (RFC 7396) to the person, only its Name may be changed. The name is given to the faces of the person too. With If-Match, the patch is only applied to the given version.
+// @Tags people
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, whose pictures show the person"
+// @Param If-Match header string false "ETag of the version the patch applies to"
+// @Param personId path string true "Person ID"
+// @Param patch body object true "Merge patch, a null Name removes the name"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the updated person"
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 415 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people/{personId} [patch]
+func (h *PeopleHandler) PatchPerson(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	person, err := h.ownedPerson(c, ctx, c.Param("personId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if err := checkIfMatch(c, person.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	patched, fields, err := applyMergePatch(c, person, personPatchSpec)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	patched.UpdatedAt = versioning.NextUpdatedAt(person.UpdatedAt)
+	fields["updated_at"] = patched.UpdatedAt
+
+	if err := h.people.UpdateIfUnmodified(ctx, person.ID, person.UpdatedAt, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "person", "Failed to update person"))
+		return
+	}
+	if err := h.grouping.Rename(ctx, patched); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to name the faces of the person", err))
+		return
+	}
+
+	setETag(c, patched.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Person updated successfully", "data": patched})
+}
+
+// MergePeople godoc
+// @Summary Merge people
+// @Description Moves the faces of the given people into the person and deletes them, for people recognized as different who are the same. The person keeps its name, or takes the first name of the merged people when it has none.
+// @Tags people
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, whose pictures show the people"
+// @Param personId path string true "Person ID"
+// @Param merge body MergePeopleRequest true "People to merge into the person"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people/{personId}/merge [post]
+func (h *PeopleHandler) MergePeople(c *gin.Context) {
+	var request MergePeopleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	person, err := h.ownedPerson(c, ctx, c.Param("personId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var others []models.Person
+	for _, otherID := range request.PersonIDs {
+		if otherID == person.ID {
+			apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "A person can't be merged into itself"))
+			return
+		}
+		if slices.ContainsFunc(others, func(other models.Person) bool { return other.ID == otherID }) {
+			continue
+		}
+		other, err := h.ownedPerson(c, ctx, otherID.Hex())
+		if err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		others = append(others, other)
+	}
+
+	person, err = h.grouping.Merge(ctx, person, others)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "person", "Failed to merge people"))
+		return
+	}
+
+	setETag(c, person.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "People merged successfully", "data": person})
+}
+
+// SplitPerson godoc
+// @Summary Split a person
+// @Description Moves some faces of the person into a new person, for faces of someone else grouped into it. The person must keep at least one face.
+// @Tags people
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, whose pictures show the person"
+// @Param personId path string true "Person ID"
+// @Param split body SplitPersonRequest true "Faces to move into the new person"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people/{personId}/split [post]
+func (h *PeopleHandler) SplitPerson(c *gin.Context) {
+	var request SplitPersonRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	person, err := h.ownedPerson(c, ctx, c.Param("personId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	split, err := h.grouping.Split(ctx, person, request.FaceIDs, request.Name)
+	switch {
+	case errors.Is(err, recognition.ErrFaceNotInPerson):
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "Every face must be one of the person"))
+		return
+	case errors.Is(err, recognition.ErrNoFaceLeft):
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "The person must keep at least one face"))
+		return
+	case err != nil:
+		apperror.Abort(c, apperror.Internal("Failed to split person", err))
+		return
+	}
+
+	setETag(c, split.UpdatedAt)
+	c.JSON(http.StatusCreated, gin.H{"message": "Person split successfully", "data": split})
+}
+
+// GetPersonFaces godoc
+// @Summary List the faces of a person
+// @Description Fetches a page of the faces grouped into the person, with the picture they were found in
+// @Tags people
+// @Produce json
+// @Param X-User-ID header string true "Acting user, whose pictures show the person"
+// @Param personId path string true "Person ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, confidence, recognized_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people/{personId}/faces [get]
+func (h *PeopleHandler) GetPersonFaces(c *gin.Context) {
+	query, err := parsePageQuery(c, faceListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	person, err := h.ownedPerson(c, ctx, c.Param("personId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	page, err := h.faces.List(ctx, repository.FaceFilter{PersonIDs: []primitive.ObjectID{person.ID}}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve faces", err)
+		return
+	}
+
+	respondWithPage(c, "Faces retrieved successfully", query, page)
+}
+
+// GetPersonPictures godoc
+// @Summary List the pictures of a person
+// @Description Fetches a page of the pictures showing the person
+// @Tags people
+// @Produce json
+// @Param X-User-ID header string true "Acting user, whose pictures show the person"
+// @Param personId path string true "Person ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, uploaded_at, taken_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /people/{personId}/pictures [get]
+func (h *PeopleHandler) GetPersonPictures(c *gin.Context) {
+	query, err := parsePageQuery(c, pictureListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	person, err := h.ownedPerson(c, ctx, c.Param("personId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	pictureIDs, err := h.faces.PictureIDs(ctx, repository.FaceFilter{PersonIDs: []primitive.ObjectID{person.ID}})
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve the faces of the person", err))
+		return
+	}
+
+	page, err := h.pictures.List(ctx, repository.PictureFilter{IDs: nonNil(pictureIDs)}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve pictures", err)
+		return
+	}
+
+	respondWithPage(c, "Pictures retrieved successfully", query, page)
+}
+
+// ownedPerson returns the person with the given ID once checked that the acting user owns it
+func (h *PeopleHandler) ownedPerson(c *gin.Context, ctx context.Context, id string) (models.Person, error) {
+	ownerID, err := requireActingUser(c)
+	if err != nil {
+		return models.Person{}, err
+	}
+
+	personID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.Person{}, apperror.InvalidID("person")
+	}
+
+	person, err := h.people.Get(ctx, personID)
+	if err != nil {
+		return person, fromRepository(err, "person", "Failed to retrieve person")
+	}
+	if person.OwnerID != ownerID {
+		return person, apperror.Forbidden("Not allowed to manage this person")
+	}
+	return person, nil
+}
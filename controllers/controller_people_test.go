@@ -0,0 +1,135 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/recognition"
+)
+
+// sequenceRecognizer finds one face in every image, described by the next of its embeddings
+type sequenceRecognizer struct {
+	mu         sync.Mutex
+	embeddings [][]float64
+}
+
+func (r *sequenceRecognizer) Detect(ctx context.Context, image []byte) ([]recognition.Detection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	embedding := r.embeddings[0]
+	r.embeddings = append(r.embeddings[1:], embedding)
+	return []recognition.Detection{{Box: models.BoundingBox{Width: 0.5, Height: 0.5}, Confidence: 0.9, Embedding: embedding}}, nil
+}
+
+// newPeopleTestAPI returns a test API where owner uploaded three pictures, the first two of a same person
+// and the third of another one, returned in that order
+func newPeopleTestAPI(t *testing.T) (api *testAPI, ownerID string, people []models.Person) {
+	api = newTestAPIWithRecognizer(t, &sequenceRecognizer{embeddings: [][]float64{{1, 0, 0}, {1, 0.1, 0}, {0, 1, 0}}})
+	ownerID = api.createUser("alice")
+	album := api.createAlbum(ownerID, true)
+	for range 3 {
+		api.recognize(api.uploadPicture(album.ID.Hex(), ownerID).ID)
+	}
+
+	people = data[[]models.Person](api.request(http.MethodGet, "/api/people/?sort=-face_count", ownerID, "").expect(http.StatusOK))
+	if len(people) != 2 || people[0].FaceCount != 2 || people[1].FaceCount != 1 {
+		t.Fatalf("people = %+v, want a person with two faces and one with a face", people)
+	}
+	return api, ownerID, people
+}
+
+func TestGetPeople(t *testing.T) {
+	api, ownerID, people := newPeopleTestAPI(t)
+	strangerID := api.createUser("bob")
+
+	if others := data[[]models.Person](api.request(http.MethodGet, "/api/people/", strangerID, "").expect(http.StatusOK)); len(others) != 0 {
+		t.Errorf("people of another user = %+v", others)
+	}
+	api.request(http.MethodGet, "/api/people/", "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+
+	path := "/api/people/" + people[0].ID.Hex()
+	r := api.request(http.MethodGet, path, ownerID, "").expect(http.StatusOK)
+	if person := data[models.Person](r); person.ID != people[0].ID || r.Header().Get("ETag") == "" {
+		t.Errorf("person = %s, want %s with its ETag", r.Body.String(), people[0].ID.Hex())
+	}
+	api.request(http.MethodGet, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, "/api/people/nope", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_person_id")
+	api.request(http.MethodGet, "/api/people/"+primitive.NewObjectID().Hex(), ownerID, "").expectProblem(http.StatusNotFound, "person_not_found")
+}
+
+func TestGetPersonFacesAndPictures(t *testing.T) {
+	api, ownerID, people := newPeopleTestAPI(t)
+	path := "/api/people/" + people[0].ID.Hex()
+
+	faces := data[[]models.RecognizedFace](api.request(http.MethodGet, path+"/faces", ownerID, "").expect(http.StatusOK))
+	if len(faces) != 2 || faces[0].PersonID != people[0].ID {
+		t.Errorf("faces = %+v, want the two faces of the person", faces)
+	}
+	pictures := data[[]models.Picture](api.request(http.MethodGet, path+"/pictures", ownerID, "").expect(http.StatusOK))
+	if len(pictures) != 2 || pictures[0].ID != faces[0].PictureID && pictures[0].ID != faces[1].PictureID {
+		t.Errorf("pictures = %+v, want the pictures of the faces", pictures)
+	}
+
+	api.request(http.MethodGet, path+"/faces", api.createUser("bob"), "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, path+"/pictures?limit=x", ownerID, "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+}
+
+func TestPatchPerson(t *testing.T) {
+	api, ownerID, people := newPeopleTestAPI(t)
+	path := "/api/people/" + people[0].ID.Hex()
+	etag := api.request(http.MethodGet, path, ownerID, "").expect(http.StatusOK).Header().Get("ETag")
+
+	person := data[models.Person](api.request(http.MethodPatch, path, ownerID, `{"Name":"Grandma"}`, "If-Match", etag).expect(http.StatusOK))
+	if person.Name != "Grandma" {
+		t.Errorf("name = %q, want Grandma", person.Name)
+	}
+	// the faces are named after their person
+	for _, face := range data[[]models.RecognizedFace](api.request(http.MethodGet, path+"/faces", ownerID, "").expect(http.StatusOK)) {
+		if face.Name != "Grandma" {
+			t.Errorf("face %s named %q, want Grandma", face.ID.Hex(), face.Name)
+		}
+	}
+
+	api.request(http.MethodPatch, path, ownerID, `{"Name":"Granny"}`, "If-Match", etag).expectProblem(http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+	api.request(http.MethodPatch, path, ownerID, `{"FaceCount":0}`).expectProblem(http.StatusBadRequest, apperror.CodeImmutableField)
+	api.request(http.MethodPatch, path, api.createUser("bob"), `{"Name":"Mine"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+}
+
+func TestMergePeople(t *testing.T) {
+	api, ownerID, people := newPeopleTestAPI(t)
+	path := "/api/people/" + people[0].ID.Hex() + "/merge"
+
+	api.request(http.MethodPost, path, ownerID, `{"PersonIDs":["`+people[0].ID.Hex()+`"]}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, ownerID, `{"PersonIDs":[]}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, ownerID, `{"PersonIDs":["`+primitive.NewObjectID().Hex()+`"]}`).expectProblem(http.StatusNotFound, "person_not_found")
+
+	merged := data[models.Person](api.request(http.MethodPost, path, ownerID, `{"PersonIDs":["`+people[1].ID.Hex()+`"]}`).expect(http.StatusOK))
+	if merged.ID != people[0].ID || merged.FaceCount != 3 {
+		t.Errorf("merged person = %+v, want the three faces", merged)
+	}
+	api.request(http.MethodGet, "/api/people/"+people[1].ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "person_not_found")
+}
+
+func TestSplitPerson(t *testing.T) {
+	api, ownerID, people := newPeopleTestAPI(t)
+	path := "/api/people/" + people[0].ID.Hex()
+	faces := data[[]models.RecognizedFace](api.request(http.MethodGet, path+"/faces", ownerID, "").expect(http.StatusOK))
+
+	split := data[models.Person](api.request(http.MethodPost, path+"/split", ownerID, `{"FaceIDs":["`+faces[1].ID.Hex()+`"],"Name":"Grandpa"}`).
+		expect(http.StatusCreated))
+	if split.ID == people[0].ID || split.Name != "Grandpa" || split.FaceCount != 1 {
+		t.Errorf("split person = %+v", split)
+	}
+	if person := data[models.Person](api.request(http.MethodGet, path, ownerID, "").expect(http.StatusOK)); person.FaceCount != 1 {
+		t.Errorf("person kept %d faces, want 1", person.FaceCount)
+	}
+
+	api.request(http.MethodPost, path+"/split", ownerID, `{"FaceIDs":["`+faces[0].ID.Hex()+`"]}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path+"/split", ownerID, `{"FaceIDs":["`+faces[1].ID.Hex()+`"]}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path+"/split", "", `{"FaceIDs":["`+faces[0].ID.Hex()+`"]}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
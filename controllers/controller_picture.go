@@ -3,17 +3,21 @@ package controllers
 import (
 	"context"
 	"errors"
-	"log"
-	"mirage-backend/controllers/dbutils"
+	"fmt"
+	"log/slog"
+	"mirage-backend/events"
+	"mirage-backend/recognition"
+	"mirage-backend/repository"
 	"mirage-backend/utils"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"mirage-backend/database"
+	"mirage-backend/apperror"
 	"mirage-backend/models"
 )
 
@@ -21,28 +25,88 @@ const timeoutDuration = 10 * time.Second
 
 const CompressionQuality = 80
 
+// Limits of the tags of a picture
+const (
+	maxPictureTags = 20
+	maxTagLength   = 50
+)
+
+// PictureHandler serves the picture endpoints
+type PictureHandler struct {
+	pictures    repository.PictureRepository
+	albums      repository.AlbumRepository
+	blobs       repository.BlobRepository
+	invitations repository.InvitationRepository
+	frames      repository.FrameRepository
+	faces       repository.FaceRepository
+	people      *recognition.People
+	events      *events.Broker
+	recognition *recognition.Pipeline
+}
+
+// NewPictureHandler returns a PictureHandler using the given repositories, telling the frames about new pictures
+// and queueing them for face recognition
+func NewPictureHandler(
+	pictures repository.PictureRepository,
+	albums repository.AlbumRepository,
+	blobs repository.BlobRepository,
+	invitations repository.InvitationRepository,
+	frames repository.FrameRepository,
+	faces repository.FaceRepository,
+	people *recognition.People,
+	broker *events.Broker,
+	pipeline *recognition.Pipeline,
+) *PictureHandler {
+	return &PictureHandler{
+		pictures:    pictures,
+		albums:      albums,
+		blobs:       blobs,
+		invitations: invitations,
+		frames:      frames,
+		faces:       faces,
+		people:      people,
+		events:      broker,
+		recognition: pipeline,
+	}
+}
+
 // UploadPicture godoc
 // @Summary Upload a picture
-// @Description Uploads a picture to the database
+// @Description Uploads a picture to the database, into an album when the acting user may upload to it
 // @Tags pictures
 // @Accept multipart/form-data
 // @Produce json
+// @Param X-User-ID header string false "Acting user, recorded as the uploader"
 // @Param file formData file true "Picture file"
+// @Param taken_at formData string false "When the picture was taken (RFC 3339), the upload time by default"
+// @Param tags formData string false "Comma-separated tags"
+// @Param latitude formData number false "Latitude where the picture was taken, given with longitude"
+// @Param longitude formData number false "Longitude where the picture was taken, given with latitude"
 // @Param albumId path string false "Album ID"
 // @Success 201 {object} models.Picture
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user for an album upload"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem "Smart album"
+// @Failure 500 {object} apperror.Problem
 // @Router /pictures [post]
 // @Router /albums/{albumId}/pictures [post]
-func UploadPicture(c *gin.Context) {
+func (h *PictureHandler) UploadPicture(c *gin.Context) {
 	// Set context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
 	defer cancel()
 
 	// Ensure multipart/form-data is used
 	contentType := c.ContentType()
 	if contentType != "multipart/form-data" {
-		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be multipart/form-data"})
+		apperror.Abort(c, errNotMultipart)
+		return
+	}
+
+	uploaderID, _, err := actingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
@@ -53,43 +117,55 @@ func UploadPicture(c *gin.Context) {
 		var err error
 		albumObjectID, err = primitive.ObjectIDFromHex(albumId)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+			apperror.Abort(c, apperror.InvalidID("album"))
+			return
+		}
+
+		// check if album exists and the acting user may upload to it
+		album, err := h.albums.Get(ctx, albumObjectID)
+		if err != nil {
+			apperror.Abort(c, fromRepository(err, "album", "Failed to check if album exists in the database"))
+			return
+		}
+		if err := authorizeAlbum(c, ctx, h.invitations, album, rightUpload); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		if album.Criteria != nil {
+			apperror.Abort(c, errSmartAlbum)
 			return
 		}
 	}
 
-	// check if album exists
-	albumExists, err := dbutils.CheckIfItemExists(c, database.AlbumCollection, albumObjectID)
-	if !albumExists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	metadata, err := pictureMetadataFromForm(c)
+	if err != nil {
+		apperror.Abort(c, err)
 		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if album exists in the database"})
 	}
 
 	//// for the future
-	//userExists, err := dbutils.CheckIfItemExists(c, userCollection, userObjectID)
+	//userExists, err := h.users.Exists(ctx, userObjectID)
 	//if !userExists {
-	//	c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	//	apperror.Abort(c, apperror.NotFound("user"))
 	//	return
 	//} else if err != nil {
-	//	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if user exists"})
+	//	apperror.Abort(c, apperror.Internal("Failed to check if user exists", err))
 	//	return
 	//}
 
 	// Get the file from the request
-	fileBytes, readErr := utils.RetrieveImageFromHTTPForm(c, "file")
-	if readErr {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file"})
+	fileBytes, err := utils.RetrieveImageFromHTTPForm(c, "file")
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
 	//log.Printf("Decoded image format: %s", format)
 
 	// Resize and compress the image
-	compressedImage, compressErr := utils.ScaleAndConvertToWebPBytes(fileBytes, CompressionQuality)
+	compressedImage, compressErr := utils.ScaleAndConvertToWebPBytes(ctx, fileBytes, CompressionQuality)
 	if compressErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image", "details": compressErr.Error()})
+		apperror.Abort(c, apperror.Internal("Failed to process image", compressErr))
 		return
 	}
 
@@ -98,18 +174,27 @@ func UploadPicture(c *gin.Context) {
 		ID:         primitive.NewObjectID(),
 		UploadedAt: time.Now(),
 		AlbumID:    albumObjectID,
+		UserID:     uploaderID,
+		TakenAt:    metadata.TakenAt,
+		Tags:       metadata.Tags,
+		Location:   metadata.Location,
+	}
+	if picture.TakenAt.IsZero() {
+		picture.TakenAt = picture.UploadedAt
 	}
 
 	// Insert the picture into the database
-	pictureAdded, err :=
-		dbutils.AddPictureToDB(ctx, compressedImage, database.PictureDataCollection, database.PictureCollection, picture)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading profile picture to the database"})
+	if err := storePicture(ctx, h.blobs, h.pictures, compressedImage, &picture); err != nil {
+		apperror.Abort(c, apperror.Internal("Error uploading picture to the database", err))
 		return
 	}
-	if !pictureAdded {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload profile picture to the database"})
-		return
+
+	// Pictures that don't fit in the queue are picked up when the recognition of their album is run
+	h.recognition.Enqueue(picture.ID)
+
+	if !albumObjectID.IsZero() {
+		publishToAlbumFrames(ctx, h.frames, h.events, albumObjectID, events.TypePictureAdded,
+			events.PictureAdded{AlbumID: albumObjectID, PictureID: picture.ID})
 	}
 
 	// Return success response
@@ -121,126 +206,127 @@ func UploadPicture(c *gin.Context) {
 
 // GetPictureData godoc
 // @Summary Get picture data
-// @Description Retrieves the raw image data of a specific picture
+// @Description Retrieves the raw image data of a specific picture, the ones of a private album only for its members and their uploader
 // @Tags pictures
 // @Accept json
 // @Produce image/webp
+// @Param X-User-ID header string false "Acting user"
 // @Param pictureId path string true "Picture ID"
 // @Success 200 {string} string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user for a picture of a private album"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /pictures/{pictureId}/data [get]
-func GetPictureData(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (h *PictureHandler) GetPictureData(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	pictureID := c.Param("pictureId")
 	pictureObjectID, err := primitive.ObjectIDFromHex(pictureID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picture ID"})
+		apperror.Abort(c, apperror.InvalidID("picture"))
 		return
 	}
 
 	// retrieve the picture
-	var picture models.Picture
-	if err := database.PictureCollection.FindOne(ctx, bson.M{"_id": pictureObjectID}).Decode(&picture); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Picture not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve picture", "details": err.Error()})
-		}
+	picture, err := h.pictures.Get(ctx, pictureObjectID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "picture", "Failed to retrieve picture"))
 		return
 	}
-
-	// Retrieve the picture data
-	var pictureData models.PictureData
-	if err := database.PictureDataCollection.FindOne(ctx, bson.M{"_id": picture.PictureDataID}).Decode(&pictureData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve picture data", "details": err.Error()})
+	if err := authorizePictureView(c, ctx, h.albums, h.invitations, picture); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	// fetch the image data
-
-	c.Data(http.StatusOK, "image/webp", pictureData.Data)
+	writePictureData(c, ctx, h.blobs, picture, false)
 }
 
 // GetPicturesInAlbum godoc
 // @Summary Get pictures in an album
-// @Description Retrieves all pictures in a specific album
+// @Description Retrieves a page of pictures in a specific album, private albums only to their members. The pictures of a smart album are the ones matching its criteria at the time of the request.
 // @Tags pictures
 // @Accept json
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
 // @Param albumId path string true "Album ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, uploaded_at, taken_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
 // @Success 200 {object} []models.Picture
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user for a private album"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /albums/{albumId}/pictures [get]
-func GetPicturesInAlbum(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (h *PictureHandler) GetPicturesInAlbum(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	albumID := c.Param("albumId")
 	albumObjectID, err := primitive.ObjectIDFromHex(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apperror.Abort(c, apperror.InvalidID("album"))
 		return
 	}
 
-	filter := bson.M{"album_id": albumObjectID}
-	cursor, err := database.PictureCollection.Find(ctx, filter)
+	album, err := h.albums.Get(ctx, albumObjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pictures", "details": err.Error()})
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve pictures"))
 		return
 	}
-	defer func(cursor *mongo.Cursor, ctx context.Context) {
-		err := cursor.Close(ctx)
-		if err != nil {
-			log.Fatal(err)
+	if album.IsPrivate {
+		if err := authorizeAlbum(c, ctx, h.invitations, album, rightView); err != nil {
+			apperror.Abort(c, err)
+			return
 		}
-	}(cursor, ctx)
+	}
 
-	var pictures []models.Picture
-	if err := cursor.All(ctx, &pictures); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode pictures", "details": err.Error()})
+	filter, err := albumPictureFilter(ctx, h.albums, h.faces, album)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve pictures", err))
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Pictures retrieved successfully", "data": pictures})
+	respondWithAlbumPictures(c, ctx, h.pictures, filter)
 }
 
 // GetPictureByID godoc
 // @Summary Get picture by ID
-// @Description Retrieves a specific picture by its ID
+// @Description Retrieves a specific picture by its ID, the ones of a private album only for its members and their uploader
 // @Tags pictures
 // @Accept json
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
 // @Param pictureId path string true "Picture ID"
 // @Success 200 {object} models.Picture
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user for a picture of a private album"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /pictures/{pictureId} [get]
-func GetPictureByID(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (h *PictureHandler) GetPictureByID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	pictureID := c.Param("pictureId")
 	pictureObjectID, err := primitive.ObjectIDFromHex(pictureID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picture ID"})
+		apperror.Abort(c, apperror.InvalidID("picture"))
 		return
 	}
 
-	filter := bson.M{"_id": pictureObjectID}
-	var picture models.Picture
-	if err := database.PictureCollection.FindOne(ctx, filter).Decode(&picture); err != nil {
-		if errors.Is(err, mongo.ErrNoDocuments) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Picture not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve picture", "details": err.Error()})
-		}
+	picture, err := h.pictures.Get(ctx, pictureObjectID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "picture", "Failed to retrieve picture"))
+		return
+	}
+	if err := authorizePictureView(c, ctx, h.albums, h.invitations, picture); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
@@ -249,130 +335,245 @@ func GetPictureByID(c *gin.Context) {
 
 // DeletePicture godoc
 // @Summary Delete picture by ID
-// @Description Deletes a specific picture by its ID
+// @Description Deletes a specific picture by its ID, pictures of an album only if the acting user may remove them from it, other pictures only if the acting user uploaded them
 // @Tags pictures
 // @Accept json
 // @Produce json
+// @Param X-User-ID header string true "Acting user"
 // @Param pictureId path string true "Picture ID"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /pictures/{pictureId} [delete]
-func DeletePicture(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (h *PictureHandler) DeletePicture(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	pictureID := c.Param("pictureId")
 	pictureObjectID, err := primitive.ObjectIDFromHex(pictureID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picture ID"})
+		apperror.Abort(c, apperror.InvalidID("picture"))
 		return
 	}
 
-	filter := bson.M{"_id": pictureObjectID}
-	result, err := database.PictureCollection.DeleteOne(ctx, filter)
+	picture, err := h.pictures.Get(ctx, pictureObjectID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "picture", "Failed to delete picture"))
+		return
+	}
+	// Only the uploader may delete a picture outside any album, including the ones left behind by a deleted album
+	err = authorizeUploader(c, picture)
+	if !picture.AlbumID.IsZero() {
+		album, getErr := h.albums.Get(ctx, picture.AlbumID)
+		if getErr != nil && !errors.Is(getErr, repository.ErrNotFound) {
+			apperror.Abort(c, apperror.Internal("Failed to delete picture", getErr))
+			return
+		}
+		if getErr == nil {
+			err = authorizePictureRemoval(c, ctx, h.invitations, album, picture)
+		}
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete picture", "details": err.Error()})
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Picture not found"})
+	if err := h.pictures.Delete(ctx, pictureObjectID); err != nil {
+		apperror.Abort(c, fromRepository(err, "picture", "Failed to delete picture"))
 		return
 	}
+	if err := h.people.Forget(ctx, pictureObjectID); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete the faces of the picture", "picture_id", pictureObjectID.Hex(), "error", err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Picture deleted successfully"})
 }
 
 // GetAllPictures godoc
 // @Summary Get all pictures
-// @Description Retrieves all pictures from the database
+// @Description Retrieves a page of the pictures the acting user may view: the ones of the public albums and of the albums shared with them, and the ones they uploaded
 // @Tags pictures
 // @Accept json
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, uploaded_at, taken_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
 // @Success 200 {object} []models.Picture
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /pictures [get]
-func GetAllPictures(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+func (h *PictureHandler) GetAllPictures(c *gin.Context) {
+	viewerID, _, err := actingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
 
-	cursor, err := database.PictureCollection.Find(ctx, bson.M{})
+	query, err := parsePageQuery(c, pictureListSpec)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pictures", "details": err.Error()})
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
 		return
 	}
-	defer func(cursor *mongo.Cursor, ctx context.Context) {
-		err := cursor.Close(ctx)
-		if err != nil {
-			log.Println(err)
-		}
-	}(cursor, ctx)
 
-	var pictures []models.Picture
-	if err := cursor.All(ctx, &pictures); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode pictures", "details": err.Error()})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	albumIDs, err := h.albums.IDs(ctx, repository.AlbumFilter{VisibleTo: &viewerID})
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve pictures", err))
+		return
+	}
+	visible := &repository.PictureVisibility{UploaderID: viewerID, AlbumIDs: nonNil(albumIDs)}
+	page, err := h.pictures.List(ctx, repository.PictureFilter{Visible: visible}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve pictures", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Pictures retrieved successfully", "data": pictures})
+	respondWithPage(c, "Pictures retrieved successfully", query, page)
 }
 
 // DeCouplePictureFromAlbum godoc
 // @Summary Remove picture from album
-// @Description Removes a picture's association with a specific album without deleting the picture
+// @Description Removes a picture's association with a specific album without deleting the picture; contributors may only remove the pictures they uploaded
 // @Tags pictures
 // @Accept json
 // @Produce json
+// @Param X-User-ID header string false "Acting user"
 // @Param albumId path string true "Album ID"
 // @Param pictureId path string true "Picture ID"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 409 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /albums/{albumId}/pictures/{pictureId} [delete]
-func DeCouplePictureFromAlbum(c *gin.Context) {
+func (h *PictureHandler) DeCouplePictureFromAlbum(c *gin.Context) {
 	albumID := c.Param("albumId")
 	pictureID := c.Param("pictureId")
 
 	// Validate album ID
 	albumObjectID, err := primitive.ObjectIDFromHex(albumID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album ID"})
+		apperror.Abort(c, apperror.InvalidID("album"))
 		return
 	}
 
 	// Validate picture ID
 	pictureObjectID, err := primitive.ObjectIDFromHex(pictureID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid picture ID"})
+		apperror.Abort(c, apperror.InvalidID("picture"))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
-	// Update the album to remove the picture ID from the PictureIDs list
-	filter := bson.M{"_id": albumObjectID}
-	update := bson.M{"$pull": bson.M{"pictureIds": pictureObjectID}}
+	album, err := h.albums.Get(ctx, albumObjectID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to dissociate picture from album"))
+		return
+	}
 
-	result, err := database.AlbumCollection.UpdateOne(ctx, filter, update)
+	picture, err := h.pictures.Get(ctx, pictureObjectID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to dissociate picture from album", "details": err.Error()})
+		apperror.Abort(c, fromRepository(err, "picture", "Failed to dissociate picture from album"))
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+	if picture.AlbumID != albumObjectID {
+		apperror.Abort(c, apperror.Conflict("picture_not_in_album", "Picture was not associated with the album"))
+		return
+	}
+	if err := authorizePictureRemoval(c, ctx, h.invitations, album, picture); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "Picture was not associated with the album"})
+	// The picture keeps existing, it just no longer references the album
+	update := repository.Fields{"album_id": primitive.NilObjectID}
+	if err := h.pictures.Update(ctx, pictureObjectID, update); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to dissociate picture from album", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Picture dissociated from album successfully"})
 }
+
+// respondWithAlbumPictures answers the page of the pictures of an album, selected by filter, requested by the query parameters
+func respondWithAlbumPictures(c *gin.Context, ctx context.Context, pictures repository.PictureRepository, filter repository.PictureFilter) {
+	query, err := parsePageQuery(c, pictureListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	page, err := pictures.List(ctx, filter, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve pictures", err)
+		return
+	}
+
+	respondWithPage(c, "Pictures retrieved successfully", query, page)
+}
+
+// writePictureData answers the image of the picture, as an attachment to save when download is set
+func writePictureData(c *gin.Context, ctx context.Context, blobs repository.BlobRepository, picture models.Picture, download bool) {
+	pictureData, err := blobs.Get(ctx, picture.PictureDataID)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve picture data", err))
+		return
+	}
+
+	if download {
+		c.Header("Content-Disposition", `attachment; filename="`+picture.ID.Hex()+`.webp"`)
+	}
+	c.Data(http.StatusOK, "image/webp", pictureData)
+}
+
+// pictureMetadata is what the uploader tells about a picture along with its file
+type pictureMetadata struct {
+	TakenAt  time.Time
+	Tags     []string
+	Location *models.GeoPoint
+}
+
+// pictureMetadataFromForm reads the optional taken_at, tags, latitude and longitude fields of the upload form
+func pictureMetadataFromForm(c *gin.Context) (pictureMetadata, error) {
+	var metadata pictureMetadata
+
+	if takenAt := c.PostForm("taken_at"); takenAt != "" {
+		var err error
+		if metadata.TakenAt, err = time.Parse(time.RFC3339, takenAt); err != nil {
+			return metadata, apperror.BadRequest(apperror.CodeInvalidInput, "taken_at must be an RFC 3339 date")
+		}
+	}
+
+	if tags := c.PostForm("tags"); tags != "" {
+		metadata.Tags = normalizeTags(strings.Split(tags, ","))
+		if len(metadata.Tags) > maxPictureTags || slices.ContainsFunc(metadata.Tags, func(tag string) bool { return len(tag) > maxTagLength }) {
+			return metadata, apperror.BadRequest(apperror.CodeInvalidInput,
+				fmt.Sprintf("tags must be at most %d tags of at most %d characters", maxPictureTags, maxTagLength))
+		}
+	}
+
+	latitude, longitude := c.PostForm("latitude"), c.PostForm("longitude")
+	if latitude == "" && longitude == "" {
+		return metadata, nil
+	}
+	lat, latErr := strconv.ParseFloat(latitude, 64)
+	lng, lngErr := strconv.ParseFloat(longitude, 64)
+	if latErr != nil || lngErr != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return metadata, apperror.BadRequest(apperror.CodeInvalidInput,
+			"latitude and longitude must be given together, between -90 and 90 and between -180 and 180")
+	}
+	metadata.Location = &models.GeoPoint{Longitude: lng, Latitude: lat}
+	return metadata, nil
+}
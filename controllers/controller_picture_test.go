@@ -0,0 +1,154 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+)
+
+func TestUploadPicture(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, contributorID, viewerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, contributorID, "bob", models.RoleContributor)
+	api.share(album, viewerID, "carol", models.RoleViewer)
+	path := "/api/albums/" + album.ID.Hex() + "/pictures/"
+
+	picture := data[models.Picture](api.upload(path, contributorID, 30, 20, map[string]string{
+		"taken_at": "2020-06-01T10:00:00Z", "tags": " Beach, sun,beach,", "latitude": "48.85", "longitude": "2.35",
+	}).expect(http.StatusCreated))
+	if picture.AlbumID != album.ID || picture.UserID.Hex() != contributorID || picture.PictureDataID.IsZero() || picture.Width == 0 || picture.Height == 0 {
+		t.Errorf("picture = %+v, want in the album, uploaded by the contributor, with its data and dimensions", picture)
+	}
+	if !picture.TakenAt.Equal(time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)) || strings.Join(picture.Tags, ",") != "beach,sun" {
+		t.Errorf("taken_at %v and tags %v, want 2020-06-01 and beach,sun", picture.TakenAt, picture.Tags)
+	}
+	if picture.Location == nil || picture.Location.Latitude != 48.85 || picture.Location.Longitude != 2.35 {
+		t.Errorf("location = %+v", picture.Location)
+	}
+
+	// without taken_at the picture is taken when uploaded
+	if loose := data[models.Picture](api.upload("/api/pictures/", "", 30, 20, nil).expect(http.StatusCreated)); !loose.TakenAt.Equal(loose.UploadedAt) || !loose.AlbumID.IsZero() {
+		t.Errorf("picture outside albums = %+v", loose)
+	}
+
+	api.upload(path, viewerID, 30, 20, nil).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.upload(path, "", 30, 20, nil).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.upload(path, ownerID, 30, 20, map[string]string{"taken_at": "yesterday"}).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.upload(path, ownerID, 30, 20, map[string]string{"latitude": "48"}).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.upload(path, ownerID, 30, 20, map[string]string{"latitude": "100", "longitude": "0"}).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.upload("/api/albums/nope/pictures/", "", 30, 20, nil).expectProblem(http.StatusBadRequest, "invalid_album_id")
+	api.upload("/api/albums/"+primitive.NewObjectID().Hex()+"/pictures/", ownerID, 30, 20, nil).expectProblem(http.StatusNotFound, "album_not_found")
+	api.request(http.MethodPost, path, ownerID, `{"file":"picture.png"}`).expectProblem(http.StatusUnsupportedMediaType, apperror.CodeUnsupportedMediaType)
+}
+
+func TestUploadPictureRejectsInvalidFiles(t *testing.T) {
+	api := newTestAPI(t)
+	body := "--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"picture.png\"\r\n\r\nnot an image\r\n--x--\r\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/pictures/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	api.serve(req).expectProblem(http.StatusBadRequest, apperror.CodeInvalidFile)
+}
+
+func TestGetPictures(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	album, private := api.createAlbum(ownerID, false), api.createAlbum(ownerID, true)
+	first, second := api.uploadPicture(album.ID.Hex(), ownerID), api.uploadPicture(album.ID.Hex(), ownerID)
+	hidden := api.uploadPicture(private.ID.Hex(), ownerID)
+
+	if picture := data[models.Picture](api.request(http.MethodGet, "/api/pictures/"+first.ID.Hex(), "", "").expect(http.StatusOK)); picture.ID != first.ID {
+		t.Errorf("picture = %+v, want %s", picture, first.ID.Hex())
+	}
+	r := api.request(http.MethodGet, "/api/pictures/"+first.ID.Hex()+"/data", "", "").expect(http.StatusOK)
+	if r.Header().Get("Content-Type") != "image/webp" || r.Body.Len() == 0 {
+		t.Errorf("picture data of type %s and %d bytes", r.Header().Get("Content-Type"), r.Body.Len())
+	}
+	api.request(http.MethodGet, "/api/pictures/nope", "", "").expectProblem(http.StatusBadRequest, "invalid_picture_id")
+	api.request(http.MethodGet, "/api/pictures/"+primitive.NewObjectID().Hex()+"/data", "", "").expectProblem(http.StatusNotFound, "picture_not_found")
+
+	// the pictures of a private album are only shown to its members
+	for _, path := range []string{"/api/pictures/" + hidden.ID.Hex(), "/api/pictures/" + hidden.ID.Hex() + "/data"} {
+		api.request(http.MethodGet, path, ownerID, "").expect(http.StatusOK)
+		api.request(http.MethodGet, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+		api.request(http.MethodGet, path, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	}
+	for userID, want := range map[string]int{"": 2, strangerID: 2, ownerID: 3} {
+		if all := data[[]models.Picture](api.request(http.MethodGet, "/api/pictures/", userID, "").expect(http.StatusOK)); len(all) != want {
+			t.Errorf("%d pictures listed for %q, want %d", len(all), userID, want)
+		}
+	}
+	api.request(http.MethodGet, "/api/pictures/", "nope", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+
+	inAlbum := "/api/albums/" + album.ID.Hex() + "/pictures/"
+	page := api.request(http.MethodGet, inAlbum+"?limit=1&sort=-uploaded_at", "", "").expect(http.StatusOK)
+	if pictures := data[[]models.Picture](page); len(pictures) != 1 || pictures[0].ID != second.ID || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the second picture and more", page.Body.String())
+	}
+	projected := data[[]map[string]any](api.request(http.MethodGet, inAlbum+"?fields=uploaded_at", "", "").expect(http.StatusOK))
+	if len(projected) != 2 || projected[0]["AlbumID"] != nil || projected[0]["UploadedAt"] == nil {
+		t.Errorf("projected pictures = %+v, want only the upload time", projected)
+	}
+	api.request(http.MethodGet, inAlbum+"?limit=500", "", "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+
+	privatePictures := "/api/albums/" + private.ID.Hex() + "/pictures/"
+	if pictures := data[[]models.Picture](api.request(http.MethodGet, privatePictures, ownerID, "").expect(http.StatusOK)); len(pictures) != 1 {
+		t.Errorf("%d pictures in the private album, want 1", len(pictures))
+	}
+	api.request(http.MethodGet, privatePictures, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, privatePictures, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestDeletePicture(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, contributorID, otherID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, contributorID, "bob", models.RoleContributor)
+	api.share(album, otherID, "carol", models.RoleContributor)
+	own, owners := api.uploadPicture(album.ID.Hex(), contributorID), api.uploadPicture(album.ID.Hex(), ownerID)
+
+	// contributors only delete their own pictures
+	api.request(http.MethodDelete, "/api/pictures/"+owners.ID.Hex(), contributorID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodDelete, "/api/pictures/"+own.ID.Hex(), contributorID, "").expect(http.StatusOK)
+	api.request(http.MethodDelete, "/api/pictures/"+owners.ID.Hex(), "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodDelete, "/api/pictures/"+owners.ID.Hex(), ownerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/pictures/"+own.ID.Hex(), "", "").expectProblem(http.StatusNotFound, "picture_not_found")
+	api.request(http.MethodDelete, "/api/pictures/"+own.ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "picture_not_found")
+	api.request(http.MethodDelete, "/api/pictures/nope", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_picture_id")
+
+	// only the uploader deletes a picture outside any album, even once its album is gone
+	loose := data[models.Picture](api.upload("/api/pictures/", otherID, 30, 20, nil).expect(http.StatusCreated))
+	orphan := api.uploadPicture(album.ID.Hex(), otherID)
+	api.request(http.MethodDelete, "/api/albums/"+album.ID.Hex(), ownerID, "").expect(http.StatusOK)
+	for _, picture := range []models.Picture{loose, orphan} {
+		api.request(http.MethodDelete, "/api/pictures/"+picture.ID.Hex(), ownerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+		api.request(http.MethodDelete, "/api/pictures/"+picture.ID.Hex(), "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+		api.request(http.MethodDelete, "/api/pictures/"+picture.ID.Hex(), otherID, "").expect(http.StatusOK)
+	}
+}
+
+func TestDeCouplePictureFromAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, contributorID := api.createUser("alice"), api.createUser("bob")
+	album, other := api.createAlbum(ownerID, false), api.createAlbum(ownerID, false)
+	api.share(album, contributorID, "bob", models.RoleContributor)
+	picture, owners := api.uploadPicture(album.ID.Hex(), contributorID), api.uploadPicture(album.ID.Hex(), ownerID)
+	path := "/api/albums/" + album.ID.Hex() + "/pictures/"
+
+	api.request(http.MethodDelete, path+owners.ID.Hex(), contributorID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodDelete, path+picture.ID.Hex(), "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodDelete, path+picture.ID.Hex(), contributorID, "").expect(http.StatusOK)
+	if stored := data[models.Picture](api.request(http.MethodGet, "/api/pictures/"+picture.ID.Hex(), "", "").expect(http.StatusOK)); !stored.AlbumID.IsZero() {
+		t.Errorf("picture still in album %s", stored.AlbumID.Hex())
+	}
+	api.request(http.MethodDelete, path+picture.ID.Hex(), ownerID, "").expectProblem(http.StatusConflict, "picture_not_in_album")
+	api.request(http.MethodDelete, "/api/albums/"+other.ID.Hex()+"/pictures/"+owners.ID.Hex(), ownerID, "").expectProblem(http.StatusConflict, "picture_not_in_album")
+	api.request(http.MethodDelete, "/api/albums/"+primitive.NewObjectID().Hex()+"/pictures/"+owners.ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "album_not_found")
+	api.request(http.MethodDelete, path+"nope", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_picture_id")
+}
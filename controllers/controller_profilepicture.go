@@ -2,112 +2,495 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"mirage-backend/controllers/dbutils"
-	"mirage-backend/database"
+	"log/slog"
+	"mirage-backend/apperror"
 	"mirage-backend/models"
+	"mirage-backend/repository"
 	"mirage-backend/utils"
 	"net/http"
 	"time"
 )
 
-// TODO: add picture compression
+const (
+	// ProfilePictureQuality is the WebP quality of stored profile pictures
+	ProfilePictureQuality = 45
+	// AvatarSize is the side in pixels of the square avatar rendition
+	AvatarSize = 128
+	// AvatarQuality is the WebP quality of the avatar rendition
+	AvatarQuality = 60
+)
+
+// ProfilePictureHandler serves the profile picture endpoints
+type ProfilePictureHandler struct {
+	users           repository.UserRepository
+	pictures        repository.PictureRepository
+	blobs           repository.BlobRepository
+	profilePictures repository.ProfilePictureRepository
+}
+
+// NewProfilePictureHandler returns a ProfilePictureHandler using the given repositories
+func NewProfilePictureHandler(
+	users repository.UserRepository,
+	pictures repository.PictureRepository,
+	blobs repository.BlobRepository,
+	profilePictures repository.ProfilePictureRepository,
+) *ProfilePictureHandler {
+	return &ProfilePictureHandler{users: users, pictures: pictures, blobs: blobs, profilePictures: profilePictures}
+}
 
 // UploadProfilePicture godoc
 // @Summary Upload a profile picture
-// @Description Uploads a profile picture to the database
+// @Description Uploads a profile picture and makes it the user's current one, the previous one is kept in the history
 // @Tags profile, pictures, pfp
 // @Accept multipart/form-data
 // @Produce json
 // @Param userId path string true "User ID"
 // @Param file formData file true "Profile picture file"
 // @Success 201 {object} models.ProfilePicture
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 415 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /profilepictures/user/{userId} [post]
-func UploadProfilePicture(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutDuration)
+// @Router /profilepictures/user/{userId} [put]
+func (h *ProfilePictureHandler) UploadProfilePicture(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
 	// Set context with timeout
 	defer cancel()
 
 	// Ensure multipart/form-data is used
 	contentType := c.ContentType()
 	if contentType != "multipart/form-data" {
-		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be multipart/form-data"})
+		apperror.Abort(c, errNotMultipart)
 		return
 	}
 
-	var userObjectID primitive.ObjectID
 	userId := c.Param("userId")
-	if userId != "" {
-		var err error
-		userObjectID, err = primitive.ObjectIDFromHex(userId)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
-			return
-		}
+	userObjectID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
 	}
 
-	userExists, err := dbutils.CheckIfItemExists(c, database.UserCollection, userObjectID)
-	if !userExists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	userExists, err := h.users.Exists(ctx, userObjectID)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to check if user exists", err))
 		return
-	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if user exists"})
+	} else if !userExists {
+		apperror.Abort(c, apperror.NotFound("user"))
 		return
 	}
 
 	// Get the file from the request
-	fileBytes, readErr := utils.RetrieveImageFromHTTPForm(c, "file")
-	if readErr {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file"})
+	fileBytes, err := utils.RetrieveImageFromHTTPForm(c, "file")
+	if err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	// Resize and compress the image
-	// I don't know how it behaves if the
-	// picture has a 1:1 aspect ratio - idk
-	compressedImage, compressErr := utils.ScaleAndConvertToWebPBytes(fileBytes, 45)
+	// Resize and compress the image, then derive the avatar from the original
+	compressedImage, compressErr := utils.ScaleAndConvertToWebPBytes(ctx, fileBytes, ProfilePictureQuality)
 	if compressErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process image", "details": compressErr.Error()})
+		apperror.Abort(c, apperror.Internal("Failed to process image", compressErr))
+		return
+	}
+	avatar, err := utils.CreateAvatar(ctx, fileBytes, AvatarSize, AvatarQuality)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to create avatar", err))
 		return
 	}
 
 	newPicture := models.Picture{
 		ID:          primitive.NewObjectID(),
+		UserID:      userObjectID,
+		UploadedAt:  time.Now(),
 		Description: "Profile picture of user " + userId,
 	}
+	newPicture.TakenAt = newPicture.UploadedAt
 
 	// Insert the picture into the database
-	pictureAdded, err :=
-		dbutils.AddPictureToDB(ctx, compressedImage, database.PictureDataCollection, database.PictureCollection, newPicture)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error uploading profile picture to the database"})
-		return
-	}
-	if !pictureAdded {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload profile picture to the database"})
+	if err := storePicture(ctx, h.blobs, h.pictures, compressedImage, &newPicture); err != nil {
+		apperror.Abort(c, apperror.Internal("Error uploading profile picture to the database", err))
 		return
 	}
 
 	// Create a new profile picture object
 	profilePicture := models.ProfilePicture{
+		ID:        primitive.NewObjectID(),
 		PictureID: newPicture.ID,
 		UserID:    userObjectID,
 		CreatedAt: time.Now(),
 	}
 
+	if profilePicture.AvatarDataID, err = h.blobs.Save(ctx, avatar); err != nil {
+		h.removeProfilePicture(ctx, profilePicture)
+		apperror.Abort(c, apperror.Internal("Failed to store avatar", err))
+		return
+	}
+
 	// Insert the profile picture into the database
-	result, err := database.PfpCollection.InsertOne(ctx, profilePicture)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload profile picture to the database"})
+	if err := h.profilePictures.Create(ctx, &profilePicture); err != nil {
+		h.removeProfilePicture(ctx, profilePicture)
+		apperror.Abort(c, apperror.Internal("Failed to upload profile picture to the database", err))
+		return
+	}
+
+	// Everything is stored, switch the user over in a single write
+	if err := h.setCurrent(ctx, userObjectID, profilePicture.ID); err != nil {
+		if deleteErr := h.profilePictures.Delete(ctx, profilePicture.ID); deleteErr != nil {
+			slog.ErrorContext(ctx, "Failed to remove profile picture", "profile_picture_id", profilePicture.ID.Hex(), "error", deleteErr)
+		}
+		h.removeProfilePicture(ctx, profilePicture)
+		apperror.Abort(c, fromRepository(err, "user", "Failed to set the current profile picture"))
 		return
 	}
 
 	// Return success response
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Profile picture uploaded successfully",
-		"id":      result.InsertedID,
+		"id":      profilePicture.ID,
+		"data":    profilePicture,
+	})
+}
+
+// GetProfilePictureByUserID godoc
+// @Summary Get a user's current profile picture
+// @Description Retrieves the metadata of the user's current profile picture
+// @Tags profile, pictures, pfp
+// @Produce json
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/user/{userId} [get]
+func (h *ProfilePictureHandler) GetProfilePictureByUserID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	profilePicture, err := h.current(ctx, c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile picture retrieved successfully", "data": profilePicture})
+}
+
+// GetUserAvatar godoc
+// @Summary Get a user's avatar
+// @Description Retrieves the small square rendition of the user's current profile picture, meant for list views
+// @Tags profile, pictures, pfp
+// @Produce image/webp
+// @Param userId path string true "User ID"
+// @Success 200 {string} string
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/user/{userId}/avatar [get]
+func (h *ProfilePictureHandler) GetUserAvatar(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	profilePicture, err := h.current(ctx, c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.writeImage(ctx, c, profilePicture, true)
+}
+
+// GetProfilePictureHistory godoc
+// @Summary Get a user's profile picture history
+// @Description Retrieves a page of the profile pictures a user uploaded, newest first by default
+// @Tags profile, pictures, pfp
+// @Produce json
+// @Param userId path string true "User ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at), prefix with - for descending, default -created_at"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} []models.ProfilePicture
+// @Failure 400 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/user/{userId}/history [get]
+func (h *ProfilePictureHandler) GetProfilePictureHistory(c *gin.Context) {
+	userObjectID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
+	}
+
+	query, err := parsePageQuery(c, profilePictureListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	page, err := h.profilePictures.ListByUser(ctx, userObjectID, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve profile pictures", err)
+		return
+	}
+
+	respondWithPage(c, "Profile pictures retrieved successfully", query, page)
+}
+
+// GetProfilePictureByID godoc
+// @Summary Get a profile picture by ID
+// @Description Retrieves the metadata of a current or previous profile picture
+// @Tags profile, pictures, pfp
+// @Produce json
+// @Param profilePictureId path string true "Profile picture ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/{profilePictureId} [get]
+func (h *ProfilePictureHandler) GetProfilePictureByID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	profilePicture, err := h.get(ctx, c.Param("profilePictureId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile picture retrieved successfully", "data": profilePicture})
+}
+
+// GetProfilePictureData godoc
+// @Summary Get profile picture data
+// @Description Retrieves the image of a profile picture
+// @Tags profile, pictures, pfp
+// @Produce image/webp
+// @Param profilePictureId path string true "Profile picture ID"
+// @Success 200 {string} string
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/{profilePictureId}/data [get]
+func (h *ProfilePictureHandler) GetProfilePictureData(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	profilePicture, err := h.get(ctx, c.Param("profilePictureId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.writeImage(ctx, c, profilePicture, false)
+}
+
+// GetProfilePictureAvatar godoc
+// @Summary Get profile picture avatar
+// @Description Retrieves the small square rendition of a profile picture
+// @Tags profile, pictures, pfp
+// @Produce image/webp
+// @Param profilePictureId path string true "Profile picture ID"
+// @Success 200 {string} string
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/{profilePictureId}/avatar [get]
+func (h *ProfilePictureHandler) GetProfilePictureAvatar(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	profilePicture, err := h.get(ctx, c.Param("profilePictureId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.writeImage(ctx, c, profilePicture, true)
+}
+
+// UpdateProfilePicture godoc
+// @Summary Restore a profile picture
+// @Description Makes a profile picture from the user's history the current one again
+// @Tags profile, pictures, pfp
+// @Produce json
+// @Param profilePictureId path string true "Profile picture ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/{profilePictureId} [put]
+func (h *ProfilePictureHandler) UpdateProfilePicture(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	profilePicture, err := h.get(ctx, c.Param("profilePictureId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if err := h.setCurrent(ctx, profilePicture.UserID, profilePicture.ID); err != nil {
+		apperror.Abort(c, fromRepository(err, "user", "Failed to set the current profile picture"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile picture set as current", "data": profilePicture})
+}
+
+// DeleteProfilePicture godoc
+// @Summary Delete a profile picture
+// @Description Deletes a profile picture and its image, when it is the current one the most recent remaining picture replaces it
+// @Tags profile, pictures, pfp
+// @Produce json
+// @Param profilePictureId path string true "Profile picture ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /profilepictures/{profilePictureId} [delete]
+func (h *ProfilePictureHandler) DeleteProfilePicture(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	profilePicture, err := h.get(ctx, c.Param("profilePictureId"))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	user, err := h.users.Get(ctx, profilePicture.UserID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apperror.Abort(c, apperror.Internal("Failed to fetch user", err))
+		return
+	}
+
+	// Move the user off the picture before it disappears
+	if err == nil && user.ProfilePictureID == profilePicture.ID {
+		replacement, err := h.previous(ctx, profilePicture)
+		if err != nil {
+			apperror.Abort(c, apperror.Internal("Failed to find the previous profile picture", err))
+			return
+		}
+		if err := h.setCurrent(ctx, user.ID, replacement); err != nil {
+			apperror.Abort(c, fromRepository(err, "user", "Failed to set the current profile picture"))
+			return
+		}
+	}
+
+	if err := h.profilePictures.Delete(ctx, profilePicture.ID); err != nil {
+		apperror.Abort(c, fromRepository(err, "profile picture", "Failed to delete profile picture"))
+		return
+	}
+	h.removeProfilePicture(ctx, profilePicture)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Profile picture deleted successfully"})
+}
+
+// get loads the profile picture with the given hex ID
+func (h *ProfilePictureHandler) get(ctx context.Context, id string) (models.ProfilePicture, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.ProfilePicture{}, apperror.InvalidID("profile picture")
+	}
+
+	profilePicture, err := h.profilePictures.Get(ctx, objectID)
+	if err != nil {
+		return profilePicture, fromRepository(err, "profile picture", "Failed to retrieve profile picture")
+	}
+	return profilePicture, nil
+}
+
+// current loads the current profile picture of the user with the given hex ID
+func (h *ProfilePictureHandler) current(ctx context.Context, userID string) (models.ProfilePicture, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return models.ProfilePicture{}, apperror.InvalidID("user")
+	}
+
+	user, err := h.users.Get(ctx, userObjectID)
+	if err != nil {
+		return models.ProfilePicture{}, fromRepository(err, "user", "Failed to fetch user")
+	}
+	if user.ProfilePictureID.IsZero() {
+		return models.ProfilePicture{}, apperror.NotFound("profile picture")
+	}
+
+	profilePicture, err := h.profilePictures.Get(ctx, user.ProfilePictureID)
+	if err != nil {
+		return profilePicture, fromRepository(err, "profile picture", "Failed to retrieve profile picture")
+	}
+	return profilePicture, nil
+}
+
+// previous returns the most recent profile picture of the same user other than profilePicture, NilObjectID if none
+func (h *ProfilePictureHandler) previous(ctx context.Context, profilePicture models.ProfilePicture) (primitive.ObjectID, error) {
+	query := repository.PageQuery{Limit: 2, SortField: "created_at", SortDesc: true}
+	page, err := h.profilePictures.ListByUser(ctx, profilePicture.UserID, query)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	for _, candidate := range page.Items {
+		if candidate.ID != profilePicture.ID {
+			return candidate.ID, nil
+		}
+	}
+	return primitive.NilObjectID, nil
+}
+
+// setCurrent points the user to the given profile picture
+func (h *ProfilePictureHandler) setCurrent(ctx context.Context, userID, profilePictureID primitive.ObjectID) error {
+	return h.users.Update(ctx, userID, repository.Fields{
+		"profile_picture_id": profilePictureID,
+		"updated_at":         time.Now(),
 	})
 }
+
+// writeImage sends the full image or the avatar of a profile picture,
+// pictures uploaded before avatars existed fall back to the full image
+func (h *ProfilePictureHandler) writeImage(ctx context.Context, c *gin.Context, profilePicture models.ProfilePicture, avatar bool) {
+	dataID := profilePicture.AvatarDataID
+	if !avatar || dataID.IsZero() {
+		picture, err := h.pictures.Get(ctx, profilePicture.PictureID)
+		if err != nil {
+			apperror.Abort(c, fromRepository(err, "picture", "Failed to retrieve picture"))
+			return
+		}
+		dataID = picture.PictureDataID
+	}
+
+	data, err := h.blobs.Get(ctx, dataID)
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve picture data", err))
+		return
+	}
+
+	c.Data(http.StatusOK, "image/webp", data)
+}
+
+// removeProfilePicture deletes the picture and image data of a profile picture, logging what can't be removed
+func (h *ProfilePictureHandler) removeProfilePicture(ctx context.Context, profilePicture models.ProfilePicture) {
+	if !profilePicture.AvatarDataID.IsZero() {
+		if err := h.blobs.Delete(ctx, profilePicture.AvatarDataID); err != nil {
+			slog.ErrorContext(ctx, "Failed to remove avatar data", "avatar_data_id", profilePicture.AvatarDataID.Hex(), "error", err)
+		}
+	}
+
+	picture, err := h.pictures.Get(ctx, profilePicture.PictureID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to fetch profile picture's picture", "picture_id", profilePicture.PictureID.Hex(), "error", err)
+		return
+	}
+	if err := h.pictures.Delete(ctx, picture.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove picture", "picture_id", picture.ID.Hex(), "error", err)
+	}
+	if err := h.blobs.Delete(ctx, picture.PictureDataID); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove picture data", "picture_data_id", picture.PictureDataID.Hex(), "error", err)
+	}
+}
@@ -0,0 +1,114 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+)
+
+// uploadProfilePicture uploads a profile picture of userID, which becomes the current one
+func (a *testAPI) uploadProfilePicture(userID string) models.ProfilePicture {
+	a.t.Helper()
+	return data[models.ProfilePicture](a.upload("/api/profilepictures/user/"+userID, "", 300, 200, nil).expect(http.StatusCreated))
+}
+
+func TestUploadProfilePicture(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+
+	profilePicture := api.uploadProfilePicture(userID)
+	if profilePicture.UserID.Hex() != userID || profilePicture.PictureID.IsZero() || profilePicture.AvatarDataID.IsZero() {
+		t.Errorf("profile picture = %+v, want a picture and an avatar", profilePicture)
+	}
+	if user := decode[controllers.UserResponse](api.request(http.MethodGet, "/api/users/"+userID, "", "").expect(http.StatusOK)); user.ProfilePictureID != profilePicture.ID {
+		t.Errorf("current profile picture %s, want %s", user.ProfilePictureID.Hex(), profilePicture.ID.Hex())
+	}
+	// the picture stays outside albums, only its uploader may share it
+	picture := data[models.Picture](api.request(http.MethodGet, "/api/pictures/"+profilePicture.PictureID.Hex(), "", "").expect(http.StatusOK))
+	if !picture.AlbumID.IsZero() || picture.UserID.Hex() != userID {
+		t.Errorf("picture = %+v, want outside albums and uploaded by the user", picture)
+	}
+	api.request(http.MethodPost, "/api/pictures/"+picture.ID.Hex()+"/share-links", userID, `{}`).expect(http.StatusCreated)
+
+	api.upload("/api/profilepictures/user/"+primitive.NewObjectID().Hex(), "", 30, 20, nil).expectProblem(http.StatusNotFound, "user_not_found")
+	api.upload("/api/profilepictures/user/nope", "", 30, 20, nil).expectProblem(http.StatusBadRequest, "invalid_user_id")
+	api.request(http.MethodPost, "/api/profilepictures/user/"+userID, "", `{}`).expectProblem(http.StatusUnsupportedMediaType, apperror.CodeUnsupportedMediaType)
+}
+
+func TestGetProfilePicture(t *testing.T) {
+	api := newTestAPI(t)
+	userID, otherID := api.createUser("alice"), api.createUser("bob")
+	first, current := api.uploadProfilePicture(userID), api.uploadProfilePicture(userID)
+
+	if profilePicture := data[models.ProfilePicture](api.request(http.MethodGet, "/api/profilepictures/user/"+userID, "", "").expect(http.StatusOK)); profilePicture.ID != current.ID {
+		t.Errorf("current profile picture %s, want %s", profilePicture.ID.Hex(), current.ID.Hex())
+	}
+	if profilePicture := data[models.ProfilePicture](api.request(http.MethodGet, "/api/profilepictures/"+first.ID.Hex(), "", "").expect(http.StatusOK)); profilePicture.ID != first.ID {
+		t.Errorf("profile picture %s, want %s", profilePicture.ID.Hex(), first.ID.Hex())
+	}
+
+	image := api.request(http.MethodGet, "/api/profilepictures/"+first.ID.Hex()+"/data", "", "").expect(http.StatusOK)
+	avatar := api.request(http.MethodGet, "/api/profilepictures/"+first.ID.Hex()+"/avatar", "", "").expect(http.StatusOK)
+	if image.Header().Get("Content-Type") != "image/webp" || avatar.Body.Len() == 0 || avatar.Body.String() == image.Body.String() {
+		t.Errorf("image of %d bytes and avatar of %d bytes, want two different renditions", image.Body.Len(), avatar.Body.Len())
+	}
+	api.request(http.MethodGet, "/api/profilepictures/user/"+userID+"/avatar", "", "").expect(http.StatusOK)
+
+	api.request(http.MethodGet, "/api/profilepictures/user/"+otherID, "", "").expectProblem(http.StatusNotFound, "profile_picture_not_found")
+	api.request(http.MethodGet, "/api/profilepictures/user/"+otherID+"/avatar", "", "").expectProblem(http.StatusNotFound, "profile_picture_not_found")
+	api.request(http.MethodGet, "/api/profilepictures/"+primitive.NewObjectID().Hex(), "", "").expectProblem(http.StatusNotFound, "profile_picture_not_found")
+	api.request(http.MethodGet, "/api/profilepictures/nope/data", "", "").expectProblem(http.StatusBadRequest, "invalid_profile_picture_id")
+}
+
+func TestGetProfilePictureHistory(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	first, second := api.uploadProfilePicture(userID), api.uploadProfilePicture(userID)
+	history := "/api/profilepictures/user/" + userID + "/history"
+
+	page := api.request(http.MethodGet, history+"?limit=1&sort=-created_at", "", "").expect(http.StatusOK)
+	if profilePictures := data[[]models.ProfilePicture](page); len(profilePictures) != 1 || profilePictures[0].ID != second.ID || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the second profile picture and more", page.Body.String())
+	}
+	next := api.request(http.MethodGet, history+"?limit=1&sort=-created_at&cursor="+pagination(page).NextCursor, "", "").expect(http.StatusOK)
+	if profilePictures := data[[]models.ProfilePicture](next); len(profilePictures) != 1 || profilePictures[0].ID != first.ID || pagination(next).HasMore {
+		t.Errorf("second page = %s, want the first profile picture only", next.Body.String())
+	}
+
+	api.request(http.MethodGet, history+"?sort=nope", "", "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+	api.request(http.MethodGet, "/api/profilepictures/user/nope/history", "", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+}
+
+func TestUpdateProfilePicture(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	first := api.uploadProfilePicture(userID)
+	api.uploadProfilePicture(userID)
+
+	api.request(http.MethodPut, "/api/profilepictures/"+first.ID.Hex(), "", "").expect(http.StatusOK)
+	if current := data[models.ProfilePicture](api.request(http.MethodGet, "/api/profilepictures/user/"+userID, "", "").expect(http.StatusOK)); current.ID != first.ID {
+		t.Errorf("current profile picture %s, want %s", current.ID.Hex(), first.ID.Hex())
+	}
+	api.request(http.MethodPut, "/api/profilepictures/"+primitive.NewObjectID().Hex(), "", "").expectProblem(http.StatusNotFound, "profile_picture_not_found")
+}
+
+func TestDeleteProfilePicture(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	first, second := api.uploadProfilePicture(userID), api.uploadProfilePicture(userID)
+
+	// the previous profile picture replaces the deleted current one
+	api.request(http.MethodDelete, "/api/profilepictures/"+second.ID.Hex(), "", "").expect(http.StatusOK)
+	if current := data[models.ProfilePicture](api.request(http.MethodGet, "/api/profilepictures/user/"+userID, "", "").expect(http.StatusOK)); current.ID != first.ID {
+		t.Errorf("current profile picture %s, want %s", current.ID.Hex(), first.ID.Hex())
+	}
+	api.request(http.MethodGet, "/api/pictures/"+second.PictureID.Hex(), "", "").expectProblem(http.StatusNotFound, "picture_not_found")
+
+	api.request(http.MethodDelete, "/api/profilepictures/"+first.ID.Hex(), "", "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/profilepictures/user/"+userID, "", "").expectProblem(http.StatusNotFound, "profile_picture_not_found")
+	api.request(http.MethodDelete, "/api/profilepictures/"+first.ID.Hex(), "", "").expectProblem(http.StatusNotFound, "profile_picture_not_found")
+}
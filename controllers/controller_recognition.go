@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/recognition"
+	"mirage-backend/repository"
+)
+
+var (
+	errRecognitionDisabled = apperror.New(http.StatusServiceUnavailable, "recognition_disabled",
+		"Face recognition is disabled on this server")
+	errRecognitionQueueFull = apperror.New(http.StatusServiceUnavailable, "recognition_queue_full",
+		"Too many pictures are waiting for face recognition, try again later")
+)
+
+// RecognitionJobResponse tells how many pictures of an album were queued for face recognition
+type RecognitionJobResponse struct {
+	Queued int
+	// Deferred pictures didn't fit in the queue, running the recognition again picks them up
+	Deferred int
+}
+
+// RecognitionHandler serves the face recognition of the albums
+type RecognitionHandler struct {
+	albums      repository.AlbumRepository
+	pictures    repository.PictureRepository
+	faces       repository.FaceRepository
+	invitations repository.InvitationRepository
+	pipeline    *recognition.Pipeline
+}
+
+// NewRecognitionHandler returns a RecognitionHandler using the given repositories, queueing the pictures on pipeline
+func NewRecognitionHandler(
+	albums repository.AlbumRepository,
+	pictures repository.PictureRepository,
+	faces repository.FaceRepository,
+	invitations repository.InvitationRepository,
+	pipeline *recognition.Pipeline,
+) *RecognitionHandler {
+	return &RecognitionHandler{albums: albums, pictures: pictures, faces: faces, invitations: invitations, pipeline: pipeline}
+}
+
+// RecognizeAlbum godoc
+// @Summary Run face recognition on an album
+// @Description Queues the pictures of the album whose faces were not detected yet, or all of them with all=true, for face recognition in the background. Uploaded pictures are queued on their own.
+// @Tags recognition
+// @Produce json
+// @Param X-User-ID header string true "Acting user, who may edit the album"
+// @Param albumId path string true "Album ID"
+// @Param all query bool false "Detect the faces of the pictures already processed again"
+// @Success 202 {object} RecognitionJobResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Failure 503 {object} apperror.Problem
+// @Router /albums/{albumId}/recognize [post]
+func (h *RecognitionHandler) RecognizeAlbum(c *gin.Context) {
+	all, err := strconv.ParseBool(c.DefaultQuery("all", "false"))
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "all must be a boolean"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, err := h.album(c, ctx, rightEdit)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if !h.pipeline.Enabled() {
+		apperror.Abort(c, errRecognitionDisabled)
+		return
+	}
+
+	pictureIDs, err := h.pictures.IDs(ctx, repository.PictureFilter{AlbumID: &album.ID, Unrecognized: !all})
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve pictures", err))
+		return
+	}
+
+	var response RecognitionJobResponse
+	for _, pictureID := range pictureIDs {
+		if h.pipeline.Enqueue(pictureID) {
+			response.Queued++
+		} else {
+			response.Deferred++
+		}
+	}
+	if response.Queued == 0 && response.Deferred > 0 {
+		apperror.Abort(c, errRecognitionQueueFull)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Face recognition queued successfully", "data": response})
+}
+
+// GetRecognitionResults godoc
+// @Summary List the faces recognized in an album
+// @Description Fetches a page of the faces detected in the pictures of the album, with their bounding box in fractions of the picture size and the confidence of the detection
+// @Tags recognition
+// @Produce json
+// @Param X-User-ID header string false "Acting user"
+// @Param albumId path string true "Album ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, confidence, recognized_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user for a private album"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/recognition-results [get]
+func (h *RecognitionHandler) GetRecognitionResults(c *gin.Context) {
+	query, err := parsePageQuery(c, faceListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, err := h.album(c, ctx, rightView)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	pictureIDs, err := h.pictures.IDs(ctx, repository.PictureFilter{AlbumID: &album.ID})
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to retrieve pictures", err))
+		return
+	}
+
+	page, err := h.faces.List(ctx, repository.FaceFilter{PictureIDs: nonNil(pictureIDs)}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve recognition results", err)
+		return
+	}
+
+	respondWithPage(c, "Recognition results retrieved successfully", query, page)
+}
+
+// album returns the album named by the albumId parameter once the acting user is checked to hold right on it;
+// public albums may be viewed by anyone
+func (h *RecognitionHandler) album(c *gin.Context, ctx context.Context, right albumRight) (models.Album, error) {
+	albumID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		return models.Album{}, apperror.InvalidID("album")
+	}
+
+	album, err := h.albums.Get(ctx, albumID)
+	if err != nil {
+		return album, fromRepository(err, "album", "Failed to retrieve album")
+	}
+	if right == rightView && !album.IsPrivate {
+		return album, nil
+	}
+	return album, authorizeAlbum(c, ctx, h.invitations, album, right)
+}
@@ -0,0 +1,68 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+)
+
+func TestRecognizeAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, contributorID := api.createUser("alice"), api.createUser("bob")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, contributorID, "bob", models.RoleContributor)
+	picture := api.uploadPicture(album.ID.Hex(), ownerID)
+	path := "/api/albums/" + album.ID.Hex() + "/recognize"
+
+	job := data[controllers.RecognitionJobResponse](api.request(http.MethodPost, path, ownerID, "").expect(http.StatusAccepted))
+	if job.Queued+job.Deferred != 1 {
+		t.Errorf("job = %+v, want the picture queued", job)
+	}
+
+	// recognized pictures are only queued again when all of them are asked for
+	api.recognize(picture.ID)
+	if job := data[controllers.RecognitionJobResponse](api.request(http.MethodPost, path, ownerID, "").expect(http.StatusAccepted)); job.Queued+job.Deferred != 0 {
+		t.Errorf("job = %+v, want nothing queued", job)
+	}
+	if job := data[controllers.RecognitionJobResponse](api.request(http.MethodPost, path+"?all=true", ownerID, "").expect(http.StatusAccepted)); job.Queued+job.Deferred != 1 {
+		t.Errorf("job = %+v, want the picture queued again", job)
+	}
+
+	api.request(http.MethodPost, path+"?all=maybe", ownerID, "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, contributorID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+}
+
+func TestRecognizeAlbumWithoutRecognizer(t *testing.T) {
+	api := newTestAPIWithRecognizer(t, nil)
+	ownerID := api.createUser("alice")
+	album := api.createAlbum(ownerID, false)
+
+	api.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/recognize", ownerID, "").
+		expectProblem(http.StatusServiceUnavailable, "recognition_disabled")
+}
+
+func TestGetRecognitionResults(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	public, private := api.createAlbum(ownerID, false), api.createAlbum(ownerID, true)
+	for _, album := range []models.Album{public, private} {
+		api.recognize(api.uploadPicture(album.ID.Hex(), ownerID).ID)
+	}
+
+	faces := data[[]models.RecognizedFace](api.request(http.MethodGet, "/api/albums/"+public.ID.Hex()+"/recognition-results", "", "").expect(http.StatusOK))
+	if len(faces) != 1 || faces[0].Confidence != 0.9 || faces[0].PersonID.IsZero() {
+		t.Errorf("faces = %+v, want the recognized face grouped into a person", faces)
+	}
+
+	results := "/api/albums/" + private.ID.Hex() + "/recognition-results"
+	if faces := data[[]models.RecognizedFace](api.request(http.MethodGet, results+"?sort=-confidence", ownerID, "").expect(http.StatusOK)); len(faces) != 1 {
+		t.Errorf("%d faces in the private album, want 1", len(faces))
+	}
+	api.request(http.MethodGet, results, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, results, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodGet, "/api/albums/nope/recognition-results", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_album_id")
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mirage-backend/apperror"
+	"mirage-backend/search"
+)
+
+// codeInvalidSearch is the error code of malformed search parameters
+const codeInvalidSearch = "invalid_search"
+
+// SearchPagination is the pagination block of the search responses. A search only ranks its best matches,
+// TotalCapped tells that more of them matched than Total counts.
+type SearchPagination struct {
+	PaginationInfo
+	TotalCapped bool `json:"total_capped"`
+}
+
+// SearchHandler serves the search endpoints
+type SearchHandler struct {
+	searcher *search.Searcher
+}
+
+// NewSearchHandler returns a SearchHandler ranking results with searcher
+func NewSearchHandler(searcher *search.Searcher) *SearchHandler {
+	return &SearchHandler{searcher: searcher}
+}
+
+// Search godoc
+// @Summary Search albums and pictures
+// @Description Ranked full-text search over album titles, tags and descriptions, picture descriptions and recognized face names.
+// @Description Only the public albums, the albums of the acting user and the ones they joined are searched, with their pictures.
+// @Description The best 500 albums and 500 pictures are ranked, pagination.total_capped tells that more matched than pagination.total counts.
+// @Tags search
+// @Produce json
+// @Param X-User-ID header string false "Acting user"
+// @Param q query string true "Search text"
+// @Param type query string false "Restrict results to albums or pictures"
+// @Param tags query string false "Comma-separated tags the album (or the picture's album) must have"
+// @Param from query string false "Only results created/uploaded at or after this date (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Only results created/uploaded at or before this date (RFC 3339 or YYYY-MM-DD)"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Success 200 {object} map[string]interface{} "Search completed successfully"
+// @Failure 400 {object} apperror.Problem "Invalid search parameters"
+// @Failure 500 {object} apperror.Problem "Failed to search"
+// @Router /search [get]
+func (h *SearchHandler) Search(c *gin.Context) {
+	query, err := parseSearchQuery(c)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(codeInvalidSearch, err.Error()))
+		return
+	}
+	// the acting user finds the private albums they may view too
+	if query.ViewerID, _, err = actingUser(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	switch c.Query("type") {
+	case "":
+	case "albums":
+		query.Types = []string{search.TypeAlbum}
+	case "pictures":
+		query.Types = []string{search.TypePicture}
+	default:
+		apperror.Abort(c, apperror.BadRequest(codeInvalidSearch, "type must be albums or pictures"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	results, err := h.searcher.Search(ctx, query)
+	if err != nil {
+		respondWithSearchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Search completed successfully",
+		"data":       results.Items,
+		"pagination": searchPagination(query, results),
+	})
+}
+
+// SearchAlbums godoc
+// @Summary Search albums
+// @Description Ranked full-text search over album titles, tags and descriptions, among the public albums and the
+// @Description albums of the acting user and the ones they joined. The best 500 albums are ranked, pagination.total_capped
+// @Description tells that more matched than pagination.total counts.
+// @Tags albums
+// @Produce json
+// @Param X-User-ID header string false "Acting user"
+// @Param q query string true "Search query"
+// @Param tags query string false "Comma-separated tags the album must have"
+// @Param from query string false "Only albums created at or after this date (RFC 3339 or YYYY-MM-DD)"
+// @Param to query string false "Only albums created at or before this date (RFC 3339 or YYYY-MM-DD)"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Success 200 {object} map[string]interface{} "Albums retrieved successfully"
+// @Failure 400 {object} apperror.Problem "Invalid search parameters"
+// @Failure 500 {object} apperror.Problem "Failed to search albums"
+// @Router /albums/search [get]
+func (h *SearchHandler) SearchAlbums(c *gin.Context) {
+	query, err := parseSearchQuery(c)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(codeInvalidSearch, err.Error()))
+		return
+	}
+	// the acting user finds the private albums they may view too
+	if query.ViewerID, _, err = actingUser(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	query.Types = []string{search.TypeAlbum}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	results, err := h.searcher.Search(ctx, query)
+	if err != nil {
+		respondWithSearchError(c, err)
+		return
+	}
+
+	albums := make([]interface{}, 0, len(results.Items))
+	for _, result := range results.Items {
+		albums = append(albums, result.Album)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Albums retrieved successfully",
+		"data":       albums,
+		"pagination": searchPagination(query, results),
+	})
+}
+
+// parseSearchQuery reads the parameters shared by the search endpoints
+func parseSearchQuery(c *gin.Context) (search.Query, error) {
+	query := search.Query{
+		Text:   strings.TrimSpace(c.Query("q")),
+		Limit:  defaultPageLimit,
+		Cursor: c.Query("cursor"),
+	}
+
+	if query.Text == "" {
+		return query, errors.New("q is required")
+	}
+
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return query, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+		}
+		query.Limit = limit
+	}
+
+	for _, tag := range strings.Split(c.Query("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			query.Tags = append(query.Tags, tag)
+		}
+	}
+
+	var err error
+	if query.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		return query, fmt.Errorf("invalid from date: %v", err)
+	}
+	if query.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		return query, fmt.Errorf("invalid to date: %v", err)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return query, errors.New("to must not be before from")
+	}
+
+	return query, nil
+}
+
+// parseDateParam accepts RFC 3339 timestamps or plain dates; a plain upper bound covers the whole day
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+// searchPagination builds the pagination block of a search response
+func searchPagination(query search.Query, results search.Results) SearchPagination {
+	return SearchPagination{
+		PaginationInfo: PaginationInfo{
+			Limit:      int64(query.Limit),
+			Total:      results.Total,
+			NextCursor: results.NextCursor,
+			HasMore:    results.NextCursor != "",
+		},
+		TotalCapped: results.TotalCapped,
+	}
+}
+
+// respondWithSearchError maps search errors to the right application error
+func respondWithSearchError(c *gin.Context, err error) {
+	if errors.Is(err, search.ErrInvalidCursor) {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidCursor, "Invalid cursor"))
+		return
+	}
+	apperror.Abort(c, apperror.Internal("Failed to search", err))
+}
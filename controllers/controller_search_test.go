@@ -0,0 +1,148 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/search"
+)
+
+func TestSearchValidation(t *testing.T) {
+	api := newTestAPI(t)
+
+	invalid := []string{
+		"",
+		"?q=+",
+		"?q=beach&limit=0",
+		"?q=beach&limit=500",
+		"?q=beach&from=yesterday",
+		"?q=beach&to=2024-13-01",
+		"?q=beach&from=2024-02-01&to=2024-01-31",
+	}
+	for _, path := range []string{"/api/search", "/api/albums/search"} {
+		for _, query := range invalid {
+			api.request(http.MethodGet, path+query, "", "").expectProblem(http.StatusBadRequest, "invalid_search")
+		}
+		api.request(http.MethodGet, path+"?q=beach", "nope", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+		api.request(http.MethodGet, path+"?q=beach&cursor=nope", "", "").expectProblem(http.StatusBadRequest, "invalid_cursor")
+	}
+	api.request(http.MethodGet, "/api/search?q=beach&type=people", "", "").expectProblem(http.StatusBadRequest, "invalid_search")
+}
+
+// searchAlbum creates an album of ownerID with the title and description
+func (a *testAPI) searchAlbum(ownerID, title, description string, private bool) models.Album {
+	a.t.Helper()
+	body := fmt.Sprintf(`{"Title":%q,"Description":%q,"Tags":["summer"],"IsPrivate":%t}`, title, description, private)
+	return data[models.Album](a.request(http.MethodPost, "/api/albums/", ownerID, body).expect(http.StatusCreated))
+}
+
+// searchIDs returns the IDs of the search results, in their order
+func (a *testAPI) searchIDs(path, userID string) []primitive.ObjectID {
+	a.t.Helper()
+	var ids []primitive.ObjectID
+	for _, result := range data[[]search.Result](a.request(http.MethodGet, path, userID, "").expect(http.StatusOK)) {
+		if result.Album != nil {
+			ids = append(ids, result.Album.ID)
+		} else {
+			ids = append(ids, result.Picture.ID)
+		}
+	}
+	return ids
+}
+
+func TestSearchRanksMatches(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	inTitle := api.searchAlbum(ownerID, "Beach", "", false)
+	inDescription := api.searchAlbum(ownerID, "Holidays", "A day at the beach", false)
+	api.searchAlbum(ownerID, "Mountains", "Hiking", false)
+
+	// titles weigh more than descriptions
+	if ids := api.searchIDs("/api/search?q=beach", ""); len(ids) != 2 || ids[0] != inTitle.ID || ids[1] != inDescription.ID {
+		t.Errorf("results = %v, want the album titled beach then the one describing it", ids)
+	}
+	// an album matching more words ranks first
+	if ids := api.searchIDs("/api/search?q=day+beach", ""); len(ids) != 2 || ids[0] != inTitle.ID {
+		t.Errorf("results = %v, want the album titled beach first", ids)
+	}
+
+	first := api.request(http.MethodGet, "/api/search?q=beach&limit=1", "", "").expect(http.StatusOK)
+	page := pagination(first)
+	if results := data[[]search.Result](first); len(results) != 1 || results[0].Type != search.TypeAlbum || page.Total != 2 || !page.HasMore {
+		t.Fatalf("first page = %s, want one of two albums", first.Body.String())
+	}
+	if searchPagination(first).TotalCapped {
+		t.Error("total of two albums reported as capped")
+	}
+	if ids := api.searchIDs("/api/search?q=beach&limit=1&cursor="+page.NextCursor, ""); len(ids) != 1 || ids[0] != inDescription.ID {
+		t.Errorf("second page = %v, want the album describing the beach", ids)
+	}
+
+	albums := data[[]models.Album](api.request(http.MethodGet, "/api/albums/search?q=beach&tags=summer", "", "").expect(http.StatusOK))
+	if len(albums) != 2 || albums[0].ID != inTitle.ID {
+		t.Errorf("albums = %+v, want the two beach albums", albums)
+	}
+	if ids := api.searchIDs("/api/search?q=beach&tags=winter", ""); len(ids) != 0 {
+		t.Errorf("results tagged winter = %v, want none", ids)
+	}
+	if ids := api.searchIDs("/api/search?q=beach&to=2000-01-01", ""); len(ids) != 0 {
+		t.Errorf("results created before 2000 = %v, want none", ids)
+	}
+}
+
+// searchPagination decodes the pagination block of a search response
+func searchPagination(r response) controllers.SearchPagination {
+	r.t.Helper()
+	return decode[struct {
+		Pagination controllers.SearchPagination `json:"pagination"`
+	}](r).Pagination
+}
+
+func TestSearchTotalIsCapped(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	for range repository.MaxSearchMatches + 1 {
+		api.searchAlbum(ownerID, "Beach", "", false)
+	}
+
+	page := searchPagination(api.request(http.MethodGet, "/api/search?q=beach&limit=1", "", "").expect(http.StatusOK))
+	if page.Total != repository.MaxSearchMatches || !page.TotalCapped {
+		t.Errorf("pagination = %+v, want a total of %d reported as capped", page, repository.MaxSearchMatches)
+	}
+}
+
+func TestSearchOnlyFindsWhatTheUserMayView(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, memberID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	public := api.searchAlbum(ownerID, "Beach", "", false)
+	private := api.searchAlbum(ownerID, "Beach house", "", true)
+	api.share(private, memberID, "bob", models.RoleViewer)
+
+	// the face of the private picture is named after the person it shows
+	picture := api.uploadPicture(private.ID.Hex(), ownerID)
+	api.recognize(picture.ID)
+	people := data[[]models.Person](api.request(http.MethodGet, "/api/people/", ownerID, "").expect(http.StatusOK))
+	api.request(http.MethodPatch, "/api/people/"+people[0].ID.Hex(), ownerID, `{"Name":"Grandma"}`).expect(http.StatusOK)
+
+	for userID, want := range map[string]int{"": 1, strangerID: 1, ownerID: 2, memberID: 2} {
+		if ids := api.searchIDs("/api/search?q=beach", userID); len(ids) != want || ids[len(ids)-1] != public.ID {
+			t.Errorf("results for %q = %v, want %d albums, the public one last", userID, ids, want)
+		}
+	}
+
+	for userID, want := range map[string]int{"": 0, strangerID: 0, ownerID: 1, memberID: 1} {
+		results := data[[]search.Result](api.request(http.MethodGet, "/api/search?q=grandma", userID, "").expect(http.StatusOK))
+		if len(results) != want {
+			t.Errorf("%d results for %q, want %d", len(results), userID, want)
+			continue
+		}
+		if want > 0 && (results[0].Picture == nil || results[0].Picture.ID != picture.ID || len(results[0].MatchedFaces) != 1) {
+			t.Errorf("results for %q = %+v, want the picture with its matched face", userID, results)
+		}
+	}
+}
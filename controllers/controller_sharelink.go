@@ -0,0 +1,587 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// SharePasswordHeader carries the password of a protected share link, the password query parameter can be used instead
+const SharePasswordHeader = "X-Share-Password"
+
+var (
+	errShareLinkExpired = apperror.New(http.StatusGone, "share_link_expired", "Share link has expired")
+
+	errSharePasswordRequired = apperror.New(http.StatusUnauthorized, "share_link_password_required",
+		"Share link is protected by a password, send it as "+SharePasswordHeader)
+
+	errInvalidSharePassword = apperror.New(http.StatusUnauthorized, "invalid_share_link_password",
+		"Invalid share link password")
+
+	errDownloadNotAllowed = apperror.New(http.StatusForbidden, "download_not_allowed",
+		"Share link does not allow downloads")
+)
+
+// ShareLinkRequest is the body of a share link creation
+type ShareLinkRequest struct {
+	Password      string    `binding:"omitempty,min=4,max=72"` // Optional password visitors must give
+	ExpiresAt     time.Time // Optional expiry, in the future
+	AllowDownload bool      // Whether visitors may download the pictures
+}
+
+// SharedContent is what a share link gives access to
+type SharedContent struct {
+	AllowDownload bool
+	ExpiresAt     time.Time
+	Album         *models.Album   `json:",omitempty"`
+	Picture       *models.Picture `json:",omitempty"`
+}
+
+// ShareLinkHandler serves the management of share links and the public read-only endpoints they open
+type ShareLinkHandler struct {
+	links       repository.ShareLinkRepository
+	albums      repository.AlbumRepository
+	pictures    repository.PictureRepository
+	blobs       repository.BlobRepository
+	invitations repository.InvitationRepository
+}
+
+// NewShareLinkHandler returns a ShareLinkHandler using the given repositories
+func NewShareLinkHandler(
+	links repository.ShareLinkRepository,
+	albums repository.AlbumRepository,
+	pictures repository.PictureRepository,
+	blobs repository.BlobRepository,
+	invitations repository.InvitationRepository,
+) *ShareLinkHandler {
+	return &ShareLinkHandler{links: links, albums: albums, pictures: pictures, blobs: blobs, invitations: invitations}
+}
+
+// CreateAlbumShareLink godoc
+// @Summary Create a public link to an album
+// @Description Creates a link giving read-only access to an album and its pictures to anyone holding its token, with an optional password and expiry
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
+// @Param albumId path string true "Album ID"
+// @Param link body ShareLinkRequest true "Password, expiry and download permission"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem "Smart album"
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/share-links [post]
+func (h *ShareLinkHandler) CreateAlbumShareLink(c *gin.Context) {
+	request, err := bindShareLink(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, err := h.authorizedAlbum(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if album.Criteria != nil {
+		apperror.Abort(c, errSmartAlbum)
+		return
+	}
+
+	h.create(c, ctx, request, models.ShareLink{AlbumID: album.ID})
+}
+
+// CreatePictureShareLink godoc
+// @Summary Create a public link to a picture
+// @Description Creates a link giving read-only access to a single picture to anyone holding its token, with an optional password and expiry
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the uploader of the picture or a manager of its album"
+// @Param pictureId path string true "Picture ID"
+// @Param link body ShareLinkRequest true "Password, expiry and download permission"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /pictures/{pictureId}/share-links [post]
+func (h *ShareLinkHandler) CreatePictureShareLink(c *gin.Context) {
+	request, err := bindShareLink(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	picture, err := h.authorizedPicture(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.create(c, ctx, request, models.ShareLink{PictureID: picture.ID})
+}
+
+// GetAlbumShareLinks godoc
+// @Summary List the public links to an album
+// @Description Fetches a page of the share links of an album with their access counts
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the album owner or a co-owner"
+// @Param albumId path string true "Album ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at, expires_at, access_count), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /albums/{albumId}/share-links [get]
+func (h *ShareLinkHandler) GetAlbumShareLinks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	album, err := h.authorizedAlbum(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.list(c, ctx, repository.ShareLinkFilter{AlbumID: &album.ID})
+}
+
+// GetPictureShareLinks godoc
+// @Summary List the public links to a picture
+// @Description Fetches a page of the share links of a picture with their access counts
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the uploader of the picture or a manager of its album"
+// @Param pictureId path string true "Picture ID"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, created_at, expires_at, access_count), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /pictures/{pictureId}/share-links [get]
+func (h *ShareLinkHandler) GetPictureShareLinks(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	picture, err := h.authorizedPicture(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	h.list(c, ctx, repository.ShareLinkFilter{PictureID: &picture.ID})
+}
+
+// DeleteShareLink godoc
+// @Summary Revoke a public link
+// @Description Deletes a share link, its token stops giving access immediately
+// @Tags sharing
+// @Produce json
+// @Param X-User-ID header string true "Acting user, allowed to create the link"
+// @Param linkId path string true "Share link ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /share-links/{linkId} [delete]
+func (h *ShareLinkHandler) DeleteShareLink(c *gin.Context) {
+	linkID, err := primitive.ObjectIDFromHex(c.Param("linkId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("share link"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	link, err := h.links.Get(ctx, linkID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "share link", "Failed to retrieve share link"))
+		return
+	}
+	if err := h.authorizeLink(c, ctx, link); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if err := h.links.Delete(ctx, linkID); err != nil {
+		apperror.Abort(c, fromRepository(err, "share link", "Failed to delete share link"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link deleted successfully"})
+}
+
+// OpenShareLink godoc
+// @Summary Open a public link
+// @Description Returns the album or picture a share link gives access to and counts the access; no account is needed
+// @Tags public
+// @Produce json
+// @Param token path string true "Share link token"
+// @Param X-Share-Password header string false "Password of a protected link"
+// @Param password query string false "Password of a protected link, when it cannot be sent as a header"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 410 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /shared/{token} [get]
+func (h *ShareLinkHandler) OpenShareLink(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	link, err := h.resolve(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	content := SharedContent{AllowDownload: link.AllowDownload, ExpiresAt: link.ExpiresAt}
+	if !link.AlbumID.IsZero() {
+		album, err := h.albums.Get(ctx, link.AlbumID)
+		if err != nil {
+			apperror.Abort(c, fromShareTarget(err, "Failed to retrieve album"))
+			return
+		}
+		content.Album = &album
+	} else {
+		picture, err := h.pictures.Get(ctx, link.PictureID)
+		if err != nil {
+			apperror.Abort(c, fromShareTarget(err, "Failed to retrieve picture"))
+			return
+		}
+		content.Picture = &picture
+	}
+
+	if err := h.links.RecordAccess(ctx, link.ID, time.Now()); err != nil {
+		slog.ErrorContext(ctx, "Failed to count share link access", "share_link_id", link.ID.Hex(), "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shared content retrieved successfully", "data": content})
+}
+
+// GetSharedPictures godoc
+// @Summary List the pictures of a shared album
+// @Description Retrieves a page of the pictures of the album a share link gives access to
+// @Tags public
+// @Produce json
+// @Param token path string true "Share link token"
+// @Param X-Share-Password header string false "Password of a protected link"
+// @Param password query string false "Password of a protected link, when it cannot be sent as a header"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, uploaded_at, taken_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} []models.Picture
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 410 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /shared/{token}/pictures [get]
+func (h *ShareLinkHandler) GetSharedPictures(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	link, err := h.resolve(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	// Links to a single picture have no album to list
+	if link.AlbumID.IsZero() {
+		apperror.Abort(c, apperror.NotFound("album"))
+		return
+	}
+
+	respondWithAlbumPictures(c, ctx, h.pictures, repository.PictureFilter{AlbumID: &link.AlbumID})
+}
+
+// GetSharedPicture godoc
+// @Summary Get a shared picture
+// @Description Retrieves a picture a share link gives access to, the picture of the link or one of its album
+// @Tags public
+// @Produce json
+// @Param token path string true "Share link token"
+// @Param pictureId path string true "Picture ID"
+// @Param X-Share-Password header string false "Password of a protected link"
+// @Param password query string false "Password of a protected link, when it cannot be sent as a header"
+// @Success 200 {object} models.Picture
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 410 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /shared/{token}/pictures/{pictureId} [get]
+func (h *ShareLinkHandler) GetSharedPicture(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	_, picture, err := h.sharedPicture(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Picture retrieved successfully", "data": picture})
+}
+
+// GetSharedPictureData godoc
+// @Summary Get the image of a shared picture
+// @Description Retrieves the image of a picture a share link gives access to; download=true serves it as an attachment when the link allows downloads
+// @Tags public
+// @Produce image/webp
+// @Param token path string true "Share link token"
+// @Param pictureId path string true "Picture ID"
+// @Param download query bool false "Serve the image as an attachment to save"
+// @Param X-Share-Password header string false "Password of a protected link"
+// @Param password query string false "Password of a protected link, when it cannot be sent as a header"
+// @Success 200 {string} string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 410 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /shared/{token}/pictures/{pictureId}/data [get]
+func (h *ShareLinkHandler) GetSharedPictureData(c *gin.Context) {
+	download, err := strconv.ParseBool(c.DefaultQuery("download", "false"))
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidInput, "download must be a boolean"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	link, picture, err := h.sharedPicture(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if download && !link.AllowDownload {
+		apperror.Abort(c, errDownloadNotAllowed)
+		return
+	}
+
+	writePictureData(c, ctx, h.blobs, picture, download)
+}
+
+// create stores a new link to the target with a fresh token
+func (h *ShareLinkHandler) create(c *gin.Context, ctx context.Context, request ShareLinkRequest, link models.ShareLink) {
+	token, err := newToken()
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to create share link", err))
+		return
+	}
+
+	if request.Password != "" {
+		if link.PasswordHash, err = bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost); err != nil {
+			apperror.Abort(c, apperror.Internal("Failed to create share link", err))
+			return
+		}
+		link.HasPassword = true
+	}
+
+	link.CreatedByID, _, _ = actingUser(c)
+	link.ID = primitive.NewObjectID()
+	link.Token = token
+	link.AllowDownload = request.AllowDownload
+	link.ExpiresAt = request.ExpiresAt
+	link.CreatedAt = time.Now()
+
+	if err := h.links.Create(ctx, &link); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to create share link", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Share link created successfully", "data": link})
+}
+
+// list answers the page of the links matching filter
+func (h *ShareLinkHandler) list(c *gin.Context, ctx context.Context, filter repository.ShareLinkFilter) {
+	query, err := parsePageQuery(c, shareLinkListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	page, err := h.links.List(ctx, filter, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve share links", err)
+		return
+	}
+
+	respondWithPage(c, "Share links retrieved successfully", query, page)
+}
+
+// authorizedAlbum returns the album in the path once the acting user is allowed to share it
+func (h *ShareLinkHandler) authorizedAlbum(c *gin.Context, ctx context.Context) (models.Album, error) {
+	albumID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		return models.Album{}, apperror.InvalidID("album")
+	}
+
+	album, err := h.albums.Get(ctx, albumID)
+	if err != nil {
+		return album, fromRepository(err, "album", "Failed to retrieve album")
+	}
+	return album, authorizeAlbum(c, ctx, h.invitations, album, rightManage)
+}
+
+// authorizedPicture returns the picture in the path once the acting user is allowed to share it
+func (h *ShareLinkHandler) authorizedPicture(c *gin.Context, ctx context.Context) (models.Picture, error) {
+	pictureID, err := primitive.ObjectIDFromHex(c.Param("pictureId"))
+	if err != nil {
+		return models.Picture{}, apperror.InvalidID("picture")
+	}
+
+	picture, err := h.pictures.Get(ctx, pictureID)
+	if err != nil {
+		return picture, fromRepository(err, "picture", "Failed to retrieve picture")
+	}
+	return picture, h.authorizePicture(c, ctx, picture)
+}
+
+// authorizeLink checks that the acting user may manage links to the target of link, as long as it still exists
+func (h *ShareLinkHandler) authorizeLink(c *gin.Context, ctx context.Context, link models.ShareLink) error {
+	if !link.AlbumID.IsZero() {
+		album, err := h.albums.Get(ctx, link.AlbumID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return apperror.Internal("Failed to retrieve album", err)
+		}
+		return authorizeAlbum(c, ctx, h.invitations, album, rightManage)
+	}
+
+	picture, err := h.pictures.Get(ctx, link.PictureID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve picture", err)
+	}
+	return h.authorizePicture(c, ctx, picture)
+}
+
+// authorizePicture checks that the acting user may share the picture: whoever may remove it from its album may share it,
+// only its uploader may share a picture outside any album, such as a profile picture
+func (h *ShareLinkHandler) authorizePicture(c *gin.Context, ctx context.Context, picture models.Picture) error {
+	if picture.AlbumID.IsZero() {
+		return authorizeUploader(c, picture)
+	}
+
+	album, err := h.albums.Get(ctx, picture.AlbumID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return authorizeUploader(c, picture)
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve album", err)
+	}
+	return authorizePictureRemoval(c, ctx, h.invitations, album, picture)
+}
+
+// resolve returns the link of the token in the path, once checked that it is still valid and its password was given
+func (h *ShareLinkHandler) resolve(c *gin.Context, ctx context.Context) (models.ShareLink, error) {
+	link, err := h.links.GetByToken(ctx, c.Param("token"))
+	if err != nil {
+		return link, fromRepository(err, "share link", "Failed to retrieve share link")
+	}
+	if !link.ExpiresAt.IsZero() && time.Now().After(link.ExpiresAt) {
+		return link, errShareLinkExpired
+	}
+
+	if link.HasPassword {
+		password := c.GetHeader(SharePasswordHeader)
+		if password == "" {
+			password = c.Query("password")
+		}
+		if password == "" {
+			return link, errSharePasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword(link.PasswordHash, []byte(password)) != nil {
+			return link, errInvalidSharePassword
+		}
+	}
+	return link, nil
+}
+
+// sharedPicture returns the link of the token in the path and the picture in the path, which must be the shared picture
+// or one of the shared album
+func (h *ShareLinkHandler) sharedPicture(c *gin.Context, ctx context.Context) (models.ShareLink, models.Picture, error) {
+	link, err := h.resolve(c, ctx)
+	if err != nil {
+		return link, models.Picture{}, err
+	}
+
+	pictureID, err := primitive.ObjectIDFromHex(c.Param("pictureId"))
+	if err != nil {
+		return link, models.Picture{}, apperror.InvalidID("picture")
+	}
+
+	picture, err := h.pictures.Get(ctx, pictureID)
+	if err != nil {
+		return link, picture, fromRepository(err, "picture", "Failed to retrieve picture")
+	}
+	// Pictures outside of the link are reported missing rather than forbidden, not to disclose them
+	if picture.ID != link.PictureID && (link.AlbumID.IsZero() || picture.AlbumID != link.AlbumID) {
+		return link, picture, apperror.NotFound("picture")
+	}
+	return link, picture, nil
+}
+
+// bindShareLink reads and validates the share link in the request body
+func bindShareLink(c *gin.Context) (ShareLinkRequest, error) {
+	var request ShareLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		return request, apperror.InvalidInput(err)
+	}
+	if !request.ExpiresAt.IsZero() && !request.ExpiresAt.After(time.Now()) {
+		return request, apperror.BadRequest("invalid_expiry", "ExpiresAt must be in the future")
+	}
+	return request, nil
+}
+
+// fromShareTarget maps the failure to fetch the target of a link, a deleted target makes the link unusable
+func fromShareTarget(err error, failure string) *apperror.Error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound("share link")
+	}
+	return apperror.Internal(failure, err)
+}
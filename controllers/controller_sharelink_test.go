@@ -0,0 +1,166 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+)
+
+func TestCreateAlbumShareLink(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, contributorID := api.createUser("alice"), api.createUser("bob")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, contributorID, "bob", models.RoleContributor)
+	path := "/api/albums/" + album.ID.Hex() + "/share-links"
+
+	link := data[models.ShareLink](api.request(http.MethodPost, path, ownerID, `{"Password":"open sesame","AllowDownload":true}`).expect(http.StatusCreated))
+	if link.Token == "" || link.AlbumID != album.ID || link.CreatedByID.Hex() != ownerID || !link.HasPassword || !link.AllowDownload {
+		t.Errorf("link = %+v", link)
+	}
+
+	api.request(http.MethodPost, path, contributorID, `{}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", `{}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPost, path, ownerID, `{"Password":"abc"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, ownerID, `{"ExpiresAt":"2020-01-01T00:00:00Z"}`).expectProblem(http.StatusBadRequest, "invalid_expiry")
+	api.request(http.MethodPost, "/api/albums/"+primitive.NewObjectID().Hex()+"/share-links", ownerID, `{}`).expectProblem(http.StatusNotFound, "album_not_found")
+
+	smart := data[models.Album](api.request(http.MethodPost, "/api/albums/", ownerID, `{"Title":"Beach","Criteria":{"Tags":["beach"]}}`).
+		expect(http.StatusCreated))
+	api.request(http.MethodPost, "/api/albums/"+smart.ID.Hex()+"/share-links", ownerID, `{}`).expectProblem(http.StatusConflict, "smart_album")
+}
+
+func TestCreatePictureShareLink(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, contributorID, viewerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, contributorID, "bob", models.RoleContributor)
+	api.share(album, viewerID, "carol", models.RoleViewer)
+	picture := api.uploadPicture(album.ID.Hex(), contributorID)
+
+	// whoever may remove a picture from its album may share it
+	for _, userID := range []string{contributorID, ownerID} {
+		link := data[models.ShareLink](api.request(http.MethodPost, "/api/pictures/"+picture.ID.Hex()+"/share-links", userID, `{}`).expect(http.StatusCreated))
+		if link.PictureID != picture.ID || !link.AlbumID.IsZero() {
+			t.Errorf("link = %+v, want a link to the picture", link)
+		}
+	}
+	api.request(http.MethodPost, "/api/pictures/"+picture.ID.Hex()+"/share-links", viewerID, `{}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+
+	// only the uploader shares a picture outside any album
+	loose := data[models.Picture](api.upload("/api/pictures/", contributorID, 30, 20, nil).expect(http.StatusCreated))
+	path := "/api/pictures/" + loose.ID.Hex() + "/share-links"
+	api.request(http.MethodPost, path, ownerID, `{}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", `{}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPost, path, contributorID, `{}`).expect(http.StatusCreated)
+	api.request(http.MethodPost, "/api/pictures/nope/share-links", contributorID, `{}`).expectProblem(http.StatusBadRequest, "invalid_picture_id")
+}
+
+func TestListAndDeleteShareLinks(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, viewerID := api.createUser("alice"), api.createUser("bob")
+	album := api.createAlbum(ownerID, true)
+	api.share(album, viewerID, "bob", models.RoleViewer)
+	picture := api.uploadPicture(album.ID.Hex(), ownerID)
+	albumLinks, pictureLinks := "/api/albums/"+album.ID.Hex()+"/share-links", "/api/pictures/"+picture.ID.Hex()+"/share-links"
+	first := data[models.ShareLink](api.request(http.MethodPost, albumLinks, ownerID, `{"Password":"open sesame"}`).expect(http.StatusCreated))
+	api.request(http.MethodPost, albumLinks, ownerID, `{}`).expect(http.StatusCreated)
+	api.request(http.MethodPost, pictureLinks, ownerID, `{}`).expect(http.StatusCreated)
+
+	page := api.request(http.MethodGet, albumLinks+"?limit=1&sort=created_at", ownerID, "").expect(http.StatusOK)
+	if links := data[[]models.ShareLink](page); len(links) != 1 || links[0].ID != first.ID || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the first link and more", page.Body.String())
+	}
+	if strings.Contains(page.Body.String(), "PasswordHash") {
+		t.Errorf("password hash disclosed: %s", page.Body.String())
+	}
+	if links := data[[]models.ShareLink](api.request(http.MethodGet, pictureLinks, ownerID, "").expect(http.StatusOK)); len(links) != 1 {
+		t.Errorf("%d links to the picture, want 1", len(links))
+	}
+	api.request(http.MethodGet, albumLinks, viewerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, pictureLinks, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+
+	api.request(http.MethodDelete, "/api/share-links/"+first.ID.Hex(), viewerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodDelete, "/api/share-links/"+first.ID.Hex(), ownerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/shared/"+first.Token, "", "").expectProblem(http.StatusNotFound, "share_link_not_found")
+	api.request(http.MethodDelete, "/api/share-links/"+first.ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "share_link_not_found")
+	api.request(http.MethodDelete, "/api/share-links/nope", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_share_link_id")
+}
+
+func TestOpenShareLink(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	album := api.createAlbum(ownerID, true)
+	picture := api.uploadPicture(album.ID.Hex(), ownerID)
+	link := data[models.ShareLink](api.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/share-links", ownerID, `{"Password":"open sesame"}`).
+		expect(http.StatusCreated))
+	path := "/api/shared/" + link.Token
+
+	api.request(http.MethodGet, path, "", "").expectProblem(http.StatusUnauthorized, "share_link_password_required")
+	api.request(http.MethodGet, path, "", "", "X-Share-Password", "close sesame").expectProblem(http.StatusUnauthorized, "invalid_share_link_password")
+	content := data[map[string]any](api.request(http.MethodGet, path, "", "", "X-Share-Password", "open sesame").expect(http.StatusOK))
+	if album, _ := content["Album"].(map[string]any); album == nil || album["ID"] != link.AlbumID.Hex() || content["Picture"] != nil {
+		t.Errorf("shared content = %+v, want the album", content)
+	}
+	api.request(http.MethodGet, path+"?password=open+sesame", "", "").expect(http.StatusOK)
+
+	links := data[[]models.ShareLink](api.request(http.MethodGet, "/api/albums/"+album.ID.Hex()+"/share-links", ownerID, "").expect(http.StatusOK))
+	if len(links) != 1 || links[0].AccessCount != 2 || links[0].LastAccessedAt.IsZero() {
+		t.Errorf("links = %+v, want two accesses counted", links)
+	}
+
+	// links to a deleted target stop working
+	pictureLink := data[models.ShareLink](api.request(http.MethodPost, "/api/pictures/"+picture.ID.Hex()+"/share-links", ownerID, `{}`).
+		expect(http.StatusCreated))
+	api.request(http.MethodDelete, "/api/pictures/"+picture.ID.Hex(), ownerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/shared/"+pictureLink.Token, "", "").expectProblem(http.StatusNotFound, "share_link_not_found")
+
+	expired := models.ShareLink{ID: primitive.NewObjectID(), Token: "expired", AlbumID: album.ID, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := api.repos.ShareLinks.Create(context.Background(), &expired); err != nil {
+		t.Fatal(err)
+	}
+	api.request(http.MethodGet, "/api/shared/expired", "", "").expectProblem(http.StatusGone, "share_link_expired")
+	api.request(http.MethodGet, "/api/shared/unknown", "", "").expectProblem(http.StatusNotFound, "share_link_not_found")
+}
+
+func TestGetSharedPictures(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	album, other := api.createAlbum(ownerID, true), api.createAlbum(ownerID, true)
+	first, second := api.uploadPicture(album.ID.Hex(), ownerID), api.uploadPicture(album.ID.Hex(), ownerID)
+	outside := api.uploadPicture(other.ID.Hex(), ownerID)
+	albumLink := data[models.ShareLink](api.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/share-links", ownerID, `{}`).expect(http.StatusCreated))
+	pictureLink := data[models.ShareLink](api.request(http.MethodPost, "/api/pictures/"+first.ID.Hex()+"/share-links", ownerID, `{"AllowDownload":true}`).
+		expect(http.StatusCreated))
+	shared := "/api/shared/" + albumLink.Token + "/pictures"
+
+	page := api.request(http.MethodGet, shared+"?limit=1&sort=-uploaded_at", "", "").expect(http.StatusOK)
+	if pictures := data[[]models.Picture](page); len(pictures) != 1 || pictures[0].ID != second.ID || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the second picture and more", page.Body.String())
+	}
+	api.request(http.MethodGet, "/api/shared/"+pictureLink.Token+"/pictures", "", "").expectProblem(http.StatusNotFound, "album_not_found")
+
+	if picture := data[models.Picture](api.request(http.MethodGet, shared+"/"+second.ID.Hex(), "", "").expect(http.StatusOK)); picture.ID != second.ID {
+		t.Errorf("shared picture = %+v, want %s", picture, second.ID.Hex())
+	}
+	// pictures outside of the link are not disclosed
+	api.request(http.MethodGet, shared+"/"+outside.ID.Hex(), "", "").expectProblem(http.StatusNotFound, "picture_not_found")
+	api.request(http.MethodGet, "/api/shared/"+pictureLink.Token+"/pictures/"+second.ID.Hex(), "", "").expectProblem(http.StatusNotFound, "picture_not_found")
+	api.request(http.MethodGet, shared+"/nope", "", "").expectProblem(http.StatusBadRequest, "invalid_picture_id")
+
+	r := api.request(http.MethodGet, shared+"/"+first.ID.Hex()+"/data", "", "").expect(http.StatusOK)
+	if r.Header().Get("Content-Type") != "image/webp" || r.Header().Get("Content-Disposition") != "" {
+		t.Errorf("picture data of type %q and disposition %q", r.Header().Get("Content-Type"), r.Header().Get("Content-Disposition"))
+	}
+	api.request(http.MethodGet, shared+"/"+first.ID.Hex()+"/data?download=true", "", "").expectProblem(http.StatusForbidden, "download_not_allowed")
+	api.request(http.MethodGet, shared+"/"+first.ID.Hex()+"/data?download=maybe", "", "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	r = api.request(http.MethodGet, "/api/shared/"+pictureLink.Token+"/pictures/"+first.ID.Hex()+"/data?download=true", "", "").expect(http.StatusOK)
+	if !strings.HasPrefix(r.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("disposition = %q, want an attachment", r.Header().Get("Content-Disposition"))
+	}
+}
@@ -0,0 +1,651 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/events"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+// GiftClaimValidity is how long the recipient of a gifted frame has to claim it
+const GiftClaimValidity = 30 * 24 * time.Hour
+
+var errGiftExpired = apperror.New(http.StatusGone, "gift_expired", "The gift claim token has expired")
+
+// FrameRequest is the body of a frame creation
+type FrameRequest struct {
+	Name string `binding:"max=100"` // Name given by the owner, e.g. the room the frame stands in
+}
+
+// FrameAlbumRequest is the body of the loading of an album onto a frame
+type FrameAlbumRequest struct {
+	AlbumID primitive.ObjectID `binding:"required"`
+}
+
+// ClaimRequest is the body of the claim of a gifted frame
+type ClaimRequest struct {
+	ClaimToken string `binding:"required"`
+}
+
+// GiftResponse is returned when gifting a frame; the claim token is only ever returned there
+type GiftResponse struct {
+	ClaimToken string
+	ExpiresAt  time.Time
+	Frame      models.SmartFrame
+}
+
+// ClaimResponse is returned when claiming a gifted frame
+type ClaimResponse struct {
+	Frame models.SmartFrame
+	// TransferredAlbumIDs are the preloaded albums of the gifter now owned by the recipient
+	TransferredAlbumIDs []primitive.ObjectID
+}
+
+// SmartFrameHandler serves the smart frame endpoints: frames, their albums and gifting them
+type SmartFrameHandler struct {
+	frames        repository.FrameRepository
+	albums        repository.AlbumRepository
+	invitations   repository.InvitationRepository
+	notifications repository.NotificationRepository
+	heartbeats    repository.HeartbeatRepository
+	displayStats  repository.DisplayStatRepository
+	events        *events.Broker
+}
+
+// NewSmartFrameHandler returns a SmartFrameHandler using the given repositories
+func NewSmartFrameHandler(
+	frames repository.FrameRepository,
+	albums repository.AlbumRepository,
+	invitations repository.InvitationRepository,
+	notifications repository.NotificationRepository,
+	heartbeats repository.HeartbeatRepository,
+	displayStats repository.DisplayStatRepository,
+	broker *events.Broker,
+) *SmartFrameHandler {
+	return &SmartFrameHandler{
+		frames:        frames,
+		albums:        albums,
+		invitations:   invitations,
+		notifications: notifications,
+		heartbeats:    heartbeats,
+		displayStats:  displayStats,
+		events:        broker,
+	}
+}
+
+// CreateFrame godoc
+// @Summary Register a smart frame
+// @Description Registers a smart frame owned by the acting user, who can then load albums onto it and gift it
+// @Tags smart-frames
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frame body FrameRequest true "Frame"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames [post]
+func (h *SmartFrameHandler) CreateFrame(c *gin.Context) {
+	ownerID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var request FrameRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame := models.SmartFrame{
+		ID:           primitive.NewObjectID(),
+		Name:         request.Name,
+		OwnerID:      ownerID,
+		LoadedAlbums: []primitive.ObjectID{},
+		Settings:     withDefaults(models.DisplaySettings{}),
+		CreatedAt:    time.Now(),
+	}
+	frame.UpdatedAt = frame.CreatedAt
+
+	if err := h.frames.Create(ctx, &frame); err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to create frame", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Frame created successfully", "data": frame})
+}
+
+// GetMyFrames godoc
+// @Summary List the frames of the acting user
+// @Description Fetches a page of the frames owned by the acting user
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user"
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, name, created_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames [get]
+func (h *SmartFrameHandler) GetMyFrames(c *gin.Context) {
+	ownerID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	query, err := parsePageQuery(c, frameListSpec)
+	if err != nil {
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	page, err := h.frames.List(ctx, repository.FrameFilter{OwnerID: &ownerID}, query)
+	if err != nil {
+		respondWithPageError(c, "Failed to retrieve frames", err)
+		return
+	}
+
+	respondWithPage(c, "Frames retrieved successfully", query, page)
+}
+
+// GetFrame godoc
+// @Summary Get a smart frame
+// @Description Get a frame with the albums loaded onto it
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId} [get]
+func (h *SmartFrameHandler) GetFrame(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Frame retrieved successfully", "data": frame})
+}
+
+// DeleteFrame godoc
+// @Summary Delete a smart frame
+// @Description Unregisters a frame along with its telemetry, the albums loaded onto it are kept
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId} [delete]
+func (h *SmartFrameHandler) DeleteFrame(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	if err := h.frames.Delete(ctx, frame.ID); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to delete frame"))
+		return
+	}
+
+	// The telemetry of the frame goes with it
+	if err := h.heartbeats.DeleteByFrame(ctx, frame.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove heartbeats of deleted frame", "frame_id", frame.ID.Hex(), "error", err)
+	}
+	if err := h.displayStats.DeleteByFrame(ctx, frame.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove display stats of deleted frame", "frame_id", frame.ID.Hex(), "error", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Frame deleted successfully"})
+}
+
+// LoadAlbum godoc
+// @Summary Load an album onto a smart frame
+// @Description Adds an album the acting user can view to the albums displayed by a frame
+// @Tags smart-frames
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param album body FrameAlbumRequest true "Album to load"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/albums [post]
+func (h *SmartFrameHandler) LoadAlbum(c *gin.Context) {
+	var request FrameAlbumRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	album, err := h.albums.Get(ctx, request.AlbumID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "album", "Failed to retrieve album"))
+		return
+	}
+	if err := authorizeAlbum(c, ctx, h.invitations, album, rightView); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if slices.Contains(frame.LoadedAlbums, album.ID) {
+		apperror.Abort(c, apperror.Conflict("album_already_loaded", "Album is already loaded onto the frame"))
+		return
+	}
+
+	frame, err = h.setLoadedAlbums(ctx, frame, append(frame.LoadedAlbums, album.ID))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	h.events.Publish(frame.ID, events.TypeSettingsChanged, events.ConfigChanged{Version: frame.ConfigVersion})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Album loaded successfully", "data": frame})
+}
+
+// UnloadAlbum godoc
+// @Summary Remove an album from a smart frame
+// @Description Stops displaying an album on a frame, the album itself is kept
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Param albumId path string true "Album ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/albums/{albumId} [delete]
+func (h *SmartFrameHandler) UnloadAlbum(c *gin.Context) {
+	albumID, err := primitive.ObjectIDFromHex(c.Param("albumId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("album"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	index := slices.Index(frame.LoadedAlbums, albumID)
+	if index < 0 {
+		apperror.Abort(c, apperror.NotFound("loaded album"))
+		return
+	}
+
+	frame, err = h.setLoadedAlbums(ctx, frame, slices.Delete(frame.LoadedAlbums, index, index+1))
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	h.events.Publish(frame.ID, events.TypeAlbumRemoved, events.AlbumRemoved{AlbumID: albumID, Version: frame.ConfigVersion})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Album removed successfully", "data": frame})
+}
+
+// GiftFrame godoc
+// @Summary Gift a smart frame
+// @Description Generates the claim token the recipient of the frame claims it with, replacing any previous one. The token is only returned here.
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 201 {object} GiftResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/gift [post]
+func (h *SmartFrameHandler) GiftFrame(c *gin.Context) {
+	if _, err := requireActingUser(c); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		apperror.Abort(c, apperror.Internal("Failed to gift frame", err))
+		return
+	}
+
+	frame.ClaimTokenHash = hashToken(token)
+	frame.ClaimExpiresAt = time.Now().Add(GiftClaimValidity)
+	frame.UpdatedAt = versioning.NextUpdatedAt(frame.UpdatedAt)
+	fields := repository.Fields{
+		"claim_token_hash": frame.ClaimTokenHash,
+		"claim_expires_at": frame.ClaimExpiresAt,
+		"updated_at":       frame.UpdatedAt,
+	}
+	if err := h.frames.Update(ctx, frame.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to gift frame"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Frame ready to be claimed",
+		"data":    GiftResponse{ClaimToken: token, ExpiresAt: frame.ClaimExpiresAt, Frame: frame},
+	})
+}
+
+// CancelGift godoc
+// @Summary Cancel the gift of a smart frame
+// @Description Invalidates the claim token of a frame that was not claimed yet
+// @Tags smart-frames
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the owner of the frame"
+// @Param frameId path string true "Frame ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem "No acting user"
+// @Failure 403 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/{frameId}/gift [delete]
+func (h *SmartFrameHandler) CancelGift(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.ownedFrame(c, ctx)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if frame.ClaimTokenHash == "" {
+		apperror.Abort(c, apperror.NotFound("gift"))
+		return
+	}
+
+	frame.ClaimTokenHash = ""
+	frame.ClaimExpiresAt = time.Time{}
+	frame.UpdatedAt = versioning.NextUpdatedAt(frame.UpdatedAt)
+	fields := repository.Fields{
+		"claim_token_hash": frame.ClaimTokenHash,
+		"claim_expires_at": frame.ClaimExpiresAt,
+		"updated_at":       frame.UpdatedAt,
+	}
+	if err := h.frames.Update(ctx, frame.ID, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to cancel gift"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gift cancelled successfully", "data": frame})
+}
+
+// ClaimFrame godoc
+// @Summary Claim a gifted smart frame
+// @Description Pairs a gifted frame with the acting user, who becomes its owner. The preloaded albums owned by the gifter are handed over too, the gifter stays a contributor on them and is notified.
+// @Tags smart-frames
+// @Accept json
+// @Produce json
+// @Param X-User-ID header string true "Acting user, the recipient of the frame"
+// @Param claim body ClaimRequest true "Claim token received from the gifter"
+// @Success 200 {object} ClaimResponse
+// @Failure 400 {object} apperror.Problem
+// @Failure 401 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 410 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /smart-frames/claim [post]
+func (h *SmartFrameHandler) ClaimFrame(c *gin.Context) {
+	recipientID, err := requireActingUser(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	var request ClaimRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apperror.Abort(c, apperror.InvalidInput(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	frame, err := h.frames.GetByClaimToken(ctx, hashToken(request.ClaimToken))
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "gift", "Failed to retrieve gift"))
+		return
+	}
+	if time.Now().After(frame.ClaimExpiresAt) {
+		apperror.Abort(c, errGiftExpired)
+		return
+	}
+	if frame.OwnerID == recipientID {
+		apperror.Abort(c, apperror.Conflict("own_frame", "The frame already belongs to the acting user"))
+		return
+	}
+
+	// The conditional update makes sure a token is only ever claimed once
+	gifterID := frame.OwnerID
+	previousUpdate := frame.UpdatedAt
+	frame.OwnerID = recipientID
+	frame.GiftedByID = gifterID
+	frame.ClaimTokenHash = ""
+	frame.ClaimExpiresAt = time.Time{}
+	frame.ClaimedAt = time.Now()
+	frame.UpdatedAt = versioning.NextUpdatedAt(previousUpdate)
+	fields := repository.Fields{
+		"owner_id":         frame.OwnerID,
+		"gifted_by_id":     frame.GiftedByID,
+		"claim_token_hash": frame.ClaimTokenHash,
+		"claim_expires_at": frame.ClaimExpiresAt,
+		"claimed_at":       frame.ClaimedAt,
+		"updated_at":       frame.UpdatedAt,
+	}
+	if err := h.frames.UpdateIfUnmodified(ctx, frame.ID, previousUpdate, fields); err != nil {
+		if errors.Is(err, repository.ErrModified) {
+			apperror.Abort(c, apperror.Conflict("gift_already_claimed", "The gift was claimed or changed meanwhile"))
+			return
+		}
+		apperror.Abort(c, fromRepository(err, "frame", "Failed to claim frame"))
+		return
+	}
+
+	transferred := h.handOverAlbums(ctx, frame, gifterID, recipientID)
+
+	notify(ctx, h.notifications, models.Notification{
+		UserID:  gifterID,
+		Type:    models.NotificationFrameClaimed,
+		Message: "Your gifted frame " + frame.Name + " was claimed",
+		ActorID: recipientID,
+		FrameID: frame.ID,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Frame claimed successfully",
+		"data":    ClaimResponse{Frame: frame, TransferredAlbumIDs: transferred},
+	})
+}
+
+// handOverAlbums makes the recipient the owner of the loaded albums owned by the gifter, who stays a contributor.
+// Smart albums select the pictures of the gifter, so they are kept by the gifter.
+// Failures are logged and the album skipped, the frame already changed hands.
+func (h *SmartFrameHandler) handOverAlbums(ctx context.Context, frame models.SmartFrame, gifterID, recipientID primitive.ObjectID) []primitive.ObjectID {
+	transferred := []primitive.ObjectID{}
+	for _, albumID := range frame.LoadedAlbums {
+		album, err := h.albums.Get(ctx, albumID)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				slog.ErrorContext(ctx, "Failed to retrieve gifted album", "album_id", albumID.Hex(), "error", err)
+			}
+			continue
+		}
+		if album.OwnerID != gifterID || album.Criteria != nil {
+			continue
+		}
+
+		if err := h.handOverAlbum(ctx, album, gifterID, recipientID); err != nil {
+			slog.ErrorContext(ctx, "Failed to hand over gifted album", "album_id", albumID.Hex(), "error", err)
+			continue
+		}
+		transferred = append(transferred, albumID)
+	}
+	return transferred
+}
+
+// handOverAlbum transfers the album to the recipient and keeps the gifter as an accepted contributor
+func (h *SmartFrameHandler) handOverAlbum(ctx context.Context, album models.Album, gifterID, recipientID primitive.ObjectID) error {
+	now := time.Now()
+	album.OwnerID = recipientID
+	album.UpdatedAt = versioning.NextUpdatedAt(album.UpdatedAt)
+	if err := h.albums.Update(ctx, album.ID, repository.Fields{"user_id": album.OwnerID, "updated_at": album.UpdatedAt}); err != nil {
+		return err
+	}
+
+	membership := repository.Fields{
+		"role":         models.RoleContributor,
+		"status":       models.InvitationAccepted,
+		"responded_at": now,
+		"updated_at":   now,
+	}
+	invitation, err := h.invitations.GetByAlbumAndUser(ctx, album.ID, gifterID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		err = h.invitations.Create(ctx, &models.AlbumInvitation{
+			ID:          primitive.NewObjectID(),
+			AlbumID:     album.ID,
+			UserID:      gifterID,
+			InvitedByID: recipientID,
+			Role:        models.RoleContributor,
+			Status:      models.InvitationAccepted,
+			CreatedAt:   now,
+			RespondedAt: now,
+			UpdatedAt:   now,
+		})
+	case err == nil:
+		err = h.invitations.Update(ctx, invitation.ID, membership)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The recipient owns the album now, a previous invitation of theirs is moot
+	invitation, err = h.invitations.GetByAlbumAndUser(ctx, album.ID, recipientID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		err = nil
+	case err == nil:
+		err = h.invitations.Update(ctx, invitation.ID, repository.Fields{"status": models.InvitationRevoked, "updated_at": now})
+	}
+	if err != nil {
+		return err
+	}
+
+	return syncAlbumMembers(ctx, h.albums, h.invitations, album)
+}
+
+// ownedFrame returns the frame in the path once checked that the acting user owns it
+func (h *SmartFrameHandler) ownedFrame(c *gin.Context, ctx context.Context) (models.SmartFrame, error) {
+	frameID, err := primitive.ObjectIDFromHex(c.Param("frameId"))
+	if err != nil {
+		return models.SmartFrame{}, apperror.InvalidID("frame")
+	}
+
+	frame, err := h.frames.Get(ctx, frameID)
+	if err != nil {
+		return frame, fromRepository(err, "frame", "Failed to retrieve frame")
+	}
+
+	userID, err := requireActingUser(c)
+	if err != nil {
+		return frame, err
+	}
+	if userID != frame.OwnerID {
+		return frame, apperror.Forbidden("Not allowed to manage this frame")
+	}
+	return frame, nil
+}
+
+// setLoadedAlbums stores the albums displayed by the frame, dropping the weights of the removed ones,
+// and returns the updated frame
+func (h *SmartFrameHandler) setLoadedAlbums(ctx context.Context, frame models.SmartFrame, albumIDs []primitive.ObjectID) (models.SmartFrame, error) {
+	previousUpdate := frame.UpdatedAt
+	frame.LoadedAlbums = nonNil(albumIDs)
+	frame.Settings = withDefaults(frame.Settings)
+	frame.Settings.AlbumWeights = slices.DeleteFunc(frame.Settings.AlbumWeights, func(weight models.AlbumWeight) bool {
+		return !slices.Contains(frame.LoadedAlbums, weight.AlbumID)
+	})
+	frame.ConfigVersion++
+	frame.UpdatedAt = versioning.NextUpdatedAt(previousUpdate)
+
+	fields := repository.Fields{
+		"loaded_albums_id": frame.LoadedAlbums,
+		"settings":         frame.Settings,
+		"config_version":   frame.ConfigVersion,
+		"updated_at":       frame.UpdatedAt,
+	}
+	if err := h.frames.UpdateIfUnmodified(ctx, frame.ID, previousUpdate, fields); err != nil {
+		return frame, fromRepository(err, "frame", "Failed to update frame")
+	}
+	return frame, nil
+}
@@ -0,0 +1,181 @@
+package controllers_test
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// createFrame registers a smart frame of ownerID
+func (a *testAPI) createFrame(ownerID string) models.SmartFrame {
+	a.t.Helper()
+	return data[models.SmartFrame](a.request(http.MethodPost, "/api/smart-frames/", ownerID, `{"Name":"Kitchen"}`).expect(http.StatusCreated))
+}
+
+// giftFrame gifts the frame and returns its claim token
+func (a *testAPI) giftFrame(frame models.SmartFrame) string {
+	a.t.Helper()
+	return data[controllers.GiftResponse](a.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/gift", frame.OwnerID.Hex(), "").
+		expect(http.StatusCreated)).ClaimToken
+}
+
+func TestCreateFrame(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+
+	frame := api.createFrame(ownerID)
+	if frame.OwnerID.Hex() != ownerID || frame.Name != "Kitchen" || frame.LoadedAlbums == nil || frame.Settings.SlideInterval != controllers.DefaultSlideInterval {
+		t.Errorf("frame = %+v, want owned, named, without albums and with the default settings", frame)
+	}
+
+	api.request(http.MethodPost, "/api/smart-frames/", "", `{}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPost, "/api/smart-frames/", ownerID, `{"Name":1}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+}
+
+func TestGetFrames(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	first, second := api.createFrame(ownerID), api.createFrame(ownerID)
+	api.createFrame(strangerID)
+
+	page := api.request(http.MethodGet, "/api/smart-frames/?limit=1&sort=-created_at", ownerID, "").expect(http.StatusOK)
+	if frames := data[[]models.SmartFrame](page); len(frames) != 1 || frames[0].ID != second.ID || !pagination(page).HasMore {
+		t.Errorf("first page = %s, want the second frame and more", page.Body.String())
+	}
+	api.request(http.MethodGet, "/api/smart-frames/", "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodGet, "/api/smart-frames/?sort=nope", ownerID, "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+
+	path := "/api/smart-frames/" + first.ID.Hex()
+	if frame := data[models.SmartFrame](api.request(http.MethodGet, path, ownerID, "").expect(http.StatusOK)); frame.ID != first.ID {
+		t.Errorf("frame = %+v, want %s", frame, first.ID.Hex())
+	}
+	api.request(http.MethodGet, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodGet, path, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodGet, "/api/smart-frames/nope", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_frame_id")
+	api.request(http.MethodGet, "/api/smart-frames/"+primitive.NewObjectID().Hex(), ownerID, "").expectProblem(http.StatusNotFound, "frame_not_found")
+}
+
+func TestDeleteFrame(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	path := "/api/smart-frames/" + frame.ID.Hex()
+
+	api.request(http.MethodDelete, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodDelete, path, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodDelete, path, ownerID, "").expect(http.StatusOK)
+	api.request(http.MethodGet, path, ownerID, "").expectProblem(http.StatusNotFound, "frame_not_found")
+}
+
+func TestLoadAndUnloadAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, memberID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	album, private, shared := api.createAlbum(ownerID, true), api.createAlbum(memberID, true), api.createAlbum(memberID, true)
+	api.share(shared, ownerID, "alice", models.RoleViewer)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/albums"
+
+	for _, loaded := range []models.Album{album, shared} {
+		api.request(http.MethodPost, path, ownerID, `{"AlbumID":"`+loaded.ID.Hex()+`"}`).expect(http.StatusOK)
+	}
+	loaded := data[models.SmartFrame](api.request(http.MethodGet, "/api/smart-frames/"+frame.ID.Hex(), ownerID, "").expect(http.StatusOK))
+	if !slices.Equal(loaded.LoadedAlbums, []primitive.ObjectID{album.ID, shared.ID}) || loaded.ConfigVersion != frame.ConfigVersion+2 {
+		t.Errorf("frame = %+v, want both albums loaded and two new versions", loaded)
+	}
+
+	// only the albums the owner may view are loaded
+	api.request(http.MethodPost, path, ownerID, `{"AlbumID":"`+private.ID.Hex()+`"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, ownerID, `{"AlbumID":"`+album.ID.Hex()+`"}`).expectProblem(http.StatusConflict, "album_already_loaded")
+	api.request(http.MethodPost, path, ownerID, `{"AlbumID":"`+primitive.NewObjectID().Hex()+`"}`).expectProblem(http.StatusNotFound, "album_not_found")
+	api.request(http.MethodPost, path, ownerID, `{}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, path, memberID, `{"AlbumID":"`+shared.ID.Hex()+`"}`).expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+
+	unloaded := data[models.SmartFrame](api.request(http.MethodDelete, path+"/"+album.ID.Hex(), ownerID, "").expect(http.StatusOK))
+	if !slices.Equal(unloaded.LoadedAlbums, []primitive.ObjectID{shared.ID}) {
+		t.Errorf("loaded albums = %v, want only the shared album", unloaded.LoadedAlbums)
+	}
+	api.request(http.MethodDelete, path+"/"+album.ID.Hex(), ownerID, "").expectProblem(http.StatusNotFound, "loaded_album_not_found")
+	api.request(http.MethodDelete, path+"/nope", ownerID, "").expectProblem(http.StatusBadRequest, "invalid_album_id")
+	api.request(http.MethodDelete, path+"/"+shared.ID.Hex(), memberID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+}
+
+func TestGiftFrame(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(ownerID)
+	path := "/api/smart-frames/" + frame.ID.Hex() + "/gift"
+
+	gift := data[controllers.GiftResponse](api.request(http.MethodPost, path, ownerID, "").expect(http.StatusCreated))
+	if gift.ClaimToken == "" || gift.Frame.ClaimExpiresAt.IsZero() || gift.ExpiresAt.Before(time.Now().Add(controllers.GiftClaimValidity-time.Hour)) {
+		t.Errorf("gift = %+v, want a claim token valid for the claim validity", gift)
+	}
+	api.request(http.MethodPost, path, strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, path, "", "").expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+
+	cancelled := data[models.SmartFrame](api.request(http.MethodDelete, path, ownerID, "").expect(http.StatusOK))
+	if !cancelled.ClaimExpiresAt.IsZero() {
+		t.Errorf("cancelled gift still expires at %v", cancelled.ClaimExpiresAt)
+	}
+	api.request(http.MethodDelete, path, ownerID, "").expectProblem(http.StatusNotFound, "gift_not_found")
+	api.request(http.MethodPost, "/api/smart-frames/claim", strangerID, `{"ClaimToken":"`+gift.ClaimToken+`"}`).expectProblem(http.StatusNotFound, "gift_not_found")
+}
+
+func TestClaimFrame(t *testing.T) {
+	api := newTestAPI(t)
+	gifterID, recipientID, memberID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	frame := api.createFrame(gifterID)
+	owned, foreign := api.createAlbum(gifterID, true), api.createAlbum(memberID, false)
+	smart := data[models.Album](api.request(http.MethodPost, "/api/albums/", gifterID, `{"Title":"Beach","Criteria":{"Tags":["beach"]}}`).
+		expect(http.StatusCreated))
+	api.share(owned, recipientID, "bob", models.RoleViewer)
+	api.share(foreign, gifterID, "alice", models.RoleViewer)
+	for _, album := range []models.Album{owned, foreign, smart} {
+		api.request(http.MethodPost, "/api/smart-frames/"+frame.ID.Hex()+"/albums", gifterID, `{"AlbumID":"`+album.ID.Hex()+`"}`).expect(http.StatusOK)
+	}
+	token := api.giftFrame(frame)
+
+	api.request(http.MethodPost, "/api/smart-frames/claim", gifterID, `{"ClaimToken":"`+token+`"}`).expectProblem(http.StatusConflict, "own_frame")
+	api.request(http.MethodPost, "/api/smart-frames/claim", "", `{"ClaimToken":"`+token+`"}`).expectProblem(http.StatusUnauthorized, apperror.CodeUnauthenticated)
+	api.request(http.MethodPost, "/api/smart-frames/claim", recipientID, `{}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+
+	claim := data[controllers.ClaimResponse](api.request(http.MethodPost, "/api/smart-frames/claim", recipientID, `{"ClaimToken":"`+token+`"}`).
+		expect(http.StatusOK))
+	if claim.Frame.OwnerID.Hex() != recipientID || claim.Frame.GiftedByID.Hex() != gifterID || claim.Frame.ClaimedAt.IsZero() {
+		t.Errorf("claimed frame = %+v", claim.Frame)
+	}
+	// only the regular albums of the gifter change hands, the gifter staying a contributor
+	if !slices.Equal(claim.TransferredAlbumIDs, []primitive.ObjectID{owned.ID}) {
+		t.Errorf("transferred albums = %v, want %s", claim.TransferredAlbumIDs, owned.ID.Hex())
+	}
+	album := data[models.Album](api.request(http.MethodGet, "/api/albums/"+owned.ID.Hex(), recipientID, "").expect(http.StatusOK))
+	if album.OwnerID.Hex() != recipientID || !slices.Equal(album.TargetUserIDs, []primitive.ObjectID{frame.OwnerID}) {
+		t.Errorf("transferred album = %+v, want owned by the recipient with the gifter as member", album)
+	}
+	members := data[[]models.AlbumInvitation](api.request(http.MethodGet, "/api/albums/"+owned.ID.Hex()+"/members", gifterID, "").expect(http.StatusOK))
+	if len(members) != 1 || members[0].UserID.Hex() != gifterID || members[0].Role != models.RoleContributor {
+		t.Errorf("members = %+v, want the gifter as contributor", members)
+	}
+
+	api.request(http.MethodGet, "/api/smart-frames/"+frame.ID.Hex(), gifterID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+	api.request(http.MethodPost, "/api/smart-frames/claim", memberID, `{"ClaimToken":"`+token+`"}`).expectProblem(http.StatusNotFound, "gift_not_found")
+}
+
+func TestClaimExpiredGift(t *testing.T) {
+	api := newTestAPI(t)
+	gifterID, recipientID := api.createUser("alice"), api.createUser("bob")
+	frame := api.createFrame(gifterID)
+	token := api.giftFrame(frame)
+	if err := api.repos.Frames.Update(context.Background(), frame.ID, repository.Fields{"claim_expires_at": time.Now().Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	api.request(http.MethodPost, "/api/smart-frames/claim", recipientID, `{"ClaimToken":"`+token+`"}`).expectProblem(http.StatusGone, "gift_expired")
+}
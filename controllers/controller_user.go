@@ -2,165 +2,314 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"mirage-backend/database"
+	"mirage-backend/apperror"
 	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
 )
 
+// errUserTaken is returned when the username or email belongs to another user
+var errUserTaken = apperror.Conflict("user_already_exists", "Username or email already in use")
+
+// UserHandler serves the user endpoints
+type UserHandler struct {
+	users    repository.UserRepository
+	profiles repository.UserProfileRepository
+}
+
+// NewUserHandler returns a UserHandler storing users and their profiles in the given repositories
+func NewUserHandler(users repository.UserRepository, profiles repository.UserProfileRepository) *UserHandler {
+	return &UserHandler{users: users, profiles: profiles}
+}
+
+// UserResponse is a user as the API returns it, without its password. A user fetched alone embeds its detailed profile,
+// Profile is omitted otherwise or when the user has none. The bson tags name the fields selectable by the fields parameter.
+type UserResponse struct {
+	ID               primitive.ObjectID   `bson:"_id"`
+	Username         string               `bson:"username"`
+	Email            string               `bson:"email"`
+	UserProfileID    primitive.ObjectID   `bson:"user_profile_id"`
+	ProfilePictureID primitive.ObjectID   `bson:"profile_picture_id"`
+	AlbumsID         []primitive.ObjectID `bson:"albums_id"`
+	CreatedAt        time.Time            `bson:"created_at"`
+	UpdatedAt        time.Time            `bson:"updated_at"`
+	Profile          *models.UserProfile  `bson:"-" json:",omitempty"`
+}
+
+// newUserResponse returns the user without its password
+func newUserResponse(user models.User) UserResponse {
+	return UserResponse{
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		UserProfileID:    user.UserProfileID,
+		ProfilePictureID: user.ProfilePictureID,
+		AlbumsID:         user.AlbumsID,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+	}
+}
+
 // GetAllUsers godoc
 // @Summary Get all users
-// @Description Get all users from the database
+// @Description Get a page of users from the database, without their passwords
 // @Tags users
 // @Produce json
-// @Success 200 {array} models.User
-// @Failure 500 {object} map[string]string
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param cursor query string false "Cursor returned as next_cursor by the previous page"
+// @Param sort query string false "Sort field (id, username, created_at), prefix with - for descending"
+// @Param fields query string false "Comma-separated list of fields to return"
+// @Success 200 {object} map[string]interface{} "Page of controllers.UserResponse"
+// @Failure 400 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /users [get]
-func GetAllUsers(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cursor, err := database.UserCollection.Find(ctx, bson.M{})
+func (h *UserHandler) GetAllUsers(c *gin.Context) {
+	query, err := parsePageQuery(c, userListSpec)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		apperror.Abort(c, apperror.BadRequest(apperror.CodeInvalidPagination, err.Error()))
 		return
 	}
 
-	var users []models.User
-	if err = cursor.All(ctx, &users); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding users"})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	page, err := h.users.List(ctx, query)
+	if err != nil {
+		respondWithPageError(c, "Error fetching users", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	users := make([]UserResponse, 0, len(page.Items))
+	for _, user := range page.Items {
+		users = append(users, newUserResponse(user))
+	}
+	respondWithPage(c, "Users retrieved successfully", query, repository.Page[UserResponse]{
+		Items:      users,
+		NextCursor: page.NextCursor,
+		Total:      page.Total,
+	})
 }
 
 // GetUserProfile godoc
 // @Summary Get user profile
-// @Description Get user profile information by user ID
+// @Description Get user information by user ID, with the detailed profile embedded and without the password
 // @Tags users
 // @Produce json
 // @Param userId path string true "User ID"
-// @Success 200 {object} models.User
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
+// @Success 200 {object} controllers.UserResponse
+// @Header 200 {string} ETag "Version of the user, to send as If-Match when updating it"
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /users/{userId} [get]
-func GetUserProfile(c *gin.Context) {
+func (h *UserHandler) GetUserProfile(c *gin.Context) {
 	userId := c.Param("userId")
 	objID, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		apperror.Abort(c, apperror.InvalidID("user"))
 		return
 	}
 
-	var user models.User
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	err = database.UserCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	user, err := h.users.Get(ctx, objID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		apperror.Abort(c, fromRepository(err, "user", "Error fetching user"))
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
-}
+	response := newUserResponse(user)
+	if !user.UserProfileID.IsZero() {
+		profile, err := h.profiles.Get(ctx, user.UserProfileID)
+		switch {
+		case err == nil:
+			response.Profile = &profile
+		case errors.Is(err, repository.ErrNotFound):
+			slog.WarnContext(ctx, "User references a missing profile", "user_id", userId, "profile_id", user.UserProfileID.Hex())
+		default:
+			apperror.Abort(c, apperror.Internal("Error fetching user profile", err))
+			return
+		}
+	}
 
-// TODO make it granular and every param optional
+	setETag(c, user.UpdatedAt)
+	c.JSON(http.StatusOK, response)
+}
 
 // UpdateUserProfile godoc
 // @Summary Update user profile
-// @Description Update user profile information by user ID
+// @Description Update user information by user ID, the detailed profile is updated through /users/{userId}/profile
+// @Description and the profile picture through /profilepictures/user/{userId}, ProfilePictureID is ignored
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param userId path string true "User ID"
+// @Param If-Match header string false "ETag of the user version being replaced"
 // @Param user body models.User true "User object"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 200 {object} map[string]interface{} "The updated controllers.UserResponse, without the password"
+// @Header 200 {string} ETag "Version of the updated user"
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /users/{userId} [put]
-func UpdateUserProfile(c *gin.Context) {
+func (h *UserHandler) UpdateUserProfile(c *gin.Context) {
 	userId := c.Param("userId")
 	objID, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		apperror.Abort(c, apperror.InvalidID("user"))
 		return
 	}
 
 	var updatedUser models.User
 	if err := c.ShouldBindJSON(&updatedUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Abort(c, apperror.InvalidInput(err))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$set": bson.M{
-			"username":           updatedUser.Username,
-			"email":              updatedUser.Email,
-			"password":           updatedUser.Password,
-			"user_profile_id":    updatedUser.UserProfileID,
-			"profile_picture_id": updatedUser.ProfilePictureID,
-			"albums_id":          updatedUser.AlbumsID,
-			"updated_at":         time.Now(),
-		},
+	user, err := h.users.Get(ctx, objID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "user", "Error fetching user"))
+		return
+	}
+	if err := checkIfMatch(c, user.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
 	}
 
-	result, err := database.UserCollection.UpdateOne(ctx, bson.M{"_id": objID}, update)
+	updatedAt := versioning.NextUpdatedAt(user.UpdatedAt)
+	// the profile picture is changed through the profile picture endpoints only
+	update := repository.Fields{
+		"username":   updatedUser.Username,
+		"email":      updatedUser.Email,
+		"password":   updatedUser.Password,
+		"albums_id":  nonNil(updatedUser.AlbumsID),
+		"updated_at": updatedAt,
+	}
+
+	if err := h.users.UpdateIfUnmodified(ctx, objID, user.UpdatedAt, update); err != nil {
+		respondWithUserUpdateError(c, err)
+		return
+	}
+
+	user.Username, user.Email, user.Password = updatedUser.Username, updatedUser.Email, updatedUser.Password
+	user.AlbumsID, user.UpdatedAt = updatedUser.AlbumsID, updatedAt
+
+	setETag(c, updatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully", "data": newUserResponse(user)})
+}
+
+// PatchUser godoc
+// @Summary Partially update user
+// @Description Applies a JSON Merge Patch (RFC 7396) to a user; Username, Email and Password can be changed
+// @Tags users
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param userId path string true "User ID"
+// @Param If-Match header string false "ETag of the user version being patched"
+// @Param patch body object true "Merge patch"
+// @Success 200 {object} map[string]interface{} "The patched controllers.UserResponse, without the password"
+// @Header 200 {string} ETag "Version of the updated user"
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 415 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /users/{userId} [patch]
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	objID, err := primitive.ObjectIDFromHex(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		apperror.Abort(c, apperror.InvalidID("user"))
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.users.Get(ctx, objID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "user", "Error fetching user"))
+		return
+	}
+	if err := checkIfMatch(c, user.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
+	patched, fields, err := applyMergePatch(c, user, userPatchSpec)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	patched.UpdatedAt = versioning.NextUpdatedAt(user.UpdatedAt)
+	fields["updated_at"] = patched.UpdatedAt
+
+	if err := h.users.UpdateIfUnmodified(ctx, objID, user.UpdatedAt, fields); err != nil {
+		respondWithUserUpdateError(c, err)
+		return
+	}
+
+	setETag(c, patched.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "User updated successfully", "data": newUserResponse(patched)})
+}
+
+// respondWithUserUpdateError maps the errors of user updates to the right application error
+func respondWithUserUpdateError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrDuplicate) {
+		apperror.Abort(c, errUserTaken)
+		return
+	}
+	apperror.Abort(c, fromRepository(err, "user", "Error updating user"))
 }
 
 // TODO: make sure it is cascading
 
 // DeleteUser godoc
 // @Summary Delete user
-// @Description Delete user account by user ID
+// @Description Delete user account by user ID, together with its detailed profile
 // @Tags users
 // @Produce json
 // @Param userId path string true "User ID"
 // @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /users/{userId} [delete]
-func DeleteUser(c *gin.Context) {
+func (h *UserHandler) DeleteUser(c *gin.Context) {
 	userId := c.Param("userId")
 	objID, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		apperror.Abort(c, apperror.InvalidID("user"))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	result, err := database.UserCollection.DeleteOne(ctx, bson.M{"_id": objID})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+	if err := h.users.Delete(ctx, objID); err != nil {
+		apperror.Abort(c, fromRepository(err, "user", "Error deleting user"))
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
+	if profile, err := h.profiles.GetByUser(ctx, objID); err == nil {
+		if err := h.profiles.Delete(ctx, profile.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete profile of deleted user", "profile_id", profile.ID.Hex(), "error", err)
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		slog.ErrorContext(ctx, "Failed to look up profile of deleted user", "user_id", userId, "error", err)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
@@ -174,27 +323,33 @@ func DeleteUser(c *gin.Context) {
 // @Produce json
 // @Param user body models.User true "User object"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
 // @Router /users [post]
-func CreateUser(c *gin.Context) {
+func (h *UserHandler) CreateUser(c *gin.Context) {
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apperror.Abort(c, apperror.InvalidInput(err))
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	// Profiles are created through /users/{userId}/profile, which links them to the user
+	user.UserProfileID = primitive.NilObjectID
 
-	result, err := database.UserCollection.InsertOne(ctx, user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
+	if err := h.users.Create(ctx, &user); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			apperror.Abort(c, errUserTaken)
+			return
+		}
+		apperror.Abort(c, apperror.Internal("Error creating user", err))
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "id": result.InsertedID})
+	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "id": user.ID})
 }
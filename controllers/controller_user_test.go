@@ -0,0 +1,148 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+func TestCreateUser(t *testing.T) {
+	api := newTestAPI(t)
+	api.createUser("alice")
+
+	api.request(http.MethodPost, "/api/users/", "", `{"Username":"alice","Email":"other@example.com","Password":"secret"}`).expectProblem(http.StatusConflict, "user_already_exists")
+	api.request(http.MethodPost, "/api/users/", "", `{"Username":"bob","Email":"not an email","Password":"secret"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+}
+
+func TestGetUserProfile(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+
+	r := api.request(http.MethodGet, "/api/users/"+userID, "", "").expect(http.StatusOK)
+	if r.Header().Get("ETag") == "" {
+		t.Error("user returned without ETag")
+	}
+	if user := decode[controllers.UserResponse](r); user.Username != "alice" || user.Profile != nil {
+		t.Errorf("user = %+v, want alice without profile", user)
+	}
+	if _, ok := decode[map[string]any](r)["Password"]; ok {
+		t.Errorf("user returned with its password: %s", r.Body.String())
+	}
+
+	api.request(http.MethodGet, "/api/users/nope", "", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+	api.request(http.MethodGet, "/api/users/"+primitive.NewObjectID().Hex(), "", "").expectProblem(http.StatusNotFound, "user_not_found")
+}
+
+// unavailableUsers is a user repository whose database cannot be reached
+type unavailableUsers struct {
+	repository.UserRepository
+}
+
+func (unavailableUsers) Get(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	return models.User{}, errors.New("connection refused")
+}
+
+func TestGetUserProfileFailure(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	repos.Users = unavailableUsers{repos.Users}
+	api := newTestAPIWithRepositories(t, nil, repos)
+
+	api.request(http.MethodGet, "/api/users/"+primitive.NewObjectID().Hex(), "", "").expectProblem(http.StatusInternalServerError, apperror.CodeInternal)
+}
+
+func TestGetAllUsers(t *testing.T) {
+	api := newTestAPI(t)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		api.createUser(name)
+	}
+
+	first := api.request(http.MethodGet, "/api/users/?limit=2&sort=username", "", "").expect(http.StatusOK)
+	users := data[[]models.User](first)
+	if len(users) != 2 || users[0].Username != "alice" || users[1].Username != "bob" {
+		t.Fatalf("first page = %+v, want alice and bob", users)
+	}
+	for _, user := range data[[]map[string]any](first) {
+		if _, ok := user["Password"]; ok {
+			t.Errorf("user listed with its password: %v", user)
+		}
+	}
+	next := pagination(first).NextCursor
+	users = data[[]models.User](api.request(http.MethodGet, "/api/users/?limit=2&sort=username&cursor="+next, "", "").expect(http.StatusOK))
+	if len(users) != 1 || users[0].Username != "carol" {
+		t.Errorf("second page = %+v, want carol", users)
+	}
+
+	projected := data[[]map[string]any](api.request(http.MethodGet, "/api/users/?fields=username", "", "").expect(http.StatusOK))
+	if len(projected) != 3 || len(projected[0]) != 2 || projected[0]["Username"] == nil || projected[0]["ID"] == nil {
+		t.Errorf("projected users = %+v, want only their ID and username", projected)
+	}
+	api.request(http.MethodGet, "/api/users/?fields=password", "", "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+	api.request(http.MethodGet, "/api/users/?limit=0", "", "").expectProblem(http.StatusBadRequest, apperror.CodeInvalidPagination)
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	api.createUser("bob")
+	etag := api.request(http.MethodGet, "/api/users/"+userID, "", "").expect(http.StatusOK).Header().Get("ETag")
+
+	// the profile picture is only changed through the profile picture endpoints
+	body := `{"Username":"alicia","Email":"alicia@example.com","Password":"secret","ProfilePictureID":"` + primitive.NewObjectID().Hex() + `"}`
+	updated := api.request(http.MethodPut, "/api/users/"+userID, "", body, "If-Match", etag).expect(http.StatusOK)
+	if updated.Header().Get("ETag") == etag {
+		t.Error("ETag unchanged by the update")
+	}
+	if user := data[map[string]any](updated); user["Username"] != "alicia" || user["Password"] != nil {
+		t.Errorf("updated user = %v, want alicia without password", user)
+	}
+	if user := decode[controllers.UserResponse](api.request(http.MethodGet, "/api/users/"+userID, "", "").expect(http.StatusOK)); user.Username != "alicia" || !user.ProfilePictureID.IsZero() {
+		t.Errorf("user = %+v, want alicia without profile picture", user)
+	}
+
+	api.request(http.MethodPut, "/api/users/"+userID, "", body, "If-Match", etag).expectProblem(http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+
+	api.request(http.MethodPut, "/api/users/"+userID, "", `{"Username":"bob","Email":"b@example.com","Password":"secret"}`).expectProblem(http.StatusConflict, "user_already_exists")
+	api.request(http.MethodPut, "/api/users/"+primitive.NewObjectID().Hex(), "", `{"Username":"carol","Email":"c@example.com","Password":"secret"}`).
+		expectProblem(http.StatusNotFound, "user_not_found")
+}
+
+func TestPatchUser(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+
+	user := data[controllers.UserResponse](api.request(http.MethodPatch, "/api/users/"+userID, "", `{"Email":"new@example.com"}`).expect(http.StatusOK))
+	if user.Email != "new@example.com" || user.Username != "alice" {
+		t.Errorf("patched user = %+v", user)
+	}
+	patched := data[map[string]any](api.request(http.MethodPatch, "/api/users/"+userID, "", `{"Password":"changed"}`).expect(http.StatusOK))
+	if _, ok := patched["Password"]; ok {
+		t.Errorf("patched user returned with its password: %v", patched)
+	}
+	if stored, _ := api.repos.Users.Get(context.Background(), user.ID); stored.Password != "changed" {
+		t.Errorf("stored password %q, want the patched one", stored.Password)
+	}
+
+	api.request(http.MethodPatch, "/api/users/"+userID, "", `{"CreatedAt":"2020-01-01T00:00:00Z"}`).expectProblem(http.StatusBadRequest, apperror.CodeImmutableField)
+	api.request(http.MethodPatch, "/api/users/"+userID, "", `{"Email":"invalid"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPatch, "/api/users/"+userID, "", `{"Email":"x@example.com"}`, "Content-Type", "text/plain").
+		expectProblem(http.StatusUnsupportedMediaType, apperror.CodeUnsupportedMediaType)
+	api.request(http.MethodPatch, "/api/users/"+primitive.NewObjectID().Hex(), "", `{"Email":"x@example.com"}`).expectProblem(http.StatusNotFound, "user_not_found")
+}
+
+func TestDeleteUser(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith"}`).expect(http.StatusCreated)
+
+	api.request(http.MethodDelete, "/api/users/"+userID, "", "").expect(http.StatusOK)
+	api.request(http.MethodGet, "/api/users/"+userID, "", "").expectProblem(http.StatusNotFound, "user_not_found")
+	api.request(http.MethodGet, "/api/users/"+userID+"/profile", "", "").expectProblem(http.StatusNotFound, "profile_not_found")
+	api.request(http.MethodDelete, "/api/users/"+userID, "", "").expectProblem(http.StatusNotFound, "user_not_found")
+}
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+// earliestDOB is the oldest date of birth accepted in a profile
+var earliestDOB = time.Date(1900, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// UserProfileHandler serves the endpoints of the detailed user profiles
+type UserProfileHandler struct {
+	users    repository.UserRepository
+	profiles repository.UserProfileRepository
+}
+
+// NewUserProfileHandler returns a UserProfileHandler using the given repositories
+func NewUserProfileHandler(users repository.UserRepository, profiles repository.UserProfileRepository) *UserProfileHandler {
+	return &UserProfileHandler{users: users, profiles: profiles}
+}
+
+// CreateProfile godoc
+// @Summary Create a user's profile
+// @Description Create the detailed profile (name, surname, sex, date of birth) of a user, a user has at most one profile
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param userId path string true "User ID"
+// @Param profile body models.UserProfile true "Profile, Sex is one of female, male, other"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 409 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /users/{userId}/profile [post]
+func (h *UserProfileHandler) CreateProfile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
+	}
+
+	profile, err := bindProfile(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	if _, err := h.users.Get(ctx, userID); err != nil {
+		apperror.Abort(c, fromRepository(err, "user", "Failed to fetch user"))
+		return
+	}
+
+	profile.ID = primitive.NewObjectID()
+	profile.UserID = userID
+	profile.CreatedAt = time.Now()
+	profile.UpdatedAt = profile.CreatedAt
+
+	if err := h.profiles.Create(ctx, &profile); err != nil {
+		if errors.Is(err, repository.ErrDuplicate) {
+			apperror.Abort(c, apperror.Conflict("profile_already_exists", "User already has a profile"))
+			return
+		}
+		apperror.Abort(c, apperror.Internal("Failed to create profile", err))
+		return
+	}
+
+	// Link the profile to the user, removing it again if that fails so that no profile is left unreferenced
+	linkErr := h.users.Update(ctx, userID, repository.Fields{"user_profile_id": profile.ID, "updated_at": time.Now()})
+	if linkErr != nil {
+		if err := h.profiles.Delete(ctx, profile.ID); err != nil {
+			slog.ErrorContext(ctx, "Failed to remove unlinked profile", "profile_id", profile.ID.Hex(), "error", err)
+		}
+		apperror.Abort(c, fromRepository(linkErr, "user", "Failed to link profile to user"))
+		return
+	}
+
+	setETag(c, profile.UpdatedAt)
+	c.JSON(http.StatusCreated, gin.H{"message": "Profile created successfully", "data": profile})
+}
+
+// GetProfile godoc
+// @Summary Get a user's profile
+// @Description Get the detailed profile of a user
+// @Tags users
+// @Produce json
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the profile, to send as If-Match when updating it"
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /users/{userId}/profile [get]
+func (h *UserProfileHandler) GetProfile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	profile, err := h.profiles.GetByUser(ctx, userID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "profile", "Failed to fetch profile"))
+		return
+	}
+
+	setETag(c, profile.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Profile retrieved successfully", "data": profile})
+}
+
+// UpdateProfile godoc
+// @Summary Update a user's profile
+// @Description Replace the name, surname, sex and date of birth of a user's profile
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param userId path string true "User ID"
+// @Param If-Match header string false "ETag of the profile version being replaced"
+// @Param profile body models.UserProfile true "Profile, Sex is one of female, male, other"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the updated profile"
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /users/{userId}/profile [put]
+func (h *UserProfileHandler) UpdateProfile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
+	}
+
+	update, err := bindProfile(c)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	profile, err := h.profiles.GetByUser(ctx, userID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "profile", "Failed to fetch profile"))
+		return
+	}
+
+	if err := checkIfMatch(c, profile.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	previousUpdate := profile.UpdatedAt
+	profile.Name = update.Name
+	profile.Surname = update.Surname
+	profile.Sex = update.Sex
+	profile.DOB = update.DOB
+	profile.UpdatedAt = versioning.NextUpdatedAt(previousUpdate)
+
+	fields := repository.Fields{
+		"name":       profile.Name,
+		"surname":    profile.Surname,
+		"sex":        profile.Sex,
+		"dob":        profile.DOB,
+		"updated_at": profile.UpdatedAt,
+	}
+	if err := h.profiles.UpdateIfUnmodified(ctx, profile.ID, previousUpdate, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "profile", "Failed to update profile"))
+		return
+	}
+
+	setETag(c, profile.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully", "data": profile})
+}
+
+// PatchProfile godoc
+// @Summary Partially update a user's profile
+// @Description Applies a JSON Merge Patch (RFC 7396) to a user's profile; Name, Surname, Sex and DOB can be changed
+// @Tags users
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param userId path string true "User ID"
+// @Param If-Match header string false "ETag of the profile version being patched"
+// @Param patch body object true "Merge patch, null removes Sex or DOB"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "Version of the updated profile"
+// @Failure 400 {object} apperror.Problem
+// @Failure 404 {object} apperror.Problem
+// @Failure 412 {object} apperror.Problem
+// @Failure 415 {object} apperror.Problem
+// @Failure 500 {object} apperror.Problem
+// @Router /users/{userId}/profile [patch]
+func (h *UserProfileHandler) PatchProfile(c *gin.Context) {
+	userID, err := primitive.ObjectIDFromHex(c.Param("userId"))
+	if err != nil {
+		apperror.Abort(c, apperror.InvalidID("user"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeoutDuration)
+	defer cancel()
+
+	profile, err := h.profiles.GetByUser(ctx, userID)
+	if err != nil {
+		apperror.Abort(c, fromRepository(err, "profile", "Failed to fetch profile"))
+		return
+	}
+	if err := checkIfMatch(c, profile.UpdatedAt); err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+
+	patched, fields, err := applyMergePatch(c, profile, profilePatchSpec)
+	if err != nil {
+		apperror.Abort(c, err)
+		return
+	}
+	if _, ok := fields["dob"]; ok {
+		if patched.DOB, err = normalizeDOB(patched.DOB); err != nil {
+			apperror.Abort(c, err)
+			return
+		}
+		fields["dob"] = patched.DOB
+	}
+	patched.UpdatedAt = versioning.NextUpdatedAt(profile.UpdatedAt)
+	fields["updated_at"] = patched.UpdatedAt
+
+	if err := h.profiles.UpdateIfUnmodified(ctx, profile.ID, profile.UpdatedAt, fields); err != nil {
+		apperror.Abort(c, fromRepository(err, "profile", "Failed to update profile"))
+		return
+	}
+
+	setETag(c, patched.UpdatedAt)
+	c.JSON(http.StatusOK, gin.H{"message": "Profile updated successfully", "data": patched})
+}
+
+// bindProfile reads and validates the profile in the request body
+func bindProfile(c *gin.Context) (models.UserProfile, error) {
+	var profile models.UserProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		return profile, apperror.InvalidInput(err)
+	}
+
+	dob, err := normalizeDOB(profile.DOB)
+	if err != nil {
+		return profile, err
+	}
+	profile.DOB = dob
+
+	return profile, nil
+}
+
+// normalizeDOB keeps only the calendar date of a date of birth and checks that it is plausible
+func normalizeDOB(dob time.Time) (time.Time, error) {
+	if dob.IsZero() {
+		return dob, nil
+	}
+
+	year, month, day := dob.Date()
+	dob = time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+
+	if dob.Before(earliestDOB) {
+		return dob, apperror.BadRequest("invalid_dob", "Date of birth must not be before 1900-01-01")
+	}
+	if dob.After(time.Now().UTC()) {
+		return dob, apperror.BadRequest("invalid_dob", "Date of birth must not be in the future")
+	}
+	return dob, nil
+}
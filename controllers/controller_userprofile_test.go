@@ -0,0 +1,94 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/models"
+)
+
+func TestCreateProfile(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+
+	profile := data[models.UserProfile](api.request(http.MethodPost, "/api/users/"+userID+"/profile", "",
+		`{"Name":"Alice","Surname":"Smith","Sex":"female","DOB":"1990-04-02T23:30:00+02:00"}`).expect(http.StatusCreated))
+	if profile.UserID.Hex() != userID {
+		t.Errorf("profile of %s, want %s", profile.UserID.Hex(), userID)
+	}
+	if want := time.Date(1990, 4, 2, 0, 0, 0, 0, time.UTC); !profile.DOB.Equal(want) {
+		t.Errorf("DOB = %v, want the calendar date %v", profile.DOB, want)
+	}
+
+	user := decode[controllers.UserResponse](api.request(http.MethodGet, "/api/users/"+userID, "", "").expect(http.StatusOK))
+	if user.Profile == nil || user.Profile.ID != profile.ID {
+		t.Errorf("user embeds profile %+v, want %s", user.Profile, profile.ID.Hex())
+	}
+
+	api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith"}`).
+		expectProblem(http.StatusConflict, "profile_already_exists")
+	api.request(http.MethodPost, "/api/users/"+primitive.NewObjectID().Hex()+"/profile", "", `{"Name":"Bob","Surname":"Smith"}`).
+		expectProblem(http.StatusNotFound, "user_not_found")
+	api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith","Sex":"unknown"}`).
+		expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith","DOB":"1850-01-01T00:00:00Z"}`).
+		expectProblem(http.StatusBadRequest, "invalid_dob")
+}
+
+func TestGetProfile(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+
+	api.request(http.MethodGet, "/api/users/"+userID+"/profile", "", "").expectProblem(http.StatusNotFound, "profile_not_found")
+	api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith"}`).expect(http.StatusCreated)
+
+	r := api.request(http.MethodGet, "/api/users/"+userID+"/profile", "", "").expect(http.StatusOK)
+	if profile := data[models.UserProfile](r); profile.Name != "Alice" {
+		t.Errorf("profile = %+v", profile)
+	}
+	if r.Header().Get("ETag") == "" {
+		t.Error("profile returned without ETag")
+	}
+	api.request(http.MethodGet, "/api/users/nope/profile", "", "").expectProblem(http.StatusBadRequest, "invalid_user_id")
+}
+
+func TestUpdateProfile(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	etag := api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith","Sex":"female"}`).
+		expect(http.StatusCreated).Header().Get("ETag")
+
+	profile := data[models.UserProfile](api.request(http.MethodPut, "/api/users/"+userID+"/profile", "", `{"Name":"Alicia","Surname":"Jones"}`, "If-Match", etag).
+		expect(http.StatusOK))
+	if profile.Name != "Alicia" || profile.Surname != "Jones" || profile.Sex != "" {
+		t.Errorf("profile = %+v, want every field replaced", profile)
+	}
+
+	api.request(http.MethodPut, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith"}`, "If-Match", etag).
+		expectProblem(http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+	api.request(http.MethodPut, "/api/users/"+userID+"/profile", "", `{"Name":"Alice"}`).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	api.request(http.MethodPut, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith","DOB":"2999-01-01T00:00:00Z"}`).
+		expectProblem(http.StatusBadRequest, "invalid_dob")
+	api.request(http.MethodPut, "/api/users/"+api.createUser("bob")+"/profile", "", `{"Name":"Bob","Surname":"Smith"}`).
+		expectProblem(http.StatusNotFound, "profile_not_found")
+}
+
+func TestPatchProfile(t *testing.T) {
+	api := newTestAPI(t)
+	userID := api.createUser("alice")
+	api.request(http.MethodPost, "/api/users/"+userID+"/profile", "", `{"Name":"Alice","Surname":"Smith","Sex":"female"}`).expect(http.StatusCreated)
+
+	profile := data[models.UserProfile](api.request(http.MethodPatch, "/api/users/"+userID+"/profile", "", `{"Sex":null,"DOB":"2000-01-01T12:00:00Z"}`).
+		expect(http.StatusOK))
+	if profile.Name != "Alice" || profile.Sex != "" || !profile.DOB.Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("patched profile = %+v", profile)
+	}
+
+	api.request(http.MethodPatch, "/api/users/"+userID+"/profile", "", `{"UserID":"`+primitive.NewObjectID().Hex()+`"}`).
+		expectProblem(http.StatusBadRequest, apperror.CodeImmutableField)
+	api.request(http.MethodPatch, "/api/users/"+userID+"/profile", "", `{"DOB":"2999-01-01T00:00:00Z"}`).expectProblem(http.StatusBadRequest, "invalid_dob")
+}
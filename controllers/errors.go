@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"mirage-backend/apperror"
+	"mirage-backend/repository"
+)
+
+var errNotMultipart = apperror.New(http.StatusUnsupportedMediaType, apperror.CodeUnsupportedMediaType,
+	"Content-Type must be multipart/form-data")
+
+// errModified answers writes whose If-Match precondition doesn't hold
+var errModified = apperror.New(http.StatusPreconditionFailed, apperror.CodePreconditionFailed,
+	"The resource was modified since it was read")
+
+// fromRepository maps a repository error on the given resource to an application error,
+// failure describes the operation when the error is unexpected
+func fromRepository(err error, resource, failure string) *apperror.Error {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return apperror.NotFound(resource)
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return apperror.BadRequest(apperror.CodeInvalidCursor, "Invalid cursor")
+	case errors.Is(err, repository.ErrModified):
+		return errModified
+	default:
+		return apperror.Internal(failure, err)
+	}
+}
@@ -0,0 +1,237 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/controllers"
+	"mirage-backend/events"
+	"mirage-backend/health"
+	"mirage-backend/models"
+	"mirage-backend/recognition"
+	"mirage-backend/repository"
+	"mirage-backend/routes"
+)
+
+// publisherToken authenticates the firmware release pipeline in the tests
+const publisherToken = "publisher-secret"
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testAPI serves the API on in-memory repositories, with a face recognizer finding one face in every picture
+type testAPI struct {
+	t           *testing.T
+	router      *gin.Engine
+	repos       repository.Repositories
+	recognition *recognition.Pipeline
+	events      *events.Broker
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	recognizer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"faces":[{"box":{"x":0.1,"y":0.1,"width":0.2,"height":0.2},"confidence":0.9,"embedding":[1,0,0]}]}`)
+	}))
+	t.Cleanup(recognizer.Close)
+	return newTestAPIWithRecognizer(t, recognition.NewHTTPRecognizer(recognizer.URL, time.Second))
+}
+
+// newTestAPIWithRecognizer serves the API with the given face recognizer, face recognition is disabled when it is nil
+func newTestAPIWithRecognizer(t *testing.T, recognizer recognition.Recognizer) *testAPI {
+	t.Helper()
+	return newTestAPIWithRepositories(t, recognizer, repository.NewMemoryRepositories())
+}
+
+// newTestAPIWithRepositories serves the API on the given repositories, with the given face recognizer
+func newTestAPIWithRepositories(t *testing.T, recognizer recognition.Recognizer, repos repository.Repositories) *testAPI {
+	t.Helper()
+
+	people := recognition.NewPeople(repos.People, repos.Faces, 0.8)
+	pipeline := recognition.NewPipeline(recognizer, repos.Pictures, repos.Blobs, people, 10, 0.5)
+	broker := events.NewBroker(10)
+
+	router := gin.New()
+	router.NoRoute(apperror.NoRoute)
+	router.Use(apperror.Middleware())
+	routes.InitRoutes(router, "/api", routes.Dependencies{
+		Repositories:           repos,
+		Health:                 health.NewRegistry(0),
+		Events:                 broker,
+		Recognition:            pipeline,
+		People:                 people,
+		FirmwarePublisherToken: publisherToken,
+	})
+	return &testAPI{t: t, router: router, repos: repos, recognition: pipeline, events: broker}
+}
+
+// response is the outcome of a request to the test API
+type response struct {
+	*httptest.ResponseRecorder
+	t *testing.T
+}
+
+// expect fails the test unless the response has the status
+func (r response) expect(status int) response {
+	r.t.Helper()
+	if r.Code != status {
+		r.t.Fatalf("status %d, want %d: %s", r.Code, status, r.Body.String())
+	}
+	return r
+}
+
+// expectProblem fails the test unless the response is a problem with the status and code
+func (r response) expectProblem(status int, code string) {
+	r.t.Helper()
+	r.expect(status)
+	var problem apperror.Problem
+	if err := json.Unmarshal(r.Body.Bytes(), &problem); err != nil {
+		r.t.Fatalf("response is not a problem: %v: %s", err, r.Body.String())
+	}
+	if problem.Code != code {
+		r.t.Fatalf("problem code %q, want %q: %s", problem.Code, code, r.Body.String())
+	}
+}
+
+// data decodes the data of the response envelope into T
+func data[T any](r response) T {
+	r.t.Helper()
+	return decode[struct {
+		Data T `json:"data"`
+	}](r).Data
+}
+
+// decode decodes the whole response body into T
+func decode[T any](r response) T {
+	r.t.Helper()
+	var body T
+	if err := json.Unmarshal(r.Body.Bytes(), &body); err != nil {
+		r.t.Fatalf("cannot decode the response: %v: %s", err, r.Body.String())
+	}
+	return body
+}
+
+// pagination returns the pagination of a list response
+func pagination(r response) controllers.PaginationInfo {
+	r.t.Helper()
+	return decode[struct {
+		Pagination controllers.PaginationInfo `json:"pagination"`
+	}](r).Pagination
+}
+
+// request sends a request on behalf of userID unless it is empty, with a JSON body unless body is empty
+func (a *testAPI) request(method, path, userID, body string, headers ...string) response {
+	a.t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if body != "" {
+		contentType := "application/json"
+		if method == http.MethodPatch {
+			contentType = "application/merge-patch+json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if userID != "" {
+		req.Header.Set(controllers.UserIDHeader, userID)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	return a.serve(req)
+}
+
+// upload posts on behalf of userID a PNG picture of width by height pixels as the multipart file, with the other form fields
+func (a *testAPI) upload(path, userID string, width, height int, fields map[string]string) response {
+	a.t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	file, err := form.CreateFormFile("file", "picture.png")
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	if err := png.Encode(file, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		a.t.Fatal(err)
+	}
+	if err := form.Close(); err != nil {
+		a.t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if userID != "" {
+		req.Header.Set(controllers.UserIDHeader, userID)
+	}
+	return a.serve(req)
+}
+
+func (a *testAPI) serve(req *http.Request) response {
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return response{ResponseRecorder: w, t: a.t}
+}
+
+// createUser creates a user named name and returns its ID
+func (a *testAPI) createUser(name string) string {
+	a.t.Helper()
+	r := a.request(http.MethodPost, "/api/users/", "", `{"Username":"`+name+`","Email":"`+name+`@example.com","Password":"secret"}`).expect(http.StatusCreated)
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(r.Body.Bytes(), &created); err != nil {
+		a.t.Fatal(err)
+	}
+	return created.ID
+}
+
+// createAlbum creates an album of owner, private or not
+func (a *testAPI) createAlbum(ownerID string, private bool) models.Album {
+	a.t.Helper()
+	body := fmt.Sprintf(`{"Title":"Holidays","IsPrivate":%t}`, private)
+	return data[models.Album](a.request(http.MethodPost, "/api/albums/", ownerID, body).expect(http.StatusCreated))
+}
+
+// uploadPicture uploads a picture to the album on behalf of userID
+func (a *testAPI) uploadPicture(albumID, userID string) models.Picture {
+	a.t.Helper()
+	return data[models.Picture](a.upload("/api/albums/"+albumID+"/pictures/", userID, 30, 20, nil).expect(http.StatusCreated))
+}
+
+// share invites userID to the album as role and accepts the invitation
+func (a *testAPI) share(album models.Album, userID, username, role string) {
+	a.t.Helper()
+	invitation := data[models.AlbumInvitation](a.request(http.MethodPost, "/api/albums/"+album.ID.Hex()+"/invitations", album.OwnerID.Hex(),
+		`{"Invitee":"`+username+`","Role":"`+role+`"}`).expect(http.StatusCreated))
+	a.request(http.MethodPost, "/api/invitations/"+invitation.ID.Hex()+"/accept", userID, "").expect(http.StatusOK)
+}
+
+// recognize runs the face recognition of the picture
+func (a *testAPI) recognize(pictureID primitive.ObjectID) {
+	a.t.Helper()
+	if err := a.recognition.Process(context.Background(), pictureID); err != nil {
+		a.t.Fatal(err)
+	}
+}
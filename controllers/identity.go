@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+)
+
+// UserIDHeader identifies the user a request acts on behalf of, standing in for authentication until it exists
+const UserIDHeader = "X-User-ID"
+
+var errUnauthenticated = apperror.New(http.StatusUnauthorized, apperror.CodeUnauthenticated,
+	UserIDHeader+" header is required")
+
+// actingUser returns the user the request acts on behalf of, ok is false for anonymous requests
+func actingUser(c *gin.Context) (userID primitive.ObjectID, ok bool, err error) {
+	header := c.GetHeader(UserIDHeader)
+	if header == "" {
+		return primitive.NilObjectID, false, nil
+	}
+
+	userID, err = primitive.ObjectIDFromHex(header)
+	if err != nil {
+		return primitive.NilObjectID, false, apperror.InvalidID("user")
+	}
+	return userID, true, nil
+}
+
+// requireActingUser returns the user the request acts on behalf of, rejecting anonymous requests
+func requireActingUser(c *gin.Context) (primitive.ObjectID, error) {
+	userID, ok, err := actingUser(c)
+	if err != nil {
+		return userID, err
+	}
+	if !ok {
+		return userID, errUnauthenticated
+	}
+	return userID, nil
+}
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"mirage-backend/apperror"
+	"mirage-backend/repository"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// listSpec declares what a list endpoint allows clients to sort by and project
+type listSpec struct {
+	// SortFields maps the public sort names to bson fields
+	SortFields map[string]string
+	// DefaultSort is the sort used when none is requested, using the same syntax as the query parameter
+	DefaultSort string
+	// Fields is the set of bson fields that can be requested through the `fields` parameter
+	Fields []string
+}
+
+var albumListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"title":      "title",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	DefaultSort: "id",
+	Fields:      []string{"title", "description", "user_id", "target_user_ids", "tags", "is_private", "created_at", "updated_at"},
+}
+
+var pictureListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":          "_id",
+		"uploaded_at": "uploaded_at",
+		"taken_at":    "taken_at",
+	},
+	DefaultSort: "id",
+	Fields: []string{
+		"picture_data_id", "thumbnail", "album_id", "uploader_user_id", "description",
+		"uploaded_at", "faces_id", "width", "height", "recognition_status", "recognized_at",
+		"taken_at", "tags", "location",
+	},
+}
+
+var faceListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":            "_id",
+		"confidence":    "confidence",
+		"recognized_at": "recognized_at",
+	},
+	DefaultSort: "id",
+	Fields:      []string{"picture_id", "name", "sex", "confidence", "recognized_at", "age", "box", "person_id"},
+}
+
+var personListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"name":       "name",
+		"face_count": "face_count",
+		"updated_at": "updated_at",
+	},
+	DefaultSort: "-face_count",
+	Fields:      []string{"owner_id", "name", "face_count", "created_at", "updated_at"},
+}
+
+var profilePictureListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"created_at": "created_at",
+	},
+	DefaultSort: "-created_at",
+	Fields:      []string{"picture_id", "avatar_data_id", "user_id", "created_at"},
+}
+
+var userListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"username":   "username",
+		"created_at": "created_at",
+	},
+	DefaultSort: "id",
+	Fields:      []string{"username", "email", "user_profile_id", "profile_picture_id", "albums_id", "created_at", "updated_at"},
+}
+
+var invitationListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"created_at": "created_at",
+		"updated_at": "updated_at",
+	},
+	DefaultSort: "-created_at",
+	Fields:      []string{"album_id", "user_id", "invited_by_id", "role", "status", "created_at", "responded_at", "updated_at"},
+}
+
+var shareLinkListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":           "_id",
+		"created_at":   "created_at",
+		"expires_at":   "expires_at",
+		"access_count": "access_count",
+	},
+	DefaultSort: "-created_at",
+	Fields: []string{
+		"token", "album_id", "picture_id", "created_by_id", "has_password", "allow_download",
+		"expires_at", "access_count", "last_accessed_at", "created_at",
+	},
+}
+
+var frameListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"name":       "name",
+		"created_at": "created_at",
+	},
+	DefaultSort: "id",
+	Fields: []string{"name", "owner_id", "gifted_by_id", "claim_expires_at", "claimed_at", "created_at", "first_boot",
+		"loaded_albums_id", "settings", "config_version", "status", "firmware_channel", "updated_at"},
+}
+
+var heartbeatListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":          "_id",
+		"received_at": "received_at",
+	},
+	DefaultSort: "-received_at",
+	Fields:      []string{"frame_id", "received_at", "firmware_version", "free_storage", "ip_address", "current_picture_id"},
+}
+
+var displayStatListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":                "_id",
+		"count":             "count",
+		"last_displayed_at": "last_displayed_at",
+	},
+	DefaultSort: "-count",
+	Fields:      []string{"frame_id", "picture_id", "count", "last_displayed_at"},
+}
+
+var firmwareListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"created_at": "created_at",
+	},
+	DefaultSort: "-created_at",
+	Fields: []string{"version", "channel", "size", "checksum", "signature", "rollout_percent", "notes",
+		"succeeded_count", "failed_count", "created_at", "updated_at"},
+}
+
+var firmwareReportListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":          "_id",
+		"reported_at": "reported_at",
+	},
+	DefaultSort: "-reported_at",
+	Fields:      []string{"frame_id", "release_id", "from_version", "outcome", "error", "reported_at"},
+}
+
+var notificationListSpec = listSpec{
+	SortFields: map[string]string{
+		"id":         "_id",
+		"created_at": "created_at",
+	},
+	DefaultSort: "-created_at",
+	Fields:      []string{"user_id", "type", "message", "actor_id", "frame_id", "created_at", "read_at"},
+}
+
+// PaginationInfo is returned alongside every paginated list
+type PaginationInfo struct {
+	Limit      int64  `json:"limit"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+}
+
+// parsePageQuery reads `limit`, `cursor`, `sort` and `fields` from the query string.
+//
+// Sorting uses the public names of the spec, prefixed with `-` for descending order
+// (e.g. `sort=-uploaded_at`). Fields are a comma-separated list of bson field names.
+func parsePageQuery(c *gin.Context, spec listSpec) (repository.PageQuery, error) {
+	query := repository.PageQuery{
+		Limit:  defaultPageLimit,
+		Cursor: c.Query("cursor"),
+	}
+
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		limit, err := strconv.ParseInt(rawLimit, 10, 64)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return query, fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit)
+		}
+		query.Limit = limit
+	}
+
+	sortName := c.DefaultQuery("sort", spec.DefaultSort)
+	if strings.HasPrefix(sortName, "-") {
+		query.SortDesc = true
+		sortName = strings.TrimPrefix(sortName, "-")
+	}
+	sortField, ok := spec.SortFields[sortName]
+	if !ok {
+		return query, fmt.Errorf("unsupported sort field: %s", sortName)
+	}
+	query.SortField = sortField
+
+	if rawFields := c.Query("fields"); rawFields != "" {
+		for _, field := range strings.Split(rawFields, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !slices.Contains(spec.Fields, field) {
+				return query, fmt.Errorf("unsupported field: %s", field)
+			}
+			query.Fields = append(query.Fields, field)
+		}
+	}
+
+	return query, nil
+}
+
+// respondWithPage writes the standard list envelope, applying the field projection to the items
+func respondWithPage[T any](c *gin.Context, message string, query repository.PageQuery, page repository.Page[T]) {
+	var data interface{} = page.Items
+	if len(query.Fields) > 0 {
+		projected := make([]map[string]interface{}, 0, len(page.Items))
+		for _, item := range page.Items {
+			projected = append(projected, projectFields(item, query.Fields))
+		}
+		data = projected
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data":    data,
+		"pagination": PaginationInfo{
+			Limit:      query.Limit,
+			Total:      page.Total,
+			NextCursor: page.NextCursor,
+			HasMore:    page.NextCursor != "",
+		},
+	})
+}
+
+// respondWithPageError maps pagination errors to the right application error
+func respondWithPageError(c *gin.Context, message string, err error) {
+	apperror.Abort(c, fromRepository(err, "page", message))
+}
+
+// projectFields keeps only the struct fields whose bson name was requested (plus the ID),
+// keyed the same way the full model is serialized to JSON
+func projectFields(item interface{}, fields []string) map[string]interface{} {
+	value := reflect.Indirect(reflect.ValueOf(item))
+	result := make(map[string]interface{})
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		bsonName := strings.Split(field.Tag.Get("bson"), ",")[0]
+		if bsonName == "_id" || slices.Contains(fields, bsonName) {
+			result[jsonFieldName(field)] = value.Field(i).Interface()
+		}
+	}
+
+	return result
+}
+
+// jsonFieldName returns the key encoding/json uses for the struct field
+func jsonFieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
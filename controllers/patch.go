@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"mirage-backend/apperror"
+	"mirage-backend/repository"
+)
+
+// MergePatchContentType is the media type of JSON Merge Patch documents (RFC 7396)
+const MergePatchContentType = "application/merge-patch+json"
+
+// patchSpec declares which fields of a resource a PATCH may change, by their JSON name which is the Go field name
+type patchSpec struct {
+	Fields []string
+}
+
+var albumPatchSpec = patchSpec{
+	Fields: []string{"Title", "Description", "Tags", "IsPrivate", "Criteria"},
+}
+
+var userPatchSpec = patchSpec{
+	Fields: []string{"Username", "Email", "Password"},
+}
+
+var profilePatchSpec = patchSpec{
+	Fields: []string{"Name", "Surname", "Sex", "DOB"},
+}
+
+var personPatchSpec = patchSpec{
+	Fields: []string{"Name"},
+}
+
+// applyMergePatch applies the JSON Merge Patch in the request body to current.
+//
+// Only the fields of the spec may appear in the patch; the patched resource is validated with its
+// binding tags and returned together with the bson fields to $set, which are the patched ones.
+func applyMergePatch[T any](c *gin.Context, current T, spec patchSpec) (T, repository.Fields, error) {
+	var patched T
+
+	if contentType := c.ContentType(); contentType != MergePatchContentType && contentType != binding.MIMEJSON {
+		return patched, nil, apperror.New(http.StatusUnsupportedMediaType, apperror.CodeUnsupportedMediaType,
+			"Content-Type must be "+MergePatchContentType)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return patched, nil, apperror.InvalidInput(err)
+	}
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		return patched, nil, apperror.BadRequest(apperror.CodeInvalidInput, "The patch must be a JSON object")
+	}
+	for name := range patch {
+		if !slices.Contains(spec.Fields, name) {
+			return patched, nil, apperror.BadRequest(apperror.CodeImmutableField, fmt.Sprintf("%s cannot be changed", name))
+		}
+	}
+
+	// Merge the patch into the JSON representation of the resource and decode the result
+	data, err := json.Marshal(current)
+	if err != nil {
+		return patched, nil, apperror.Internal("Failed to encode resource", err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return patched, nil, apperror.Internal("Failed to encode resource", err)
+	}
+	var changes map[string]interface{}
+	if err := json.Unmarshal(body, &changes); err != nil {
+		return patched, nil, apperror.InvalidInput(err)
+	}
+	if data, err = json.Marshal(mergePatch(document, changes)); err != nil {
+		return patched, nil, apperror.Internal("Failed to apply patch", err)
+	}
+	if err := json.Unmarshal(data, &patched); err != nil {
+		return patched, nil, apperror.InvalidInput(err)
+	}
+	if err := binding.Validator.ValidateStruct(&patched); err != nil {
+		return patched, nil, apperror.InvalidInput(err)
+	}
+
+	fields := repository.Fields{}
+	value := reflect.ValueOf(patched)
+	for name := range patch {
+		field, _ := value.Type().FieldByName(name)
+		fieldValue := value.FieldByIndex(field.Index)
+		// like nonNil, a removed list is stored empty
+		if fieldValue.Kind() == reflect.Slice && fieldValue.IsNil() {
+			fieldValue = reflect.MakeSlice(fieldValue.Type(), 0, 0)
+		}
+		fields[strings.Split(field.Tag.Get("bson"), ",")[0]] = fieldValue.Interface()
+	}
+
+	return patched, fields, nil
+}
+
+// mergePatch merges patch into target following RFC 7396: null removes a member, objects merge recursively
+// and any other value replaces the member
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// etag is the entity tag of a resource version, derived from its last update with the millisecond precision MongoDB keeps
+func etag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMilli(), 36) + `"`
+}
+
+// setETag advertises the version of the returned resource
+func setETag(c *gin.Context, updatedAt time.Time) {
+	c.Header("ETag", etag(updatedAt))
+}
+
+// checkIfMatch verifies the If-Match precondition of the request against the current version of the resource.
+// Requests without If-Match are accepted, the conditional write still fails if the resource changes meanwhile.
+func checkIfMatch(c *gin.Context, updatedAt time.Time) error {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil
+	}
+
+	current := etag(updatedAt)
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == current {
+			return nil
+		}
+	}
+	return errModified
+}
+
+// nonNil returns an empty slice instead of nil, so that an emptied list is stored as such and not as null
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
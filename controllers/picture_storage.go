@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/codes"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/tracing"
+	"mirage-backend/utils"
+)
+
+// storePicture saves compressed picture data as a blob and inserts the picture referencing it.
+//
+// Parameters:
+//   - ctx: The context for database operations.
+//   - blobs: The repository storing the picture data.
+//   - pictures: The repository storing picture metadata.
+//   - data: The byte slice containing the compressed picture data.
+//   - picture: The picture metadata to be stored; its PictureDataID, Width and Height are filled in.
+//
+// This function performs the following steps:
+//  1. Retrieves the dimensions (width and height) of the picture using the `utils.GetPictureDimensions` function.
+//  2. Stores the compressed image data in the blob repository.
+//  3. Updates the `Picture` model with the generated `PictureDataID`, width, and height.
+//  4. Stores the picture metadata, removing the blob again if that fails.
+func storePicture(
+	ctx context.Context,
+	blobs repository.BlobRepository,
+	pictures repository.PictureRepository,
+	data []byte,
+	picture *models.Picture,
+) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "picture.store")
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	width, height, err := utils.GetPictureDimensions(data)
+	if err != nil {
+		return err
+	}
+
+	pictureDataID, err := blobs.Save(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	picture.PictureDataID = pictureDataID
+	picture.Height = height
+	picture.Width = width
+
+	if err := pictures.Create(ctx, picture); err != nil {
+		if cleanupErr := blobs.Delete(ctx, pictureDataID); cleanupErr != nil {
+			slog.ErrorContext(ctx, "Failed to remove orphaned picture data", "picture_data_id", pictureDataID.Hex(), "error", cleanupErr)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// errSmartAlbum answers the requests adding pictures or people to a smart album, whose pictures come from its criteria
+var errSmartAlbum = apperror.Conflict("smart_album", "Smart albums select their pictures through their criteria")
+
+// errAlbumKind answers the updates turning a regular album into a smart one or the other way around
+var errAlbumKind = apperror.Conflict("album_kind_change", "Albums cannot be turned into smart albums or back")
+
+// normalizeCriteria validates the criteria of a smart album of owner, lower casing and deduplicating its tags.
+// Smart albums must have an owner, whose pictures they select, and the people must be people of the owner.
+func normalizeCriteria(ctx context.Context, people repository.PersonRepository, ownerID primitive.ObjectID, criteria *models.SmartCriteria) error {
+	if !criteria.TakenAfter.IsZero() && !criteria.TakenBefore.IsZero() && !criteria.TakenBefore.After(criteria.TakenAfter) {
+		return apperror.BadRequest(apperror.CodeInvalidInput, "TakenBefore must be after TakenAfter")
+	}
+	if ownerID.IsZero() {
+		return apperror.BadRequest(apperror.CodeInvalidInput, "Smart albums need an owner")
+	}
+	criteria.Tags = normalizeTags(criteria.Tags)
+
+	if len(criteria.PersonIDs) == 0 {
+		return nil
+	}
+	owned, err := people.ListByOwner(ctx, ownerID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve people", err)
+	}
+	for _, personID := range criteria.PersonIDs {
+		if !slices.ContainsFunc(owned, func(person models.Person) bool { return person.ID == personID }) {
+			return apperror.BadRequest(apperror.CodeInvalidInput, "Person "+personID.Hex()+" is not a person of the album owner")
+		}
+	}
+	return nil
+}
+
+// normalizeTags lower cases and trims the tags, dropping the empty and repeated ones
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// albumPictureFilter returns the filter selecting the pictures of the album: the ones in it for a regular album,
+// the ones matching its criteria among the pictures its owner may see for a smart album
+func albumPictureFilter(ctx context.Context, albums repository.AlbumRepository, faces repository.FaceRepository, album models.Album) (repository.PictureFilter, error) {
+	criteria := album.Criteria
+	if criteria == nil {
+		return repository.PictureFilter{AlbumID: &album.ID}, nil
+	}
+
+	owned, err := albums.IDs(ctx, repository.AlbumFilter{OwnerID: &album.OwnerID})
+	if err != nil {
+		return repository.PictureFilter{}, err
+	}
+	shared, err := albums.IDs(ctx, repository.AlbumFilter{MemberID: &album.OwnerID})
+	if err != nil {
+		return repository.PictureFilter{}, err
+	}
+
+	filter := repository.PictureFilter{
+		Scope:       &repository.PictureScope{UploaderID: album.OwnerID, AlbumIDs: nonNil(append(owned, shared...))},
+		TakenAfter:  criteria.TakenAfter,
+		TakenBefore: criteria.TakenBefore,
+		Tags:        criteria.Tags,
+		UploaderIDs: criteria.UploaderIDs,
+		Near:        criteria.Near,
+	}
+
+	// The pictures must show every person, a person merged into another or left without faces matches no picture
+	for i, personID := range criteria.PersonIDs {
+		pictureIDs, err := faces.PictureIDs(ctx, repository.FaceFilter{PersonIDs: []primitive.ObjectID{personID}})
+		if err != nil {
+			return repository.PictureFilter{}, err
+		}
+		if i > 0 {
+			pictureIDs = slices.DeleteFunc(pictureIDs, func(id primitive.ObjectID) bool { return !slices.Contains(filter.IDs, id) })
+		}
+		filter.IDs = nonNil(pictureIDs)
+	}
+	return filter, nil
+}
@@ -0,0 +1,102 @@
+package controllers_test
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/apperror"
+	"mirage-backend/models"
+)
+
+// createSmartAlbum creates a smart album of ownerID selecting the pictures matching criteria
+func (a *testAPI) createSmartAlbum(ownerID, criteria string) models.Album {
+	a.t.Helper()
+	return data[models.Album](a.request(http.MethodPost, "/api/albums/", ownerID, `{"Title":"Smart","Criteria":`+criteria+`}`).
+		expect(http.StatusCreated))
+}
+
+// smartAlbumPictures returns the IDs of the pictures of the album, as seen by its owner
+func (a *testAPI) smartAlbumPictures(album models.Album) []primitive.ObjectID {
+	a.t.Helper()
+	var ids []primitive.ObjectID
+	for _, picture := range data[[]models.Picture](a.request(http.MethodGet, "/api/albums/"+album.ID.Hex()+"/pictures/?sort=uploaded_at", album.OwnerID.Hex(), "").
+		expect(http.StatusOK)) {
+		ids = append(ids, picture.ID)
+	}
+	return ids
+}
+
+func TestCreateSmartAlbum(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, strangerID := api.createUser("alice"), api.createUser("bob")
+	api.recognize(api.uploadPicture(api.createAlbum(strangerID, true).ID.Hex(), strangerID).ID)
+	people := data[[]models.Person](api.request(http.MethodGet, "/api/people/", strangerID, "").expect(http.StatusOK))
+
+	album := api.createSmartAlbum(ownerID, `{"Tags":[" Beach","beach","Sun"]}`)
+	if !album.IsPrivate || strings.Join(album.Criteria.Tags, ",") != "beach,sun" {
+		t.Errorf("smart album = %+v, want private with normalized tags", album)
+	}
+
+	invalid := []string{
+		`{"Title":"Smart","Criteria":{"TakenAfter":"2021-01-01T00:00:00Z","TakenBefore":"2020-01-01T00:00:00Z"}}`,
+		`{"Title":"Smart","Criteria":{"PersonIDs":["` + people[0].ID.Hex() + `"]}}`,
+		`{"Title":"Smart","Criteria":{"Near":{"Latitude":0,"Longitude":0,"RadiusKm":0}}}`,
+	}
+	for _, body := range invalid {
+		api.request(http.MethodPost, "/api/albums/", ownerID, body).expectProblem(http.StatusBadRequest, apperror.CodeInvalidInput)
+	}
+}
+
+func TestSmartAlbumPictures(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID, memberID, strangerID := api.createUser("alice"), api.createUser("bob"), api.createUser("carol")
+	own, shared, foreign := api.createAlbum(ownerID, true), api.createAlbum(memberID, true), api.createAlbum(strangerID, false)
+	api.share(shared, ownerID, "alice", models.RoleViewer)
+	beach := map[string]string{"tags": "beach"}
+
+	ownBeach := data[models.Picture](api.upload("/api/albums/"+own.ID.Hex()+"/pictures/", ownerID, 30, 20, beach).expect(http.StatusCreated))
+	api.uploadPicture(own.ID.Hex(), ownerID)
+	sharedBeach := data[models.Picture](api.upload("/api/albums/"+shared.ID.Hex()+"/pictures/", memberID, 30, 20, beach).expect(http.StatusCreated))
+	api.upload("/api/albums/"+foreign.ID.Hex()+"/pictures/", strangerID, 30, 20, beach).expect(http.StatusCreated)
+	api.upload("/api/pictures/", ownerID, 30, 20, beach).expect(http.StatusCreated)
+	api.uploadProfilePicture(ownerID)
+
+	// the pictures the owner may view match, the ones outside any album never do
+	if ids := api.smartAlbumPictures(api.createSmartAlbum(ownerID, `{"Tags":["beach"]}`)); !slices.Equal(ids, []primitive.ObjectID{ownBeach.ID, sharedBeach.ID}) {
+		t.Errorf("tagged pictures = %v, want %s and %s", ids, ownBeach.ID.Hex(), sharedBeach.ID.Hex())
+	}
+	if ids := api.smartAlbumPictures(api.createSmartAlbum(ownerID, `{"UploaderIDs":["`+ownerID+`"]}`)); len(ids) != 2 {
+		t.Errorf("%d pictures uploaded by the owner, want the 2 in an album", len(ids))
+	}
+
+	api.recognize(ownBeach.ID)
+	people := data[[]models.Person](api.request(http.MethodGet, "/api/people/", ownerID, "").expect(http.StatusOK))
+	withPerson := api.createSmartAlbum(ownerID, `{"PersonIDs":["`+people[0].ID.Hex()+`"]}`)
+	if ids := api.smartAlbumPictures(withPerson); !slices.Equal(ids, []primitive.ObjectID{ownBeach.ID}) {
+		t.Errorf("pictures of the person = %v, want %s", ids, ownBeach.ID.Hex())
+	}
+	api.request(http.MethodGet, "/api/albums/"+withPerson.ID.Hex()+"/pictures/", strangerID, "").expectProblem(http.StatusForbidden, apperror.CodeForbidden)
+}
+
+func TestSmartAlbumRestrictions(t *testing.T) {
+	api := newTestAPI(t)
+	ownerID := api.createUser("alice")
+	api.createUser("bob")
+	smart, regular := api.createSmartAlbum(ownerID, `{"Tags":["beach"]}`), api.createAlbum(ownerID, false)
+	path := "/api/albums/" + smart.ID.Hex()
+
+	api.upload(path+"/pictures/", ownerID, 30, 20, nil).expectProblem(http.StatusConflict, "smart_album")
+	api.request(http.MethodPost, path+"/invitations", ownerID, `{"Invitee":"bob","Role":"viewer"}`).expectProblem(http.StatusConflict, "smart_album")
+
+	// the criteria are updated, but albums don't change kind
+	patched := data[models.Album](api.request(http.MethodPatch, path, ownerID, `{"Criteria":{"Tags":["Sea"]},"IsPrivate":false}`).expect(http.StatusOK))
+	if !patched.IsPrivate || strings.Join(patched.Criteria.Tags, ",") != "sea" {
+		t.Errorf("patched smart album = %+v, want private with the new tags", patched)
+	}
+	api.request(http.MethodPatch, path, ownerID, `{"Criteria":null}`).expectProblem(http.StatusConflict, "album_kind_change")
+	api.request(http.MethodPut, path, ownerID, `{"Title":"Regular"}`).expectProblem(http.StatusConflict, "album_kind_change")
+	api.request(http.MethodPatch, "/api/albums/"+regular.ID.Hex(), ownerID, `{"Criteria":{"Tags":["sea"]}}`).expectProblem(http.StatusConflict, "album_kind_change")
+}
@@ -1,29 +1,76 @@
 package database
 
-import "go.mongodb.org/mongo-driver/mongo"
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
 var (
-	PfpCollection         *mongo.Collection
-	AlbumCollection       *mongo.Collection
-	PictureCollection     *mongo.Collection
-	PictureDataCollection *mongo.Collection
-	UserCollection        *mongo.Collection
+	PfpCollection            *mongo.Collection
+	AlbumCollection          *mongo.Collection
+	PictureCollection        *mongo.Collection
+	PictureDataCollection    *mongo.Collection
+	UserCollection           *mongo.Collection
+	FaceCollection           *mongo.Collection
+	ProfileCollection        *mongo.Collection
+	InvitationCollection     *mongo.Collection
+	ShareLinkCollection      *mongo.Collection
+	FrameCollection          *mongo.Collection
+	NotificationCollection   *mongo.Collection
+	HeartbeatCollection      *mongo.Collection
+	DisplayStatCollection    *mongo.Collection
+	FirmwareCollection       *mongo.Collection
+	FirmwareReportCollection *mongo.Collection
+	PersonCollection         *mongo.Collection
 )
 
 // Collection names
 const (
-	PfpCollectionName         = "profilepictures"
-	AlbumCollectionName       = "albums"
-	PictureCollectionName     = "pictures"
-	PictureDataCollectionName = "pictureData"
-	UserCollectionName        = "users"
+	PfpCollectionName            = "profilepictures"
+	AlbumCollectionName          = "albums"
+	PictureCollectionName        = "pictures"
+	PictureDataCollectionName    = "pictureData"
+	UserCollectionName           = "users"
+	FaceCollectionName           = "recognizedFaces"
+	ProfileCollectionName        = "userprofiles"
+	InvitationCollectionName     = "albumInvitations"
+	ShareLinkCollectionName      = "shareLinks"
+	FrameCollectionName          = "smartFrames"
+	NotificationCollectionName   = "notifications"
+	HeartbeatCollectionName      = "frameHeartbeats"
+	DisplayStatCollectionName    = "pictureDisplayStats"
+	FirmwareCollectionName       = "firmwareReleases"
+	FirmwareReportCollectionName = "firmwareReports"
+	PersonCollectionName         = "people"
 )
 
 // InitializeCollections initializes all MongoDB collections used in the application
-func InitializeCollections() {
-	PfpCollection = GetCollection(PfpCollectionName)
-	AlbumCollection = GetCollection(AlbumCollectionName)
-	PictureCollection = GetCollection(PictureCollectionName)
-	PictureDataCollection = GetCollection(PictureDataCollectionName)
-	UserCollection = GetCollection(UserCollectionName)
+func InitializeCollections() error {
+	var errs []error
+	collections := map[string]**mongo.Collection{
+		PfpCollectionName:            &PfpCollection,
+		AlbumCollectionName:          &AlbumCollection,
+		PictureCollectionName:        &PictureCollection,
+		PictureDataCollectionName:    &PictureDataCollection,
+		UserCollectionName:           &UserCollection,
+		FaceCollectionName:           &FaceCollection,
+		ProfileCollectionName:        &ProfileCollection,
+		InvitationCollectionName:     &InvitationCollection,
+		ShareLinkCollectionName:      &ShareLinkCollection,
+		FrameCollectionName:          &FrameCollection,
+		NotificationCollectionName:   &NotificationCollection,
+		HeartbeatCollectionName:      &HeartbeatCollection,
+		DisplayStatCollectionName:    &DisplayStatCollection,
+		FirmwareCollectionName:       &FirmwareCollection,
+		FirmwareReportCollectionName: &FirmwareReportCollection,
+		PersonCollectionName:         &PersonCollection,
+	}
+	for name, collection := range collections {
+		var err error
+		if *collection, err = EnsureCollection(Db.Database, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
-	"log"
+	"log/slog"
 	"mirage-backend/config"
 	"time"
 
@@ -19,26 +19,22 @@ type Connection struct {
 
 var Db = Connection{}
 
-func SetupDatabase() (bool, error) {
-	mongoURI := config.GetDatabaseURI()
-	if mongoURI == "" {
-		return false, fmt.Errorf("MONGO_URI not set in .env file")
-	}
-
+// SetupDatabase connects to MongoDB, extra options such as command monitors are applied after the URI
+func SetupDatabase(cfg config.DatabaseConfig, extra ...*options.ClientOptions) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var err error
-	clientOptions := options.Client().ApplyURI(mongoURI)
+	clientOptions := append([]*options.ClientOptions{options.Client().ApplyURI(cfg.URI)}, extra...)
 
 	// Connect to MongoDB
-	Db.Client, err = mongo.Connect(ctx, clientOptions)
+	Db.Client, err = mongo.Connect(ctx, clientOptions...)
 	if err != nil {
 		return false, fmt.Errorf("failed to connect to MongoDB: %v", err)
 	}
 
 	// set database
-	Db.Database = Db.Client.Database(config.GetDatabaseName())
+	Db.Database = Db.Client.Database(cfg.Name)
 
 	// verify connection
 	err = Db.Client.Ping(ctx, nil)
@@ -49,13 +45,12 @@ func SetupDatabase() (bool, error) {
 	return true, nil
 }
 
-func GetCollection(collectionName string) *mongo.Collection {
-	// Ensure 'users' collection exists
-	collection, err := EnsureCollection(Db.Database, collectionName)
-	if err != nil {
-		log.Fatalf("Error ensuring users collection: %v", err)
+// Disconnect closes the MongoDB client, waiting for in-progress operations until ctx is done
+func Disconnect(ctx context.Context) error {
+	if Db.Client == nil {
+		return nil
 	}
-	return collection
+	return Db.Client.Disconnect(ctx)
 }
 
 // EnsureCollection checks if a collection exists and creates it if it doesn't
@@ -89,7 +84,7 @@ func EnsureCollection(db *mongo.Database, collectionName string) (*mongo.Collect
 			return nil, fmt.Errorf("failed to create collection %s: %v", collectionName, err)
 		}
 
-		log.Printf("Created new collection: %s", collectionName)
+		slog.Info("Created new collection", "collection", collectionName)
 	}
 
 	// Return the collection
@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SchemaReport lists what ReconcileSchema changed or found out of place
+type SchemaReport struct {
+	CreatedIndexes    []string // Declared indexes that were missing
+	RecreatedIndexes  []string // Indexes whose definition drifted from the declaration
+	UndeclaredIndexes []string // Indexes present in the database but not declared, left untouched
+	UpdatedValidators []string // Collections whose validator was missing or different
+}
+
+// HasDrift reports whether the database didn't match the declared schema
+func (r SchemaReport) HasDrift() bool {
+	return len(r.CreatedIndexes)+len(r.RecreatedIndexes)+len(r.UndeclaredIndexes)+len(r.UpdatedValidators) > 0
+}
+
+// existingIndex is the subset of the listIndexes output needed to detect drift
+type existingIndex struct {
+	Name               string   `bson:"name"`
+	Key                bson.D   `bson:"key"`
+	Unique             bool     `bson:"unique"`
+	Sparse             bool     `bson:"sparse"`
+	Weights            bson.Raw `bson:"weights"`
+	ExpireAfterSeconds *int64   `bson:"expireAfterSeconds"` // Only set on TTL indexes
+}
+
+// ReconcileSchema makes the indexes and validators of every collection match CollectionSpecs.
+//
+// It is idempotent: missing indexes are created, drifted ones are dropped and recreated, and validators
+// are (re)applied only when they differ. Indexes that exist but are not declared are reported, not dropped.
+// Errors on a collection don't stop the reconciliation of the others; they are joined in the returned error.
+func ReconcileSchema(ctx context.Context, db *mongo.Database) (SchemaReport, error) {
+	var report SchemaReport
+	var errs []error
+
+	for _, spec := range CollectionSpecs {
+		if _, err := EnsureCollection(db, spec.Name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := reconcileValidator(ctx, db, spec, &report); err != nil {
+			errs = append(errs, fmt.Errorf("validator on %s: %v", spec.Name, err))
+		}
+		if err := reconcileIndexes(ctx, db.Collection(spec.Name), spec, &report); err != nil {
+			errs = append(errs, fmt.Errorf("indexes on %s: %v", spec.Name, err))
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// LogSchemaReport prints the drift found by ReconcileSchema
+func LogSchemaReport(report SchemaReport) {
+	if !report.HasDrift() {
+		slog.Info("Database schema is up to date")
+		return
+	}
+	for _, name := range report.CreatedIndexes {
+		slog.Warn("Schema drift: created missing index", "index", name)
+	}
+	for _, name := range report.RecreatedIndexes {
+		slog.Warn("Schema drift: recreated index with its declared definition", "index", name)
+	}
+	for _, name := range report.UndeclaredIndexes {
+		slog.Warn("Schema drift: index is not declared", "index", name)
+	}
+	for _, name := range report.UpdatedValidators {
+		slog.Warn("Schema drift: updated validator", "collection", name)
+	}
+}
+
+// reconcileValidator applies the declared validator when the current one differs
+func reconcileValidator(ctx context.Context, db *mongo.Database, spec CollectionSpec, report *SchemaReport) error {
+	specs, err := db.ListCollectionSpecifications(ctx, bson.M{"name": spec.Name})
+	if err != nil {
+		return err
+	}
+
+	var current bson.Raw
+	if len(specs) == 1 && specs[0].Options != nil {
+		if validator, err := specs[0].Options.LookupErr("validator"); err == nil {
+			current, _ = validator.DocumentOK()
+		}
+	}
+
+	if sameDocument(current, spec.Validator) {
+		return nil
+	}
+
+	command := bson.D{
+		{Key: "collMod", Value: spec.Name},
+		{Key: "validator", Value: spec.Validator},
+		// documents written before the validator existed are not rejected on unrelated updates
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}
+	if err := db.RunCommand(ctx, command).Err(); err != nil {
+		return err
+	}
+
+	report.UpdatedValidators = append(report.UpdatedValidators, spec.Name)
+	return nil
+}
+
+// reconcileIndexes creates missing indexes and recreates drifted ones
+func reconcileIndexes(ctx context.Context, collection *mongo.Collection, spec CollectionSpec, report *SchemaReport) error {
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var existing []existingIndex
+	if err := cursor.All(ctx, &existing); err != nil {
+		return err
+	}
+
+	byName := make(map[string]existingIndex, len(existing))
+	for _, index := range existing {
+		byName[index.Name] = index
+	}
+
+	declared := map[string]bool{"_id_": true}
+	for _, index := range spec.Indexes {
+		declared[index.Name] = true
+		qualifiedName := spec.Name + "." + index.Name
+
+		current, ok := byName[index.Name]
+		if ok && matchesIndex(current, index) {
+			continue
+		}
+
+		if ok {
+			if _, err := collection.Indexes().DropOne(ctx, index.Name); err != nil {
+				return err
+			}
+		} else if index.isText() {
+			// only one text index is allowed per collection, drop any other one first
+			for _, other := range existing {
+				if other.Name != index.Name && isTextKey(other.Key) {
+					if _, err := collection.Indexes().DropOne(ctx, other.Name); err != nil {
+						return err
+					}
+					declared[other.Name] = true
+					report.RecreatedIndexes = append(report.RecreatedIndexes, spec.Name+"."+other.Name)
+				}
+			}
+		}
+
+		if _, err := collection.Indexes().CreateOne(ctx, index.model()); err != nil {
+			return fmt.Errorf("failed to create index %s: %v", index.Name, err)
+		}
+
+		if ok {
+			report.RecreatedIndexes = append(report.RecreatedIndexes, qualifiedName)
+		} else {
+			report.CreatedIndexes = append(report.CreatedIndexes, qualifiedName)
+		}
+	}
+
+	for _, index := range existing {
+		if !declared[index.Name] {
+			report.UndeclaredIndexes = append(report.UndeclaredIndexes, spec.Name+"."+index.Name)
+		}
+	}
+
+	return nil
+}
+
+// matchesIndex compares an index found in the database with its declaration
+func matchesIndex(current existingIndex, spec IndexSpec) bool {
+	if current.Unique != spec.Unique || current.Sparse != spec.Sparse {
+		return false
+	}
+	if current.ExpireAfterSeconds == nil {
+		if spec.ExpireAfter > 0 {
+			return false
+		}
+	} else if *current.ExpireAfterSeconds != int64(spec.ExpireAfter.Seconds()) {
+		return false
+	}
+
+	if spec.isText() {
+		// text indexes are stored as {_fts: "text", _ftsx: 1}, the indexed fields only appear in the weights
+		weights := spec.Weights
+		if len(weights) == 0 {
+			for _, key := range spec.Keys {
+				weights = append(weights, bson.E{Key: key.Key, Value: 1})
+			}
+		}
+		return isTextKey(current.Key) && sameDocument(current.Weights, weightsAsDocument(weights))
+	}
+
+	if len(current.Key) != len(spec.Keys) {
+		return false
+	}
+	for i, key := range spec.Keys {
+		if current.Key[i].Key != key.Key || !reflect.DeepEqual(normalize(current.Key[i].Value), normalize(key.Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// weightsAsDocument converts declared weights into a document comparable with the stored ones
+func weightsAsDocument(weights bson.D) bson.M {
+	document := bson.M{}
+	for _, weight := range weights {
+		document[weight.Key] = weight.Value
+	}
+	return document
+}
+
+func isTextKey(key bson.D) bool {
+	for _, k := range key {
+		if k.Key == "_fts" {
+			return true
+		}
+	}
+	return false
+}
+
+// sameDocument compares a document read from the database with a declared one, ignoring
+// field order and numeric types (the server may return int32 where we declared int)
+func sameDocument(current bson.Raw, declared interface{}) bool {
+	if current == nil {
+		return false
+	}
+
+	declaredBytes, err := bson.Marshal(declared)
+	if err != nil {
+		return false
+	}
+
+	var a, b bson.M
+	if bson.Unmarshal(current, &a) != nil || bson.Unmarshal(declaredBytes, &b) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// normalize turns decoded documents into plain maps and slices with float numbers
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		m := make(map[string]interface{}, len(v))
+		for _, e := range v {
+			m[e.Key] = normalize(e.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = normalize(e)
+		}
+		return m
+	case bson.A:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = normalize(e)
+		}
+		return s
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,398 @@
+package database
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index that must exist on a collection
+type IndexSpec struct {
+	Name        string
+	Keys        bson.D
+	Unique      bool
+	Sparse      bool
+	Weights     bson.D        // Only for text indexes
+	ExpireAfter time.Duration // Only for TTL indexes on a date field, documents are deleted this long after it
+}
+
+// CollectionSpec declares the indexes and the JSON schema validator of a collection
+type CollectionSpec struct {
+	Name      string
+	Indexes   []IndexSpec
+	Validator bson.M
+}
+
+// Text index names, MongoDB allows a single text index per collection
+const (
+	AlbumTextIndexName   = "albums_text"
+	PictureTextIndexName = "pictures_text"
+	FaceTextIndexName    = "faces_text"
+)
+
+// HeartbeatRetention is how long the heartbeats of the frames are kept as their status history
+const HeartbeatRetention = 30 * 24 * time.Hour
+
+var objectID = bson.M{"bsonType": "objectId"}
+var date = bson.M{"bsonType": "date"}
+var fraction = bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": 0, "maximum": 1}
+
+// CollectionSpecs is the declared schema of every collection, reconciled at startup by ReconcileSchema
+var CollectionSpecs = []CollectionSpec{
+	{
+		Name: UserCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "username_unique", Keys: bson.D{{Key: "username", Value: 1}}, Unique: true},
+			{Name: "email_unique", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		},
+		Validator: jsonSchema([]string{"username", "email", "password", "created_at"}, bson.M{
+			"username":           bson.M{"bsonType": "string", "minLength": 1},
+			"email":              bson.M{"bsonType": "string", "minLength": 3},
+			"password":           bson.M{"bsonType": "string", "minLength": 1},
+			"user_profile_id":    objectID,
+			"profile_picture_id": objectID,
+			"albums_id":          bson.M{"bsonType": "array", "items": objectID},
+			"created_at":         date,
+			"updated_at":         date,
+		}),
+	},
+	{
+		Name: AlbumCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "user_id", Keys: bson.D{{Key: "user_id", Value: 1}}},
+			{Name: "target_user_ids", Keys: bson.D{{Key: "target_user_ids", Value: 1}}},
+			{
+				Name: AlbumTextIndexName,
+				Keys: bson.D{{Key: "title", Value: "text"}, {Key: "tags", Value: "text"}, {Key: "description", Value: "text"}},
+				// title matches rank above tags, and tags above the description
+				Weights: bson.D{{Key: "title", Value: 10}, {Key: "tags", Value: 5}, {Key: "description", Value: 2}},
+			},
+		},
+		Validator: jsonSchema([]string{"title", "user_id", "is_private", "created_at"}, bson.M{
+			"title":           bson.M{"bsonType": "string", "minLength": 1},
+			"description":     bson.M{"bsonType": "string"},
+			"user_id":         objectID,
+			"target_user_ids": bson.M{"bsonType": "array", "items": objectID},
+			"tags":            bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+			"is_private":      bson.M{"bsonType": "bool"},
+			"created_at":      date,
+			"updated_at":      date,
+			"criteria": bson.M{"bsonType": "object", "properties": bson.M{
+				"taken_after":  date,
+				"taken_before": date,
+				"tags":         bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+				"person_ids":   bson.M{"bsonType": "array", "items": objectID},
+				"uploader_ids": bson.M{"bsonType": "array", "items": objectID},
+				"near": bson.M{"bsonType": "object", "required": []string{"latitude", "longitude", "radius_km"}, "properties": bson.M{
+					"latitude":  bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": -90, "maximum": 90},
+					"longitude": bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": -180, "maximum": 180},
+					"radius_km": bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": 0},
+				}},
+			}},
+		}),
+	},
+	{
+		Name: InvitationCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "album_id_user_id_unique", Keys: bson.D{{Key: "album_id", Value: 1}, {Key: "user_id", Value: 1}}, Unique: true},
+			{Name: "user_id_status", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}}},
+		},
+		Validator: jsonSchema([]string{"album_id", "user_id", "invited_by_id", "role", "status", "created_at"}, bson.M{
+			"album_id":      objectID,
+			"user_id":       objectID,
+			"invited_by_id": objectID,
+			"role":          bson.M{"enum": []string{"viewer", "contributor", "co_owner"}},
+			"status":        bson.M{"enum": []string{"pending", "accepted", "declined", "revoked"}},
+			"created_at":    date,
+			"responded_at":  date,
+			"updated_at":    date,
+		}),
+	},
+	{
+		Name: ShareLinkCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "token_unique", Keys: bson.D{{Key: "token", Value: 1}}, Unique: true},
+			{Name: "album_id", Keys: bson.D{{Key: "album_id", Value: 1}}},
+			{Name: "picture_id", Keys: bson.D{{Key: "picture_id", Value: 1}}},
+		},
+		Validator: jsonSchema([]string{"token", "has_password", "allow_download", "access_count", "created_at"}, bson.M{
+			"token":            bson.M{"bsonType": "string", "minLength": 1},
+			"album_id":         objectID,
+			"picture_id":       objectID,
+			"created_by_id":    objectID,
+			"password_hash":    bson.M{"bsonType": "binData"},
+			"has_password":     bson.M{"bsonType": "bool"},
+			"allow_download":   bson.M{"bsonType": "bool"},
+			"expires_at":       date,
+			"access_count":     bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"last_accessed_at": date,
+			"created_at":       date,
+		}),
+	},
+	{
+		Name: FrameCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "owner_id", Keys: bson.D{{Key: "owner_id", Value: 1}}},
+			{Name: "claim_token_hash", Keys: bson.D{{Key: "claim_token_hash", Value: 1}}, Sparse: true},
+			{Name: "loaded_albums_id", Keys: bson.D{{Key: "loaded_albums_id", Value: 1}}},
+		},
+		Validator: jsonSchema([]string{"owner_id", "created_at"}, bson.M{
+			"name":              bson.M{"bsonType": "string"},
+			"owner_id":          objectID,
+			"gifted_by_id":      objectID,
+			"claim_token_hash":  bson.M{"bsonType": "string"},
+			"claim_expires_at":  date,
+			"claimed_at":        date,
+			"device_token_hash": bson.M{"bsonType": "string"},
+			"created_at":        date,
+			"first_boot":        date,
+			"loaded_albums_id":  bson.M{"bsonType": "array", "items": objectID},
+			"settings": bson.M{"bsonType": "object", "properties": bson.M{
+				"slide_interval": bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+				"transition":     bson.M{"enum": []string{"none", "fade", "slide", "zoom"}},
+				"order":          bson.M{"enum": []string{"shuffle", "chronological"}},
+				"album_weights": bson.M{"bsonType": "array", "items": bson.M{
+					"bsonType": "object",
+					"required": []string{"album_id", "weight"},
+					"properties": bson.M{
+						"album_id": objectID,
+						"weight":   bson.M{"bsonType": []string{"int", "long"}, "minimum": 1},
+					},
+				}},
+			}},
+			"config_version":   bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"firmware_channel": bson.M{"enum": []string{"stable", "beta"}},
+			"status": bson.M{"bsonType": "object", "properties": bson.M{
+				"last_seen_at":       date,
+				"firmware_version":   bson.M{"bsonType": "string"},
+				"free_storage":       bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+				"ip_address":         bson.M{"bsonType": "string"},
+				"current_picture_id": objectID,
+			}},
+			"updated_at": date,
+		}),
+	},
+	{
+		Name: NotificationCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "user_id_created_at", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		Validator: jsonSchema([]string{"user_id", "type", "message", "created_at"}, bson.M{
+			"user_id":    objectID,
+			"type":       bson.M{"enum": []string{"frame_claimed"}},
+			"message":    bson.M{"bsonType": "string"},
+			"actor_id":   objectID,
+			"frame_id":   objectID,
+			"created_at": date,
+			"read_at":    date,
+		}),
+	},
+	{
+		Name: HeartbeatCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "frame_id_received_at", Keys: bson.D{{Key: "frame_id", Value: 1}, {Key: "received_at", Value: -1}}},
+			{Name: "received_at_ttl", Keys: bson.D{{Key: "received_at", Value: 1}}, ExpireAfter: HeartbeatRetention},
+		},
+		Validator: jsonSchema([]string{"frame_id", "received_at", "firmware_version"}, bson.M{
+			"frame_id":           objectID,
+			"received_at":        date,
+			"firmware_version":   bson.M{"bsonType": "string"},
+			"free_storage":       bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"ip_address":         bson.M{"bsonType": "string"},
+			"current_picture_id": objectID,
+		}),
+	},
+	{
+		Name: DisplayStatCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "frame_id_picture_id_unique", Keys: bson.D{{Key: "frame_id", Value: 1}, {Key: "picture_id", Value: 1}}, Unique: true},
+		},
+		Validator: jsonSchema([]string{"frame_id", "picture_id", "count"}, bson.M{
+			"frame_id":          objectID,
+			"picture_id":        objectID,
+			"count":             bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"last_displayed_at": date,
+		}),
+	},
+	{
+		Name: FirmwareCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "channel_version_unique", Keys: bson.D{{Key: "channel", Value: 1}, {Key: "version", Value: 1}}, Unique: true},
+		},
+		Validator: jsonSchema([]string{"version", "channel", "blob_id", "size", "checksum", "signature", "rollout_percent", "created_at"}, bson.M{
+			"version":         bson.M{"bsonType": "string", "pattern": `^[0-9]+\.[0-9]+\.[0-9]+$`},
+			"channel":         bson.M{"enum": []string{"stable", "beta"}},
+			"blob_id":         objectID,
+			"size":            bson.M{"bsonType": []string{"int", "long"}, "minimum": 1},
+			"checksum":        bson.M{"bsonType": "string", "pattern": "^[0-9a-f]{64}$"},
+			"signature":       bson.M{"bsonType": "string", "minLength": 1},
+			"rollout_percent": bson.M{"bsonType": []string{"int", "long"}, "minimum": 0, "maximum": 100},
+			"notes":           bson.M{"bsonType": "string"},
+			"succeeded_count": bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"failed_count":    bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"created_at":      date,
+			"updated_at":      date,
+		}),
+	},
+	{
+		Name: FirmwareReportCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "release_id_reported_at", Keys: bson.D{{Key: "release_id", Value: 1}, {Key: "reported_at", Value: -1}}},
+			{Name: "frame_id_outcome", Keys: bson.D{{Key: "frame_id", Value: 1}, {Key: "outcome", Value: 1}}},
+		},
+		Validator: jsonSchema([]string{"frame_id", "release_id", "outcome", "reported_at"}, bson.M{
+			"frame_id":     objectID,
+			"release_id":   objectID,
+			"from_version": bson.M{"bsonType": "string"},
+			"outcome":      bson.M{"enum": []string{"succeeded", "failed"}},
+			"error":        bson.M{"bsonType": "string"},
+			"reported_at":  date,
+		}),
+	},
+	{
+		Name: PictureCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "album_id_uploaded_at", Keys: bson.D{{Key: "album_id", Value: 1}, {Key: "uploaded_at", Value: -1}}},
+			{Name: "uploader_user_id", Keys: bson.D{{Key: "uploader_user_id", Value: 1}}},
+			{Name: "taken_at", Keys: bson.D{{Key: "taken_at", Value: -1}}},
+			{Name: "tags", Keys: bson.D{{Key: "tags", Value: 1}}},
+			{Name: "location", Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+			{Name: "picture_data_id", Keys: bson.D{{Key: "picture_data_id", Value: 1}}},
+			{Name: PictureTextIndexName, Keys: bson.D{{Key: "description", Value: "text"}}},
+		},
+		Validator: jsonSchema([]string{"picture_data_id", "album_id", "uploaded_at"}, bson.M{
+			"picture_data_id":    objectID,
+			"thumbnail":          bson.M{"bsonType": "binData"},
+			"album_id":           objectID,
+			"uploader_user_id":   objectID,
+			"description":        bson.M{"bsonType": "string"},
+			"uploaded_at":        date,
+			"faces_id":           bson.M{"bsonType": "array", "items": objectID},
+			"width":              bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"height":             bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"recognition_status": bson.M{"enum": []string{"done", "failed"}},
+			"recognized_at":      date,
+			"taken_at":           date,
+			"tags":               bson.M{"bsonType": "array", "items": bson.M{"bsonType": "string"}},
+			"location": bson.M{"bsonType": "object", "required": []string{"lng", "lat"}, "properties": bson.M{
+				"lng": bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": -180, "maximum": 180},
+				"lat": bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": -90, "maximum": 90},
+			}},
+		}),
+	},
+	{
+		Name: PictureDataCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "hash", Keys: bson.D{{Key: "hash", Value: 1}}, Sparse: true},
+		},
+		Validator: jsonSchema([]string{"data"}, bson.M{
+			"data": bson.M{"bsonType": "binData"},
+			"hash": bson.M{"bsonType": "string", "pattern": "^[0-9a-f]{64}$"},
+		}),
+	},
+	{
+		Name: ProfileCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "user_id_unique", Keys: bson.D{{Key: "user_id", Value: 1}}, Unique: true},
+		},
+		Validator: jsonSchema([]string{"user_id", "name", "surname", "created_at"}, bson.M{
+			"user_id":    objectID,
+			"name":       bson.M{"bsonType": "string", "minLength": 1},
+			"surname":    bson.M{"bsonType": "string", "minLength": 1},
+			"sex":        bson.M{"enum": []string{"female", "male", "other"}}, // empty once cleared by an update
+			"dob":        date,
+			"created_at": date,
+			"updated_at": date,
+		}),
+	},
+	{
+		Name: PfpCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "user_id_created_at", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		Validator: jsonSchema([]string{"picture_id", "user_id", "created_at"}, bson.M{
+			"picture_id":     objectID,
+			"avatar_data_id": objectID,
+			"user_id":        objectID,
+			"created_at":     date,
+		}),
+	},
+	{
+		Name: FaceCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "picture_id", Keys: bson.D{{Key: "picture_id", Value: 1}}},
+			{Name: "person_id", Keys: bson.D{{Key: "person_id", Value: 1}}, Sparse: true},
+			{Name: FaceTextIndexName, Keys: bson.D{{Key: "name", Value: "text"}}},
+		},
+		Validator: jsonSchema([]string{"picture_id", "confidence", "recognized_at"}, bson.M{
+			"picture_id":    objectID,
+			"name":          bson.M{"bsonType": "string"},
+			"sex":           bson.M{"bsonType": "string"},
+			"confidence":    bson.M{"bsonType": []string{"double", "int", "long"}, "minimum": 0, "maximum": 1},
+			"recognized_at": date,
+			"age":           bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"box": bson.M{"bsonType": "object", "properties": bson.M{
+				"x":      fraction,
+				"y":      fraction,
+				"width":  fraction,
+				"height": fraction,
+			}},
+			"person_id": objectID,
+			"embedding": bson.M{"bsonType": "array", "items": bson.M{"bsonType": []string{"double", "int", "long"}}},
+		}),
+	},
+	{
+		Name: PersonCollectionName,
+		Indexes: []IndexSpec{
+			{Name: "owner_id_updated_at", Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		},
+		Validator: jsonSchema([]string{"owner_id", "face_count", "centroid", "created_at", "updated_at"}, bson.M{
+			"owner_id":   objectID,
+			"name":       bson.M{"bsonType": "string"},
+			"face_count": bson.M{"bsonType": []string{"int", "long"}, "minimum": 0},
+			"centroid":   bson.M{"bsonType": "array", "items": bson.M{"bsonType": []string{"double", "int", "long"}}},
+			"created_at": date,
+			"updated_at": date,
+		}),
+	},
+}
+
+// jsonSchema builds a $jsonSchema validator for documents with the given required fields and properties
+func jsonSchema(required []string, properties bson.M) bson.M {
+	properties["_id"] = objectID
+	return bson.M{"$jsonSchema": bson.M{
+		"bsonType":   "object",
+		"required":   required,
+		"properties": properties,
+	}}
+}
+
+// model converts the spec into the index model used to create it
+func (s IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(s.Name)
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.Sparse {
+		opts.SetSparse(true)
+	}
+	if len(s.Weights) > 0 {
+		opts.SetWeights(s.Weights)
+	}
+	if s.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(s.ExpireAfter.Seconds()))
+	}
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+// isText reports whether the spec declares a text index
+func (s IndexSpec) isText() bool {
+	for _, key := range s.Keys {
+		if key.Value == "text" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+// Package events pushes events to the connected smart frames.
+//
+// The broker lives in the process: a frame receives the events published by the instance it is connected to,
+// and after a restart the frames are told to refresh since the events they missed are gone.
+package events
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/metrics"
+)
+
+// Types of the events pushed to frames
+const (
+	TypePictureAdded    = "picture_added"    // A picture was uploaded into a loaded album
+	TypeAlbumRemoved    = "album_removed"    // An album was removed from the frame
+	TypeSettingsChanged = "settings_changed" // The configuration changed, the frame fetches it again
+	TypeReboot          = "reboot"           // The owner asked the frame to reboot
+	TypeRefresh         = "refresh"          // The frame reloads its configuration and pictures, also sent when events were missed
+)
+
+// DefaultHistory is how many recent events are kept per frame for frames resuming after a disconnection
+const DefaultHistory = 100
+
+// subscriptionBuffer is how many events a subscriber can lag behind before it is disconnected
+const subscriptionBuffer = 32
+
+// Event is something pushed to a frame
+type Event struct {
+	ID   string // Resumption point, "<epoch>-<sequence>"
+	Type string // One of the Type* values
+	Data any    // Payload, sent as JSON
+	At   time.Time
+}
+
+// Broker fans the events published for a frame out to its connections and remembers the last ones
+type Broker struct {
+	epoch   string
+	history int
+
+	mu     sync.Mutex
+	frames map[primitive.ObjectID]*frameStream
+	closed bool
+	done   chan struct{}
+}
+
+// frameStream holds the state of the events of one frame
+type frameStream struct {
+	sequence    uint64
+	recent      []Event
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription receives the events of a frame until it is closed
+type Subscription struct {
+	broker  *Broker
+	frameID primitive.ObjectID
+	events  chan Event
+}
+
+// NewBroker returns a broker keeping the given number of recent events per frame
+func NewBroker(history int) *Broker {
+	return &Broker{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		history: history,
+		frames:  make(map[primitive.ObjectID]*frameStream),
+		done:    make(chan struct{}),
+	}
+}
+
+// Publish sends an event to the connections of the frame and returns how many received it.
+// Subscribers too far behind are disconnected, they resume from the history when reconnecting.
+func (b *Broker) Publish(frameID primitive.ObjectID, eventType string, data any) (Event, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stream := b.stream(frameID)
+	stream.sequence++
+	event := Event{ID: b.eventID(stream.sequence), Type: eventType, Data: data, At: time.Now()}
+
+	stream.recent = append(stream.recent, event)
+	if len(stream.recent) > b.history {
+		stream.recent = stream.recent[len(stream.recent)-b.history:]
+	}
+
+	delivered := 0
+	for subscription := range stream.subscribers {
+		select {
+		case subscription.events <- event:
+			delivered++
+		default:
+			b.unsubscribe(subscription)
+		}
+	}
+	return event, delivered
+}
+
+// Subscribe connects to the events of a frame. The events published after lastEventID are returned as missed.
+// When they can't be told, because lastEventID is unknown or too old, resync is true and missed only holds
+// a TypeRefresh event without data, carrying the current resumption point.
+func (b *Broker) Subscribe(frameID primitive.ObjectID, lastEventID string) (subscription *Subscription, missed []Event, resync bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscription = &Subscription{broker: b, frameID: frameID, events: make(chan Event, subscriptionBuffer)}
+	if b.closed {
+		close(subscription.events)
+		return subscription, nil, false
+	}
+
+	stream := b.stream(frameID)
+	stream.subscribers[subscription] = struct{}{}
+	metrics.FrameEventStreams.Inc()
+
+	if lastEventID == "" {
+		return subscription, nil, false
+	}
+	refresh := []Event{{ID: b.eventID(stream.sequence), Type: TypeRefresh, At: time.Now()}}
+	sequence, ok := b.sequence(lastEventID)
+	if !ok || sequence > stream.sequence {
+		return subscription, refresh, true
+	}
+	if sequence == stream.sequence {
+		return subscription, nil, false
+	}
+	// The oldest remembered event must directly follow the last one received, otherwise some were forgotten
+	if len(stream.recent) == 0 || b.mustSequence(stream.recent[0].ID) > sequence+1 {
+		return subscription, refresh, true
+	}
+	for _, event := range stream.recent {
+		if b.mustSequence(event.ID) > sequence {
+			missed = append(missed, event)
+		}
+	}
+	return subscription, missed, false
+}
+
+// Connected returns how many connections the frame has
+func (b *Broker) Connected(frameID primitive.ObjectID) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if stream, ok := b.frames[frameID]; ok {
+		return len(stream.subscribers)
+	}
+	return 0
+}
+
+// Done is closed once the broker is closed
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Close disconnects every subscriber, letting the event streams end so that the server can shut down
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, stream := range b.frames {
+		for subscription := range stream.subscribers {
+			b.unsubscribe(subscription)
+		}
+	}
+	close(b.done)
+}
+
+// Events delivers the events of the frame, it is closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.unsubscribe(s)
+}
+
+// stream returns the state of the frame's events, creating it on first use; b.mu must be held
+func (b *Broker) stream(frameID primitive.ObjectID) *frameStream {
+	stream, ok := b.frames[frameID]
+	if !ok {
+		stream = &frameStream{subscribers: make(map[*Subscription]struct{})}
+		b.frames[frameID] = stream
+	}
+	return stream
+}
+
+// unsubscribe removes the subscription and closes its channel, once; b.mu must be held
+func (b *Broker) unsubscribe(subscription *Subscription) {
+	stream, ok := b.frames[subscription.frameID]
+	if !ok {
+		return
+	}
+	if _, ok := stream.subscribers[subscription]; !ok {
+		return
+	}
+	delete(stream.subscribers, subscription)
+	close(subscription.events)
+	metrics.FrameEventStreams.Dec()
+}
+
+// eventID returns the ID of the event with the given sequence
+func (b *Broker) eventID(sequence uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(sequence, 10)
+}
+
+// sequence extracts the sequence of an event ID of this broker's epoch
+func (b *Broker) sequence(eventID string) (uint64, bool) {
+	epoch, sequence, found := strings.Cut(eventID, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(sequence, 10, 64)
+	return value, err == nil
+}
+
+// mustSequence extracts the sequence of an event ID generated by this broker
+func (b *Broker) mustSequence(eventID string) uint64 {
+	sequence, _ := b.sequence(eventID)
+	return sequence
+}
@@ -0,0 +1,168 @@
+package events
+
+import (
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// received drains the events already delivered to the subscription, and tells whether it is closed
+func received(s *Subscription) (events []Event, closed bool) {
+	for {
+		select {
+		case event, ok := <-s.Events():
+			if !ok {
+				return events, true
+			}
+			events = append(events, event)
+		default:
+			return events, false
+		}
+	}
+}
+
+// types returns the types of the events
+func types(events []Event) []string {
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestPublishReachesTheSubscribersOfTheFrame(t *testing.T) {
+	broker := NewBroker(DefaultHistory)
+	frameID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+	first, _, _ := broker.Subscribe(frameID, "")
+	second, _, _ := broker.Subscribe(frameID, "")
+	other, _, _ := broker.Subscribe(otherID, "")
+
+	if _, delivered := broker.Publish(frameID, TypeSettingsChanged, nil); delivered != 2 {
+		t.Errorf("delivered to %d subscribers, want 2", delivered)
+	}
+	for _, s := range []*Subscription{first, second} {
+		if events, closed := received(s); closed || !slices.Equal(types(events), []string{TypeSettingsChanged}) {
+			t.Errorf("received %v, closed %t, want the event", types(events), closed)
+		}
+	}
+	if events, _ := received(other); len(events) != 0 {
+		t.Errorf("other frame received %v", types(events))
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	broker := NewBroker(DefaultHistory)
+	frameID := primitive.NewObjectID()
+	subscription, _, _ := broker.Subscribe(frameID, "")
+	staying, _, _ := broker.Subscribe(frameID, "")
+
+	subscription.Close()
+	subscription.Close() // closing twice is harmless
+	if _, closed := received(subscription); !closed {
+		t.Error("events not closed with the subscription")
+	}
+	if connected := broker.Connected(frameID); connected != 1 {
+		t.Errorf("%d connections, want 1", connected)
+	}
+	if _, delivered := broker.Publish(frameID, TypeReboot, nil); delivered != 1 {
+		t.Errorf("delivered to %d subscribers, want 1", delivered)
+	}
+
+	broker.Close()
+	if _, closed := received(staying); !closed {
+		t.Error("events not closed with the broker")
+	}
+	select {
+	case <-broker.Done():
+	default:
+		t.Error("Done not closed with the broker")
+	}
+	late, missed, resync := broker.Subscribe(frameID, "")
+	if _, closed := received(late); !closed || missed != nil || resync {
+		t.Errorf("subscription after Close: closed %t, missed %v, resync %t, want it closed", closed, missed, resync)
+	}
+}
+
+func TestSlowSubscribersAreDisconnected(t *testing.T) {
+	broker := NewBroker(DefaultHistory)
+	frameID := primitive.NewObjectID()
+	slow, _, _ := broker.Subscribe(frameID, "")
+	fast, _, _ := broker.Subscribe(frameID, "")
+
+	var last Event
+	for i := range subscriptionBuffer + 1 {
+		var delivered int
+		last, delivered = broker.Publish(frameID, TypePictureAdded, i)
+		want := 2
+		if i == subscriptionBuffer {
+			// the buffer of the slow subscriber is full
+			want = 1
+		}
+		if delivered != want {
+			t.Fatalf("event %d delivered to %d subscribers, want %d", i, delivered, want)
+		}
+		// only the fast subscriber keeps up
+		if events, closed := received(fast); closed || len(events) != 1 {
+			t.Fatalf("fast subscriber received %d events, closed %t, want 1", len(events), closed)
+		}
+	}
+
+	events, closed := received(slow)
+	if !closed || len(events) != subscriptionBuffer {
+		t.Errorf("slow subscriber received %d events, closed %t, want the buffered ones then closed", len(events), closed)
+	}
+	if connected := broker.Connected(frameID); connected != 1 {
+		t.Errorf("%d connections, want the fast subscriber only", connected)
+	}
+
+	// the slow subscriber resumes from the last event it got
+	_, missed, resync := broker.Subscribe(frameID, events[len(events)-1].ID)
+	if resync || len(missed) != 1 || missed[0].ID != last.ID {
+		t.Errorf("missed %v, resync %t, want the last event", missed, resync)
+	}
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	broker := NewBroker(3)
+	frameID := primitive.NewObjectID()
+	var published []Event
+	for range 5 {
+		event, _ := broker.Publish(frameID, TypePictureAdded, nil)
+		published = append(published, event)
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		missed      []Event
+		resync      bool
+	}{
+		{name: "new connection"},
+		{name: "up to date", lastEventID: published[4].ID},
+		{name: "remembered", lastEventID: published[1].ID, missed: published[2:]},
+		{name: "forgotten", lastEventID: published[0].ID, resync: true},
+		{name: "other epoch", lastEventID: "old-3", resync: true},
+		{name: "future", lastEventID: broker.eventID(9), resync: true},
+		{name: "malformed", lastEventID: "nope", resync: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription, missed, resync := broker.Subscribe(frameID, tt.lastEventID)
+			defer subscription.Close()
+
+			if resync != tt.resync {
+				t.Errorf("resync %t, want %t", resync, tt.resync)
+			}
+			if tt.resync {
+				if len(missed) != 1 || missed[0].Type != TypeRefresh || missed[0].ID != published[4].ID {
+					t.Errorf("missed %v, want a refresh at %s", missed, published[4].ID)
+				}
+				return
+			}
+			if !slices.EqualFunc(missed, tt.missed, func(a, b Event) bool { return a.ID == b.ID }) {
+				t.Errorf("missed %v, want %v", missed, tt.missed)
+			}
+		})
+	}
+}
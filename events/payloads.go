@@ -0,0 +1,20 @@
+package events
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// PictureAdded is the data of a TypePictureAdded event
+type PictureAdded struct {
+	AlbumID   primitive.ObjectID
+	PictureID primitive.ObjectID
+}
+
+// AlbumRemoved is the data of a TypeAlbumRemoved event
+type AlbumRemoved struct {
+	AlbumID primitive.ObjectID
+	Version int64 // Version of the frame configuration without the album
+}
+
+// ConfigChanged is the data of TypeSettingsChanged and TypeRefresh events
+type ConfigChanged struct {
+	Version int64 // Version of the frame configuration to fetch
+}
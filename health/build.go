@@ -0,0 +1,43 @@
+package health
+
+import "runtime/debug"
+
+// Version and Commit identify the running build, they can be set at link time:
+//
+//	go build -ldflags "-X mirage-backend/health.Version=1.2.0 -X mirage-backend/health.Commit=$(git rev-parse HEAD)"
+//
+// When left empty they are read from the build information embedded by the Go toolchain.
+var (
+	Version string
+	Commit  string
+)
+
+// BuildInfo describes the running build
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+}
+
+// Build returns the version and commit of the running binary
+func Build() BuildInfo {
+	info := BuildInfo{Version: Version, Commit: Commit}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
@@ -0,0 +1,132 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Component statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Overall readiness statuses
+const (
+	StatusReady    = "ready"
+	StatusDegraded = "degraded"
+)
+
+// Check reports whether a dependency is usable, it must give up when ctx is done
+type Check func(ctx context.Context) error
+
+// ComponentStatus is the outcome of a single check
+type ComponentStatus struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every registered check
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Ready reports whether every component is up
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the checks deciding whether the application can serve traffic
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// NewRegistry returns an empty registry, each check is given at most timeout to complete
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a check reported under the given component name
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+// Run executes every check concurrently
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := append([]namedCheck(nil), r.checks...)
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusReady, Components: make(map[string]ComponentStatus, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			status := r.run(ctx, c.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[c.name] = status
+			if status.Status != StatusUp {
+				report.Status = StatusDegraded
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// run executes a check within the registry timeout, a check that doesn't honour its context is abandoned
+func (r *Registry) run(ctx context.Context, check Check) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	result := make(chan error, 1)
+	go func() { result <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", r.timeout)
+	}
+
+	status := ComponentStatus{
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// QueueDepth returns a check failing when a work queue holds more than max items
+func QueueDepth(depth func() int, max int) Check {
+	return func(ctx context.Context) error {
+		if current := depth(); current > max {
+			return fmt.Errorf("queue depth %d exceeds %d", current, max)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slow is a check waiting for its context, like a check of an unreachable database
+func slow(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// stuck is a check ignoring its context
+func stuck(release <-chan struct{}) Check {
+	return func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+}
+
+func TestRun(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	tests := []struct {
+		name   string
+		checks map[string]Check
+		status string
+		// down maps the components that are down to part of their error
+		down map[string]string
+	}{
+		{name: "no check", status: StatusReady},
+		{name: "up", checks: map[string]Check{"database": func(ctx context.Context) error { return nil }}, status: StatusReady},
+		{
+			name: "failing",
+			checks: map[string]Check{
+				"database":    func(ctx context.Context) error { return nil },
+				"recognition": func(ctx context.Context) error { return errors.New("connection refused") },
+			},
+			status: StatusDegraded,
+			down:   map[string]string{"recognition": "connection refused"},
+		},
+		{name: "slow", checks: map[string]Check{"database": slow}, status: StatusDegraded, down: map[string]string{"database": "timed out after 50ms"}},
+		{name: "stuck", checks: map[string]Check{"database": stuck(release)}, status: StatusDegraded, down: map[string]string{"database": "timed out after 50ms"}},
+		{name: "queue", checks: map[string]Check{"recognition_queue": QueueDepth(func() int { return 11 }, 10)}, status: StatusDegraded,
+			down: map[string]string{"recognition_queue": "queue depth 11 exceeds 10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(50 * time.Millisecond)
+			for name, check := range tt.checks {
+				registry.Register(name, check)
+			}
+
+			start := time.Now()
+			report := registry.Run(context.Background())
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Run() took %s, want the checks given up after the timeout", elapsed)
+			}
+			if report.Status != tt.status || report.Ready() != (tt.status == StatusReady) {
+				t.Errorf("status %q, want %q", report.Status, tt.status)
+			}
+			if len(report.Components) != len(tt.checks) {
+				t.Errorf("components %v, want one per check", report.Components)
+			}
+			for name, component := range report.Components {
+				want, down := tt.down[name]
+				if down && (component.Status != StatusDown || !strings.Contains(component.Error, want)) {
+					t.Errorf("%s = %+v, want down with %q", name, component, want)
+				}
+				if !down && (component.Status != StatusUp || component.Error != "") {
+					t.Errorf("%s = %+v, want up", name, component)
+				}
+			}
+		})
+	}
+}
+
+func TestRunChecksConcurrently(t *testing.T) {
+	registry := NewRegistry(time.Second)
+	var running atomic.Int32
+	all := make(chan struct{})
+	for _, name := range []string{"database", "blobs", "recognition"} {
+		registry.Register(name, func(ctx context.Context) error {
+			// every check waits for the others to have started
+			if running.Add(1) == 3 {
+				close(all)
+			}
+			select {
+			case <-all:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+
+	if report := registry.Run(context.Background()); !report.Ready() {
+		t.Errorf("report = %+v, want the checks run at the same time", report)
+	}
+}
+
+func TestRunHonoursTheCallerContext(t *testing.T) {
+	registry := NewRegistry(time.Minute)
+	registry.Register("database", slow)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if report := registry.Run(ctx); report.Ready() || report.Components["database"].Status != StatusDown {
+		t.Errorf("report = %+v, want the database down once the request is done", report)
+	}
+}
@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// records decodes the JSON records written to buf
+func records(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("cannot decode the record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// useLogger makes the logger writing JSON to the returned buffer the default one for the test
+func useLogger(t *testing.T, level string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger, err := New(&buf, level, FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestNew(t *testing.T) {
+	for _, tt := range []struct {
+		level, format string
+		valid         bool
+	}{
+		{"debug", FormatText, true},
+		{"WARN", "JSON", true},
+		{"loud", FormatJSON, false},
+		{"info", "xml", false},
+	} {
+		if _, err := New(&bytes.Buffer{}, tt.level, tt.format); (err == nil) != tt.valid {
+			t.Errorf("New(%q, %q) = %v, want valid %t", tt.level, tt.format, err, tt.valid)
+		}
+	}
+}
+
+func TestRecordsCarryTheContextFields(t *testing.T) {
+	buf := useLogger(t, "info")
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(WithRequestID(context.Background(), "req-1"),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	slog.InfoContext(ctx, "with context")
+	slog.With("picture_id", "p1").InfoContext(ctx, "derived")
+	slog.Info("without context")
+	slog.DebugContext(ctx, "below the level")
+
+	got := records(t, buf)
+	if len(got) != 3 {
+		t.Fatalf("%d records, want 3: %v", len(got), got)
+	}
+	for _, record := range got[:2] {
+		if record["request_id"] != "req-1" || record["trace_id"] != traceID.String() || record["span_id"] != spanID.String() {
+			t.Errorf("record %v, want the request and span IDs", record)
+		}
+	}
+	if got[1]["picture_id"] != "p1" {
+		t.Errorf("derived record %v lost its attributes", got[1])
+	}
+	if _, ok := got[2]["request_id"]; ok {
+		t.Errorf("record without context %v has a request ID", got[2])
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name, header string
+		kept         bool
+	}{
+		{name: "kept", header: "client-id-1", kept: true},
+		{name: "missing"},
+		{name: "spaces", header: "client id"},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := useLogger(t, "info")
+			router := gin.New()
+			router.Use(RequestID(), AccessLog())
+			var handled string
+			router.GET("/albums/:id", func(c *gin.Context) {
+				handled = RequestIDFromContext(c.Request.Context())
+				slog.InfoContext(c.Request.Context(), "handling")
+				c.Status(http.StatusNotFound)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/albums/1", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			if tt.kept && requestID != tt.header {
+				t.Errorf("request ID %q, want the client one", requestID)
+			}
+			if !tt.kept && (len(requestID) != 32 || requestID == tt.header) {
+				t.Errorf("request ID %q, want a generated one", requestID)
+			}
+			if handled != requestID {
+				t.Errorf("handler saw request ID %q, want %q", handled, requestID)
+			}
+
+			got := records(t, buf)
+			if len(got) != 2 {
+				t.Fatalf("%d records, want the handler and access logs: %v", len(got), got)
+			}
+			for _, record := range got {
+				if record["request_id"] != requestID {
+					t.Errorf("record %v, want request ID %q", record, requestID)
+				}
+			}
+			if access := got[1]; access["level"] != "WARN" || access["route"] != "/albums/:id" || access["status"] != float64(http.StatusNotFound) {
+				t.Errorf("access log %v, want a warning for the route", access)
+			}
+		})
+	}
+}
@@ -1,47 +1,187 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"log"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"log/slog"
+	"mirage-backend/app"
+	"mirage-backend/apperror"
 	"mirage-backend/config"
+	"mirage-backend/controllers"
 	"mirage-backend/database"
+	"mirage-backend/events"
+	"mirage-backend/health"
+	"mirage-backend/logging"
+	"mirage-backend/metrics"
+	"mirage-backend/recognition"
+	"mirage-backend/repository"
 	"mirage-backend/routes"
+	"mirage-backend/tracing"
+	"os"
 	"time"
+	_ "time/tzdata" // Time zones of the frames' quiet hours resolve even without a system zoneinfo database
 )
 
-func init() {
-	dbConnected, err := database.SetupDatabase()
+// connectDatabase connects to MongoDB
+func connectDatabase(cfg config.DatabaseConfig) {
+	monitor := database.ChainMonitors(metrics.CommandMonitor(), otelmongo.NewMonitor())
+	monitoring := options.Client().SetMonitor(monitor)
+	dbConnected, err := database.SetupDatabase(cfg, monitoring)
 	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+		fatal("Failed to connect to MongoDB", err)
 	} else if dbConnected {
-		log.Println("Connected to MongoDB!")
+		slog.Info("Connected to MongoDB")
 	}
 }
 
-func main() {
+// setupDatabase brings the collections and schema of MongoDB up to date
+func setupDatabase() {
+	if err := database.InitializeCollections(); err != nil {
+		fatal("Failed to initialize collections", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := database.ReconcileSchema(ctx, database.Db.Database)
+	database.LogSchemaReport(report)
+	if err != nil {
+		fatal("Failed to reconcile database schema", err)
+	}
+}
+
+// setupHealthChecks registers the dependencies checked by the readiness probe
+func setupHealthChecks(repos repository.Repositories, pipeline *recognition.Pipeline) *health.Registry {
+	checks := health.NewRegistry(2 * time.Second)
+	checks.Register("mongodb", func(ctx context.Context) error {
+		return database.Db.Client.Ping(ctx, readpref.Primary())
+	})
+	checks.Register("blob_storage", repos.Blobs.Ping)
+	if pipeline.Enabled() {
+		// an instance whose queue is nearly full stops receiving the uploads that would overflow it
+		checks.Register("face_detection_queue", health.QueueDepth(pipeline.Depth, pipeline.Capacity()*9/10))
+	}
+	return checks
+}
 
-	router := gin.Default()
+// setupRouter builds the gin engine serving the API, pushing the frame events through broker
+// and queueing the uploaded pictures on pipeline, which groups their faces through people
+func setupRouter(cfg config.Config, repos repository.Repositories, broker *events.Broker, pipeline *recognition.Pipeline, people *recognition.People) *gin.Engine {
+	router := gin.New()
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(apperror.NoRoute)
+	router.NoMethod(apperror.NoMethod)
+	router.Use(
+		otelgin.Middleware(tracing.ServiceName),
+		logging.RequestID(),
+		logging.AccessLog(),
+		metrics.Middleware(),
+		// errors are turned into responses inside the logging and metrics middlewares so that they see the status
+		apperror.Middleware(),
+		apperror.Recovery(),
+	)
 	//router.Use(cors.Default())
 
 	router.Use(cors.New(cors.Config{
 		//AllowOrigins: []string{"http://172.0.0.1:5500"},                            // Allow all origins
 		AllowMethods:    []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}, // Allow all methods
 		AllowAllOrigins: true,
-		AllowHeaders:    []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
-		ExposeHeaders:   []string{"Content-Length"}, AllowCredentials: true, MaxAge: 12 * time.Hour}))
+		AllowHeaders:    []string{"Origin", "Content-Length", "Content-Type", "Authorization", logging.RequestIDHeader, controllers.UserIDHeader, controllers.SharePasswordHeader},
+		ExposeHeaders:   []string{"Content-Length", logging.RequestIDHeader}, AllowCredentials: true, MaxAge: 12 * time.Hour}))
 
 	const ApiPath = "/api/v1"
-	routes.InitRoutes(router, ApiPath)
+	router.GET("/metrics", metrics.Handler())
+	routes.InitRoutes(router, ApiPath, routes.Dependencies{
+		Repositories:           repos,
+		Health:                 setupHealthChecks(repos, pipeline),
+		Events:                 broker,
+		Recognition:            pipeline,
+		People:                 people,
+		Environment:            cfg.Environment,
+		FirmwarePublisherToken: cfg.Firmware.PublisherToken,
+	})
+
+	return router
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
 
-	port := config.GetPort()
-	if port == "" {
-		port = "8080"
+	logger, err := logging.New(os.Stderr, cfg.Log.Level, cfg.Log.Format)
+	if err != nil {
+		fatal("Failed to set up logging", err)
+	}
+	slog.SetDefault(logger)
+
+	// gin prints its own debug output, keep it for debug logging unless GIN_MODE says otherwise
+	if os.Getenv(gin.EnvGinMode) == "" && cfg.Log.Level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
 	}
 
-	err := router.Run(":" + port)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Fatalln(err)
+		fatal("Failed to set up tracing", err)
+	}
+
+	connectDatabase(cfg.Database)
+
+	// migrations run on the data as it is, before the schema expected by the current code is enforced on it
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrateCommand(os.Args[2:])
+		_ = disconnectDatabase(context.Background())
+		_ = shutdownTracing(context.Background())
+		if err != nil {
+			fatal("Migration command failed", err)
+		}
+		return
+	}
+
+	setupDatabase()
+	warnAboutPendingMigrations()
+
+	repos := repository.NewMongoRepositories(database.Db.Database)
+	broker := events.NewBroker(events.DefaultHistory)
+	people := recognition.NewPeople(repos.People, repos.Faces, cfg.Recognition.Similarity)
+	pipeline := recognition.NewPipeline(recognition.New(cfg.Recognition), repos.Pictures, repos.Blobs, people,
+		cfg.Recognition.QueueSize, cfg.Recognition.MinConfidence)
+
+	application := app.New(cfg.Server, setupRouter(cfg, repos, broker, pipeline, people))
+	// event streams never end on their own, close them for the server to drain
+	application.OnShutdown(broker.Close)
+	if pipeline.Enabled() {
+		for range cfg.Recognition.Workers {
+			application.Go(pipeline.Run)
+		}
+	}
+	// stop hooks run in reverse order, spans of the last requests are flushed after the database is closed
+	application.OnStop(shutdownTracing)
+	application.OnStop(disconnectDatabase)
+
+	if err := application.Run(); err != nil {
+		fatal("Server stopped with errors", err)
 	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs the error and exits, it is only meant for startup and shutdown failures
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
+// disconnectDatabase closes the MongoDB client
+func disconnectDatabase(ctx context.Context) error {
+	if err := database.Disconnect(ctx); err != nil {
+		return err
+	}
+	slog.Info("Disconnected from MongoDB")
+	return nil
 }
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestMiddlewareLabelsRequestsWithTheRouteTemplate(t *testing.T) {
+	HTTPRequests.Reset()
+	HTTPRequestDuration.Reset()
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/albums/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	paths := []string{"/api/albums/1", "/api/albums/2", "/api/albums/3", "/nope/1", "/nope/2"}
+	for _, path := range paths {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// one series per route template and status, whatever the paths
+	if series := testutil.CollectAndCount(HTTPRequests); series != 2 {
+		t.Errorf("%d request series, want 2", series)
+	}
+	if series := testutil.CollectAndCount(HTTPRequestDuration); series != 2 {
+		t.Errorf("%d latency series, want 2", series)
+	}
+	if count := testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, "/api/albums/:id", "200")); count != 3 {
+		t.Errorf("%v requests of /api/albums/:id, want 3", count)
+	}
+	if count := testutil.ToFloat64(HTTPRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")); count != 2 {
+		t.Errorf("%v unmatched requests, want 2", count)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "mirage"
+
+var (
+	// HTTPRequests counts handled requests by route template and status
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration measures request latency by route template and status
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// MongoCommandDuration measures MongoDB command round trips
+	MongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command latency, by command and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"command", "outcome"})
+
+	// UploadSize measures the size of uploaded images before processing
+	UploadSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of uploaded images before compression.",
+		Buckets:   prometheus.ExponentialBuckets(64*1024, 2, 10), // 64KB to 32MB
+	})
+
+	// CompressionRatio measures compressed size over original size
+	CompressionRatio = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_compression_ratio",
+		Help:      "Compressed image size divided by the uploaded image size.",
+		Buckets:   prometheus.LinearBuckets(0.05, 0.1, 12),
+	})
+
+	// ImageProcessingDuration measures each stage of the image pipeline
+	ImageProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_processing_duration_seconds",
+		Help:      "Time spent in each image pipeline stage.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"stage"})
+
+	// WorkerQueueDepth reports how many jobs wait in each background queue
+	WorkerQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_queue_depth",
+		Help:      "Jobs waiting in background worker queues.",
+	}, []string{"queue"})
+
+	// FrameEventStreams reports how many smart frames are connected to their event stream
+	FrameEventStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "frame_event_streams",
+		Help:      "Open smart frame event streams.",
+	})
+)
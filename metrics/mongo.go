@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// CommandMonitor returns a MongoDB command monitor recording the duration of every command
+func CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			observeCommand(e.CommandName, "success", e.Duration)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			observeCommand(e.CommandName, "failure", e.Duration)
+		},
+	}
+}
+
+func observeCommand(command, outcome string, duration time.Duration) {
+	MongoCommandDuration.WithLabelValues(command, outcome).Observe(duration.Seconds())
+}
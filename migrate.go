@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"mirage-backend/database"
+	"mirage-backend/migrations"
+)
+
+const migrateUsage = "usage: mirage-backend migrate up [version] | down [steps] | status"
+
+// runMigrateCommand handles the `migrate` subcommand
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := migrations.NewMigrator(database.Db.Database, migrations.All)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		var target int64
+		if len(args) > 1 {
+			if target, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return fmt.Errorf("invalid target version %q", args[1])
+			}
+		}
+		if err := migrator.Up(ctx, target); err != nil {
+			return err
+		}
+		slog.Info("Migrations applied")
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		if err := migrator.Down(ctx, steps); err != nil {
+			return err
+		}
+		slog.Info("Migrations rolled back")
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-40s %s\n", status.Version, status.Name, state)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
+
+// warnAboutPendingMigrations logs a reminder when the database is behind the code
+func warnAboutPendingMigrations() {
+	migrator, err := migrations.NewMigrator(database.Db.Database, migrations.All)
+	if err != nil {
+		fatal("Invalid migrations", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		slog.Warn("Failed to check pending migrations", "error", err)
+	} else if pending > 0 {
+		slog.Warn("Database migrations are pending, run `mirage-backend migrate up`", "pending", pending)
+	}
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mirage-backend/database"
+)
+
+// hashBackfilledField marks the picture data whose hash was set by backfillPictureDataHash
+const hashBackfilledField = "hash_backfilled"
+
+// backfillPictureDataHash computes the SHA-256 hash of picture data stored before it was recorded on upload.
+// Hashes are written on upload as well, so the backfilled picture data are marked for Down to only undo those.
+var backfillPictureDataHash = Migration{
+	Version: 1,
+	Name:    "backfill_picture_data_hash",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		collection := db.Collection(database.PictureDataCollectionName)
+
+		cursor, err := collection.Find(ctx, bson.M{"hash": bson.M{"$exists": false}})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+
+		for cursor.Next(ctx) {
+			var pictureData struct {
+				ID   primitive.ObjectID `bson:"_id"`
+				Data []byte             `bson:"data"`
+			}
+			if err := cursor.Decode(&pictureData); err != nil {
+				return err
+			}
+
+			hash := sha256.Sum256(pictureData.Data)
+			update := bson.M{"$set": bson.M{"hash": hex.EncodeToString(hash[:]), hashBackfilledField: true}}
+			if _, err := collection.UpdateByID(ctx, pictureData.ID, update); err != nil {
+				return err
+			}
+		}
+
+		return cursor.Err()
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		filter := bson.M{hashBackfilledField: bson.M{"$exists": true}}
+		_, err := db.Collection(database.PictureDataCollectionName).
+			UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"hash": "", hashBackfilledField: ""}})
+		return err
+	},
+}
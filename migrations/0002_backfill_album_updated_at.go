@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mirage-backend/database"
+)
+
+// updatedAtBackfilledField marks the albums whose updated_at was set by backfillAlbumUpdatedAt
+const updatedAtBackfilledField = "updated_at_backfilled"
+
+// backfillAlbumUpdatedAt gives albums that were never updated an updated_at equal to their creation time,
+// so that sorting by updated_at doesn't put them before every other album.
+// CreateAlbum sets updated_at to the creation time as well, so the backfilled albums are marked for Down to only
+// undo those, and only while they were not updated since. Albums backfilled before the mark existed are left as is.
+var backfillAlbumUpdatedAt = Migration{
+	Version: 2,
+	Name:    "backfill_album_updated_at",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		filter := bson.M{"$or": bson.A{
+			bson.M{"updated_at": bson.M{"$exists": false}},
+			bson.M{"updated_at": time.Time{}},
+		}}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": "$created_at", updatedAtBackfilledField: true}}}}
+
+		_, err := db.Collection(database.AlbumCollectionName).UpdateMany(ctx, filter, update)
+		return err
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		albums := db.Collection(database.AlbumCollectionName)
+
+		filter := bson.M{
+			updatedAtBackfilledField: true,
+			"$expr":                  bson.M{"$eq": bson.A{"$updated_at", "$created_at"}},
+		}
+		if _, err := albums.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"updated_at": time.Time{}}}); err != nil {
+			return err
+		}
+
+		filter = bson.M{updatedAtBackfilledField: bson.M{"$exists": true}}
+		_, err := albums.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{updatedAtBackfilledField: ""}})
+		return err
+	},
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"mirage-backend/database"
+)
+
+// takenAtBackfilledField marks the pictures whose taken_at was set by backfillPictureTakenAt
+const takenAtBackfilledField = "taken_at_backfilled"
+
+// backfillPictureTakenAt gives pictures uploaded before their capture time was recorded a taken_at equal to their
+// upload time, which is what UploadPicture defaults to, so that smart albums selecting a date range can match them.
+// Pictures uploaded since get the same taken_at, so the backfilled ones are marked for Down to only undo those.
+var backfillPictureTakenAt = Migration{
+	Version: 3,
+	Name:    "backfill_picture_taken_at",
+	Up: func(ctx context.Context, db *mongo.Database) error {
+		filter := bson.M{"$or": bson.A{
+			bson.M{"taken_at": bson.M{"$exists": false}},
+			bson.M{"taken_at": time.Time{}},
+		}}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"taken_at": "$uploaded_at", takenAtBackfilledField: true}}}}
+
+		_, err := db.Collection(database.PictureCollectionName).UpdateMany(ctx, filter, update)
+		return err
+	},
+	Down: func(ctx context.Context, db *mongo.Database) error {
+		pictures := db.Collection(database.PictureCollectionName)
+
+		filter := bson.M{
+			takenAtBackfilledField: true,
+			"$expr":                bson.M{"$eq": bson.A{"$taken_at", "$uploaded_at"}},
+		}
+		if _, err := pictures.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{"taken_at": ""}}); err != nil {
+			return err
+		}
+
+		filter = bson.M{takenAtBackfilledField: bson.M{"$exists": true}}
+		_, err := pictures.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{takenAtBackfilledField: ""}})
+		return err
+	},
+}
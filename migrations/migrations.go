@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration is a single, ordered change to the stored documents.
+//
+// Up and Down must be idempotent: a migration interrupted halfway (e.g. by a crash) is run again
+// from the start, so it must cope with documents that were already migrated.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// All lists every migration of the application, in order of version.
+// New migrations are appended here with the next version number; versions are never reused.
+var All = []Migration{
+	backfillPictureDataHash,
+	backfillAlbumUpdatedAt,
+	backfillPictureTakenAt,
+}
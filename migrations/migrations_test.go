@@ -0,0 +1,293 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mirage-backend/database"
+)
+
+// testDatabase returns an empty database on the MongoDB server of TEST_DB_URI, dropped at the end of the test.
+// The test is skipped when TEST_DB_URI is not set.
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+
+	uri := os.Getenv("TEST_DB_URI")
+	if uri == "" {
+		t.Skip("TEST_DB_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db := client.Database("mirage_migrations_test_" + primitive.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Drop(ctx); err != nil {
+			t.Error(err)
+		}
+		_ = client.Disconnect(ctx)
+	})
+	return db
+}
+
+func noop(context.Context, *mongo.Database) error { return nil }
+
+func TestNewMigratorRejectsInvalidMigrations(t *testing.T) {
+	tests := map[string][]Migration{
+		"zero version":      {{Version: 0, Name: "zero", Up: noop, Down: noop}},
+		"missing down":      {{Version: 1, Name: "up only", Up: noop}},
+		"duplicate version": {{Version: 1, Name: "a", Up: noop, Down: noop}, {Version: 1, Name: "b", Up: noop, Down: noop}},
+	}
+	for name, migrations := range tests {
+		if _, err := NewMigrator(nil, migrations); err == nil {
+			t.Errorf("%s: NewMigrator accepted invalid migrations", name)
+		}
+	}
+}
+
+func TestAllMigrationsAreValid(t *testing.T) {
+	migrator, err := NewMigrator(nil, All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrator.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+	}
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	legacyAlbumID, currentAlbumID := primitive.NewObjectID(), primitive.NewObjectID()
+	pictureDataID, currentPictureDataID := primitive.NewObjectID(), primitive.NewObjectID()
+	pictureID, currentPictureID := primitive.NewObjectID(), primitive.NewObjectID()
+	insert(t, db, database.AlbumCollectionName,
+		bson.M{"_id": legacyAlbumID, "title": "legacy", "created_at": created},
+		// created since CreateAlbum sets updated_at, it must survive a rollback
+		bson.M{"_id": currentAlbumID, "title": "current", "created_at": created, "updated_at": created},
+	)
+	insert(t, db, database.PictureDataCollectionName,
+		bson.M{"_id": pictureDataID, "data": []byte("image")},
+		// uploaded since UploadPicture records the hash, it must survive a rollback
+		bson.M{"_id": currentPictureDataID, "data": []byte("image"), "hash": "recorded"},
+	)
+	insert(t, db, database.PictureCollectionName,
+		bson.M{"_id": pictureID, "picture_data_id": pictureDataID, "uploaded_at": created},
+		// uploaded since UploadPicture defaults taken_at to the upload time, it must survive a rollback
+		bson.M{"_id": currentPictureID, "picture_data_id": pictureDataID, "uploaded_at": created, "taken_at": created},
+	)
+
+	migrator, err := NewMigrator(db, All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != 0 {
+		t.Fatalf("Pending() = %d, %v after Up, want 0", pending, err)
+	}
+
+	if album := find(t, db, database.AlbumCollectionName, legacyAlbumID); !album["updated_at"].(primitive.DateTime).Time().Equal(created) {
+		t.Errorf("legacy album updated_at = %v, want %v", album["updated_at"], created)
+	}
+	if data := find(t, db, database.PictureDataCollectionName, pictureDataID); data["hash"] == nil {
+		t.Error("picture data hash not backfilled")
+	}
+	if picture := find(t, db, database.PictureCollectionName, pictureID); !picture["taken_at"].(primitive.DateTime).Time().Equal(created) {
+		t.Errorf("picture taken_at = %v, want %v", picture["taken_at"], created)
+	}
+
+	// applying again finds nothing to do
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrator.Down(ctx, len(All)); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != len(All) {
+		t.Fatalf("Pending() = %d, %v after Down, want %d", pending, err, len(All))
+	}
+
+	legacy := find(t, db, database.AlbumCollectionName, legacyAlbumID)
+	if !legacy["updated_at"].(primitive.DateTime).Time().Equal(time.Time{}) {
+		t.Errorf("legacy album updated_at = %v after rollback, want the zero time", legacy["updated_at"])
+	}
+	if _, ok := legacy[updatedAtBackfilledField]; ok {
+		t.Errorf("legacy album still has %s after rollback", updatedAtBackfilledField)
+	}
+	if current := find(t, db, database.AlbumCollectionName, currentAlbumID); !current["updated_at"].(primitive.DateTime).Time().Equal(created) {
+		t.Errorf("current album updated_at = %v after rollback, want %v", current["updated_at"], created)
+	}
+	data := find(t, db, database.PictureDataCollectionName, pictureDataID)
+	if data["hash"] != nil {
+		t.Error("picture data hash kept after rollback")
+	}
+	if _, ok := data[hashBackfilledField]; ok {
+		t.Errorf("picture data still has %s after rollback", hashBackfilledField)
+	}
+	if current := find(t, db, database.PictureDataCollectionName, currentPictureDataID); current["hash"] != "recorded" {
+		t.Errorf("current picture data hash = %v after rollback, want the recorded one", current["hash"])
+	}
+	picture := find(t, db, database.PictureCollectionName, pictureID)
+	if picture["taken_at"] != nil {
+		t.Error("picture taken_at kept after rollback")
+	}
+	if _, ok := picture[takenAtBackfilledField]; ok {
+		t.Errorf("picture still has %s after rollback", takenAtBackfilledField)
+	}
+	if current := find(t, db, database.PictureCollectionName, currentPictureID); !current["taken_at"].(primitive.DateTime).Time().Equal(created) {
+		t.Errorf("current picture taken_at = %v after rollback, want %v", current["taken_at"], created)
+	}
+}
+
+func TestUpStopsAtTarget(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	migrator, err := NewMigrator(db, All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if status.Applied != (status.Version <= 1) {
+			t.Errorf("migration %d applied = %v", status.Version, status.Applied)
+		}
+	}
+}
+
+func TestLockHeldByAnotherInstance(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	insert(t, db, LockCollectionName, bson.M{"_id": lockID, "owner": "other", "expires_at": time.Now().Add(time.Minute)})
+	migrator, err := NewMigrator(db, All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx, 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Up() = %v while locked, want ErrLocked", err)
+	}
+
+	// a crashed instance keeps the lock until its lease expires
+	if _, err := db.Collection(LockCollectionName).UpdateByID(ctx, lockID, bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up() = %v once the lease expired", err)
+	}
+}
+
+func TestLockIsRenewedWhileMigrating(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	slow := Migration{Version: 1, Name: "slow", Down: noop, Up: func(ctx context.Context, db *mongo.Database) error {
+		close(started)
+		select {
+		case <-time.After(time.Second):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+
+	first, err := NewMigrator(db, []Migration{slow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.lockTTL = 300 * time.Millisecond
+	done := make(chan error, 1)
+	go func() { done <- first.Up(ctx, 0) }()
+
+	<-started
+	// the migration outlives the TTL, the lease must still be held
+	time.Sleep(600 * time.Millisecond)
+	second, err := NewMigrator(db, []Migration{slow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Up(ctx, 0); !errors.Is(err, ErrLocked) {
+		t.Errorf("concurrent Up() = %v, want ErrLocked", err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Up() = %v", err)
+	}
+}
+
+func TestLostLockCancelsMigrations(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	stolen := Migration{Version: 1, Name: "stolen", Down: noop, Up: func(ctx context.Context, db *mongo.Database) error {
+		// another instance takes over the lock
+		if _, err := db.Collection(LockCollectionName).UpdateByID(ctx, lockID, bson.M{"$set": bson.M{"owner": "other"}}); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(5 * time.Second):
+			return errors.New("migration not cancelled")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+
+	migrator, err := NewMigrator(db, []Migration{stolen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrator.lockTTL = 300 * time.Millisecond
+	if err := migrator.Up(ctx, 0); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("Up() = %v, want ErrLockLost", err)
+	}
+	if pending, err := migrator.Pending(ctx); err != nil || pending != 1 {
+		t.Errorf("Pending() = %d, %v, want the cancelled migration left pending", pending, err)
+	}
+}
+
+func insert(t *testing.T, db *mongo.Database, collection string, documents ...interface{}) {
+	t.Helper()
+	if _, err := db.Collection(collection).InsertMany(context.Background(), documents); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func find(t *testing.T, db *mongo.Database, collection string, id primitive.ObjectID) bson.M {
+	t.Helper()
+	var document bson.M
+	if err := db.Collection(collection).FindOne(context.Background(), bson.M{"_id": id}).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
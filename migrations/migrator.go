@@ -0,0 +1,283 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection names
+const (
+	MigrationsCollectionName = "schema_migrations"
+	LockCollectionName       = "schema_migrations_lock"
+)
+
+// lockTTL bounds how long a crashed instance can keep other instances from migrating,
+// the instance running migrations renews its lease every third of it
+const lockTTL = 10 * time.Minute
+
+const lockID = "migrations"
+
+var (
+	// ErrLocked is returned when another instance is already running migrations
+	ErrLocked = errors.New("migrations are locked by another instance")
+	// ErrLockLost is returned when the lease on the lock could not be renewed in time and another instance may be migrating
+	ErrLockLost = errors.New("migrations lock lost")
+)
+
+// Record is a migration applied to the database, stored in the schema_migrations collection
+type Record struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// Status describes a known migration and whether it is applied
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator runs migrations against a database
+type Migrator struct {
+	db         *mongo.Database
+	migrations []Migration
+	owner      string
+	lockTTL    time.Duration
+}
+
+// NewMigrator returns a migrator for the given migrations, sorted by version
+func NewMigrator(db *mongo.Database, migrations []Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, migration := range sorted {
+		if migration.Version <= 0 || migration.Up == nil || migration.Down == nil {
+			return nil, fmt.Errorf("migration %d (%s) must have a positive version and both directions", migration.Version, migration.Name)
+		}
+		if i > 0 && sorted[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migration.Version)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex())
+
+	return &Migrator{db: db, migrations: sorted, owner: owner, lockTTL: lockTTL}, nil
+}
+
+// Up applies every pending migration up to and including target; a target of 0 applies all of them
+func (m *Migrator) Up(ctx context.Context, target int64) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if target > 0 && migration.Version > target {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			slog.InfoContext(ctx, "Applying migration", "version", migration.Version, "name", migration.Name)
+			if err := migration.Up(ctx, m.db); err != nil {
+				return fmt.Errorf("migration %d %s failed: %v", migration.Version, migration.Name, err)
+			}
+
+			record := Record{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if _, err := m.db.Collection(MigrationsCollectionName).InsertOne(ctx, record); err != nil {
+				return fmt.Errorf("failed to record migration %d: %v", migration.Version, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			slog.InfoContext(ctx, "Rolling back migration", "version", migration.Version, "name", migration.Name)
+			if err := migration.Down(ctx, m.db); err != nil {
+				return fmt.Errorf("rollback of migration %d %s failed: %v", migration.Version, migration.Name, err)
+			}
+
+			if _, err := m.db.Collection(MigrationsCollectionName).DeleteOne(ctx, bson.M{"_id": migration.Version}); err != nil {
+				return fmt.Errorf("failed to remove record of migration %d: %v", migration.Version, err)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Status lists every known migration along with whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		statuses = append(statuses, Status{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+
+	return statuses, nil
+}
+
+// Pending returns how many known migrations are not applied yet
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// applied returns the recorded migrations keyed by version
+func (m *Migrator) applied(ctx context.Context) (map[int64]Record, error) {
+	cursor, err := m.db.Collection(MigrationsCollectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// withLock runs fn while holding the migrations lock.
+//
+// The lock is a single document acquired with an upsert: when another owner holds an unexpired lease
+// the upsert collides with the existing _id and fails with a duplicate key error. The lease is renewed while fn runs,
+// should it expire anyway the context of fn is cancelled and ErrLockLost returned.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) error {
+	locks := m.db.Collection(LockCollectionName)
+	now := time.Now()
+
+	filter := bson.M{
+		"_id": lockID,
+		"$or": bson.A{
+			bson.M{"owner": m.owner},
+			bson.M{"expires_at": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": m.owner, "locked_at": now, "expires_at": now.Add(m.lockTTL)}}
+
+	_, err := locks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	} else if err != nil {
+		return fmt.Errorf("failed to acquire migrations lock: %v", err)
+	}
+
+	defer func() {
+		// release with a fresh context so that a cancelled run still frees the lock
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := locks.DeleteOne(releaseCtx, bson.M{"_id": lockID, "owner": m.owner}); err != nil {
+			slog.Error("Failed to release migrations lock", "error", err)
+		}
+	}()
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	var renewing sync.WaitGroup
+	renewing.Add(1)
+	go func() {
+		defer renewing.Done()
+		m.renewLock(lockCtx, locks, cancel)
+	}()
+
+	err = fn(lockCtx)
+	lost := context.Cause(lockCtx)
+	cancel(nil)
+	renewing.Wait()
+
+	if errors.Is(lost, ErrLockLost) {
+		return lost
+	}
+	return err
+}
+
+// renewLock extends the lease on the lock every third of its TTL until ctx is done,
+// cancelling ctx with ErrLockLost when the lease expires before it could be renewed
+func (m *Migrator) renewLock(ctx context.Context, locks *mongo.Collection, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(m.lockTTL / 3)
+	defer ticker.Stop()
+
+	expiresAt := time.Now().Add(m.lockTTL)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			filter := bson.M{"_id": lockID, "owner": m.owner, "expires_at": bson.M{"$gte": now}}
+			update := bson.M{"$set": bson.M{"expires_at": now.Add(m.lockTTL)}}
+
+			result, err := locks.UpdateOne(ctx, filter, update)
+			switch {
+			case err == nil && result.MatchedCount == 0:
+				cancel(ErrLockLost)
+				return
+			case err == nil:
+				expiresAt = now.Add(m.lockTTL)
+			case ctx.Err() != nil:
+				return
+			case !now.Before(expiresAt):
+				cancel(ErrLockLost)
+				return
+			default:
+				// the next tick retries, the lease is still valid
+				slog.WarnContext(ctx, "Failed to renew migrations lock", "error", err)
+			}
+		}
+	}
+}
@@ -18,21 +18,32 @@ type User struct {
 	UpdatedAt        time.Time            `bson:"updated_at"`                     // Last profile update timestamp
 }
 
+// Values accepted for UserProfile.Sex
+const (
+	SexFemale = "female"
+	SexMale   = "male"
+	SexOther  = "other"
+)
+
 // UserProfile Represents a user's detailed profile
 type UserProfile struct {
-	ID      primitive.ObjectID `bson:"_id,omitempty"`
-	Name    string             `bson:"name" binding:"required"`    // First name
-	Surname string             `bson:"surname" binding:"required"` // Last name
-	Sex     string             `bson:"sex"`                        // Gender
-	DOB     time.Time          `bson:"dob"`                        // Date of birth
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`                                                   // Owner of the profile, one profile per user
+	Name      string             `bson:"name" binding:"required"`                                   // First name
+	Surname   string             `bson:"surname" binding:"required"`                                // Last name
+	Sex       string             `bson:"sex,omitempty" binding:"omitempty,oneof=female male other"` // Gender
+	DOB       time.Time          `bson:"dob,omitempty"`                                             // Date of birth, stored at midnight UTC
+	CreatedAt time.Time          `bson:"created_at"`                                                // Profile creation timestamp
+	UpdatedAt time.Time          `bson:"updated_at"`                                                // Last profile update timestamp
 }
 
-// ProfilePicture Represents a profile picture
+// ProfilePicture Represents a profile picture, the user's previous ones are kept as history
 type ProfilePicture struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	PictureID primitive.ObjectID `bson:"picture_id"`                 // Associated picture
-	UserID    primitive.ObjectID `bson:"user_id" binding:"required"` // User associated with this picture
-	CreatedAt time.Time          `bson:"created_at"`                 // When the profile picture was uploaded
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	PictureID    primitive.ObjectID `bson:"picture_id"`                 // Associated picture
+	AvatarDataID primitive.ObjectID `bson:"avatar_data_id,omitempty"`   // Small square rendition for list views
+	UserID       primitive.ObjectID `bson:"user_id" binding:"required"` // User associated with this picture
+	CreatedAt    time.Time          `bson:"created_at"`                 // When the profile picture was uploaded
 }
 
 // Album Represents an album owned by a user
@@ -41,11 +52,81 @@ type Album struct {
 	Title         string               `bson:"title" binding:"required"`  // Required album title
 	Description   string               `bson:"description,omitempty"`     // Optional description
 	OwnerID       primitive.ObjectID   `bson:"user_id"`                   // Album owner
-	TargetUserIDs []primitive.ObjectID `bson:"target_user_ids,omitempty"` // List of users it is shared with
+	TargetUserIDs []primitive.ObjectID `bson:"target_user_ids,omitempty"` // Members who accepted an invitation, kept in sync with the invitations
 	Tags          []string             `bson:"tags,omitempty"`            // Tags for categorization
 	IsPrivate     bool                 `bson:"is_private"`                // Privacy setting
 	CreatedAt     time.Time            `bson:"created_at"`                // Creation timestamp
 	UpdatedAt     time.Time            `bson:"updated_at"`                // Last updated timestamp
+	// Criteria makes a smart album, whose pictures are the ones matching it instead of the ones uploaded to it
+	Criteria *SmartCriteria `bson:"criteria,omitempty"`
+}
+
+// SmartCriteria Represents the query selecting the pictures of a smart album among the pictures its owner uploaded
+// or that are in the albums the owner owns or is a member of. A picture must match every criterion set.
+type SmartCriteria struct {
+	TakenAfter  time.Time            `bson:"taken_after,omitempty"`                             // Taken at or after
+	TakenBefore time.Time            `bson:"taken_before,omitempty"`                            // Taken before
+	Tags        []string             `bson:"tags,omitempty" binding:"max=20,dive,min=1,max=50"` // Tagged with each of them
+	PersonIDs   []primitive.ObjectID `bson:"person_ids,omitempty" binding:"max=20"`             // Showing each of these people of the owner
+	UploaderIDs []primitive.ObjectID `bson:"uploader_ids,omitempty" binding:"max=50"`           // Uploaded by one of them
+	Near        *GeoCircle           `bson:"near,omitempty"`                                    // Taken in the area
+}
+
+// GeoCircle Represents the area within a distance of a point
+type GeoCircle struct {
+	Latitude  float64 `bson:"latitude" binding:"min=-90,max=90"`
+	Longitude float64 `bson:"longitude" binding:"min=-180,max=180"`
+	RadiusKm  float64 `bson:"radius_km" binding:"gt=0,max=20000"`
+}
+
+// GeoPoint Represents where a picture was taken, stored as a legacy coordinate pair, longitude first, for MongoDB
+type GeoPoint struct {
+	Longitude float64 `bson:"lng"`
+	Latitude  float64 `bson:"lat"`
+}
+
+// Roles of the members of an album, from the least to the most privileged
+const (
+	RoleViewer      = "viewer"      // Can see the album and its pictures
+	RoleContributor = "contributor" // Can also upload pictures and remove the ones they uploaded
+	RoleCoOwner     = "co_owner"    // Can also edit the album, remove any picture and manage members
+)
+
+// States of an album invitation
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+// AlbumInvitation Represents the invitation of a user to an album; once accepted it is the user's membership
+type AlbumInvitation struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	AlbumID     primitive.ObjectID `bson:"album_id"`               // Album the user is invited to
+	UserID      primitive.ObjectID `bson:"user_id"`                // Invited user
+	InvitedByID primitive.ObjectID `bson:"invited_by_id"`          // User who sent the invitation
+	Role        string             `bson:"role"`                   // One of the Role* values
+	Status      string             `bson:"status"`                 // One of the Invitation* values
+	CreatedAt   time.Time          `bson:"created_at"`             // When the invitation was (last) sent
+	RespondedAt time.Time          `bson:"responded_at,omitempty"` // When the invitation was accepted or declined
+	UpdatedAt   time.Time          `bson:"updated_at"`             // Last change of role or status
+}
+
+// ShareLink Represents a public link giving read-only access to an album or a single picture without an account
+type ShareLink struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Token          string             `bson:"token"`                            // Secret identifying the link in its URL
+	AlbumID        primitive.ObjectID `bson:"album_id,omitempty"`               // Shared album, unless PictureID is set
+	PictureID      primitive.ObjectID `bson:"picture_id,omitempty"`             // Shared picture, unless AlbumID is set
+	CreatedByID    primitive.ObjectID `bson:"created_by_id,omitempty"`          // User who created the link
+	PasswordHash   []byte             `bson:"password_hash,omitempty" json:"-"` // bcrypt hash of the optional password, never sent
+	HasPassword    bool               `bson:"has_password"`                     // Whether visitors must give the password
+	AllowDownload  bool               `bson:"allow_download"`                   // Whether visitors may download the pictures
+	ExpiresAt      time.Time          `bson:"expires_at,omitempty"`             // Optional expiry
+	AccessCount    int64              `bson:"access_count"`                     // Number of times the link was opened
+	LastAccessedAt time.Time          `bson:"last_accessed_at,omitempty"`       // Last time the link was opened
+	CreatedAt      time.Time          `bson:"created_at"`                       // Creation timestamp
 }
 
 // RecognizedFace Represents face recognition metadata
@@ -57,8 +138,37 @@ type RecognizedFace struct {
 	Confidence   float64            `bson:"confidence"`     // Recognition confidence level
 	RecognizedAt time.Time          `bson:"recognized_at"`  // Time of recognition
 	Age          int                `bson:"age,omitempty"`  // Estimated age
+	Box          BoundingBox        `bson:"box"`            // Where the face is in the picture
+	// Person the face was grouped into, unset when the detector gave no embedding or the picture has no uploader
+	PersonID  primitive.ObjectID `bson:"person_id,omitempty"`
+	Embedding []float64          `bson:"embedding,omitempty" json:"-"` // Vector describing the face, compared to group faces
+}
+
+// Person Represents someone whose face appears in the pictures a user uploaded, grouping the similar faces
+type Person struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	OwnerID   primitive.ObjectID `bson:"owner_id"`                         // User whose pictures show the person
+	Name      string             `bson:"name,omitempty" binding:"max=100"` // Name given by the owner, copied onto the faces
+	FaceCount int                `bson:"face_count"`                       // Number of faces grouped into the person
+	Centroid  []float64          `bson:"centroid" json:"-"`                // Mean embedding of the faces
+	CreatedAt time.Time          `bson:"created_at"`                       // Creation timestamp
+	UpdatedAt time.Time          `bson:"updated_at"`                       // Last change of the person
 }
 
+// BoundingBox Represents a rectangle of a picture, in fractions of its width and height from its top left corner
+type BoundingBox struct {
+	X      float64 `bson:"x"`
+	Y      float64 `bson:"y"`
+	Width  float64 `bson:"width"`
+	Height float64 `bson:"height"`
+}
+
+// Outcomes of the face detection of a picture
+const (
+	RecognitionDone   = "done"
+	RecognitionFailed = "failed"
+)
+
 // Picture Represents a picture in an album
 type Picture struct {
 	ID            primitive.ObjectID   `bson:"_id,omitempty"`
@@ -71,21 +181,168 @@ type Picture struct {
 	FacesID       []primitive.ObjectID `bson:"faces_id,omitempty"`    // List of recognized face IDs
 	Width         int                  `bson:"width,omitempty"`       // Image width in pixels
 	Height        int                  `bson:"height,omitempty"`      // Image height in pixels
+	// Outcome of the face detection, one of the Recognition* values, empty until the picture was processed
+	RecognitionStatus string    `bson:"recognition_status,omitempty"`
+	RecognizedAt      time.Time `bson:"recognized_at,omitempty"` // When the faces were last detected
+	TakenAt           time.Time `bson:"taken_at"`                // When the picture was taken, the upload time unless given
+	Tags              []string  `bson:"tags,omitempty"`          // Lower case tags given by the uploader
+	Location          *GeoPoint `bson:"location,omitempty"`      // Where the picture was taken, if given
 	//FileSize    int64                `bson:"file_size,omitempty"`   // File size in bytes
 }
 
 // SmartFrame Represents a smart frame device
 type SmartFrame struct {
-	ID           primitive.ObjectID   `bson:"_id,omitempty"`
-	OwnerID      primitive.ObjectID   `bson:"owner_id" binding:"required"` // Owner's user ID
-	GiftedByID   primitive.ObjectID   `bson:"gifted_by_id,omitempty"`      // Gifter's user ID
-	CreatedAt    time.Time            `bson:"created_at"`                  // Device creation timestamp
-	FirstBoot    time.Time            `bson:"first_boot"`                  // Timestamp of first boot
-	LoadedAlbums []primitive.ObjectID `bson:"loaded_albums_id,omitempty"`  // Preloaded albums
+	ID              primitive.ObjectID   `bson:"_id,omitempty"`
+	Name            string               `bson:"name,omitempty"`                       // Name given by the owner
+	OwnerID         primitive.ObjectID   `bson:"owner_id" binding:"required"`          // Owner's user ID
+	GiftedByID      primitive.ObjectID   `bson:"gifted_by_id,omitempty"`               // Gifter's user ID
+	ClaimTokenHash  string               `bson:"claim_token_hash,omitempty" json:"-"`  // SHA-256 of the pending gift's claim token, never sent
+	ClaimExpiresAt  time.Time            `bson:"claim_expires_at,omitempty"`           // Expiry of the pending gift, zero when not gifted
+	ClaimedAt       time.Time            `bson:"claimed_at,omitempty"`                 // When the recipient claimed the gift
+	DeviceTokenHash string               `bson:"device_token_hash,omitempty" json:"-"` // SHA-256 of the token the device authenticates with, never sent
+	CreatedAt       time.Time            `bson:"created_at"`                           // Device creation timestamp
+	FirstBoot       time.Time            `bson:"first_boot"`                           // Timestamp of first boot
+	LoadedAlbums    []primitive.ObjectID `bson:"loaded_albums_id,omitempty"`           // Preloaded albums
+	Settings        DisplaySettings      `bson:"settings"`                             // How the frame displays its albums
+	ConfigVersion   int64                `bson:"config_version"`                       // Incremented whenever the settings or loaded albums change
+	Status          FrameStatus          `bson:"status"`                               // What the frame reported in its last heartbeat
+	FirmwareChannel string               `bson:"firmware_channel,omitempty"`           // Firmware releases the frame receives, stable when empty
+	UpdatedAt       time.Time            `bson:"updated_at"`                           // Last change of the frame
+}
+
+// FrameStatus Represents what a smart frame reported in its last heartbeat
+type FrameStatus struct {
+	LastSeenAt       time.Time          `bson:"last_seen_at,omitempty"`       // When the last heartbeat was received, zero if never
+	FirmwareVersion  string             `bson:"firmware_version,omitempty"`   // Version of the software running on the frame
+	FreeStorage      int64              `bson:"free_storage"`                 // Free storage left on the frame, in bytes
+	IPAddress        string             `bson:"ip_address,omitempty"`         // Address the heartbeat came from
+	CurrentPictureID primitive.ObjectID `bson:"current_picture_id,omitempty"` // Picture on screen
+}
+
+// FrameHeartbeat Represents a heartbeat received from a smart frame, kept as its status history
+type FrameHeartbeat struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	FrameID          primitive.ObjectID `bson:"frame_id"`                     // Frame that sent the heartbeat
+	ReceivedAt       time.Time          `bson:"received_at"`                  // When it was received
+	FirmwareVersion  string             `bson:"firmware_version"`             // Version of the software running on the frame
+	FreeStorage      int64              `bson:"free_storage"`                 // Free storage left on the frame, in bytes
+	IPAddress        string             `bson:"ip_address,omitempty"`         // Address the heartbeat came from
+	CurrentPictureID primitive.ObjectID `bson:"current_picture_id,omitempty"` // Picture on screen
+}
+
+// PictureDisplayStat Represents how many times a frame displayed a picture
+type PictureDisplayStat struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	FrameID         primitive.ObjectID `bson:"frame_id"`          // Frame that displayed the picture
+	PictureID       primitive.ObjectID `bson:"picture_id"`        // Displayed picture
+	Count           int64              `bson:"count"`             // Number of times it was displayed
+	LastDisplayedAt time.Time          `bson:"last_displayed_at"` // When the last display was reported
+}
+
+// Firmware release channels, frames on the beta channel also receive the stable releases
+const (
+	FirmwareChannelStable = "stable"
+	FirmwareChannelBeta   = "beta"
+)
+
+// Outcomes of a firmware update reported by a frame
+const (
+	FirmwareUpdateSucceeded = "succeeded"
+	FirmwareUpdateFailed    = "failed"
+)
+
+// FirmwareRelease Represents a version of the frame firmware distributed over the air
+type FirmwareRelease struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Version        string             `bson:"version"`         // MAJOR.MINOR.PATCH, unique within the channel
+	Channel        string             `bson:"channel"`         // One of the FirmwareChannel* values
+	BlobID         primitive.ObjectID `bson:"blob_id"`         // Firmware image in the blob store
+	Size           int64              `bson:"size"`            // Size of the image, in bytes
+	Checksum       string             `bson:"checksum"`        // Hex SHA-256 of the image
+	Signature      string             `bson:"signature"`       // Signature of the image by the publisher, verified by the frames
+	RolloutPercent int                `bson:"rollout_percent"` // Share of the frames of the channel offered the release, 0 to 100
+	Notes          string             `bson:"notes,omitempty"` // Release notes
+	SucceededCount int64              `bson:"succeeded_count"` // Updates reported successful by the frames
+	FailedCount    int64              `bson:"failed_count"`    // Updates reported failed by the frames
+	CreatedAt      time.Time          `bson:"created_at"`
+	UpdatedAt      time.Time          `bson:"updated_at"`
+}
+
+// FirmwareUpdateReport Represents the outcome of a firmware update reported by a frame
+type FirmwareUpdateReport struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	FrameID     primitive.ObjectID `bson:"frame_id"`               // Frame that installed the release
+	ReleaseID   primitive.ObjectID `bson:"release_id"`             // Installed release
+	FromVersion string             `bson:"from_version,omitempty"` // Version the frame ran before the update
+	Outcome     string             `bson:"outcome"`                // One of the FirmwareUpdate* values
+	Error       string             `bson:"error,omitempty"`        // What went wrong, for failed updates
+	ReportedAt  time.Time          `bson:"reported_at"`
+}
+
+// Transitions between two slides of a frame
+const (
+	TransitionNone  = "none"
+	TransitionFade  = "fade"
+	TransitionSlide = "slide"
+	TransitionZoom  = "zoom"
+)
+
+// Orders in which a frame displays the pictures of its albums
+const (
+	OrderShuffle       = "shuffle"       // Random order, albums picked according to their weight
+	OrderChronological = "chronological" // Oldest upload first
+)
+
+// What a frame does during its quiet hours
+const (
+	QuietModeOff = "off" // Screen turned off
+	QuietModeDim = "dim" // Screen dimmed, the slideshow goes on
+)
+
+// DisplaySettings Represents the slideshow configuration of a smart frame
+type DisplaySettings struct {
+	SlideInterval int           `bson:"slide_interval" binding:"omitempty,min=5,max=86400"`        // Seconds each picture stays on screen
+	Transition    string        `bson:"transition" binding:"omitempty,oneof=none fade slide zoom"` // One of the Transition* values
+	Order         string        `bson:"order" binding:"omitempty,oneof=shuffle chronological"`     // One of the Order* values
+	QuietHours    QuietHours    `bson:"quiet_hours"`                                               // Night mode schedule
+	AlbumWeights  []AlbumWeight `bson:"album_weights,omitempty" binding:"omitempty,max=100,dive"`  // Relative share of the loaded albums, 1 when not listed
+}
+
+// QuietHours Represents the daily period a frame turns its screen off or dims it
+type QuietHours struct {
+	Enabled  bool   `bson:"enabled"`                                          // Whether the schedule applies
+	Start    string `bson:"start,omitempty"`                                  // Local start time, HH:MM
+	End      string `bson:"end,omitempty"`                                    // Local end time, HH:MM, the next day when before Start
+	Timezone string `bson:"timezone,omitempty"`                               // IANA time zone of Start and End, e.g. Europe/Paris
+	Mode     string `bson:"mode,omitempty" binding:"omitempty,oneof=off dim"` // One of the QuietMode* values
+}
+
+// AlbumWeight Represents how often the pictures of a loaded album are shown compared to the other albums
+type AlbumWeight struct {
+	AlbumID primitive.ObjectID `bson:"album_id" binding:"required"`
+	Weight  int                `bson:"weight" binding:"required,min=1,max=10"`
+}
+
+// Kinds of notification
+const (
+	NotificationFrameClaimed = "frame_claimed" // A gifted frame was claimed by its recipient
+)
+
+// Notification Represents something that happened which a user should be told about
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	UserID    primitive.ObjectID `bson:"user_id"`            // Notified user
+	Type      string             `bson:"type"`               // One of the Notification* values
+	Message   string             `bson:"message"`            // Human readable summary
+	ActorID   primitive.ObjectID `bson:"actor_id,omitempty"` // User whose action caused the notification
+	FrameID   primitive.ObjectID `bson:"frame_id,omitempty"` // Frame the notification is about
+	CreatedAt time.Time          `bson:"created_at"`         // When it happened
+	ReadAt    time.Time          `bson:"read_at,omitempty"`  // When the user read it, zero while unread
 }
 
 // PictureData Represents the binary data of a picture
 type PictureData struct {
 	ID   primitive.ObjectID `bson:"_id,omitempty"`
 	Data []byte             `bson:"data,omitempty"`
+	Hash string             `bson:"hash,omitempty"` // SHA-256 of the data, hex encoded
 }
@@ -0,0 +1,100 @@
+package recognition
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"mirage-backend/models"
+)
+
+// maxResponseSize bounds the answer read from the detection service
+const maxResponseSize = 1 << 20
+
+// HTTPRecognizer delegates the detection to a service, typically running next to the backend.
+//
+// The image is posted as the request body with its content type. The service answers 200 with the faces,
+// their box in fractions of the image size from its top left corner and optionally their embedding, used to
+// group the faces into people:
+//
+//	{"faces": [{"box": {"x": 0.42, "y": 0.18, "width": 0.12, "height": 0.16}, "confidence": 0.97, "embedding": [0.1, ...]}]}
+type HTTPRecognizer struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPRecognizer returns a recognizer posting the images to endpoint, giving up on one after timeout
+func NewHTTPRecognizer(endpoint string, timeout time.Duration) *HTTPRecognizer {
+	return &HTTPRecognizer{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// httpDetections is the answer of the detection service
+type httpDetections struct {
+	Faces []struct {
+		Box struct {
+			X      float64 `json:"x"`
+			Y      float64 `json:"y"`
+			Width  float64 `json:"width"`
+			Height float64 `json:"height"`
+		} `json:"box"`
+		Confidence float64   `json:"confidence"`
+		Embedding  []float64 `json:"embedding"`
+	} `json:"faces"`
+}
+
+func (r *HTTPRecognizer) Detect(ctx context.Context, image []byte) ([]Detection, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", http.DetectContentType(image))
+	request.Header.Set("Accept", "application/json")
+
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("detection service unreachable: %w", err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read detection service answer: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("detection service answered %d: %s", response.StatusCode, bytes.TrimSpace(body))
+	}
+
+	var answer httpDetections
+	if err := json.Unmarshal(body, &answer); err != nil {
+		return nil, fmt.Errorf("invalid detection service answer: %w", err)
+	}
+
+	detections := make([]Detection, 0, len(answer.Faces))
+	for _, face := range answer.Faces {
+		detection := Detection{
+			Box:        models.BoundingBox{X: face.Box.X, Y: face.Box.Y, Width: face.Box.Width, Height: face.Box.Height},
+			Confidence: face.Confidence,
+			Embedding:  face.Embedding,
+		}
+		if !valid(detection) {
+			return nil, fmt.Errorf("invalid detection service answer: face %+v out of bounds", detection)
+		}
+		detections = append(detections, detection)
+	}
+	return detections, nil
+}
+
+// valid tells whether the detection lies within the image and its confidence is a fraction
+func valid(detection Detection) bool {
+	box := detection.Box
+	return box.X >= 0 && box.Y >= 0 && box.Width > 0 && box.Height > 0 &&
+		box.X+box.Width <= 1 && box.Y+box.Height <= 1 &&
+		detection.Confidence >= 0 && detection.Confidence <= 1
+}
@@ -0,0 +1,295 @@
+package recognition
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/versioning"
+)
+
+var (
+	// ErrFaceNotInPerson is returned when splitting a person with a face that isn't grouped into it
+	ErrFaceNotInPerson = errors.New("face not grouped into the person")
+	// ErrNoFaceLeft is returned when splitting every face off a person
+	ErrNoFaceLeft = errors.New("a person must keep at least one face")
+)
+
+// People groups the faces detected in the pictures of each user into the people they show.
+//
+// A face joins the person of the picture's uploader whose centroid, the mean embedding of its faces, is the most
+// similar to its own embedding, as long as their cosine similarity reaches the threshold; otherwise it starts a new
+// person. The faces and people are changed through People, one change at a time, so that the face counts and
+// centroids of the people follow their faces. People left without faces are deleted.
+type People struct {
+	people     repository.PersonRepository
+	faces      repository.FaceRepository
+	similarity float64
+
+	mu sync.Mutex
+}
+
+// NewPeople returns People grouping the faces whose cosine similarity with a person is at least similarity
+func NewPeople(people repository.PersonRepository, faces repository.FaceRepository, similarity float64) *People {
+	return &People{people: people, faces: faces, similarity: similarity}
+}
+
+// StoreFaces replaces the faces of the picture with the given ones, grouping the faces with an embedding into the
+// people of the uploader of the picture
+func (p *People) StoreFaces(ctx context.Context, picture models.Picture, faces []models.RecognizedFace) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	previous, err := p.faces.Find(ctx, repository.FaceFilter{PictureIDs: []primitive.ObjectID{picture.ID}})
+	if err != nil {
+		return err
+	}
+	touched := personIDs(previous)
+
+	if !picture.UserID.IsZero() {
+		assigned, err := p.assign(ctx, picture.UserID, faces)
+		if err != nil {
+			return err
+		}
+		touched = appendMissing(touched, assigned...)
+	}
+
+	if err := p.faces.ReplaceForPicture(ctx, picture.ID, faces); err != nil {
+		return err
+	}
+	return p.refresh(ctx, touched)
+}
+
+// Forget deletes the faces of the picture
+func (p *People) Forget(ctx context.Context, pictureID primitive.ObjectID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	faces, err := p.faces.Find(ctx, repository.FaceFilter{PictureIDs: []primitive.ObjectID{pictureID}})
+	if err != nil {
+		return err
+	}
+	if err := p.faces.DeleteByPicture(ctx, pictureID); err != nil {
+		return err
+	}
+	return p.refresh(ctx, personIDs(faces))
+}
+
+// Rename copies the name of the person onto its faces
+func (p *People) Rename(ctx context.Context, person models.Person) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	filter := repository.FaceFilter{PersonIDs: []primitive.ObjectID{person.ID}}
+	return p.faces.AssignPerson(ctx, filter, person.ID, person.Name)
+}
+
+// Merge moves the faces of others into person and deletes them. The merged person keeps its name, or takes the
+// first name among others when it has none.
+func (p *People) Merge(ctx context.Context, person models.Person, others []models.Person) (models.Person, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	otherIDs := make([]primitive.ObjectID, 0, len(others))
+	for _, other := range others {
+		otherIDs = append(otherIDs, other.ID)
+		if person.Name == "" {
+			person.Name = other.Name
+		}
+	}
+
+	if err := p.people.Update(ctx, person.ID, repository.Fields{"name": person.Name}); err != nil {
+		return person, err
+	}
+	// The faces of the person get the name it may have taken too
+	filter := repository.FaceFilter{PersonIDs: append(otherIDs, person.ID)}
+	if err := p.faces.AssignPerson(ctx, filter, person.ID, person.Name); err != nil {
+		return person, err
+	}
+	if err := p.refresh(ctx, filter.PersonIDs); err != nil {
+		return person, err
+	}
+	return p.people.Get(ctx, person.ID)
+}
+
+// Split moves the given faces of person into a new person with the given name, which is returned
+func (p *People) Split(ctx context.Context, person models.Person, faceIDs []primitive.ObjectID, name string) (models.Person, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	faces, err := p.faces.Find(ctx, repository.FaceFilter{PersonIDs: []primitive.ObjectID{person.ID}})
+	if err != nil {
+		return models.Person{}, err
+	}
+	faceIDs = appendMissing(nil, faceIDs...)
+	var moved []models.RecognizedFace
+	for _, faceID := range faceIDs {
+		index := slices.IndexFunc(faces, func(face models.RecognizedFace) bool { return face.ID == faceID })
+		if index < 0 {
+			return models.Person{}, ErrFaceNotInPerson
+		}
+		moved = append(moved, faces[index])
+	}
+	if len(moved) == len(faces) {
+		return models.Person{}, ErrNoFaceLeft
+	}
+
+	now := time.Now()
+	split := models.Person{
+		OwnerID:   person.OwnerID,
+		Name:      name,
+		FaceCount: len(moved),
+		Centroid:  centroid(moved),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := p.people.Create(ctx, &split); err != nil {
+		return split, err
+	}
+
+	filter := repository.FaceFilter{IDs: faceIDs, PersonIDs: []primitive.ObjectID{person.ID}}
+	if err := p.faces.AssignPerson(ctx, filter, split.ID, name); err != nil {
+		return split, err
+	}
+	if err := p.refresh(ctx, []primitive.ObjectID{person.ID, split.ID}); err != nil {
+		return split, err
+	}
+	return p.people.Get(ctx, split.ID)
+}
+
+// assign sets the person of the faces with an embedding among the people of owner, creating the missing ones,
+// and returns the people the faces were grouped into
+func (p *People) assign(ctx context.Context, ownerID primitive.ObjectID, faces []models.RecognizedFace) ([]primitive.ObjectID, error) {
+	var people []models.Person
+	var assigned []primitive.ObjectID
+	loaded := false
+
+	for i := range faces {
+		if len(faces[i].Embedding) == 0 {
+			continue
+		}
+		if !loaded {
+			var err error
+			if people, err = p.people.ListByOwner(ctx, ownerID); err != nil {
+				return nil, err
+			}
+			loaded = true
+		}
+
+		best, bestSimilarity := -1, p.similarity
+		for j, person := range people {
+			if similarity, ok := cosineSimilarity(faces[i].Embedding, person.Centroid); ok && similarity >= bestSimilarity {
+				best, bestSimilarity = j, similarity
+			}
+		}
+		if best < 0 {
+			now := time.Now()
+			person := models.Person{OwnerID: ownerID, FaceCount: 1, Centroid: faces[i].Embedding, CreatedAt: now, UpdatedAt: now}
+			if err := p.people.Create(ctx, &person); err != nil {
+				return nil, err
+			}
+			people = append(people, person)
+			best = len(people) - 1
+		}
+
+		faces[i].PersonID = people[best].ID
+		faces[i].Name = people[best].Name
+		assigned = appendMissing(assigned, people[best].ID)
+	}
+	return assigned, nil
+}
+
+// refresh recomputes the face count and centroid of the people from their faces, deleting the ones left without faces
+func (p *People) refresh(ctx context.Context, personIDs []primitive.ObjectID) error {
+	for _, personID := range personIDs {
+		faces, err := p.faces.Find(ctx, repository.FaceFilter{PersonIDs: []primitive.ObjectID{personID}})
+		if err != nil {
+			return err
+		}
+
+		if len(faces) == 0 {
+			err = p.people.Delete(ctx, personID)
+		} else {
+			var person models.Person
+			if person, err = p.people.Get(ctx, personID); err == nil {
+				err = p.people.Update(ctx, personID, repository.Fields{
+					"face_count": len(faces),
+					"centroid":   centroid(faces),
+					"updated_at": versioning.NextUpdatedAt(person.UpdatedAt),
+				})
+			}
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// centroid returns the mean embedding of the faces, ignoring the embeddings whose size differs from the first one
+func centroid(faces []models.RecognizedFace) []float64 {
+	var sum []float64
+	count := 0
+	for _, face := range faces {
+		if len(face.Embedding) == 0 || (sum != nil && len(face.Embedding) != len(sum)) {
+			continue
+		}
+		if sum == nil {
+			sum = make([]float64, len(face.Embedding))
+		}
+		for i, value := range face.Embedding {
+			sum[i] += value
+		}
+		count++
+	}
+
+	for i := range sum {
+		sum[i] /= float64(count)
+	}
+	return sum
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, false when they can't be compared
+func cosineSimilarity(a, b []float64) (float64, bool) {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0, false
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0, false
+	}
+	return dot / math.Sqrt(normA*normB), true
+}
+
+// personIDs returns the people the faces are grouped into
+func personIDs(faces []models.RecognizedFace) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, face := range faces {
+		if !face.PersonID.IsZero() {
+			ids = appendMissing(ids, face.PersonID)
+		}
+	}
+	return ids
+}
+
+// appendMissing appends the IDs not in ids yet
+func appendMissing(ids []primitive.ObjectID, more ...primitive.ObjectID) []primitive.ObjectID {
+	for _, id := range more {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
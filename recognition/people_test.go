@@ -0,0 +1,135 @@
+package recognition
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// storeFace stores a face with the embedding as the only one of a new picture uploaded by userID, and returns it
+func storeFace(t *testing.T, people *People, repos repository.Repositories, userID primitive.ObjectID, embedding ...float64) models.RecognizedFace {
+	t.Helper()
+	ctx := context.Background()
+	picture := models.Picture{ID: primitive.NewObjectID(), UserID: userID}
+	if err := people.StoreFaces(ctx, picture, []models.RecognizedFace{{Confidence: 0.9, Embedding: embedding}}); err != nil {
+		t.Fatal(err)
+	}
+	faces, err := repos.Faces.Find(ctx, repository.FaceFilter{PictureIDs: []primitive.ObjectID{picture.ID}})
+	if err != nil || len(faces) != 1 {
+		t.Fatalf("faces of the picture = %v, %v, want one", faces, err)
+	}
+	return faces[0]
+}
+
+func TestFacesAreGroupedFromTheThreshold(t *testing.T) {
+	ownerID := primitive.NewObjectID()
+	tests := []struct {
+		name      string
+		uploader  primitive.ObjectID
+		embedding []float64
+		// joins is whether the face is grouped with the first one, otherwise it starts a person unless it has no embedding
+		joins bool
+	}{
+		{name: "same", uploader: ownerID, embedding: []float64{2, 0, 0}, joins: true},
+		{name: "at the threshold", uploader: ownerID, embedding: []float64{3, 4, 0}, joins: true},
+		{name: "below the threshold", uploader: ownerID, embedding: []float64{3, 4.01, 0}},
+		{name: "opposite", uploader: ownerID, embedding: []float64{-1, 0, 0}},
+		{name: "other size", uploader: ownerID, embedding: []float64{1, 0}},
+		{name: "zero", uploader: ownerID, embedding: []float64{0, 0, 0}},
+		{name: "no embedding", uploader: ownerID},
+		{name: "other uploader", uploader: primitive.NewObjectID(), embedding: []float64{1, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repos := repository.NewMemoryRepositories()
+			people := NewPeople(repos.People, repos.Faces, 0.6)
+			first := storeFace(t, people, repos, ownerID, 1, 0, 0)
+
+			face := storeFace(t, people, repos, tt.uploader, tt.embedding...)
+			switch {
+			case tt.joins && face.PersonID != first.PersonID:
+				t.Errorf("face grouped into %s, want %s", face.PersonID.Hex(), first.PersonID.Hex())
+			case !tt.joins && face.PersonID == first.PersonID:
+				t.Error("face grouped with the first one")
+			case len(tt.embedding) == 0 && !face.PersonID.IsZero():
+				t.Errorf("face without embedding grouped into %s", face.PersonID.Hex())
+			}
+			if !face.PersonID.IsZero() {
+				person, err := repos.People.Get(ctx, face.PersonID)
+				if err != nil || person.OwnerID != tt.uploader {
+					t.Errorf("person = %+v, %v, want one of the uploader", person, err)
+				}
+			}
+
+			person, err := repos.People.Get(ctx, first.PersonID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 2, false: 1}[tt.joins]; person.FaceCount != want {
+				t.Errorf("first person has %d faces, want %d", person.FaceCount, want)
+			}
+		})
+	}
+}
+
+func TestFacesJoinTheMostSimilarPerson(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	people := NewPeople(repos.People, repos.Faces, 0.5)
+	ownerID := primitive.NewObjectID()
+	storeFace(t, people, repos, ownerID, 1, 0, 0)
+	second := storeFace(t, people, repos, ownerID, 0, 1, 0)
+
+	// similar enough to both people, closer to the second one
+	face := storeFace(t, people, repos, ownerID, 0.6, 0.8, 0)
+	if face.PersonID != second.PersonID {
+		t.Fatalf("face grouped into %s, want %s", face.PersonID.Hex(), second.PersonID.Hex())
+	}
+	person, err := repos.People.Get(ctx, second.PersonID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{0.3, 0.9, 0}; person.FaceCount != 2 || !slices.Equal(person.Centroid, want) {
+		t.Errorf("person has %d faces around %v, want 2 around %v", person.FaceCount, person.Centroid, want)
+	}
+
+	// a person left without faces is deleted
+	for _, pictureID := range []primitive.ObjectID{second.PictureID, face.PictureID} {
+		if err := people.Forget(ctx, pictureID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repos.People.Get(ctx, second.PersonID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get() = %v, want the person deleted", err)
+	}
+	if remaining, _ := repos.People.ListByOwner(ctx, ownerID); len(remaining) != 1 {
+		t.Errorf("%d people left, want 1", len(remaining))
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b       []float64
+		similarity float64
+		ok         bool
+	}{
+		{a: []float64{1, 0}, b: []float64{5, 0}, similarity: 1, ok: true},
+		{a: []float64{1, 0}, b: []float64{0, 1}, similarity: 0, ok: true},
+		{a: []float64{1, 0}, b: []float64{-1, 0}, similarity: -1, ok: true},
+		{a: []float64{3, 4}, b: []float64{1, 0}, similarity: 0.6, ok: true},
+		{a: []float64{1, 0}, b: []float64{1, 0, 0}},
+		{a: []float64{0, 0}, b: []float64{1, 0}},
+		{a: nil, b: nil},
+	}
+	for _, tt := range tests {
+		if similarity, ok := cosineSimilarity(tt.a, tt.b); similarity != tt.similarity || ok != tt.ok {
+			t.Errorf("cosineSimilarity(%v, %v) = %v, %t, want %v, %t", tt.a, tt.b, similarity, ok, tt.similarity, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package recognition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"mirage-backend/metrics"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+	"mirage-backend/tracing"
+)
+
+// QueueName labels the queue of the pictures waiting for face detection in the metrics
+const QueueName = "face_detection"
+
+// ErrDisabled is returned when no recognizer is configured
+var ErrDisabled = errors.New("face recognition is disabled")
+
+// Pipeline queues pictures and detects their faces in the background workers started with Run
+type Pipeline struct {
+	recognizer    Recognizer
+	pictures      repository.PictureRepository
+	blobs         repository.BlobRepository
+	people        *People
+	minConfidence float64
+
+	jobs chan primitive.ObjectID
+
+	mu     sync.Mutex
+	queued map[primitive.ObjectID]struct{}
+}
+
+// NewPipeline returns a pipeline running recognizer, holding up to queueSize pictures and keeping the faces
+// detected with at least minConfidence, which are grouped by people. A nil recognizer disables face detection.
+func NewPipeline(
+	recognizer Recognizer,
+	pictures repository.PictureRepository,
+	blobs repository.BlobRepository,
+	people *People,
+	queueSize int,
+	minConfidence float64,
+) *Pipeline {
+	return &Pipeline{
+		recognizer:    recognizer,
+		pictures:      pictures,
+		blobs:         blobs,
+		people:        people,
+		minConfidence: minConfidence,
+		jobs:          make(chan primitive.ObjectID, queueSize),
+		queued:        make(map[primitive.ObjectID]struct{}),
+	}
+}
+
+// Enabled tells whether a recognizer is configured
+func (p *Pipeline) Enabled() bool {
+	return p.recognizer != nil
+}
+
+// Depth returns how many pictures wait for detection
+func (p *Pipeline) Depth() int {
+	return len(p.jobs)
+}
+
+// Capacity returns how many pictures can wait for detection
+func (p *Pipeline) Capacity() int {
+	return cap(p.jobs)
+}
+
+// Enqueue queues the picture for detection, unless it already waits for it. It returns false without
+// blocking when detection is disabled or the queue is full.
+func (p *Pipeline) Enqueue(pictureID primitive.ObjectID) bool {
+	if !p.Enabled() {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.queued[pictureID]; ok {
+		return true
+	}
+	select {
+	case p.jobs <- pictureID:
+		p.queued[pictureID] = struct{}{}
+		metrics.WorkerQueueDepth.WithLabelValues(QueueName).Set(float64(len(p.jobs)))
+		return true
+	default:
+		return false
+	}
+}
+
+// Run processes the queued pictures until ctx is done, it is meant to be run by each background worker
+func (p *Pipeline) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case pictureID := <-p.jobs:
+			p.mu.Lock()
+			delete(p.queued, pictureID)
+			metrics.WorkerQueueDepth.WithLabelValues(QueueName).Set(float64(len(p.jobs)))
+			p.mu.Unlock()
+
+			if err := p.Process(ctx, pictureID); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "Failed to detect faces", "picture_id", pictureID.Hex(), "error", err)
+			}
+		}
+	}
+}
+
+// Process detects the faces of the picture and replaces the ones stored for it. A picture deleted in the
+// meantime is skipped; when the detection fails the picture is marked as failed so that it can be retried.
+func (p *Pipeline) Process(ctx context.Context, pictureID primitive.ObjectID) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "recognition.process",
+		trace.WithAttributes(attribute.String("picture.id", pictureID.Hex())))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if !p.Enabled() {
+		return ErrDisabled
+	}
+
+	picture, err := p.pictures.Get(ctx, pictureID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	detections, err := p.detect(ctx, picture)
+	if err != nil {
+		fields := repository.Fields{"recognition_status": models.RecognitionFailed, "recognized_at": time.Now()}
+		if updateErr := p.pictures.Update(ctx, pictureID, fields); updateErr != nil && !errors.Is(updateErr, repository.ErrNotFound) {
+			err = errors.Join(err, updateErr)
+		}
+		return err
+	}
+	span.SetAttributes(attribute.Int("faces.count", len(detections)))
+
+	now := time.Now()
+	faces := make([]models.RecognizedFace, 0, len(detections))
+	for _, detection := range detections {
+		faces = append(faces, models.RecognizedFace{
+			Confidence:   detection.Confidence,
+			Box:          detection.Box,
+			Embedding:    detection.Embedding,
+			RecognizedAt: now,
+		})
+	}
+	if err := p.people.StoreFaces(ctx, picture, faces); err != nil {
+		return fmt.Errorf("failed to store faces: %w", err)
+	}
+
+	faceIDs := make([]primitive.ObjectID, 0, len(faces))
+	for _, face := range faces {
+		faceIDs = append(faceIDs, face.ID)
+	}
+	fields := repository.Fields{"faces_id": faceIDs, "recognition_status": models.RecognitionDone, "recognized_at": now}
+	if err := p.pictures.Update(ctx, pictureID, fields); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// The picture was deleted while its faces were detected
+			return p.people.Forget(ctx, pictureID)
+		}
+		return err
+	}
+	return nil
+}
+
+// detect runs the recognizer on the image of the picture and keeps the detections confident enough
+func (p *Pipeline) detect(ctx context.Context, picture models.Picture) ([]Detection, error) {
+	image, err := p.blobs.Get(ctx, picture.PictureDataID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve picture data: %w", err)
+	}
+
+	start := time.Now()
+	detections, err := p.recognizer.Detect(ctx, image)
+	metrics.ImageProcessingDuration.WithLabelValues(QueueName).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	kept := detections[:0]
+	for _, detection := range detections {
+		if detection.Confidence >= p.minConfidence {
+			kept = append(kept, detection)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,37 @@
+// Package recognition detects the faces in the pictures, in the background.
+//
+// The detection itself is done by a Recognizer, chosen by the configuration; the Pipeline queues the pictures,
+// runs the recognizer on them and stores the faces it finds. The faces the recognizer describes with an embedding
+// are grouped by People into the people appearing in the pictures of each user.
+package recognition
+
+import (
+	"context"
+	"time"
+
+	"mirage-backend/config"
+	"mirage-backend/models"
+)
+
+// Detection is a face found in an image
+type Detection struct {
+	Box        models.BoundingBox
+	Confidence float64 // Between 0 and 1
+	// Embedding describes the face so that the faces of a same person are close, nil when the recognizer has none
+	Embedding []float64
+}
+
+// Recognizer detects the faces in an image
+type Recognizer interface {
+	Detect(ctx context.Context, image []byte) ([]Detection, error)
+}
+
+// New returns the recognizer selected by the configuration, nil when face detection is disabled
+func New(cfg config.RecognitionConfig) Recognizer {
+	switch cfg.Backend {
+	case config.RecognitionBackendHTTP:
+		return NewHTTPRecognizer(cfg.Endpoint, time.Duration(cfg.Timeout))
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,1135 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/models"
+)
+
+// NewMemoryRepositories returns repositories keeping everything in memory, meant for tests and local runs
+func NewMemoryRepositories() Repositories {
+	albums := &MemoryAlbumRepository{store: newMemoryStore[models.Album]()}
+	pictures := &MemoryPictureRepository{store: newMemoryStore[models.Picture]()}
+	faces := &MemoryFaceRepository{store: newMemoryStore[models.RecognizedFace]()}
+	return Repositories{
+		Users:           &MemoryUserRepository{store: newMemoryStore[models.User]()},
+		Profiles:        &MemoryUserProfileRepository{store: newMemoryStore[models.UserProfile]()},
+		Albums:          albums,
+		Pictures:        pictures,
+		Blobs:           &MemoryBlobRepository{store: newMemoryStore[models.PictureData]()},
+		ProfilePictures: &MemoryProfilePictureRepository{store: newMemoryStore[models.ProfilePicture]()},
+		Invitations:     &MemoryInvitationRepository{store: newMemoryStore[models.AlbumInvitation]()},
+		ShareLinks:      &MemoryShareLinkRepository{store: newMemoryStore[models.ShareLink]()},
+		Frames:          &MemoryFrameRepository{store: newMemoryStore[models.SmartFrame]()},
+		Notifications:   &MemoryNotificationRepository{store: newMemoryStore[models.Notification]()},
+		Heartbeats:      &MemoryHeartbeatRepository{store: newMemoryStore[models.FrameHeartbeat]()},
+		DisplayStats:    &MemoryDisplayStatRepository{store: newMemoryStore[models.PictureDisplayStat]()},
+		Firmware:        &MemoryFirmwareRepository{store: newMemoryStore[models.FirmwareRelease]()},
+		FirmwareReports: &MemoryFirmwareReportRepository{store: newMemoryStore[models.FirmwareUpdateReport]()},
+		Faces:           faces,
+		People:          &MemoryPersonRepository{store: newMemoryStore[models.Person]()},
+		Search:          &MemorySearchRepository{albums: albums, pictures: pictures, faces: faces},
+	}
+}
+
+// MemoryUserRepository keeps users in memory, enforcing unique usernames and emails
+type MemoryUserRepository struct {
+	store *memoryStore[models.User]
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(user.ID, *user, r.unique)
+}
+
+func (r *MemoryUserRepository) Get(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryUserRepository) FindByLogin(ctx context.Context, login string) (models.User, error) {
+	return r.store.find(func(user models.User) bool { return user.Username == login || user.Email == login })
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, query PageQuery) (Page[models.User], error) {
+	return r.store.list(func(models.User) bool { return true }, query)
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, r.unique)
+}
+
+func (r *MemoryUserRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return r.store.updateIf(id, func(user models.User) bool { return user.UpdatedAt.Equal(updatedAt) }, fields, r.unique)
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+func (r *MemoryUserRepository) Exists(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return r.store.exists(id), nil
+}
+
+// unique mimics the unique username and email indexes
+func (r *MemoryUserRepository) unique(candidate, other models.User) bool {
+	return candidate.Username != other.Username && candidate.Email != other.Email
+}
+
+// MemoryUserProfileRepository keeps user profiles in memory, enforcing one profile per user
+type MemoryUserProfileRepository struct {
+	store *memoryStore[models.UserProfile]
+}
+
+func (r *MemoryUserProfileRepository) Create(ctx context.Context, profile *models.UserProfile) error {
+	if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(profile.ID, *profile, r.unique)
+}
+
+func (r *MemoryUserProfileRepository) Get(ctx context.Context, id primitive.ObjectID) (models.UserProfile, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryUserProfileRepository) GetByUser(ctx context.Context, userID primitive.ObjectID) (models.UserProfile, error) {
+	return r.store.find(func(profile models.UserProfile) bool { return profile.UserID == userID })
+}
+
+func (r *MemoryUserProfileRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, r.unique)
+}
+
+func (r *MemoryUserProfileRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return r.store.updateIf(id, func(profile models.UserProfile) bool { return profile.UpdatedAt.Equal(updatedAt) }, fields, r.unique)
+}
+
+func (r *MemoryUserProfileRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+// unique mimics the unique user_id index
+func (r *MemoryUserProfileRepository) unique(candidate, other models.UserProfile) bool {
+	return candidate.UserID != other.UserID
+}
+
+// MemoryAlbumRepository keeps albums in memory
+type MemoryAlbumRepository struct {
+	store *memoryStore[models.Album]
+}
+
+func (r *MemoryAlbumRepository) Create(ctx context.Context, album *models.Album) error {
+	if album.ID.IsZero() {
+		album.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(album.ID, *album, nil)
+}
+
+func (r *MemoryAlbumRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Album, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryAlbumRepository) List(ctx context.Context, filter AlbumFilter, query PageQuery) (Page[models.Album], error) {
+	return r.store.list(func(album models.Album) bool { return r.matches(filter, album) }, query)
+}
+
+func (r *MemoryAlbumRepository) IDs(ctx context.Context, filter AlbumFilter) ([]primitive.ObjectID, error) {
+	var albumIDs []primitive.ObjectID
+	for _, album := range r.store.filter(func(album models.Album) bool { return r.matches(filter, album) }) {
+		albumIDs = append(albumIDs, album.ID)
+	}
+	return albumIDs, nil
+}
+
+func (r *MemoryAlbumRepository) matches(filter AlbumFilter, album models.Album) bool {
+	return (filter.IDs == nil || slices.Contains(filter.IDs, album.ID)) &&
+		(filter.OwnerID == nil || album.OwnerID == *filter.OwnerID) &&
+		(filter.MemberID == nil || slices.Contains(album.TargetUserIDs, *filter.MemberID)) &&
+		(filter.VisibleTo == nil || !album.IsPrivate || !filter.VisibleTo.IsZero() &&
+			(album.OwnerID == *filter.VisibleTo || slices.Contains(album.TargetUserIDs, *filter.VisibleTo)))
+}
+
+func (r *MemoryAlbumRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, nil)
+}
+
+func (r *MemoryAlbumRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return r.store.updateIf(id, func(album models.Album) bool { return album.UpdatedAt.Equal(updatedAt) }, fields, nil)
+}
+
+func (r *MemoryAlbumRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+func (r *MemoryAlbumRepository) Exists(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return r.store.exists(id), nil
+}
+
+// MemoryPictureRepository keeps picture metadata in memory
+type MemoryPictureRepository struct {
+	store *memoryStore[models.Picture]
+}
+
+func (r *MemoryPictureRepository) Create(ctx context.Context, picture *models.Picture) error {
+	if picture.ID.IsZero() {
+		picture.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(picture.ID, *picture, nil)
+}
+
+func (r *MemoryPictureRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Picture, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryPictureRepository) List(ctx context.Context, filter PictureFilter, query PageQuery) (Page[models.Picture], error) {
+	return r.store.list(func(picture models.Picture) bool { return r.matches(filter, picture) }, query)
+}
+
+func (r *MemoryPictureRepository) IDs(ctx context.Context, filter PictureFilter) ([]primitive.ObjectID, error) {
+	var pictureIDs []primitive.ObjectID
+	for _, picture := range r.store.filter(func(picture models.Picture) bool { return r.matches(filter, picture) }) {
+		pictureIDs = append(pictureIDs, picture.ID)
+	}
+	return pictureIDs, nil
+}
+
+func (r *MemoryPictureRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, nil)
+}
+
+func (r *MemoryPictureRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+// matches tells whether the picture is kept by the filter
+func (r *MemoryPictureRepository) matches(filter PictureFilter, picture models.Picture) bool {
+	return (filter.AlbumID == nil || picture.AlbumID == *filter.AlbumID) &&
+		(filter.IDs == nil || slices.Contains(filter.IDs, picture.ID)) &&
+		(!filter.Unrecognized || picture.RecognitionStatus != models.RecognitionDone) &&
+		(filter.Scope == nil || (picture.UserID == filter.Scope.UploaderID && !picture.AlbumID.IsZero()) || slices.Contains(filter.Scope.AlbumIDs, picture.AlbumID)) &&
+		(filter.Visible == nil || (!filter.Visible.UploaderID.IsZero() && picture.UserID == filter.Visible.UploaderID) || slices.Contains(filter.Visible.AlbumIDs, picture.AlbumID)) &&
+		(filter.TakenAfter.IsZero() || !picture.TakenAt.Before(filter.TakenAfter)) &&
+		(filter.TakenBefore.IsZero() || picture.TakenAt.Before(filter.TakenBefore)) &&
+		!slices.ContainsFunc(filter.Tags, func(tag string) bool { return !slices.Contains(picture.Tags, tag) }) &&
+		(filter.UploaderIDs == nil || slices.Contains(filter.UploaderIDs, picture.UserID)) &&
+		(filter.Near == nil || picture.Location != nil && distanceKm(*filter.Near, *picture.Location) <= filter.Near.RadiusKm)
+}
+
+// distanceKm returns the great-circle distance between the center of the circle and the point
+func distanceKm(circle models.GeoCircle, point models.GeoPoint) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	lat1, lat2 := toRadians(circle.Latitude), toRadians(point.Latitude)
+	dLat, dLng := lat2-lat1, toRadians(point.Longitude-circle.Longitude)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// MemoryBlobRepository keeps picture data in memory
+type MemoryBlobRepository struct {
+	store *memoryStore[models.PictureData]
+}
+
+func (r *MemoryBlobRepository) Save(ctx context.Context, data []byte) (primitive.ObjectID, error) {
+	hash := sha256.Sum256(data)
+	pictureData := models.PictureData{
+		ID:   primitive.NewObjectID(),
+		Data: bytes.Clone(data),
+		Hash: hex.EncodeToString(hash[:]),
+	}
+	return pictureData.ID, r.store.insert(pictureData.ID, pictureData, nil)
+}
+
+func (r *MemoryBlobRepository) Get(ctx context.Context, id primitive.ObjectID) ([]byte, error) {
+	pictureData, err := r.store.get(id)
+	if err != nil {
+		return nil, err
+	}
+	return pictureData.Data, nil
+}
+
+func (r *MemoryBlobRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+func (r *MemoryBlobRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// MemoryProfilePictureRepository keeps profile pictures in memory
+type MemoryProfilePictureRepository struct {
+	store *memoryStore[models.ProfilePicture]
+}
+
+func (r *MemoryProfilePictureRepository) Create(ctx context.Context, profilePicture *models.ProfilePicture) error {
+	if profilePicture.ID.IsZero() {
+		profilePicture.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(profilePicture.ID, *profilePicture, nil)
+}
+
+func (r *MemoryProfilePictureRepository) Get(ctx context.Context, id primitive.ObjectID) (models.ProfilePicture, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryProfilePictureRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, query PageQuery) (Page[models.ProfilePicture], error) {
+	return r.store.list(func(profilePicture models.ProfilePicture) bool {
+		return profilePicture.UserID == userID
+	}, query)
+}
+
+func (r *MemoryProfilePictureRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+// MemoryInvitationRepository keeps album invitations in memory, enforcing one invitation per album and user
+type MemoryInvitationRepository struct {
+	store *memoryStore[models.AlbumInvitation]
+}
+
+func (r *MemoryInvitationRepository) Create(ctx context.Context, invitation *models.AlbumInvitation) error {
+	if invitation.ID.IsZero() {
+		invitation.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(invitation.ID, *invitation, r.unique)
+}
+
+func (r *MemoryInvitationRepository) Get(ctx context.Context, id primitive.ObjectID) (models.AlbumInvitation, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryInvitationRepository) GetByAlbumAndUser(ctx context.Context, albumID, userID primitive.ObjectID) (models.AlbumInvitation, error) {
+	return r.store.find(func(invitation models.AlbumInvitation) bool {
+		return invitation.AlbumID == albumID && invitation.UserID == userID
+	})
+}
+
+func (r *MemoryInvitationRepository) List(ctx context.Context, filter InvitationFilter, query PageQuery) (Page[models.AlbumInvitation], error) {
+	return r.store.list(func(invitation models.AlbumInvitation) bool {
+		return (filter.AlbumID == nil || invitation.AlbumID == *filter.AlbumID) &&
+			(filter.UserID == nil || invitation.UserID == *filter.UserID) &&
+			(filter.Status == "" || invitation.Status == filter.Status)
+	}, query)
+}
+
+func (r *MemoryInvitationRepository) MemberIDs(ctx context.Context, albumID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	members := r.store.filter(func(invitation models.AlbumInvitation) bool {
+		return invitation.AlbumID == albumID && invitation.Status == models.InvitationAccepted
+	})
+
+	memberIDs := make([]primitive.ObjectID, 0, len(members))
+	for _, member := range members {
+		memberIDs = append(memberIDs, member.UserID)
+	}
+	return memberIDs, nil
+}
+
+func (r *MemoryInvitationRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, r.unique)
+}
+
+func (r *MemoryInvitationRepository) DeleteByAlbum(ctx context.Context, albumID primitive.ObjectID) error {
+	r.store.deleteWhere(func(invitation models.AlbumInvitation) bool { return invitation.AlbumID == albumID })
+	return nil
+}
+
+// unique mimics the unique album_id and user_id index
+func (r *MemoryInvitationRepository) unique(candidate, other models.AlbumInvitation) bool {
+	return candidate.AlbumID != other.AlbumID || candidate.UserID != other.UserID
+}
+
+// MemoryShareLinkRepository keeps share links in memory, enforcing unique tokens
+type MemoryShareLinkRepository struct {
+	store *memoryStore[models.ShareLink]
+}
+
+func (r *MemoryShareLinkRepository) Create(ctx context.Context, link *models.ShareLink) error {
+	if link.ID.IsZero() {
+		link.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(link.ID, *link, func(candidate, other models.ShareLink) bool {
+		return candidate.Token != other.Token
+	})
+}
+
+func (r *MemoryShareLinkRepository) Get(ctx context.Context, id primitive.ObjectID) (models.ShareLink, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryShareLinkRepository) GetByToken(ctx context.Context, token string) (models.ShareLink, error) {
+	return r.store.find(func(link models.ShareLink) bool { return link.Token == token })
+}
+
+func (r *MemoryShareLinkRepository) List(ctx context.Context, filter ShareLinkFilter, query PageQuery) (Page[models.ShareLink], error) {
+	return r.store.list(func(link models.ShareLink) bool {
+		return (filter.AlbumID == nil || link.AlbumID == *filter.AlbumID) &&
+			(filter.PictureID == nil || link.PictureID == *filter.PictureID)
+	}, query)
+}
+
+func (r *MemoryShareLinkRepository) RecordAccess(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	return r.store.modify(id, func(link *models.ShareLink) {
+		link.AccessCount++
+		link.LastAccessedAt = at
+	})
+}
+
+func (r *MemoryShareLinkRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+// MemoryFrameRepository keeps smart frames in memory
+type MemoryFrameRepository struct {
+	store *memoryStore[models.SmartFrame]
+}
+
+func (r *MemoryFrameRepository) Create(ctx context.Context, frame *models.SmartFrame) error {
+	if frame.ID.IsZero() {
+		frame.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(frame.ID, *frame, nil)
+}
+
+func (r *MemoryFrameRepository) Get(ctx context.Context, id primitive.ObjectID) (models.SmartFrame, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryFrameRepository) GetByClaimToken(ctx context.Context, tokenHash string) (models.SmartFrame, error) {
+	return r.store.find(func(frame models.SmartFrame) bool { return frame.ClaimTokenHash == tokenHash })
+}
+
+func (r *MemoryFrameRepository) List(ctx context.Context, filter FrameFilter, query PageQuery) (Page[models.SmartFrame], error) {
+	return r.store.list(func(frame models.SmartFrame) bool {
+		return filter.OwnerID == nil || frame.OwnerID == *filter.OwnerID
+	}, query)
+}
+
+func (r *MemoryFrameRepository) IDsWithAlbum(ctx context.Context, albumID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	frames := r.store.filter(func(frame models.SmartFrame) bool { return slices.Contains(frame.LoadedAlbums, albumID) })
+
+	frameIDs := make([]primitive.ObjectID, 0, len(frames))
+	for _, frame := range frames {
+		frameIDs = append(frameIDs, frame.ID)
+	}
+	return frameIDs, nil
+}
+
+func (r *MemoryFrameRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, nil)
+}
+
+func (r *MemoryFrameRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return r.store.updateIf(id, func(frame models.SmartFrame) bool { return frame.UpdatedAt.Equal(updatedAt) }, fields, nil)
+}
+
+func (r *MemoryFrameRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+// MemoryNotificationRepository keeps notifications in memory
+type MemoryNotificationRepository struct {
+	store *memoryStore[models.Notification]
+}
+
+func (r *MemoryNotificationRepository) Create(ctx context.Context, notification *models.Notification) error {
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(notification.ID, *notification, nil)
+}
+
+func (r *MemoryNotificationRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Notification, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryNotificationRepository) List(ctx context.Context, filter NotificationFilter, query PageQuery) (Page[models.Notification], error) {
+	return r.store.list(func(notification models.Notification) bool {
+		return notification.UserID == filter.UserID && (!filter.UnreadOnly || notification.ReadAt.IsZero())
+	}, query)
+}
+
+func (r *MemoryNotificationRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, nil)
+}
+
+// MemoryHeartbeatRepository keeps frame heartbeats in memory, without expiring them
+type MemoryHeartbeatRepository struct {
+	store *memoryStore[models.FrameHeartbeat]
+}
+
+func (r *MemoryHeartbeatRepository) Create(ctx context.Context, heartbeat *models.FrameHeartbeat) error {
+	if heartbeat.ID.IsZero() {
+		heartbeat.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(heartbeat.ID, *heartbeat, nil)
+}
+
+func (r *MemoryHeartbeatRepository) ListByFrame(ctx context.Context, frameID primitive.ObjectID, query PageQuery) (Page[models.FrameHeartbeat], error) {
+	return r.store.list(func(heartbeat models.FrameHeartbeat) bool { return heartbeat.FrameID == frameID }, query)
+}
+
+func (r *MemoryHeartbeatRepository) DeleteByFrame(ctx context.Context, frameID primitive.ObjectID) error {
+	r.store.deleteWhere(func(heartbeat models.FrameHeartbeat) bool { return heartbeat.FrameID == frameID })
+	return nil
+}
+
+// MemoryDisplayStatRepository keeps picture display stats in memory, one per frame and picture
+type MemoryDisplayStatRepository struct {
+	store *memoryStore[models.PictureDisplayStat]
+}
+
+func (r *MemoryDisplayStatRepository) Record(ctx context.Context, frameID primitive.ObjectID, counts map[primitive.ObjectID]int64, at time.Time) error {
+	for pictureID, count := range counts {
+		stat := models.PictureDisplayStat{ID: primitive.NewObjectID(), FrameID: frameID, PictureID: pictureID, Count: count, LastDisplayedAt: at}
+		err := r.store.insert(stat.ID, stat, r.unique)
+		if !errors.Is(err, ErrDuplicate) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		existing, err := r.store.find(func(other models.PictureDisplayStat) bool { return !r.unique(stat, other) })
+		if err != nil {
+			return err
+		}
+		err = r.store.modify(existing.ID, func(existing *models.PictureDisplayStat) {
+			existing.Count += count
+			if at.After(existing.LastDisplayedAt) {
+				existing.LastDisplayedAt = at
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryDisplayStatRepository) ListByFrame(ctx context.Context, frameID primitive.ObjectID, query PageQuery) (Page[models.PictureDisplayStat], error) {
+	return r.store.list(func(stat models.PictureDisplayStat) bool { return stat.FrameID == frameID }, query)
+}
+
+func (r *MemoryDisplayStatRepository) DeleteByFrame(ctx context.Context, frameID primitive.ObjectID) error {
+	r.store.deleteWhere(func(stat models.PictureDisplayStat) bool { return stat.FrameID == frameID })
+	return nil
+}
+
+// unique mimics the unique frame_id and picture_id index
+func (r *MemoryDisplayStatRepository) unique(candidate, other models.PictureDisplayStat) bool {
+	return candidate.FrameID != other.FrameID || candidate.PictureID != other.PictureID
+}
+
+// MemoryFirmwareRepository keeps firmware releases in memory, one per channel and version
+type MemoryFirmwareRepository struct {
+	store *memoryStore[models.FirmwareRelease]
+}
+
+func (r *MemoryFirmwareRepository) Create(ctx context.Context, release *models.FirmwareRelease) error {
+	if release.ID.IsZero() {
+		release.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(release.ID, *release, r.unique)
+}
+
+func (r *MemoryFirmwareRepository) Get(ctx context.Context, id primitive.ObjectID) (models.FirmwareRelease, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryFirmwareRepository) List(ctx context.Context, filter FirmwareFilter, query PageQuery) (Page[models.FirmwareRelease], error) {
+	return r.store.list(func(release models.FirmwareRelease) bool {
+		return filter.Channel == "" || release.Channel == filter.Channel
+	}, query)
+}
+
+func (r *MemoryFirmwareRepository) ListByChannels(ctx context.Context, channels []string) ([]models.FirmwareRelease, error) {
+	return r.store.filter(func(release models.FirmwareRelease) bool { return slices.Contains(channels, release.Channel) }), nil
+}
+
+func (r *MemoryFirmwareRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, r.unique)
+}
+
+func (r *MemoryFirmwareRepository) RecordOutcome(ctx context.Context, id primitive.ObjectID, outcome string) error {
+	return r.store.modify(id, func(release *models.FirmwareRelease) {
+		if outcome == models.FirmwareUpdateFailed {
+			release.FailedCount++
+		} else {
+			release.SucceededCount++
+		}
+	})
+}
+
+// unique mimics the unique channel and version index
+func (r *MemoryFirmwareRepository) unique(candidate, other models.FirmwareRelease) bool {
+	return candidate.Channel != other.Channel || candidate.Version != other.Version
+}
+
+// MemoryFirmwareReportRepository keeps firmware update reports in memory
+type MemoryFirmwareReportRepository struct {
+	store *memoryStore[models.FirmwareUpdateReport]
+}
+
+func (r *MemoryFirmwareReportRepository) Create(ctx context.Context, report *models.FirmwareUpdateReport) error {
+	if report.ID.IsZero() {
+		report.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(report.ID, *report, nil)
+}
+
+func (r *MemoryFirmwareReportRepository) ListByRelease(ctx context.Context, releaseID primitive.ObjectID, query PageQuery) (Page[models.FirmwareUpdateReport], error) {
+	return r.store.list(func(report models.FirmwareUpdateReport) bool { return report.ReleaseID == releaseID }, query)
+}
+
+func (r *MemoryFirmwareReportRepository) FailedReleaseIDs(ctx context.Context, frameID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	var releaseIDs []primitive.ObjectID
+	for _, report := range r.store.filter(func(report models.FirmwareUpdateReport) bool {
+		return report.FrameID == frameID && report.Outcome == models.FirmwareUpdateFailed
+	}) {
+		if !slices.Contains(releaseIDs, report.ReleaseID) {
+			releaseIDs = append(releaseIDs, report.ReleaseID)
+		}
+	}
+	return releaseIDs, nil
+}
+
+// MemoryFaceRepository keeps detected faces in memory
+type MemoryFaceRepository struct {
+	store *memoryStore[models.RecognizedFace]
+}
+
+func (r *MemoryFaceRepository) ReplaceForPicture(ctx context.Context, pictureID primitive.ObjectID, faces []models.RecognizedFace) error {
+	r.store.deleteWhere(func(face models.RecognizedFace) bool { return face.PictureID == pictureID })
+	for i := range faces {
+		if faces[i].ID.IsZero() {
+			faces[i].ID = primitive.NewObjectID()
+		}
+		faces[i].PictureID = pictureID
+		if err := r.store.insert(faces[i].ID, faces[i], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryFaceRepository) List(ctx context.Context, filter FaceFilter, query PageQuery) (Page[models.RecognizedFace], error) {
+	return r.store.list(func(face models.RecognizedFace) bool { return r.matches(filter, face) }, query)
+}
+
+func (r *MemoryFaceRepository) Find(ctx context.Context, filter FaceFilter) ([]models.RecognizedFace, error) {
+	return r.store.filter(func(face models.RecognizedFace) bool { return r.matches(filter, face) }), nil
+}
+
+func (r *MemoryFaceRepository) PictureIDs(ctx context.Context, filter FaceFilter) ([]primitive.ObjectID, error) {
+	var pictureIDs []primitive.ObjectID
+	for _, face := range r.store.filter(func(face models.RecognizedFace) bool { return r.matches(filter, face) }) {
+		if !slices.Contains(pictureIDs, face.PictureID) {
+			pictureIDs = append(pictureIDs, face.PictureID)
+		}
+	}
+	return pictureIDs, nil
+}
+
+func (r *MemoryFaceRepository) AssignPerson(ctx context.Context, filter FaceFilter, personID primitive.ObjectID, name string) error {
+	for _, face := range r.store.filter(func(face models.RecognizedFace) bool { return r.matches(filter, face) }) {
+		err := r.store.modify(face.ID, func(face *models.RecognizedFace) {
+			face.PersonID = personID
+			face.Name = name
+		})
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryFaceRepository) DeleteByPicture(ctx context.Context, pictureID primitive.ObjectID) error {
+	r.store.deleteWhere(func(face models.RecognizedFace) bool { return face.PictureID == pictureID })
+	return nil
+}
+
+func (r *MemoryFaceRepository) matches(filter FaceFilter, face models.RecognizedFace) bool {
+	return (filter.IDs == nil || slices.Contains(filter.IDs, face.ID)) &&
+		(filter.PictureIDs == nil || slices.Contains(filter.PictureIDs, face.PictureID)) &&
+		(filter.PersonIDs == nil || slices.Contains(filter.PersonIDs, face.PersonID))
+}
+
+// MemoryPersonRepository keeps people in memory
+type MemoryPersonRepository struct {
+	store *memoryStore[models.Person]
+}
+
+func (r *MemoryPersonRepository) Create(ctx context.Context, person *models.Person) error {
+	if person.ID.IsZero() {
+		person.ID = primitive.NewObjectID()
+	}
+	return r.store.insert(person.ID, *person, nil)
+}
+
+func (r *MemoryPersonRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Person, error) {
+	return r.store.get(id)
+}
+
+func (r *MemoryPersonRepository) List(ctx context.Context, filter PersonFilter, query PageQuery) (Page[models.Person], error) {
+	return r.store.list(func(person models.Person) bool {
+		return filter.OwnerID == nil || person.OwnerID == *filter.OwnerID
+	}, query)
+}
+
+func (r *MemoryPersonRepository) ListByOwner(ctx context.Context, ownerID primitive.ObjectID) ([]models.Person, error) {
+	return r.store.filter(func(person models.Person) bool { return person.OwnerID == ownerID }), nil
+}
+
+func (r *MemoryPersonRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return r.store.update(id, fields, nil)
+}
+
+func (r *MemoryPersonRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return r.store.updateIf(id, func(person models.Person) bool { return person.UpdatedAt.Equal(updatedAt) }, fields, nil)
+}
+
+func (r *MemoryPersonRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.store.delete(id)
+}
+
+// MemorySearchRepository scores matches over the in-memory albums, pictures and faces. It approximates the text score
+// of MongoDB with the weight of each field times the number of words of the text it contains, without stemming.
+type MemorySearchRepository struct {
+	albums   *MemoryAlbumRepository
+	pictures *MemoryPictureRepository
+	faces    *MemoryFaceRepository
+}
+
+func (r *MemorySearchRepository) Albums(ctx context.Context, filter SearchFilter) (SearchMatches, error) {
+	words := searchWords(filter.Text)
+	var matches []SearchMatch
+	for _, album := range r.albums.store.filter(func(album models.Album) bool {
+		return r.albums.matches(AlbumFilter{VisibleTo: &filter.ViewerID}, album) &&
+			hasTags(album, filter.Tags) && inSearchRange(filter, album.CreatedAt)
+	}) {
+		// the weights of the albums text index
+		score := 10*wordsFound(words, album.Title) + 5*wordsFound(words, album.Tags...) + 2*wordsFound(words, album.Description)
+		if score > 0 {
+			matches = append(matches, SearchMatch{ID: album.ID, Score: score})
+		}
+	}
+	return bestMatches(matches, false), nil
+}
+
+func (r *MemorySearchRepository) Pictures(ctx context.Context, filter SearchFilter) (SearchMatches, error) {
+	// pictures are found through the albums the viewer may see, or because the viewer uploaded them
+	visibleIDs := make(map[primitive.ObjectID]bool)
+	taggedIDs := make(map[primitive.ObjectID]bool)
+	for _, album := range r.albums.store.filter(func(models.Album) bool { return true }) {
+		visibleIDs[album.ID] = r.albums.matches(AlbumFilter{VisibleTo: &filter.ViewerID}, album)
+		taggedIDs[album.ID] = hasTags(album, filter.Tags)
+	}
+
+	words := searchWords(filter.Text)
+	var matches []SearchMatch
+	for _, picture := range r.pictures.store.filter(func(picture models.Picture) bool {
+		visible := visibleIDs[picture.AlbumID] || !filter.ViewerID.IsZero() && picture.UserID == filter.ViewerID
+		return visible && (len(filter.Tags) == 0 || taggedIDs[picture.AlbumID]) && inSearchRange(filter, picture.UploadedAt)
+	}) {
+		match := SearchMatch{ID: picture.ID, Score: wordsFound(words, picture.Description)}
+		for _, face := range r.faces.store.filter(func(face models.RecognizedFace) bool { return face.PictureID == picture.ID }) {
+			if score := wordsFound(words, face.Name); score > 0 {
+				match.Score = max(match.Score, score)
+				match.Faces = append(match.Faces, face.Name)
+			}
+		}
+		if match.Score > 0 {
+			matches = append(matches, match)
+		}
+	}
+	return bestMatches(matches, false), nil
+}
+
+// searchWords returns the distinct lowercase words of the text
+func searchWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isWordSeparator) {
+		if !slices.Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// wordsFound counts the words found in the values
+func wordsFound(words []string, values ...string) float64 {
+	var found float64
+	for _, word := range words {
+		for _, value := range values {
+			if slices.Contains(strings.FieldsFunc(strings.ToLower(value), isWordSeparator), word) {
+				found++
+				break
+			}
+		}
+	}
+	return found
+}
+
+// isWordSeparator tells whether the rune separates words
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// hasTags tells whether the album has all the tags
+func hasTags(album models.Album, tags []string) bool {
+	return !slices.ContainsFunc(tags, func(tag string) bool { return !slices.Contains(album.Tags, tag) })
+}
+
+// inSearchRange tells whether the time is within the inclusive date range of the filter
+func inSearchRange(filter SearchFilter, t time.Time) bool {
+	return (filter.From.IsZero() || !t.Before(filter.From)) && (filter.To.IsZero() || !t.After(filter.To))
+}
+
+// memoryStore is a concurrency-safe map of documents with the semantics the Mongo repositories rely on
+type memoryStore[T any] struct {
+	mu   sync.RWMutex
+	docs map[primitive.ObjectID]T
+}
+
+func newMemoryStore[T any]() *memoryStore[T] {
+	return &memoryStore[T]{docs: make(map[primitive.ObjectID]T)}
+}
+
+// insert adds a document; unique, when set, must accept the document against every other one
+func (s *memoryStore[T]) insert(id primitive.ObjectID, doc T, unique func(candidate, other T) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.docs[id]; ok {
+		return ErrDuplicate
+	}
+	if !s.isUnique(id, doc, unique) {
+		return ErrDuplicate
+	}
+	s.docs[id] = doc
+	return nil
+}
+
+func (s *memoryStore[T]) get(id primitive.ObjectID) (T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.docs[id]
+	if !ok {
+		return doc, ErrNotFound
+	}
+	return doc, nil
+}
+
+// find returns the first document accepted by match, ErrNotFound if there is none
+func (s *memoryStore[T]) find(match func(T) bool) (T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, doc := range s.docs {
+		if match(doc) {
+			return doc, nil
+		}
+	}
+	var zero T
+	return zero, ErrNotFound
+}
+
+// filter returns every document accepted by match
+func (s *memoryStore[T]) filter(match func(T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var docs []T
+	for _, doc := range s.docs {
+		if match(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// deleteWhere removes every document accepted by match
+func (s *memoryStore[T]) deleteWhere(match func(T) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, doc := range s.docs {
+		if match(doc) {
+			delete(s.docs, id)
+		}
+	}
+}
+
+func (s *memoryStore[T]) exists(id primitive.ObjectID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.docs[id]
+	return ok
+}
+
+func (s *memoryStore[T]) delete(id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.docs[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.docs, id)
+	return nil
+}
+
+// modify changes the document in place with change, atomically like an update operator would
+func (s *memoryStore[T]) modify(id primitive.ObjectID, change func(*T)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	change(&doc)
+	s.docs[id] = doc
+	return nil
+}
+
+// update applies fields to the document through its bson representation, like $set would
+func (s *memoryStore[T]) update(id primitive.ObjectID, fields Fields, unique func(candidate, other T) bool) error {
+	return s.updateIf(id, nil, fields, unique)
+}
+
+// updateIf is update that only applies when unmodified, if set, accepts the current document, ErrModified otherwise
+func (s *memoryStore[T]) updateIf(id primitive.ObjectID, unmodified func(T) bool, fields Fields, unique func(candidate, other T) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.docs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if unmodified != nil && !unmodified(doc) {
+		return ErrModified
+	}
+
+	updated, err := applyFields(doc, fields)
+	if err != nil {
+		return err
+	}
+	if !s.isUnique(id, updated, unique) {
+		return ErrDuplicate
+	}
+
+	s.docs[id] = updated
+	return nil
+}
+
+func (s *memoryStore[T]) isUnique(id primitive.ObjectID, doc T, unique func(candidate, other T) bool) bool {
+	if unique == nil {
+		return true
+	}
+	for otherID, other := range s.docs {
+		if otherID != id && !unique(doc, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// list filters, sorts and paginates the documents the same way findPage does on MongoDB
+func (s *memoryStore[T]) list(match func(T) bool, query PageQuery) (Page[T], error) {
+	s.mu.RLock()
+	var raws []bson.Raw
+	for _, doc := range s.docs {
+		if !match(doc) {
+			continue
+		}
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			s.mu.RUnlock()
+			return Page[T]{}, err
+		}
+		raws = append(raws, raw)
+	}
+	s.mu.RUnlock()
+
+	return paginate[T](raws, query)
+}
+
+// applyFields returns a copy of doc with the given bson fields set
+func applyFields[T any](doc T, fields Fields) (T, error) {
+	var updated T
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return updated, err
+	}
+
+	var document bson.M
+	if err := bson.Unmarshal(data, &document); err != nil {
+		return updated, err
+	}
+	for key, value := range fields {
+		document[key] = value
+	}
+
+	if data, err = bson.Marshal(document); err != nil {
+		return updated, err
+	}
+	err = bson.Unmarshal(data, &updated)
+	return updated, err
+}
+
+// paginate applies sort, cursor and limit to already filtered documents
+func paginate[T any](raws []bson.Raw, query PageQuery) (Page[T], error) {
+	page := Page[T]{Total: int64(len(raws))}
+
+	// position compares two documents by sort field then _id, honoring the sort direction
+	position := func(value bson.RawValue, id primitive.ObjectID, other bson.Raw) int {
+		result := 0
+		if query.SortField != "_id" {
+			result = compareValues(value, lookupOrNull(other, query.SortField))
+		}
+		if result == 0 {
+			otherID, _ := other.Lookup("_id").ObjectIDOK()
+			result = bytes.Compare(id[:], otherID[:])
+		}
+		if query.SortDesc {
+			result = -result
+		}
+		return result
+	}
+
+	sort.Slice(raws, func(i, j int) bool {
+		id, _ := raws[i].Lookup("_id").ObjectIDOK()
+		return position(lookupOrNull(raws[i], query.SortField), id, raws[j]) < 0
+	})
+
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil || cursor.SortField != query.SortField {
+			return page, ErrInvalidCursor
+		}
+		start := sort.Search(len(raws), func(i int) bool {
+			return position(cursor.Value, cursor.ID, raws[i]) < 0
+		})
+		raws = raws[start:]
+	}
+
+	hasMore := int64(len(raws)) > query.Limit
+	if hasMore {
+		raws = raws[:query.Limit]
+	}
+
+	page.Items = make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var item T
+		if err := bson.Unmarshal(raw, &item); err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	if hasMore {
+		var err error
+		if page.NextCursor, err = encodeCursor(query.SortField, raws[len(raws)-1]); err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
+
+func lookupOrNull(raw bson.Raw, field string) bson.RawValue {
+	value, err := raw.LookupErr(field)
+	if err != nil {
+		return bson.RawValue{Type: bson.TypeNull}
+	}
+	return value
+}
+
+// compareValues orders the bson values used as sort keys; like MongoDB null and missing values come first,
+// values of other different types are ordered by type
+func compareValues(a, b bson.RawValue) int {
+	if aNull, bNull := isNull(a), isNull(b); aNull || bNull {
+		switch {
+		case aNull && bNull:
+			return 0
+		case aNull:
+			return -1
+		default:
+			return 1
+		}
+	}
+	if a.Type != b.Type {
+		if isNumber(a) && isNumber(b) {
+			return compareFloats(numberValue(a), numberValue(b))
+		}
+		return int(a.Type) - int(b.Type)
+	}
+
+	switch a.Type {
+	case bson.TypeString:
+		return strings.Compare(a.StringValue(), b.StringValue())
+	case bson.TypeDateTime:
+		return compareFloats(float64(a.DateTime()), float64(b.DateTime()))
+	case bson.TypeObjectID:
+		aID, bID := a.ObjectID(), b.ObjectID()
+		return bytes.Compare(aID[:], bID[:])
+	case bson.TypeBoolean:
+		if a.Boolean() == b.Boolean() {
+			return 0
+		} else if b.Boolean() {
+			return -1
+		}
+		return 1
+	case bson.TypeInt32, bson.TypeInt64, bson.TypeDouble:
+		return compareFloats(numberValue(a), numberValue(b))
+	default:
+		return bytes.Compare(a.Value, b.Value)
+	}
+}
+
+func numberValue(value bson.RawValue) float64 {
+	switch value.Type {
+	case bson.TypeInt32:
+		return float64(value.Int32())
+	case bson.TypeInt64:
+		return float64(value.Int64())
+	default:
+		return value.Double()
+	}
+}
+
+func isNull(value bson.RawValue) bool {
+	return value.Type == bson.TypeNull || value.Type == bson.TypeUndefined || value.Type == 0
+}
+
+func isNumber(value bson.RawValue) bool {
+	return value.Type == bson.TypeInt32 || value.Type == bson.TypeInt64 || value.Type == bson.TypeDouble
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/models"
+)
+
+func TestPictureScopeLeavesOutPicturesWithoutAlbum(t *testing.T) {
+	ctx := context.Background()
+	pictures := NewMemoryRepositories().Pictures
+
+	userID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+	ownAlbumID, sharedAlbumID := primitive.NewObjectID(), primitive.NewObjectID()
+	inOwnAlbum := &models.Picture{AlbumID: ownAlbumID, UserID: userID}
+	inSharedAlbum := &models.Picture{AlbumID: sharedAlbumID, UserID: otherID}
+	elsewhere := &models.Picture{AlbumID: primitive.NewObjectID(), UserID: otherID}
+	profilePicture := &models.Picture{UserID: userID}
+	ownerless := &models.Picture{}
+	for _, picture := range []*models.Picture{inOwnAlbum, inSharedAlbum, elsewhere, profilePicture, ownerless} {
+		if err := pictures.Create(ctx, picture); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, uploaderID := range []primitive.ObjectID{userID, primitive.NilObjectID} {
+		ids, err := pictures.IDs(ctx, PictureFilter{Scope: &PictureScope{UploaderID: uploaderID, AlbumIDs: []primitive.ObjectID{sharedAlbumID}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []primitive.ObjectID{inSharedAlbum.ID}
+		if !uploaderID.IsZero() {
+			want = append(want, inOwnAlbum.ID)
+		}
+		if len(ids) != len(want) || slices.ContainsFunc(want, func(id primitive.ObjectID) bool { return !slices.Contains(ids, id) }) {
+			t.Errorf("uploader %s: scope matches %v, want %v", uploaderID.Hex(), ids, want)
+		}
+	}
+}
+
+func TestPictureVisibilityNeedsAnUploaderForPicturesWithoutAlbum(t *testing.T) {
+	ctx := context.Background()
+	pictures := NewMemoryRepositories().Pictures
+
+	userID, albumID := primitive.NewObjectID(), primitive.NewObjectID()
+	inAlbum := &models.Picture{AlbumID: albumID, UserID: primitive.NewObjectID()}
+	profilePicture := &models.Picture{UserID: userID}
+	ownerless := &models.Picture{}
+	for _, picture := range []*models.Picture{inAlbum, profilePicture, ownerless} {
+		if err := pictures.Create(ctx, picture); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, uploaderID := range []primitive.ObjectID{userID, primitive.NilObjectID} {
+		ids, err := pictures.IDs(ctx, PictureFilter{Visible: &PictureVisibility{UploaderID: uploaderID, AlbumIDs: []primitive.ObjectID{albumID}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []primitive.ObjectID{inAlbum.ID}
+		if !uploaderID.IsZero() {
+			want = append(want, profilePicture.ID)
+		}
+		if len(ids) != len(want) || slices.ContainsFunc(want, func(id primitive.ObjectID) bool { return !slices.Contains(ids, id) }) {
+			t.Errorf("uploader %s: visibility matches %v, want %v", uploaderID.Hex(), ids, want)
+		}
+	}
+}
@@ -0,0 +1,1120 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"mirage-backend/database"
+	"mirage-backend/models"
+)
+
+// NewMongoRepositories returns repositories backed by the collections of the given database
+func NewMongoRepositories(db *mongo.Database) Repositories {
+	return Repositories{
+		Users:           &MongoUserRepository{collection: db.Collection(database.UserCollectionName)},
+		Profiles:        &MongoUserProfileRepository{collection: db.Collection(database.ProfileCollectionName)},
+		Albums:          &MongoAlbumRepository{collection: db.Collection(database.AlbumCollectionName)},
+		Pictures:        &MongoPictureRepository{collection: db.Collection(database.PictureCollectionName)},
+		Blobs:           &MongoBlobRepository{collection: db.Collection(database.PictureDataCollectionName)},
+		ProfilePictures: &MongoProfilePictureRepository{collection: db.Collection(database.PfpCollectionName)},
+		Invitations:     &MongoInvitationRepository{collection: db.Collection(database.InvitationCollectionName)},
+		ShareLinks:      &MongoShareLinkRepository{collection: db.Collection(database.ShareLinkCollectionName)},
+		Frames:          &MongoFrameRepository{collection: db.Collection(database.FrameCollectionName)},
+		Notifications:   &MongoNotificationRepository{collection: db.Collection(database.NotificationCollectionName)},
+		Heartbeats:      &MongoHeartbeatRepository{collection: db.Collection(database.HeartbeatCollectionName)},
+		DisplayStats:    &MongoDisplayStatRepository{collection: db.Collection(database.DisplayStatCollectionName)},
+		Firmware:        &MongoFirmwareRepository{collection: db.Collection(database.FirmwareCollectionName)},
+		FirmwareReports: &MongoFirmwareReportRepository{collection: db.Collection(database.FirmwareReportCollectionName)},
+		Faces:           &MongoFaceRepository{collection: db.Collection(database.FaceCollectionName)},
+		People:          &MongoPersonRepository{collection: db.Collection(database.PersonCollectionName)},
+		Search: &MongoSearchRepository{
+			albums:   db.Collection(database.AlbumCollectionName),
+			pictures: db.Collection(database.PictureCollectionName),
+			faces:    db.Collection(database.FaceCollectionName),
+		},
+	}
+}
+
+// MongoUserRepository stores users in MongoDB
+type MongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, user)
+	return mapWriteError(err)
+}
+
+func (r *MongoUserRepository) Get(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := findOne(ctx, r.collection, id, &user)
+	return user, err
+}
+
+func (r *MongoUserRepository) FindByLogin(ctx context.Context, login string) (models.User, error) {
+	var user models.User
+	err := findOneBy(ctx, r.collection, bson.M{"$or": bson.A{bson.M{"username": login}, bson.M{"email": login}}}, &user)
+	return user, err
+}
+
+func (r *MongoUserRepository) List(ctx context.Context, query PageQuery) (Page[models.User], error) {
+	return findPage[models.User](ctx, r.collection, bson.M{}, query)
+}
+
+func (r *MongoUserRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoUserRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return updateOneIfUnmodified(ctx, r.collection, id, updatedAt, fields)
+}
+
+func (r *MongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+func (r *MongoUserRepository) Exists(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return exists(ctx, r.collection, id)
+}
+
+// MongoUserProfileRepository stores user profiles in MongoDB
+type MongoUserProfileRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoUserProfileRepository) Create(ctx context.Context, profile *models.UserProfile) error {
+	if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, profile)
+	return mapWriteError(err)
+}
+
+func (r *MongoUserProfileRepository) Get(ctx context.Context, id primitive.ObjectID) (models.UserProfile, error) {
+	var profile models.UserProfile
+	err := findOne(ctx, r.collection, id, &profile)
+	return profile, err
+}
+
+func (r *MongoUserProfileRepository) GetByUser(ctx context.Context, userID primitive.ObjectID) (models.UserProfile, error) {
+	var profile models.UserProfile
+	err := findOneBy(ctx, r.collection, bson.M{"user_id": userID}, &profile)
+	return profile, err
+}
+
+func (r *MongoUserProfileRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoUserProfileRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return updateOneIfUnmodified(ctx, r.collection, id, updatedAt, fields)
+}
+
+func (r *MongoUserProfileRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+// MongoAlbumRepository stores albums in MongoDB
+type MongoAlbumRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoAlbumRepository) Create(ctx context.Context, album *models.Album) error {
+	if album.ID.IsZero() {
+		album.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, album)
+	return mapWriteError(err)
+}
+
+func (r *MongoAlbumRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Album, error) {
+	var album models.Album
+	err := findOne(ctx, r.collection, id, &album)
+	return album, err
+}
+
+func (r *MongoAlbumRepository) List(ctx context.Context, filter AlbumFilter, query PageQuery) (Page[models.Album], error) {
+	return findPage[models.Album](ctx, r.collection, albumFilter(filter), query)
+}
+
+func (r *MongoAlbumRepository) IDs(ctx context.Context, filter AlbumFilter) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "_id", albumFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	albumIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			albumIDs = append(albumIDs, id)
+		}
+	}
+	return albumIDs, nil
+}
+
+// albumFilter builds the MongoDB filter matching the albums of the AlbumFilter
+func albumFilter(filter AlbumFilter) bson.M {
+	mongoFilter := bson.M{}
+	if filter.IDs != nil {
+		mongoFilter["_id"] = bson.M{"$in": filter.IDs}
+	}
+	if filter.OwnerID != nil {
+		mongoFilter["user_id"] = *filter.OwnerID
+	}
+	if filter.MemberID != nil {
+		mongoFilter["target_user_ids"] = *filter.MemberID
+	}
+	if filter.VisibleTo != nil {
+		visible := bson.A{bson.M{"is_private": bson.M{"$ne": true}}}
+		if viewerID := *filter.VisibleTo; !viewerID.IsZero() {
+			visible = append(visible, bson.M{"user_id": viewerID}, bson.M{"target_user_ids": viewerID})
+		}
+		mongoFilter["$or"] = visible
+	}
+	return mongoFilter
+}
+
+func (r *MongoAlbumRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoAlbumRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return updateOneIfUnmodified(ctx, r.collection, id, updatedAt, fields)
+}
+
+func (r *MongoAlbumRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+func (r *MongoAlbumRepository) Exists(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return exists(ctx, r.collection, id)
+}
+
+// MongoPictureRepository stores picture metadata in MongoDB
+type MongoPictureRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoPictureRepository) Create(ctx context.Context, picture *models.Picture) error {
+	if picture.ID.IsZero() {
+		picture.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, picture)
+	return mapWriteError(err)
+}
+
+func (r *MongoPictureRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Picture, error) {
+	var picture models.Picture
+	err := findOne(ctx, r.collection, id, &picture)
+	return picture, err
+}
+
+func (r *MongoPictureRepository) List(ctx context.Context, filter PictureFilter, query PageQuery) (Page[models.Picture], error) {
+	return findPage[models.Picture](ctx, r.collection, pictureFilter(filter), query)
+}
+
+func (r *MongoPictureRepository) IDs(ctx context.Context, filter PictureFilter) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "_id", pictureFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	pictureIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			pictureIDs = append(pictureIDs, id)
+		}
+	}
+	return pictureIDs, nil
+}
+
+func (r *MongoPictureRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoPictureRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+// pictureFilter translates a PictureFilter into a MongoDB filter
+func pictureFilter(filter PictureFilter) bson.M {
+	mongoFilter := bson.M{}
+	if filter.AlbumID != nil {
+		mongoFilter["album_id"] = *filter.AlbumID
+	}
+	if filter.IDs != nil {
+		mongoFilter["_id"] = bson.M{"$in": filter.IDs}
+	}
+	if filter.Unrecognized {
+		mongoFilter["recognition_status"] = bson.M{"$ne": models.RecognitionDone}
+	}
+	// Scope and Visible both pick pictures among alternatives, which all have to hold
+	var alternatives bson.A
+	if filter.Scope != nil {
+		alternatives = append(alternatives, bson.M{"$or": bson.A{
+			bson.M{"uploader_user_id": filter.Scope.UploaderID, "album_id": bson.M{"$nin": bson.A{nil, primitive.NilObjectID}}},
+			bson.M{"album_id": bson.M{"$in": filter.Scope.AlbumIDs}},
+		}})
+	}
+	if filter.Visible != nil {
+		visible := bson.A{bson.M{"album_id": bson.M{"$in": filter.Visible.AlbumIDs}}}
+		if !filter.Visible.UploaderID.IsZero() {
+			visible = append(visible, bson.M{"uploader_user_id": filter.Visible.UploaderID})
+		}
+		alternatives = append(alternatives, bson.M{"$or": visible})
+	}
+	if len(alternatives) > 0 {
+		mongoFilter["$and"] = alternatives
+	}
+	takenAt := bson.M{}
+	if !filter.TakenAfter.IsZero() {
+		takenAt["$gte"] = filter.TakenAfter
+	}
+	if !filter.TakenBefore.IsZero() {
+		takenAt["$lt"] = filter.TakenBefore
+	}
+	if len(takenAt) > 0 {
+		mongoFilter["taken_at"] = takenAt
+	}
+	if len(filter.Tags) > 0 {
+		mongoFilter["tags"] = bson.M{"$all": filter.Tags}
+	}
+	if filter.UploaderIDs != nil {
+		mongoFilter["uploader_user_id"] = bson.M{"$in": filter.UploaderIDs}
+	}
+	if near := filter.Near; near != nil {
+		center := bson.A{near.Longitude, near.Latitude}
+		mongoFilter["location"] = bson.M{"$geoWithin": bson.M{"$centerSphere": bson.A{center, near.RadiusKm / EarthRadiusKm}}}
+	}
+	return mongoFilter
+}
+
+// MongoBlobRepository stores picture data in MongoDB documents
+type MongoBlobRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoBlobRepository) Save(ctx context.Context, data []byte) (primitive.ObjectID, error) {
+	hash := sha256.Sum256(data)
+	pictureData := models.PictureData{
+		ID:   primitive.NewObjectID(),
+		Data: data,
+		Hash: hex.EncodeToString(hash[:]),
+	}
+
+	if _, err := r.collection.InsertOne(ctx, pictureData); err != nil {
+		return primitive.NilObjectID, err
+	}
+	return pictureData.ID, nil
+}
+
+func (r *MongoBlobRepository) Get(ctx context.Context, id primitive.ObjectID) ([]byte, error) {
+	var pictureData models.PictureData
+	if err := findOne(ctx, r.collection, id, &pictureData); err != nil {
+		return nil, err
+	}
+	return pictureData.Data, nil
+}
+
+func (r *MongoBlobRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+func (r *MongoBlobRepository) Ping(ctx context.Context) error {
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1})
+	err := r.collection.FindOne(ctx, bson.M{}, opts).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	return err
+}
+
+// MongoProfilePictureRepository stores profile pictures in MongoDB
+type MongoProfilePictureRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoProfilePictureRepository) Create(ctx context.Context, profilePicture *models.ProfilePicture) error {
+	if profilePicture.ID.IsZero() {
+		profilePicture.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, profilePicture)
+	return mapWriteError(err)
+}
+
+func (r *MongoProfilePictureRepository) Get(ctx context.Context, id primitive.ObjectID) (models.ProfilePicture, error) {
+	var profilePicture models.ProfilePicture
+	err := findOne(ctx, r.collection, id, &profilePicture)
+	return profilePicture, err
+}
+
+func (r *MongoProfilePictureRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, query PageQuery) (Page[models.ProfilePicture], error) {
+	return findPage[models.ProfilePicture](ctx, r.collection, bson.M{"user_id": userID}, query)
+}
+
+func (r *MongoProfilePictureRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+// MongoInvitationRepository stores album invitations in MongoDB
+type MongoInvitationRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoInvitationRepository) Create(ctx context.Context, invitation *models.AlbumInvitation) error {
+	if invitation.ID.IsZero() {
+		invitation.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, invitation)
+	return mapWriteError(err)
+}
+
+func (r *MongoInvitationRepository) Get(ctx context.Context, id primitive.ObjectID) (models.AlbumInvitation, error) {
+	var invitation models.AlbumInvitation
+	err := findOne(ctx, r.collection, id, &invitation)
+	return invitation, err
+}
+
+func (r *MongoInvitationRepository) GetByAlbumAndUser(ctx context.Context, albumID, userID primitive.ObjectID) (models.AlbumInvitation, error) {
+	var invitation models.AlbumInvitation
+	err := findOneBy(ctx, r.collection, bson.M{"album_id": albumID, "user_id": userID}, &invitation)
+	return invitation, err
+}
+
+func (r *MongoInvitationRepository) List(ctx context.Context, filter InvitationFilter, query PageQuery) (Page[models.AlbumInvitation], error) {
+	mongoFilter := bson.M{}
+	if filter.AlbumID != nil {
+		mongoFilter["album_id"] = *filter.AlbumID
+	}
+	if filter.UserID != nil {
+		mongoFilter["user_id"] = *filter.UserID
+	}
+	if filter.Status != "" {
+		mongoFilter["status"] = filter.Status
+	}
+	return findPage[models.AlbumInvitation](ctx, r.collection, mongoFilter, query)
+}
+
+func (r *MongoInvitationRepository) MemberIDs(ctx context.Context, albumID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "user_id", bson.M{"album_id": albumID, "status": models.InvitationAccepted})
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			memberIDs = append(memberIDs, id)
+		}
+	}
+	return memberIDs, nil
+}
+
+func (r *MongoInvitationRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoInvitationRepository) DeleteByAlbum(ctx context.Context, albumID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"album_id": albumID})
+	return err
+}
+
+// MongoShareLinkRepository stores share links in MongoDB
+type MongoShareLinkRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoShareLinkRepository) Create(ctx context.Context, link *models.ShareLink) error {
+	if link.ID.IsZero() {
+		link.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, link)
+	return mapWriteError(err)
+}
+
+func (r *MongoShareLinkRepository) Get(ctx context.Context, id primitive.ObjectID) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := findOne(ctx, r.collection, id, &link)
+	return link, err
+}
+
+func (r *MongoShareLinkRepository) GetByToken(ctx context.Context, token string) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := findOneBy(ctx, r.collection, bson.M{"token": token}, &link)
+	return link, err
+}
+
+func (r *MongoShareLinkRepository) List(ctx context.Context, filter ShareLinkFilter, query PageQuery) (Page[models.ShareLink], error) {
+	mongoFilter := bson.M{}
+	if filter.AlbumID != nil {
+		mongoFilter["album_id"] = *filter.AlbumID
+	}
+	if filter.PictureID != nil {
+		mongoFilter["picture_id"] = *filter.PictureID
+	}
+	return findPage[models.ShareLink](ctx, r.collection, mongoFilter, query)
+}
+
+func (r *MongoShareLinkRepository) RecordAccess(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	update := bson.M{"$inc": bson.M{"access_count": int64(1)}, "$set": bson.M{"last_accessed_at": at}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return mapWriteError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoShareLinkRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+// MongoFrameRepository stores smart frames in MongoDB
+type MongoFrameRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoFrameRepository) Create(ctx context.Context, frame *models.SmartFrame) error {
+	if frame.ID.IsZero() {
+		frame.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, frame)
+	return mapWriteError(err)
+}
+
+func (r *MongoFrameRepository) Get(ctx context.Context, id primitive.ObjectID) (models.SmartFrame, error) {
+	var frame models.SmartFrame
+	err := findOne(ctx, r.collection, id, &frame)
+	return frame, err
+}
+
+func (r *MongoFrameRepository) GetByClaimToken(ctx context.Context, tokenHash string) (models.SmartFrame, error) {
+	var frame models.SmartFrame
+	err := findOneBy(ctx, r.collection, bson.M{"claim_token_hash": tokenHash}, &frame)
+	return frame, err
+}
+
+func (r *MongoFrameRepository) List(ctx context.Context, filter FrameFilter, query PageQuery) (Page[models.SmartFrame], error) {
+	mongoFilter := bson.M{}
+	if filter.OwnerID != nil {
+		mongoFilter["owner_id"] = *filter.OwnerID
+	}
+	return findPage[models.SmartFrame](ctx, r.collection, mongoFilter, query)
+}
+
+func (r *MongoFrameRepository) IDsWithAlbum(ctx context.Context, albumID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "_id", bson.M{"loaded_albums_id": albumID})
+	if err != nil {
+		return nil, err
+	}
+
+	frameIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			frameIDs = append(frameIDs, id)
+		}
+	}
+	return frameIDs, nil
+}
+
+func (r *MongoFrameRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoFrameRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return updateOneIfUnmodified(ctx, r.collection, id, updatedAt, fields)
+}
+
+func (r *MongoFrameRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+// MongoNotificationRepository stores notifications in MongoDB
+type MongoNotificationRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoNotificationRepository) Create(ctx context.Context, notification *models.Notification) error {
+	if notification.ID.IsZero() {
+		notification.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, notification)
+	return mapWriteError(err)
+}
+
+func (r *MongoNotificationRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Notification, error) {
+	var notification models.Notification
+	err := findOne(ctx, r.collection, id, &notification)
+	return notification, err
+}
+
+func (r *MongoNotificationRepository) List(ctx context.Context, filter NotificationFilter, query PageQuery) (Page[models.Notification], error) {
+	mongoFilter := bson.M{"user_id": filter.UserID}
+	if filter.UnreadOnly {
+		mongoFilter["read_at"] = bson.M{"$exists": false}
+	}
+	return findPage[models.Notification](ctx, r.collection, mongoFilter, query)
+}
+
+func (r *MongoNotificationRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+// findOne decodes the document with the given ID, ErrNotFound if there is none
+func findOne(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, result interface{}) error {
+	return findOneBy(ctx, collection, bson.M{"_id": id}, result)
+}
+
+// findOneBy decodes the first document matching filter, ErrNotFound if there is none
+func findOneBy(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// updateOne applies $set on the document with the given ID, ErrNotFound if there is none
+func updateOne(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, fields Fields) error {
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": fields})
+	if err != nil {
+		return mapWriteError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// updateOneIfUnmodified applies $set on the document with the given ID as long as its updated_at is unchanged,
+// ErrNotFound if there is no such document and ErrModified if it was updated in the meantime
+func updateOneIfUnmodified(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	filter := bson.M{"_id": id, "updated_at": updatedAt}
+	if updatedAt.IsZero() {
+		// documents written before updated_at existed may lack the field
+		filter["updated_at"] = bson.M{"$in": bson.A{updatedAt, nil}}
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return mapWriteError(err)
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	found, err := exists(ctx, collection, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return ErrModified
+}
+
+// deleteOne removes the document with the given ID, ErrNotFound if there is none
+func deleteOne(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) error {
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// exists reports whether a document with the given ID exists
+func exists(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) (bool, error) {
+	count, err := collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// MongoFirmwareRepository stores firmware releases in MongoDB
+type MongoFirmwareRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoFirmwareRepository) Create(ctx context.Context, release *models.FirmwareRelease) error {
+	if release.ID.IsZero() {
+		release.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, release)
+	return mapWriteError(err)
+}
+
+func (r *MongoFirmwareRepository) Get(ctx context.Context, id primitive.ObjectID) (models.FirmwareRelease, error) {
+	var release models.FirmwareRelease
+	err := findOne(ctx, r.collection, id, &release)
+	return release, err
+}
+
+func (r *MongoFirmwareRepository) List(ctx context.Context, filter FirmwareFilter, query PageQuery) (Page[models.FirmwareRelease], error) {
+	mongoFilter := bson.M{}
+	if filter.Channel != "" {
+		mongoFilter["channel"] = filter.Channel
+	}
+	return findPage[models.FirmwareRelease](ctx, r.collection, mongoFilter, query)
+}
+
+func (r *MongoFirmwareRepository) ListByChannels(ctx context.Context, channels []string) ([]models.FirmwareRelease, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"channel": bson.M{"$in": channels}})
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []models.FirmwareRelease
+	if err := cursor.All(ctx, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+func (r *MongoFirmwareRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoFirmwareRepository) RecordOutcome(ctx context.Context, id primitive.ObjectID, outcome string) error {
+	counter := "succeeded_count"
+	if outcome == models.FirmwareUpdateFailed {
+		counter = "failed_count"
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{counter: int64(1)}})
+	if err != nil {
+		return mapWriteError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MongoFirmwareReportRepository stores firmware update reports in MongoDB
+type MongoFirmwareReportRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoFirmwareReportRepository) Create(ctx context.Context, report *models.FirmwareUpdateReport) error {
+	if report.ID.IsZero() {
+		report.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, report)
+	return mapWriteError(err)
+}
+
+func (r *MongoFirmwareReportRepository) ListByRelease(ctx context.Context, releaseID primitive.ObjectID, query PageQuery) (Page[models.FirmwareUpdateReport], error) {
+	return findPage[models.FirmwareUpdateReport](ctx, r.collection, bson.M{"release_id": releaseID}, query)
+}
+
+func (r *MongoFirmwareReportRepository) FailedReleaseIDs(ctx context.Context, frameID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "release_id", bson.M{"frame_id": frameID, "outcome": models.FirmwareUpdateFailed})
+	if err != nil {
+		return nil, err
+	}
+
+	releaseIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			releaseIDs = append(releaseIDs, id)
+		}
+	}
+	return releaseIDs, nil
+}
+
+// MongoFaceRepository stores detected faces in MongoDB
+type MongoFaceRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoFaceRepository) ReplaceForPicture(ctx context.Context, pictureID primitive.ObjectID, faces []models.RecognizedFace) error {
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"picture_id": pictureID}); err != nil {
+		return err
+	}
+	if len(faces) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(faces))
+	for i := range faces {
+		if faces[i].ID.IsZero() {
+			faces[i].ID = primitive.NewObjectID()
+		}
+		faces[i].PictureID = pictureID
+		documents[i] = faces[i]
+	}
+	_, err := r.collection.InsertMany(ctx, documents)
+	return mapWriteError(err)
+}
+
+func (r *MongoFaceRepository) List(ctx context.Context, filter FaceFilter, query PageQuery) (Page[models.RecognizedFace], error) {
+	return findPage[models.RecognizedFace](ctx, r.collection, faceFilter(filter), query)
+}
+
+func (r *MongoFaceRepository) Find(ctx context.Context, filter FaceFilter) ([]models.RecognizedFace, error) {
+	cursor, err := r.collection.Find(ctx, faceFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	var faces []models.RecognizedFace
+	if err := cursor.All(ctx, &faces); err != nil {
+		return nil, err
+	}
+	return faces, nil
+}
+
+func (r *MongoFaceRepository) PictureIDs(ctx context.Context, filter FaceFilter) ([]primitive.ObjectID, error) {
+	values, err := r.collection.Distinct(ctx, "picture_id", faceFilter(filter))
+	if err != nil {
+		return nil, err
+	}
+
+	pictureIDs := make([]primitive.ObjectID, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(primitive.ObjectID); ok {
+			pictureIDs = append(pictureIDs, id)
+		}
+	}
+	return pictureIDs, nil
+}
+
+func (r *MongoFaceRepository) AssignPerson(ctx context.Context, filter FaceFilter, personID primitive.ObjectID, name string) error {
+	update := bson.M{"$set": bson.M{"person_id": personID, "name": name}}
+	if name == "" {
+		update = bson.M{"$set": bson.M{"person_id": personID}, "$unset": bson.M{"name": ""}}
+	}
+	_, err := r.collection.UpdateMany(ctx, faceFilter(filter), update)
+	return err
+}
+
+func (r *MongoFaceRepository) DeleteByPicture(ctx context.Context, pictureID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"picture_id": pictureID})
+	return err
+}
+
+// faceFilter builds the MongoDB filter matching the faces of the FaceFilter
+func faceFilter(filter FaceFilter) bson.M {
+	mongoFilter := bson.M{}
+	if filter.IDs != nil {
+		mongoFilter["_id"] = bson.M{"$in": filter.IDs}
+	}
+	if filter.PictureIDs != nil {
+		mongoFilter["picture_id"] = bson.M{"$in": filter.PictureIDs}
+	}
+	if filter.PersonIDs != nil {
+		mongoFilter["person_id"] = bson.M{"$in": filter.PersonIDs}
+	}
+	return mongoFilter
+}
+
+// MongoPersonRepository stores people in MongoDB
+type MongoPersonRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoPersonRepository) Create(ctx context.Context, person *models.Person) error {
+	if person.ID.IsZero() {
+		person.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, person)
+	return mapWriteError(err)
+}
+
+func (r *MongoPersonRepository) Get(ctx context.Context, id primitive.ObjectID) (models.Person, error) {
+	var person models.Person
+	err := findOne(ctx, r.collection, id, &person)
+	return person, err
+}
+
+func (r *MongoPersonRepository) List(ctx context.Context, filter PersonFilter, query PageQuery) (Page[models.Person], error) {
+	mongoFilter := bson.M{}
+	if filter.OwnerID != nil {
+		mongoFilter["owner_id"] = *filter.OwnerID
+	}
+	return findPage[models.Person](ctx, r.collection, mongoFilter, query)
+}
+
+func (r *MongoPersonRepository) ListByOwner(ctx context.Context, ownerID primitive.ObjectID) ([]models.Person, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"owner_id": ownerID})
+	if err != nil {
+		return nil, err
+	}
+
+	var people []models.Person
+	if err := cursor.All(ctx, &people); err != nil {
+		return nil, err
+	}
+	return people, nil
+}
+
+func (r *MongoPersonRepository) Update(ctx context.Context, id primitive.ObjectID, fields Fields) error {
+	return updateOne(ctx, r.collection, id, fields)
+}
+
+func (r *MongoPersonRepository) UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error {
+	return updateOneIfUnmodified(ctx, r.collection, id, updatedAt, fields)
+}
+
+func (r *MongoPersonRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, id)
+}
+
+// mapWriteError turns driver errors with a domain meaning into repository errors
+func mapWriteError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// MongoHeartbeatRepository stores frame heartbeats in MongoDB, expired by a TTL index
+type MongoHeartbeatRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoHeartbeatRepository) Create(ctx context.Context, heartbeat *models.FrameHeartbeat) error {
+	if heartbeat.ID.IsZero() {
+		heartbeat.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, heartbeat)
+	return mapWriteError(err)
+}
+
+func (r *MongoHeartbeatRepository) ListByFrame(ctx context.Context, frameID primitive.ObjectID, query PageQuery) (Page[models.FrameHeartbeat], error) {
+	return findPage[models.FrameHeartbeat](ctx, r.collection, bson.M{"frame_id": frameID}, query)
+}
+
+func (r *MongoHeartbeatRepository) DeleteByFrame(ctx context.Context, frameID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"frame_id": frameID})
+	return err
+}
+
+// MongoDisplayStatRepository stores picture display stats in MongoDB
+type MongoDisplayStatRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *MongoDisplayStatRepository) Record(ctx context.Context, frameID primitive.ObjectID, counts map[primitive.ObjectID]int64, at time.Time) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(counts))
+	for pictureID, count := range counts {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"frame_id": frameID, "picture_id": pictureID}).
+			SetUpdate(bson.M{"$inc": bson.M{"count": count}, "$max": bson.M{"last_displayed_at": at}}).
+			SetUpsert(true))
+	}
+	_, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return mapWriteError(err)
+}
+
+func (r *MongoDisplayStatRepository) ListByFrame(ctx context.Context, frameID primitive.ObjectID, query PageQuery) (Page[models.PictureDisplayStat], error) {
+	return findPage[models.PictureDisplayStat](ctx, r.collection, bson.M{"frame_id": frameID}, query)
+}
+
+func (r *MongoDisplayStatRepository) DeleteByFrame(ctx context.Context, frameID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"frame_id": frameID})
+	return err
+}
+
+// MongoSearchRepository scores matches with the text indexes of the albums, pictures and faces
+type MongoSearchRepository struct {
+	albums   *mongo.Collection
+	pictures *mongo.Collection
+	faces    *mongo.Collection
+}
+
+// scoredID is the projection used while scoring matches
+type scoredID struct {
+	ID    primitive.ObjectID `bson:"_id"`
+	Score float64            `bson:"score"`
+}
+
+func (r *MongoSearchRepository) Albums(ctx context.Context, filter SearchFilter) (SearchMatches, error) {
+	mongoFilter := albumFilter(AlbumFilter{VisibleTo: &filter.ViewerID})
+	mongoFilter["$text"] = bson.M{"$search": filter.Text}
+	if len(filter.Tags) > 0 {
+		mongoFilter["tags"] = bson.M{"$all": filter.Tags}
+	}
+	if dateRange := searchDateRange(filter); dateRange != nil {
+		mongoFilter["created_at"] = dateRange
+	}
+
+	scored, capped, err := findScored(ctx, r.albums, mongoFilter)
+	if err != nil {
+		return SearchMatches{}, err
+	}
+
+	matches := make([]SearchMatch, 0, len(scored))
+	for _, s := range scored {
+		matches = append(matches, SearchMatch{ID: s.ID, Score: s.Score})
+	}
+	return bestMatches(matches, capped), nil
+}
+
+func (r *MongoSearchRepository) Pictures(ctx context.Context, filter SearchFilter) (SearchMatches, error) {
+	// pictures are found through the albums the viewer may see, or because the viewer uploaded them
+	visibleIDs, err := r.albums.Distinct(ctx, "_id", albumFilter(AlbumFilter{VisibleTo: &filter.ViewerID}))
+	if err != nil {
+		return SearchMatches{}, err
+	}
+	visible := bson.A{bson.M{"album_id": bson.M{"$in": visibleIDs}}}
+	if !filter.ViewerID.IsZero() {
+		visible = append(visible, bson.M{"uploader_user_id": filter.ViewerID})
+	}
+	pictureFilter := bson.M{"$or": visible}
+	if len(filter.Tags) > 0 {
+		taggedIDs, err := r.albums.Distinct(ctx, "_id", bson.M{"tags": bson.M{"$all": filter.Tags}})
+		if err != nil {
+			return SearchMatches{}, err
+		}
+		pictureFilter["album_id"] = bson.M{"$in": taggedIDs}
+	}
+	if dateRange := searchDateRange(filter); dateRange != nil {
+		pictureFilter["uploaded_at"] = dateRange
+	}
+
+	textFilter := bson.M{"$text": bson.M{"$search": filter.Text}}
+	for key, value := range pictureFilter {
+		textFilter[key] = value
+	}
+	scored, capped, err := findScored(ctx, r.pictures, textFilter)
+	if err != nil {
+		return SearchMatches{}, err
+	}
+
+	matches := make([]SearchMatch, 0, len(scored))
+	byID := make(map[primitive.ObjectID]int, len(scored))
+	for _, s := range scored {
+		byID[s.ID] = len(matches)
+		matches = append(matches, SearchMatch{ID: s.ID, Score: s.Score})
+	}
+
+	faceMatches, facesCapped, err := r.matchFaces(ctx, filter.Text)
+	if err != nil {
+		return SearchMatches{}, err
+	}
+	capped = capped || facesCapped
+	if len(faceMatches) == 0 {
+		return bestMatches(matches, capped), nil
+	}
+
+	// face matches still have to satisfy the picture filters
+	candidates := make([]primitive.ObjectID, 0, len(faceMatches))
+	for id := range faceMatches {
+		candidates = append(candidates, id)
+	}
+	pictureFilter["_id"] = bson.M{"$in": candidates}
+	cursor, err := r.pictures.Find(ctx, pictureFilter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return SearchMatches{}, err
+	}
+	var matching []scoredID
+	if err := cursor.All(ctx, &matching); err != nil {
+		return SearchMatches{}, err
+	}
+
+	for _, m := range matching {
+		faceMatch := faceMatches[m.ID]
+		if i, ok := byID[m.ID]; ok {
+			matches[i].Faces = faceMatch.Faces
+			matches[i].Score = max(matches[i].Score, faceMatch.Score)
+			continue
+		}
+		matches = append(matches, *faceMatch)
+	}
+	return bestMatches(matches, capped), nil
+}
+
+// matchFaces finds the pictures containing faces whose name matches the text, keyed by picture ID.
+// Only the best MaxSearchMatches faces are kept, capped tells whether more of them matched.
+func (r *MongoSearchRepository) matchFaces(ctx context.Context, text string) (matches map[primitive.ObjectID]*SearchMatch, capped bool, err error) {
+	cursor, err := r.faces.Find(ctx,
+		bson.M{"$text": bson.M{"$search": text}},
+		options.Find().
+			SetProjection(bson.M{"picture_id": 1, "name": 1, "score": bson.M{"$meta": "textScore"}}).
+			SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			SetLimit(MaxSearchMatches+1),
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var faces []struct {
+		PictureID primitive.ObjectID `bson:"picture_id"`
+		Name      string             `bson:"name"`
+		Score     float64            `bson:"score"`
+	}
+	if err := cursor.All(ctx, &faces); err != nil {
+		return nil, false, err
+	}
+	if len(faces) > MaxSearchMatches {
+		faces, capped = faces[:MaxSearchMatches], true
+	}
+
+	matches = make(map[primitive.ObjectID]*SearchMatch)
+	for _, face := range faces {
+		match, ok := matches[face.PictureID]
+		if !ok {
+			match = &SearchMatch{ID: face.PictureID}
+			matches[face.PictureID] = match
+		}
+		match.Score = max(match.Score, face.Score)
+		match.Faces = append(match.Faces, face.Name)
+	}
+	return matches, capped, nil
+}
+
+// findScored returns the IDs and text scores of the best MaxSearchMatches matches of a $text filter,
+// capped tells whether more documents matched
+func findScored(ctx context.Context, collection *mongo.Collection, filter bson.M) (scored []scoredID, capped bool, err error) {
+	// one more match is fetched to know whether some were left out
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetProjection(bson.M{"_id": 1, "score": bson.M{"$meta": "textScore"}}).
+		SetSort(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		SetLimit(MaxSearchMatches+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := cursor.All(ctx, &scored); err != nil {
+		return nil, false, err
+	}
+	if len(scored) > MaxSearchMatches {
+		return scored[:MaxSearchMatches], true, nil
+	}
+	return scored, false, nil
+}
+
+// searchDateRange builds the inclusive range condition of the filter, or nil when unbounded
+func searchDateRange(filter SearchFilter) bson.M {
+	dateRange := bson.M{}
+	if !filter.From.IsZero() {
+		dateRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		dateRange["$lte"] = filter.To
+	}
+	if len(dateRange) == 0 {
+		return nil
+	}
+	return dateRange
+}
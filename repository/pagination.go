@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidCursor is returned when a page cursor cannot be decoded or does not match the requested sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageQuery describes a single page request against a collection.
+//
+// SortField is the bson field used for ordering; `_id` is always appended as a tie-breaker so
+// that documents sharing the same sort value are still returned exactly once across pages.
+// Fields, when not empty, restricts the returned documents to the given bson fields
+// (`_id` and the sort field are always included because the cursor needs them).
+type PageQuery struct {
+	Limit     int64
+	SortField string
+	SortDesc  bool
+	Cursor    string
+	Fields    []string
+}
+
+// Page is a single page of results along with the information needed to fetch the next one
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+	Total      int64
+}
+
+// pageCursor is the decoded form of the opaque cursor handed out to clients.
+//
+// Null is set when the sort field of the last document was null or missing, which MongoDB sorts before any other value.
+type pageCursor struct {
+	SortField string             `bson:"f"`
+	Value     bson.RawValue      `bson:"v"`
+	Null      bool               `bson:"n,omitempty"`
+	ID        primitive.ObjectID `bson:"id"`
+}
+
+// isNull tells whether the cursor was issued after a document without a sort value,
+// cursors issued before Null existed carry a null Value instead
+func (c pageCursor) isNull() bool {
+	return c.Null || c.Value.Type == bson.TypeNull || c.Value.Type == bson.TypeUndefined
+}
+
+// findPage runs a keyset-paginated query on the collection.
+//
+// Parameters:
+//   - ctx: The context for database operations.
+//   - collection: The MongoDB collection to query.
+//   - filter: The base filter; the cursor condition is combined with it.
+//   - query: Limit, sort, cursor and projection for the page.
+//
+// Returns:
+//   - The page, whose NextCursor is empty when there are no more documents.
+//   - ErrInvalidCursor if the cursor is malformed or was issued for a different sort field.
+//
+// Total is the number of documents matching the base filter, regardless of the cursor.
+func findPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, query PageQuery) (Page[T], error) {
+	var page Page[T]
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+
+	pageFilter := filter
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil || cursor.SortField != query.SortField {
+			return page, ErrInvalidCursor
+		}
+		pageFilter = bson.M{"$and": bson.A{filter, cursorFilter(query, cursor)}}
+	}
+
+	direction := 1
+	if query.SortDesc {
+		direction = -1
+	}
+
+	sort := bson.D{{Key: "_id", Value: direction}}
+	if query.SortField != "_id" {
+		sort = bson.D{{Key: query.SortField, Value: direction}, {Key: "_id", Value: direction}}
+	}
+
+	// fetch one extra document to know whether another page exists
+	opts := options.Find().SetSort(sort).SetLimit(query.Limit + 1)
+	if len(query.Fields) > 0 {
+		projection := bson.D{{Key: "_id", Value: 1}, {Key: query.SortField, Value: 1}}
+		for _, field := range query.Fields {
+			if field != "_id" && field != query.SortField {
+				projection = append(projection, bson.E{Key: field, Value: 1})
+			}
+		}
+		opts.SetProjection(projection)
+	}
+
+	cursor, err := collection.Find(ctx, pageFilter, opts)
+	if err != nil {
+		return page, err
+	}
+
+	var raws []bson.Raw
+	if err := cursor.All(ctx, &raws); err != nil {
+		return page, err
+	}
+
+	hasMore := int64(len(raws)) > query.Limit
+	if hasMore {
+		raws = raws[:query.Limit]
+	}
+
+	page.Items = make([]T, 0, len(raws))
+	for _, raw := range raws {
+		var item T
+		if err := bson.Unmarshal(raw, &item); err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	if hasMore {
+		page.NextCursor, err = encodeCursor(query.SortField, raws[len(raws)-1])
+		if err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
+
+// cursorFilter builds the condition selecting documents strictly after the cursor position.
+//
+// Documents whose sort field is null or missing come first in ascending order and last in descending order,
+// comparison operators never match them so they are selected explicitly.
+func cursorFilter(query PageQuery, cursor pageCursor) bson.M {
+	operator := "$gt"
+	if query.SortDesc {
+		operator = "$lt"
+	}
+
+	if query.SortField == "_id" {
+		return bson.M{"_id": bson.M{operator: cursor.ID}}
+	}
+
+	if cursor.isNull() {
+		sameValue := bson.M{query.SortField: nil, "_id": bson.M{operator: cursor.ID}}
+		if query.SortDesc {
+			return sameValue
+		}
+		return bson.M{"$or": bson.A{sameValue, bson.M{query.SortField: bson.M{"$ne": nil}}}}
+	}
+
+	after := bson.A{
+		bson.M{query.SortField: bson.M{operator: cursor.Value}},
+		bson.M{query.SortField: cursor.Value, "_id": bson.M{operator: cursor.ID}},
+	}
+	if query.SortDesc {
+		after = append(after, bson.M{query.SortField: nil})
+	}
+	return bson.M{"$or": after}
+}
+
+// encodeCursor serializes the position of the given document into an opaque, URL-safe string
+func encodeCursor(sortField string, last bson.Raw) (string, error) {
+	id, ok := last.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", fmt.Errorf("document has no ObjectID _id")
+	}
+
+	cursor := pageCursor{SortField: sortField, ID: id}
+	value, err := last.LookupErr(sortField)
+	if err != nil || value.Type == bson.TypeNull || value.Type == bson.TypeUndefined {
+		cursor.Value, cursor.Null = bson.RawValue{Type: bson.TypeNull}, true
+	} else {
+		cursor.Value = value
+	}
+
+	data, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(encoded string) (pageCursor, error) {
+	var cursor pageCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, err
+	}
+
+	if err := bson.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+
+	return cursor, nil
+}
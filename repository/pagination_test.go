@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type pagedDocument struct {
+	ID      primitive.ObjectID `bson:"_id"`
+	TakenAt *time.Time         `bson:"taken_at,omitempty"`
+}
+
+func TestPaginateWithNullSortValues(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var documents []pagedDocument
+	for i := range 7 {
+		document := pagedDocument{ID: primitive.NewObjectID()}
+		// every other document has no taken_at, two of them share the same one
+		if i%2 == 1 {
+			takenAt := day.Add(time.Duration(i/3) * time.Hour)
+			document.TakenAt = &takenAt
+		}
+		documents = append(documents, document)
+	}
+
+	for _, desc := range []bool{false, true} {
+		query := PageQuery{Limit: 2, SortField: "taken_at", SortDesc: desc}
+		seen := map[primitive.ObjectID]bool{}
+		for pages := 0; ; pages++ {
+			if pages > len(documents) {
+				t.Fatalf("desc=%v: pagination does not end", desc)
+			}
+
+			var raws []bson.Raw
+			for _, document := range documents {
+				raw, err := bson.Marshal(document)
+				if err != nil {
+					t.Fatal(err)
+				}
+				raws = append(raws, raw)
+			}
+			page, err := paginate[pagedDocument](raws, query)
+			if err != nil {
+				t.Fatalf("desc=%v: %v", desc, err)
+			}
+			for _, item := range page.Items {
+				if seen[item.ID] {
+					t.Fatalf("desc=%v: document %s returned twice", desc, item.ID.Hex())
+				}
+				seen[item.ID] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		if len(seen) != len(documents) {
+			t.Errorf("desc=%v: %d documents returned, want %d", desc, len(seen), len(documents))
+		}
+	}
+}
+
+func TestCursorFilterAfterNullValue(t *testing.T) {
+	id := primitive.NewObjectID()
+	last, err := bson.Marshal(pagedDocument{ID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodeCursor("taken_at", last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := decodeCursor(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.Null {
+		t.Fatal("cursor of a document without taken_at is not null")
+	}
+
+	ascending := cursorFilter(PageQuery{SortField: "taken_at"}, cursor)
+	want := bson.M{"$or": bson.A{
+		bson.M{"taken_at": nil, "_id": bson.M{"$gt": id}},
+		bson.M{"taken_at": bson.M{"$ne": nil}},
+	}}
+	if !reflect.DeepEqual(ascending, want) {
+		t.Errorf("ascending filter = %v, want %v", ascending, want)
+	}
+
+	descending := cursorFilter(PageQuery{SortField: "taken_at", SortDesc: true}, cursor)
+	want = bson.M{"taken_at": nil, "_id": bson.M{"$lt": id}}
+	if !reflect.DeepEqual(descending, want) {
+		t.Errorf("descending filter = %v, want %v", descending, want)
+	}
+}
@@ -0,0 +1,392 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested document doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a write would break a uniqueness constraint
+	ErrDuplicate = errors.New("duplicate")
+	// ErrModified is returned by conditional updates when the document changed since it was read
+	ErrModified = errors.New("modified")
+)
+
+// EarthRadiusKm is the radius of the Earth MongoDB uses to measure distances on a sphere
+const EarthRadiusKm = 6378.1
+
+// Fields is a set of changes keyed by bson field name, applied with $set semantics
+type Fields map[string]interface{}
+
+// AlbumFilter restricts the albums returned by AlbumRepository.List
+type AlbumFilter struct {
+	// IDs keeps the given albums when not nil
+	IDs     []primitive.ObjectID
+	OwnerID *primitive.ObjectID
+	// MemberID keeps the albums the user is a member of, through an accepted invitation
+	MemberID *primitive.ObjectID
+	// VisibleTo keeps the albums the user may view: the public ones, the ones they own and the ones they are a member of.
+	// A nil ObjectID stands for an anonymous viewer, who only views the public albums.
+	VisibleTo *primitive.ObjectID
+}
+
+// InvitationFilter restricts the invitations returned by InvitationRepository.List
+type InvitationFilter struct {
+	AlbumID *primitive.ObjectID
+	UserID  *primitive.ObjectID
+	Status  string
+}
+
+// PictureFilter restricts the pictures returned by PictureRepository.List
+type PictureFilter struct {
+	AlbumID *primitive.ObjectID
+	// IDs keeps the given pictures when not nil
+	IDs []primitive.ObjectID
+	// Unrecognized keeps the pictures whose faces were not detected successfully yet
+	Unrecognized bool
+	// Scope keeps the pictures a user may see, when set
+	Scope *PictureScope
+	// Visible keeps the pictures a user may list, when set
+	Visible *PictureVisibility
+	// TakenAfter and TakenBefore keep the pictures taken in [TakenAfter, TakenBefore), each when not zero
+	TakenAfter  time.Time
+	TakenBefore time.Time
+	// Tags keeps the pictures tagged with each of them
+	Tags []string
+	// UploaderIDs keeps the pictures uploaded by one of them when not nil
+	UploaderIDs []primitive.ObjectID
+	// Near keeps the pictures taken in the area, when set
+	Near *models.GeoCircle
+}
+
+// PictureScope matches the pictures of an album uploaded by a user or that are in one of the albums,
+// pictures outside any album such as profile pictures are never in scope
+type PictureScope struct {
+	UploaderID primitive.ObjectID
+	AlbumIDs   []primitive.ObjectID
+}
+
+// PictureVisibility matches the pictures in one of the albums and the pictures uploaded by a user,
+// pictures outside any album included; a zero UploaderID only matches the pictures of the albums
+type PictureVisibility struct {
+	UploaderID primitive.ObjectID
+	AlbumIDs   []primitive.ObjectID
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	// Create inserts the user, assigning its ID when empty; ErrDuplicate if the username or email is taken
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	// FindByLogin returns the user whose username or email is login
+	FindByLogin(ctx context.Context, login string) (models.User, error)
+	List(ctx context.Context, query PageQuery) (Page[models.User], error)
+	// Update sets the given fields; ErrDuplicate if the username or email is taken
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	// UpdateIfUnmodified sets the given fields only if updated_at still is updatedAt, ErrModified otherwise
+	UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	Exists(ctx context.Context, id primitive.ObjectID) (bool, error)
+}
+
+// AlbumRepository stores albums
+type AlbumRepository interface {
+	Create(ctx context.Context, album *models.Album) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.Album, error)
+	List(ctx context.Context, filter AlbumFilter, query PageQuery) (Page[models.Album], error)
+	// IDs returns the IDs of every album matching the filter
+	IDs(ctx context.Context, filter AlbumFilter) ([]primitive.ObjectID, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	// UpdateIfUnmodified sets the given fields only if updated_at still is updatedAt, ErrModified otherwise
+	UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	Exists(ctx context.Context, id primitive.ObjectID) (bool, error)
+}
+
+// PictureRepository stores picture metadata, the image itself lives in the BlobRepository
+type PictureRepository interface {
+	Create(ctx context.Context, picture *models.Picture) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.Picture, error)
+	List(ctx context.Context, filter PictureFilter, query PageQuery) (Page[models.Picture], error)
+	// IDs returns the IDs of every picture matching the filter
+	IDs(ctx context.Context, filter PictureFilter) ([]primitive.ObjectID, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// BlobRepository stores binary picture data
+type BlobRepository interface {
+	// Save stores the data and returns its ID
+	Save(ctx context.Context, data []byte) (primitive.ObjectID, error)
+	Get(ctx context.Context, id primitive.ObjectID) ([]byte, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Ping checks that the storage is reachable
+	Ping(ctx context.Context) error
+}
+
+// UserProfileRepository stores the detailed profiles of users, at most one per user
+type UserProfileRepository interface {
+	// Create inserts the profile, assigning its ID when empty; ErrDuplicate if the user already has one
+	Create(ctx context.Context, profile *models.UserProfile) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.UserProfile, error)
+	GetByUser(ctx context.Context, userID primitive.ObjectID) (models.UserProfile, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	// UpdateIfUnmodified sets the given fields only if updated_at still is updatedAt, ErrModified otherwise
+	UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// InvitationRepository stores album invitations, at most one per album and user
+type InvitationRepository interface {
+	// Create inserts the invitation, assigning its ID when empty; ErrDuplicate if the user was already invited
+	Create(ctx context.Context, invitation *models.AlbumInvitation) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.AlbumInvitation, error)
+	GetByAlbumAndUser(ctx context.Context, albumID, userID primitive.ObjectID) (models.AlbumInvitation, error)
+	List(ctx context.Context, filter InvitationFilter, query PageQuery) (Page[models.AlbumInvitation], error)
+	// MemberIDs returns the users who accepted an invitation to the album
+	MemberIDs(ctx context.Context, albumID primitive.ObjectID) ([]primitive.ObjectID, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	DeleteByAlbum(ctx context.Context, albumID primitive.ObjectID) error
+}
+
+// ShareLinkFilter restricts the share links returned by ShareLinkRepository.List
+type ShareLinkFilter struct {
+	AlbumID   *primitive.ObjectID
+	PictureID *primitive.ObjectID
+}
+
+// ShareLinkRepository stores the public share links of albums and pictures
+type ShareLinkRepository interface {
+	// Create inserts the link, assigning its ID when empty; ErrDuplicate if its token is taken
+	Create(ctx context.Context, link *models.ShareLink) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.ShareLink, error)
+	GetByToken(ctx context.Context, token string) (models.ShareLink, error)
+	List(ctx context.Context, filter ShareLinkFilter, query PageQuery) (Page[models.ShareLink], error)
+	// RecordAccess atomically counts an opening of the link at the given time
+	RecordAccess(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// FrameFilter restricts the frames returned by FrameRepository.List
+type FrameFilter struct {
+	OwnerID *primitive.ObjectID
+}
+
+// FrameRepository stores smart frames
+type FrameRepository interface {
+	Create(ctx context.Context, frame *models.SmartFrame) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.SmartFrame, error)
+	// GetByClaimToken returns the frame with a pending gift whose claim token hashes to tokenHash
+	GetByClaimToken(ctx context.Context, tokenHash string) (models.SmartFrame, error)
+	List(ctx context.Context, filter FrameFilter, query PageQuery) (Page[models.SmartFrame], error)
+	// IDsWithAlbum returns the frames the album is loaded onto
+	IDsWithAlbum(ctx context.Context, albumID primitive.ObjectID) ([]primitive.ObjectID, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	// UpdateIfUnmodified updates the frame only if it was last updated at updatedAt, ErrModified otherwise
+	UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// NotificationFilter restricts the notifications returned by NotificationRepository.List
+type NotificationFilter struct {
+	UserID     primitive.ObjectID
+	UnreadOnly bool
+}
+
+// NotificationRepository stores the notifications of users
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *models.Notification) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.Notification, error)
+	List(ctx context.Context, filter NotificationFilter, query PageQuery) (Page[models.Notification], error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+}
+
+// HeartbeatRepository stores the heartbeats of the frames, their status history
+type HeartbeatRepository interface {
+	Create(ctx context.Context, heartbeat *models.FrameHeartbeat) error
+	ListByFrame(ctx context.Context, frameID primitive.ObjectID, query PageQuery) (Page[models.FrameHeartbeat], error)
+	DeleteByFrame(ctx context.Context, frameID primitive.ObjectID) error
+}
+
+// DisplayStatRepository stores how many times the frames displayed each picture
+type DisplayStatRepository interface {
+	// Record adds the given display counts per picture to the frame's stats, starting the stats of new pictures
+	Record(ctx context.Context, frameID primitive.ObjectID, counts map[primitive.ObjectID]int64, at time.Time) error
+	ListByFrame(ctx context.Context, frameID primitive.ObjectID, query PageQuery) (Page[models.PictureDisplayStat], error)
+	DeleteByFrame(ctx context.Context, frameID primitive.ObjectID) error
+}
+
+// FirmwareFilter restricts the releases returned by FirmwareRepository.List
+type FirmwareFilter struct {
+	Channel string
+}
+
+// FirmwareRepository stores the firmware releases, their image lives in the BlobRepository
+type FirmwareRepository interface {
+	// Create inserts the release, assigning its ID when empty; ErrDuplicate if the version exists in the channel
+	Create(ctx context.Context, release *models.FirmwareRelease) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.FirmwareRelease, error)
+	List(ctx context.Context, filter FirmwareFilter, query PageQuery) (Page[models.FirmwareRelease], error)
+	// ListByChannels returns every release of the given channels
+	ListByChannels(ctx context.Context, channels []string) ([]models.FirmwareRelease, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	// RecordOutcome atomically counts an update to the release reported by a frame
+	RecordOutcome(ctx context.Context, id primitive.ObjectID, outcome string) error
+}
+
+// FirmwareReportRepository stores the outcomes of the firmware updates reported by the frames
+type FirmwareReportRepository interface {
+	Create(ctx context.Context, report *models.FirmwareUpdateReport) error
+	ListByRelease(ctx context.Context, releaseID primitive.ObjectID, query PageQuery) (Page[models.FirmwareUpdateReport], error)
+	// FailedReleaseIDs returns the releases the frame reported it failed to install
+	FailedReleaseIDs(ctx context.Context, frameID primitive.ObjectID) ([]primitive.ObjectID, error)
+}
+
+// FaceFilter restricts the faces matched by the FaceRepository, each list that is not nil keeps the faces in it
+type FaceFilter struct {
+	IDs        []primitive.ObjectID
+	PictureIDs []primitive.ObjectID
+	PersonIDs  []primitive.ObjectID
+}
+
+// FaceRepository stores the faces detected in the pictures
+type FaceRepository interface {
+	// ReplaceForPicture replaces the faces of the picture with the given ones, assigning their IDs when empty
+	ReplaceForPicture(ctx context.Context, pictureID primitive.ObjectID, faces []models.RecognizedFace) error
+	List(ctx context.Context, filter FaceFilter, query PageQuery) (Page[models.RecognizedFace], error)
+	// Find returns every face matching the filter
+	Find(ctx context.Context, filter FaceFilter) ([]models.RecognizedFace, error)
+	// PictureIDs returns the pictures showing a face matching the filter
+	PictureIDs(ctx context.Context, filter FaceFilter) ([]primitive.ObjectID, error)
+	// AssignPerson groups the faces matching the filter into the person, giving them its name
+	AssignPerson(ctx context.Context, filter FaceFilter, personID primitive.ObjectID, name string) error
+	DeleteByPicture(ctx context.Context, pictureID primitive.ObjectID) error
+}
+
+// PersonFilter restricts the people returned by PersonRepository.List
+type PersonFilter struct {
+	OwnerID *primitive.ObjectID
+}
+
+// PersonRepository stores the people the faces are grouped into
+type PersonRepository interface {
+	Create(ctx context.Context, person *models.Person) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.Person, error)
+	List(ctx context.Context, filter PersonFilter, query PageQuery) (Page[models.Person], error)
+	// ListByOwner returns every person of the owner
+	ListByOwner(ctx context.Context, ownerID primitive.ObjectID) ([]models.Person, error)
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) error
+	// UpdateIfUnmodified updates the person only if it was last updated at updatedAt, ErrModified otherwise
+	UpdateIfUnmodified(ctx context.Context, id primitive.ObjectID, updatedAt time.Time, fields Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// ProfilePictureRepository stores the association between users and their profile pictures
+type ProfilePictureRepository interface {
+	Create(ctx context.Context, profilePicture *models.ProfilePicture) error
+	Get(ctx context.Context, id primitive.ObjectID) (models.ProfilePicture, error)
+	// ListByUser returns the profile pictures a user uploaded, current and previous ones
+	ListByUser(ctx context.Context, userID primitive.ObjectID, query PageQuery) (Page[models.ProfilePicture], error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// MaxSearchMatches caps how many albums, and how many pictures, a SearchRepository returns for a single search
+const MaxSearchMatches = 500
+
+// SearchFilter restricts the albums and pictures matched by SearchRepository
+type SearchFilter struct {
+	// Text is matched against the titles, tags and descriptions of the albums, and against the descriptions of the
+	// pictures and the names of the faces recognized in them
+	Text string
+	// Tags keeps the albums having all of them, and the pictures of these albums
+	Tags []string
+	// From and To keep the albums created and the pictures uploaded in [From, To], each when not zero
+	From time.Time
+	To   time.Time
+	// ViewerID keeps the public albums, the ones the user owns or joined, their pictures and the pictures the user
+	// uploaded; a zero ViewerID only keeps the public albums and their pictures
+	ViewerID primitive.ObjectID
+}
+
+// SearchMatch is an album or a picture matching a search, scored by relevance
+type SearchMatch struct {
+	ID    primitive.ObjectID
+	Score float64
+	// Faces are the names of the faces of a matching picture that match the text
+	Faces []string
+}
+
+// SearchMatches are the best matches of a search, Capped when some matches were left out to return at most
+// MaxSearchMatches of them
+type SearchMatches struct {
+	Items  []SearchMatch
+	Capped bool
+}
+
+// bestMatches sorts the matches by decreasing score and keeps up to MaxSearchMatches of them,
+// capped tells whether some matches were already left out
+func bestMatches(matches []SearchMatch, capped bool) SearchMatches {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID.Hex() < matches[j].ID.Hex()
+	})
+	if len(matches) > MaxSearchMatches {
+		matches, capped = matches[:MaxSearchMatches], true
+	}
+	return SearchMatches{Items: matches, Capped: capped}
+}
+
+// SearchRepository scores the albums and pictures matching a text, the best matches first
+type SearchRepository interface {
+	// Albums returns the albums matching the filter on their title, tags or description, weighted in that order
+	Albums(ctx context.Context, filter SearchFilter) (SearchMatches, error)
+	// Pictures returns the pictures matching the filter on their description or the names of their faces,
+	// scored by the best of the two
+	Pictures(ctx context.Context, filter SearchFilter) (SearchMatches, error)
+}
+
+// Repositories bundles every repository used by the handlers
+type Repositories struct {
+	Users           UserRepository
+	Profiles        UserProfileRepository
+	Albums          AlbumRepository
+	Pictures        PictureRepository
+	Blobs           BlobRepository
+	ProfilePictures ProfilePictureRepository
+	Invitations     InvitationRepository
+	ShareLinks      ShareLinkRepository
+	Frames          FrameRepository
+	Notifications   NotificationRepository
+	Heartbeats      HeartbeatRepository
+	DisplayStats    DisplayStatRepository
+	Firmware        FirmwareRepository
+	FirmwareReports FirmwareReportRepository
+	Faces           FaceRepository
+	People          PersonRepository
+	Search          SearchRepository
+}
+
+// FieldsOf converts a model into Fields, the same way MongoDB would encode it for a $set
+func FieldsOf(model interface{}) (Fields, error) {
+	data, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields Fields
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	return fields, nil
+}
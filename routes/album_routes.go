@@ -5,31 +5,37 @@ import (
 	"mirage-backend/controllers"
 )
 
-// SetupAlbumRoutes sets up all routes related to Album
-func SetupAlbumRoutes(api *gin.RouterGroup) {
+// SetupAlbumRoutes sets up all routes related to Album, searching them with search
+func SetupAlbumRoutes(api *gin.RouterGroup, handler *controllers.AlbumHandler, search *controllers.SearchHandler) {
 	// Route group for album-related picture operations
 	albumRoutes := api.Group("/albums")
 	{
 		// Create a new album
-		albumRoutes.POST("/", controllers.CreateAlbum)
+		albumRoutes.POST("/", handler.CreateAlbum)
 
 		// Get all albums
-		albumRoutes.GET("/", controllers.GetAllAlbums)
+		albumRoutes.GET("/", handler.GetAllAlbums)
 
 		// Get a specific album by ID
-		albumRoutes.GET("/:albumId", controllers.GetAlbumByID)
+		albumRoutes.GET("/:albumId", handler.GetAlbumByID)
 
 		// Update an album by ID
-		albumRoutes.PUT("/:albumId", controllers.UpdateAlbum)
+		albumRoutes.PUT("/:albumId", handler.UpdateAlbum)
+
+		// Partially update an album by ID
+		albumRoutes.PATCH("/:albumId", handler.PatchAlbum)
 
 		// Delete an album by ID
-		albumRoutes.DELETE("/:albumId", controllers.DeleteAlbum)
+		albumRoutes.DELETE("/:albumId", handler.DeleteAlbum)
 
-		// Search for albums by title
+		// Search for albums by title, tags and description
 		// Usage: GET /albums/search?q=<search_term>
-		albumRoutes.GET("/search", controllers.SearchAlbums)
+		albumRoutes.GET("/search", search.SearchAlbums)
+
+		// Get the albums shared with the acting user
+		albumRoutes.GET("/shared", handler.GetSharedAlbums)
 
 		// Get album by user ID
-		albumRoutes.GET("/user/:userId", controllers.GetAlbumsByUserID)
+		albumRoutes.GET("/user/:userId", handler.GetAlbumsByUserID)
 	}
 }
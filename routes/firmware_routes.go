@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupFirmwareRoutes sets up the firmware routes: the releases managed by the release pipeline
+// and the over-the-air updates of the frames
+func SetupFirmwareRoutes(api *gin.RouterGroup, handler *controllers.FirmwareHandler) {
+	firmwareRoutes := api.Group("/firmware")
+	{
+		firmwareRoutes.POST("/releases", handler.CreateRelease)
+		firmwareRoutes.GET("/releases", handler.GetReleases)
+		firmwareRoutes.GET("/releases/:releaseId", handler.GetRelease)
+		firmwareRoutes.PUT("/releases/:releaseId/rollout", handler.UpdateRollout)
+		firmwareRoutes.GET("/releases/:releaseId/reports", handler.GetReleaseReports)
+	}
+
+	// Endpoints called by the frame itself
+	deviceRoutes := api.Group("/smart-frames/:frameId/firmware")
+	{
+		deviceRoutes.GET("/update", handler.CheckForUpdate)
+		deviceRoutes.GET("/releases/:releaseId", handler.DownloadRelease)
+		deviceRoutes.POST("/reports", handler.ReportUpdate)
+	}
+}
@@ -4,23 +4,54 @@ import (
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"mirage-backend/controllers"
+	"mirage-backend/events"
+	"mirage-backend/health"
+	"mirage-backend/recognition"
+	"mirage-backend/repository"
 	"mirage-backend/routes/other"
+	"mirage-backend/search"
 	"mirage-backend/utils"
 )
 
-func InitRoutes(r *gin.Engine, apiPath string) {
+// Dependencies are the services the routes are built on
+type Dependencies struct {
+	Repositories repository.Repositories
+	Health       *health.Registry
+	Events       *events.Broker
+	Recognition  *recognition.Pipeline
+	People       *recognition.People // Groups the faces stored by the Recognition pipeline
+	Environment  string
+	// FirmwarePublisherToken authenticates the release pipeline, publishing firmware is disabled when empty
+	FirmwarePublisherToken string
+}
+
+func InitRoutes(r *gin.Engine, apiPath string, deps Dependencies) {
+	repos := deps.Repositories
+	broker := deps.Events
+
+	searchHandler := controllers.NewSearchHandler(search.NewSearcher(repos.Search, repos.Albums, repos.Pictures))
+
 	api := r.Group(apiPath)
 	{
-		SetupUserRoutes(api)
-		SetupAlbumRoutes(api)
-		SetupPictureRoutes(api)
-		SetupProfilePictureRoutes(api)
+		SetupUserRoutes(api, controllers.NewUserHandler(repos.Users, repos.Profiles), controllers.NewUserProfileHandler(repos.Users, repos.Profiles))
+		SetupAlbumRoutes(api, controllers.NewAlbumHandler(repos.Albums, repos.Invitations, repos.People), searchHandler)
+		SetupInvitationRoutes(api, controllers.NewInvitationHandler(repos.Albums, repos.Users, repos.Invitations))
+		SetupPictureRoutes(api, controllers.NewPictureHandler(repos.Pictures, repos.Albums, repos.Blobs, repos.Invitations, repos.Frames, repos.Faces, deps.People, broker, deps.Recognition))
+		SetupRecognitionRoutes(api, controllers.NewRecognitionHandler(repos.Albums, repos.Pictures, repos.Faces, repos.Invitations, deps.Recognition))
+		SetupPeopleRoutes(api, controllers.NewPeopleHandler(repos.People, repos.Faces, repos.Pictures, deps.People))
+		SetupShareLinkRoutes(api, controllers.NewShareLinkHandler(repos.ShareLinks, repos.Albums, repos.Pictures, repos.Blobs, repos.Invitations))
+		SetupProfilePictureRoutes(api, controllers.NewProfilePictureHandler(repos.Users, repos.Pictures, repos.Blobs, repos.ProfilePictures))
+		SetupSmartFrameRoutes(api, controllers.NewSmartFrameHandler(repos.Frames, repos.Albums, repos.Invitations, repos.Notifications, repos.Heartbeats, repos.DisplayStats, broker))
+		SetupFirmwareRoutes(api, controllers.NewFirmwareHandler(repos.Firmware, repos.FirmwareReports, repos.Frames, repos.Blobs, deps.FirmwarePublisherToken))
+		SetupNotificationRoutes(api, controllers.NewNotificationHandler(repos.Notifications))
+		SetupSearchRoutes(api, searchHandler)
 
 		// Homepage result
 		other.SetupHomepageRoutes(api)
 
 		// Health check route
-		other.SetupHealthRoutes(api)
+		other.SetupHealthRoutes(api, deps.Health, deps.Environment)
 
 		// Swagger documentation route
 
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupInvitationRoutes sets up the album sharing routes: invitations and members of albums
+func SetupInvitationRoutes(api *gin.RouterGroup, handler *controllers.InvitationHandler) {
+	albumRoutes := api.Group("/albums/:albumId")
+	{
+		// Invite a user to an album and list the invitations sent
+		albumRoutes.POST("/invitations", handler.InviteToAlbum)
+		albumRoutes.GET("/invitations", handler.GetAlbumInvitations)
+
+		// Members of an album, their role and their access
+		albumRoutes.GET("/members", handler.GetAlbumMembers)
+		albumRoutes.PUT("/members/:userId", handler.UpdateMemberRole)
+		albumRoutes.DELETE("/members/:userId", handler.RemoveMember)
+	}
+
+	// Invitations received by the acting user
+	invitationRoutes := api.Group("/invitations")
+	{
+		invitationRoutes.GET("/", handler.GetMyInvitations)
+		invitationRoutes.POST("/:invitationId/accept", handler.AcceptInvitation)
+		invitationRoutes.POST("/:invitationId/decline", handler.DeclineInvitation)
+	}
+}
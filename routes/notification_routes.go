@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupNotificationRoutes sets up the routes of the notifications of the acting user
+func SetupNotificationRoutes(api *gin.RouterGroup, handler *controllers.NotificationHandler) {
+	notificationRoutes := api.Group("/notifications")
+	{
+		notificationRoutes.GET("/", handler.GetMyNotifications)
+		notificationRoutes.POST("/:notificationId/read", handler.MarkNotificationRead)
+	}
+}
@@ -7,16 +7,27 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"mirage-backend/health"
 )
 
 // HealthCheckResponse represents the structure of the health check response
 type HealthCheckResponse struct {
-	Status      string        `json:"status"`
-	Uptime      string        `json:"uptime"`
-	Version     string        `json:"version"`
-	Environment string        `json:"environment"`
-	System      SystemInfo    `json:"system"`
-	Metrics     ServerMetrics `json:"metrics"`
+	Status      string                            `json:"status"`
+	Uptime      string                            `json:"uptime"`
+	Version     string                            `json:"version"`
+	Commit      string                            `json:"commit"`
+	Environment string                            `json:"environment"`
+	Components  map[string]health.ComponentStatus `json:"components"`
+	System      SystemInfo                        `json:"system"`
+	Metrics     ServerMetrics                     `json:"metrics"`
+}
+
+// ReadinessResponse represents the structure of the readiness probe response
+type ReadinessResponse struct {
+	Status     string                            `json:"status"`
+	Version    string                            `json:"version"`
+	Commit     string                            `json:"commit"`
+	Components map[string]health.ComponentStatus `json:"components"`
 }
 
 // SystemInfo contains information about the system
@@ -33,31 +44,59 @@ type ServerMetrics struct {
 	StartTime int64 `json:"startTime"`
 }
 
-var (
-	appStartTime time.Time
-	appVersion   = "0.1.0"
-	appEnv       = "development"
-)
+var appStartTime = time.Now()
 
-func init() {
-	appStartTime = time.Now()
+// HealthHandler serves the health endpoints
+type HealthHandler struct {
+	checks      *health.Registry
+	environment string
 }
 
 // SetupHealthRoutes sets up the health check routes
-func SetupHealthRoutes(rg *gin.RouterGroup) {
-	rg.GET("/health", HealthCheck)
+func SetupHealthRoutes(rg *gin.RouterGroup, checks *health.Registry, environment string) {
+	handler := &HealthHandler{checks: checks, environment: environment}
+
+	rg.GET("/health", handler.HealthCheck)
+	rg.GET("/livez", handler.Livez)
+	rg.GET("/readyz", handler.Readyz)
+}
+
+// Livez reports that the process is running, it doesn't look at any dependency
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+		"uptime": formatUptime(time.Since(appStartTime)),
+	})
+}
+
+// Readyz reports whether every dependency is usable, with 503 when one of them isn't
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.checks.Run(c.Request.Context())
+	build := health.Build()
+
+	c.JSON(statusCode(report), ReadinessResponse{
+		Status:     report.Status,
+		Version:    build.Version,
+		Commit:     build.Commit,
+		Components: report.Components,
+	})
 }
 
 // HealthCheck provides a comprehensive health status of the application
-func HealthCheck(c *gin.Context) {
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
+	report := h.checks.Run(c.Request.Context())
+	build := health.Build()
+
 	response := HealthCheckResponse{
-		Status:      "healthy",
+		Status:      report.Status,
 		Uptime:      formatUptime(time.Since(appStartTime)),
-		Version:     appVersion,
-		Environment: appEnv,
+		Version:     build.Version,
+		Commit:      build.Commit,
+		Environment: h.environment,
+		Components:  report.Components,
 		System: SystemInfo{
 			GoVersion:    runtime.Version(),
 			NumCPU:       runtime.NumCPU(),
@@ -70,7 +109,15 @@ func HealthCheck(c *gin.Context) {
 		},
 	}
 
-	c.JSON(http.StatusOK, response)
+	c.JSON(statusCode(report), response)
+}
+
+// statusCode maps a readiness report to the HTTP status expected by probes
+func statusCode(report health.Report) int {
+	if report.Ready() {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
 }
 
 // formatUptime converts duration to a human-readable uptime string
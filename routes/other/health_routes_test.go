@@ -0,0 +1,91 @@
+package other
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"mirage-backend/health"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve answers a GET of path by the health routes running the checks
+func serve(t *testing.T, checks map[string]health.Check, path string) (int, map[string]health.ComponentStatus, string) {
+	t.Helper()
+	registry := health.NewRegistry(50 * time.Millisecond)
+	for name, check := range checks {
+		registry.Register(name, check)
+	}
+	router := gin.New()
+	SetupHealthRoutes(router.Group("/"), registry, "test")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var body struct {
+		Status     string                            `json:"status"`
+		Components map[string]health.ComponentStatus `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("cannot decode the response: %v: %s", err, w.Body.String())
+	}
+	return w.Code, body.Components, body.Status
+}
+
+func TestReadiness(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name   string
+		checks map[string]health.Check
+		code   int
+		status string
+		down   string
+	}{
+		{name: "up", checks: map[string]health.Check{"database": up, "blobs": up}, code: http.StatusOK, status: health.StatusReady},
+		{name: "failing", checks: map[string]health.Check{"database": up, "blobs": failing}, code: http.StatusServiceUnavailable,
+			status: health.StatusDegraded, down: "blobs"},
+		{name: "slow", checks: map[string]health.Check{"database": slow, "blobs": up}, code: http.StatusServiceUnavailable,
+			status: health.StatusDegraded, down: "database"},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{"/readyz", "/health"} {
+			t.Run(tt.name+path, func(t *testing.T) {
+				code, components, status := serve(t, tt.checks, path)
+				if code != tt.code || status != tt.status {
+					t.Errorf("%s = %d %q, want %d %q", path, code, status, tt.code, tt.status)
+				}
+				for name, component := range components {
+					if down := name == tt.down; down != (component.Status == health.StatusDown) {
+						t.Errorf("%s = %+v, want down %t", name, component, down)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLivenessIgnoresTheChecks(t *testing.T) {
+	registry := health.NewRegistry(time.Second)
+	registry.Register("database", func(ctx context.Context) error { return errors.New("connection refused") })
+	router := gin.New()
+	SetupHealthRoutes(router.Group("/"), registry, "test")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/livez = %d, want %d with a failing check", w.Code, http.StatusOK)
+	}
+}
@@ -27,6 +27,8 @@ func Homepage(c *gin.Context) {
 			"/api/v1/pictures",
 			"/api/v1/albums",
 			"/health",
+			"/livez",
+			"/readyz",
 		},
 		"quickLinks": gin.H{
 			"documentation": "/docs",
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupPeopleRoutes sets up the routes of the people the recognized faces are grouped into
+func SetupPeopleRoutes(api *gin.RouterGroup, handler *controllers.PeopleHandler) {
+	peopleRoutes := api.Group("/people")
+	{
+		peopleRoutes.GET("/", handler.GetMyPeople)
+		peopleRoutes.GET("/:personId", handler.GetPerson)
+		peopleRoutes.PATCH("/:personId", handler.PatchPerson)
+
+		// Fix the grouping of the faces
+		peopleRoutes.POST("/:personId/merge", handler.MergePeople)
+		peopleRoutes.POST("/:personId/split", handler.SplitPerson)
+
+		// What the person appears in
+		peopleRoutes.GET("/:personId/faces", handler.GetPersonFaces)
+		peopleRoutes.GET("/:personId/pictures", handler.GetPersonPictures)
+	}
+}
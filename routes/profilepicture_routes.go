@@ -5,26 +5,34 @@ import (
 	"mirage-backend/controllers"
 )
 
-func SetupProfilePictureRoutes(api *gin.RouterGroup) {
+func SetupProfilePictureRoutes(api *gin.RouterGroup, handler *controllers.ProfilePictureHandler) {
 	// Route group for profile picture-related operations
 	profilePictureRoutes := api.Group("/profilepictures")
 	{
-		// Upload profile picture
-		profilePictureRoutes.POST("/user/:userId", controllers.UploadProfilePicture)
-
-		//// Get all profile pictures
-		//profilePictureRoutes.GET("/", controllers.GetAllProfilePictures)
-		//
-		//// Get profile picture by user ID
-		//profilePictureRoutes.GET("/user/:userId", controllers.GetProfilePictureByUserID)
-		//
-		//// Get profile picture by ID
-		//profilePictureRoutes.GET("/:profilePictureId", controllers.GetProfilePictureByID)
-		//
-		//// Update profile picture by ID
-		//profilePictureRoutes.PUT("/:profilePictureId", controllers.UpdateProfilePicture)
-		//
-		//// Delete profile picture by ID
-		//profilePictureRoutes.DELETE("/:profilePictureId", controllers.DeleteProfilePicture)
+		// Upload profile picture, replacing the current one
+		profilePictureRoutes.POST("/user/:userId", handler.UploadProfilePicture)
+		profilePictureRoutes.PUT("/user/:userId", handler.UploadProfilePicture)
+
+		// Get the current profile picture of a user
+		profilePictureRoutes.GET("/user/:userId", handler.GetProfilePictureByUserID)
+
+		// Get the avatar of the current profile picture of a user
+		profilePictureRoutes.GET("/user/:userId/avatar", handler.GetUserAvatar)
+
+		// Get the profile pictures a user uploaded
+		profilePictureRoutes.GET("/user/:userId/history", handler.GetProfilePictureHistory)
+
+		// Get profile picture by ID
+		profilePictureRoutes.GET("/:profilePictureId", handler.GetProfilePictureByID)
+
+		// Get profile picture image and avatar
+		profilePictureRoutes.GET("/:profilePictureId/data", handler.GetProfilePictureData)
+		profilePictureRoutes.GET("/:profilePictureId/avatar", handler.GetProfilePictureAvatar)
+
+		// Make a previous profile picture the current one
+		profilePictureRoutes.PUT("/:profilePictureId", handler.UpdateProfilePicture)
+
+		// Delete profile picture by ID
+		profilePictureRoutes.DELETE("/:profilePictureId", handler.DeleteProfilePicture)
 	}
 }
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupRecognitionRoutes sets up the face recognition routes of the albums
+func SetupRecognitionRoutes(api *gin.RouterGroup, handler *controllers.RecognitionHandler) {
+	albumRoutes := api.Group("/albums")
+	{
+		// Queue the pictures of an album for face recognition
+		albumRoutes.POST("/:albumId/recognize", handler.RecognizeAlbum)
+
+		// Get the faces recognized in the pictures of an album
+		albumRoutes.GET("/:albumId/recognition-results", handler.GetRecognitionResults)
+	}
+}
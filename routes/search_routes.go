@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+func SetupSearchRoutes(api *gin.RouterGroup, handler *controllers.SearchHandler) {
+	// Ranked search across albums and pictures
+	// Usage: GET /search?q=<search_term>&type=albums|pictures&tags=a,b&from=2024-01-01&to=2024-12-31
+	api.GET("/search", handler.Search)
+}
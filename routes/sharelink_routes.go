@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupShareLinkRoutes sets up the management of share links and the public endpoints they open
+func SetupShareLinkRoutes(api *gin.RouterGroup, handler *controllers.ShareLinkHandler) {
+	// Share links of an album or of a single picture
+	api.POST("/albums/:albumId/share-links", handler.CreateAlbumShareLink)
+	api.GET("/albums/:albumId/share-links", handler.GetAlbumShareLinks)
+	api.POST("/pictures/:pictureId/share-links", handler.CreatePictureShareLink)
+	api.GET("/pictures/:pictureId/share-links", handler.GetPictureShareLinks)
+
+	// Revoke a share link
+	api.DELETE("/share-links/:linkId", handler.DeleteShareLink)
+
+	// Read-only endpoints for visitors without an account, identified by the link token
+	sharedRoutes := api.Group("/shared/:token")
+	{
+		sharedRoutes.GET("", handler.OpenShareLink)
+		sharedRoutes.GET("/pictures", handler.GetSharedPictures)
+		sharedRoutes.GET("/pictures/:pictureId", handler.GetSharedPicture)
+		sharedRoutes.GET("/pictures/:pictureId/data", handler.GetSharedPictureData)
+	}
+}
@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"mirage-backend/controllers"
+)
+
+// SetupSmartFrameRoutes sets up the smart frame routes: frames, the albums loaded onto them, gifting them,
+// their display settings and telemetry and the endpoints called by the devices
+func SetupSmartFrameRoutes(api *gin.RouterGroup, handler *controllers.SmartFrameHandler) {
+	frameRoutes := api.Group("/smart-frames")
+	{
+		frameRoutes.POST("/", handler.CreateFrame)
+		frameRoutes.GET("/", handler.GetMyFrames)
+		frameRoutes.GET("/:frameId", handler.GetFrame)
+		frameRoutes.DELETE("/:frameId", handler.DeleteFrame)
+
+		// Albums displayed by a frame
+		frameRoutes.POST("/:frameId/albums", handler.LoadAlbum)
+		frameRoutes.DELETE("/:frameId/albums/:albumId", handler.UnloadAlbum)
+
+		// Gift a frame and claim it as its recipient
+		frameRoutes.POST("/:frameId/gift", handler.GiftFrame)
+		frameRoutes.DELETE("/:frameId/gift", handler.CancelGift)
+		frameRoutes.POST("/claim", handler.ClaimFrame)
+
+		// Display settings edited by the owner and the device token the frame authenticates with
+		frameRoutes.GET("/:frameId/settings", handler.GetFrameSettings)
+		frameRoutes.PUT("/:frameId/settings", handler.UpdateFrameSettings)
+		frameRoutes.POST("/:frameId/device-token", handler.IssueDeviceToken)
+		frameRoutes.POST("/:frameId/commands", handler.SendFrameCommand)
+		frameRoutes.PUT("/:frameId/firmware-channel", handler.UpdateFirmwareChannel)
+
+		// Telemetry reported by the frame
+		frameRoutes.GET("/:frameId/status", handler.GetFrameStatus)
+		frameRoutes.GET("/:frameId/heartbeats", handler.GetFrameHeartbeats)
+		frameRoutes.GET("/:frameId/display-stats", handler.GetFrameDisplayStats)
+
+		// Endpoints called by the frame itself
+		frameRoutes.GET("/:frameId/config", handler.GetDeviceConfig)
+		frameRoutes.GET("/:frameId/events", handler.StreamFrameEvents)
+		frameRoutes.POST("/:frameId/heartbeat", handler.RecordHeartbeat)
+	}
+}
@@ -5,23 +5,32 @@ import (
 	"mirage-backend/controllers"
 )
 
-func SetupUserRoutes(api *gin.RouterGroup) {
+func SetupUserRoutes(api *gin.RouterGroup, handler *controllers.UserHandler, profiles *controllers.UserProfileHandler) {
 
 	userRoutes := api.Group("/users")
 	{
 		// Get User Profile
-		userRoutes.GET("/:userId", controllers.GetUserProfile)
+		userRoutes.GET("/:userId", handler.GetUserProfile)
 
 		// Create User
-		userRoutes.POST("/", controllers.CreateUser)
+		userRoutes.POST("/", handler.CreateUser)
 
 		// Update User Profile
-		userRoutes.PUT("/:userId", controllers.UpdateUserProfile)
+		userRoutes.PUT("/:userId", handler.UpdateUserProfile)
+
+		// Partially update User
+		userRoutes.PATCH("/:userId", handler.PatchUser)
 
 		// Delete User
-		userRoutes.DELETE("/:userId", controllers.DeleteUser)
+		userRoutes.DELETE("/:userId", handler.DeleteUser)
 
 		// Get All Users
-		userRoutes.GET("/", controllers.GetAllUsers)
+		userRoutes.GET("/", handler.GetAllUsers)
+
+		// Detailed profile
+		userRoutes.POST("/:userId/profile", profiles.CreateProfile)
+		userRoutes.GET("/:userId/profile", profiles.GetProfile)
+		userRoutes.PUT("/:userId/profile", profiles.UpdateProfile)
+		userRoutes.PATCH("/:userId/profile", profiles.PatchProfile)
 	}
 }
@@ -0,0 +1,222 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mirage-backend/models"
+	"mirage-backend/repository"
+)
+
+// Result types
+const (
+	TypeAlbum   = "album"
+	TypePicture = "picture"
+)
+
+// ErrInvalidCursor is returned when the cursor of a search request cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query describes a ranked search request
+type Query struct {
+	Text   string    // Text to match against titles, tags, descriptions and face names
+	Types  []string  // Result types to include, all of them when empty
+	Tags   []string  // Albums must have all of these tags; pictures must belong to such an album
+	From   time.Time // Lower bound on album creation / picture upload time (inclusive), ignored when zero
+	To     time.Time // Upper bound on album creation / picture upload time (inclusive), ignored when zero
+	Limit  int
+	Cursor string
+	// ViewerID is the user searching, who only finds the public albums, the albums they own or joined and their
+	// pictures; anonymous searches, with a zero ViewerID, only find public albums and their pictures
+	ViewerID primitive.ObjectID
+}
+
+// Result is a single ranked search hit
+type Result struct {
+	Type         string          `json:"type"`
+	Score        float64         `json:"score"`
+	Album        *models.Album   `json:"album,omitempty"`
+	Picture      *models.Picture `json:"picture,omitempty"`
+	MatchedFaces []string        `json:"matched_faces,omitempty"`
+}
+
+// Results is a page of ranked hits. Only the best repository.MaxSearchMatches albums and pictures are ranked,
+// TotalCapped tells that more of them matched than Total counts.
+type Results struct {
+	Items       []Result
+	Total       int64
+	TotalCapped bool
+	NextCursor  string
+}
+
+// Searcher ranks the albums and pictures matched by a search repository
+type Searcher struct {
+	matches  repository.SearchRepository
+	albums   repository.AlbumRepository
+	pictures repository.PictureRepository
+}
+
+// NewSearcher returns a Searcher ranking the matches of the search repository, loaded from the album and picture repositories
+func NewSearcher(matches repository.SearchRepository, albums repository.AlbumRepository, pictures repository.PictureRepository) *Searcher {
+	return &Searcher{matches: matches, albums: albums, pictures: pictures}
+}
+
+// hit is a match before the full document is loaded
+type hit struct {
+	Type string
+	repository.SearchMatch
+}
+
+// Search runs a ranked full-text search across albums and pictures.
+//
+// Albums are matched on title, tags and description, pictures on their description and on the names of the faces
+// recognized in them. Matches of both are merged by score and paginated with an opaque offset cursor.
+func (s *Searcher) Search(ctx context.Context, query Query) (Results, error) {
+	var results Results
+
+	offset, err := decodeCursor(query.Cursor)
+	if err != nil {
+		return results, ErrInvalidCursor
+	}
+
+	filter := repository.SearchFilter{Text: query.Text, Tags: query.Tags, From: query.From, To: query.To, ViewerID: query.ViewerID}
+	var hits []hit
+
+	if includesType(query.Types, TypeAlbum) {
+		albums, err := s.matches.Albums(ctx, filter)
+		if err != nil {
+			return results, err
+		}
+		for _, match := range albums.Items {
+			hits = append(hits, hit{Type: TypeAlbum, SearchMatch: match})
+		}
+		results.TotalCapped = albums.Capped
+	}
+
+	if includesType(query.Types, TypePicture) {
+		pictures, err := s.matches.Pictures(ctx, filter)
+		if err != nil {
+			return results, err
+		}
+		for _, match := range pictures.Items {
+			hits = append(hits, hit{Type: TypePicture, SearchMatch: match})
+		}
+		results.TotalCapped = results.TotalCapped || pictures.Capped
+	}
+
+	// best scores first, ties broken by ID so that pages are stable
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID.Hex() > hits[j].ID.Hex()
+	})
+
+	results.Total = int64(len(hits))
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+	end := offset + query.Limit
+	if end < len(hits) {
+		results.NextCursor = encodeCursor(end)
+	} else {
+		end = len(hits)
+	}
+
+	results.Items, err = s.load(ctx, hits[offset:end])
+	if err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// load fetches the full documents of the given hits, preserving their order
+func (s *Searcher) load(ctx context.Context, hits []hit) ([]Result, error) {
+	var albumIDs, pictureIDs []primitive.ObjectID
+	for _, h := range hits {
+		if h.Type == TypeAlbum {
+			albumIDs = append(albumIDs, h.ID)
+		} else {
+			pictureIDs = append(pictureIDs, h.ID)
+		}
+	}
+
+	albums := make(map[primitive.ObjectID]*models.Album)
+	if len(albumIDs) > 0 {
+		page, err := s.albums.List(ctx, repository.AlbumFilter{IDs: albumIDs}, byID(len(albumIDs)))
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.Items {
+			albums[page.Items[i].ID] = &page.Items[i]
+		}
+	}
+
+	pictures := make(map[primitive.ObjectID]*models.Picture)
+	if len(pictureIDs) > 0 {
+		page, err := s.pictures.List(ctx, repository.PictureFilter{IDs: pictureIDs}, byID(len(pictureIDs)))
+		if err != nil {
+			return nil, err
+		}
+		for i := range page.Items {
+			pictures[page.Items[i].ID] = &page.Items[i]
+		}
+	}
+
+	results := make([]Result, 0, len(hits))
+	for _, h := range hits {
+		result := Result{Type: h.Type, Score: h.Score, MatchedFaces: h.Faces}
+		if h.Type == TypeAlbum {
+			result.Album = albums[h.ID]
+		} else {
+			result.Picture = pictures[h.ID]
+		}
+		// skip documents deleted between ranking and loading
+		if result.Album == nil && result.Picture == nil {
+			continue
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// byID is the page query loading up to count documents in a single page
+func byID(count int) repository.PageQuery {
+	return repository.PageQuery{Limit: int64(count), SortField: "_id"}
+}
+
+// includesType reports whether the result type was requested, an empty list meaning all of them
+func includesType(types []string, resultType string) bool {
+	return len(types) == 0 || slices.Contains(types, resultType)
+}
+
+// encodeCursor hides the offset of the next page behind an opaque string
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the offset encoded by encodeCursor, 0 for an empty cursor
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
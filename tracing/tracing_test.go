@@ -0,0 +1,116 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"mirage-backend/config"
+)
+
+// remoteParent returns a context carrying a span received from another service, sampled or not
+func remoteParent(sampled bool) context.Context {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: flags, Remote: true,
+	}))
+}
+
+func TestNewProviderSampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratio   float64
+		parent  context.Context
+		sampled bool
+	}{
+		{name: "always", ratio: 1, parent: context.Background(), sampled: true},
+		{name: "never", ratio: 0, parent: context.Background()},
+		{name: "sampled parent", ratio: 0, parent: remoteParent(true), sampled: true},
+		{name: "unsampled parent", ratio: 1, parent: remoteParent(false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			provider := NewProvider(exporter, tt.ratio)
+			defer provider.Shutdown(context.Background())
+
+			ctx, span := provider.Tracer(ServiceName).Start(tt.parent, "picture.store")
+			_, child := provider.Tracer(ServiceName).Start(ctx, "image.process")
+			child.End()
+			span.End()
+			// shutting down would also reset the exporter
+			if err := provider.ForceFlush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := exporter.GetSpans()
+			if !tt.sampled {
+				if len(spans) != 0 {
+					t.Errorf("%d spans exported, want none", len(spans))
+				}
+				return
+			}
+			if len(spans) != 2 {
+				t.Fatalf("%d spans exported, want 2", len(spans))
+			}
+			if spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+				t.Errorf("span %s not a child of %s", spans[0].Name, spans[1].Name)
+			}
+			if parent := trace.SpanContextFromContext(tt.parent); parent.IsValid() && spans[1].SpanContext.TraceID() != parent.TraceID() {
+				t.Errorf("trace %s, want the remote trace %s", spans[1].SpanContext.TraceID(), parent.TraceID())
+			}
+			if service, ok := spans[1].Resource.Set().Value(semconv.ServiceNameKey); !ok || service.AsString() != ServiceName {
+				t.Errorf("service %q, want %q", service.AsString(), ServiceName)
+			}
+		})
+	}
+}
+
+func TestSetupPropagatesTraceContext(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.TracingConfig{Exporter: config.TracingExporterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	carrier := propagation.HeaderCarrier{}
+	otel.GetTextMapPropagator().Inject(remoteParent(true), carrier)
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"; carrier.Get("traceparent") != want {
+		t.Errorf("traceparent %q, want %q", carrier.Get("traceparent"), want)
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	var stdout bytes.Buffer
+	exporter, err := newExporter(context.Background(), config.TracingConfig{Exporter: config.TracingExporterStdout}, &stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := NewProvider(exporter, 1)
+	_, span := provider.Tracer(ServiceName).Start(context.Background(), "recognition.process")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), "recognition.process") {
+		t.Errorf("stdout %q, want the span", stdout.String())
+	}
+
+	if _, err := newExporter(context.Background(), config.TracingConfig{Exporter: "zipkin"}, &stdout); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
@@ -5,8 +5,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"image"
 	"io"
+	"log/slog"
 	"mime/multipart"
-	"net/http"
+	"mirage-backend/apperror"
 )
 
 // RetrieveImageFromHTTPForm retrieves and validates an image file uploaded through an HTTP form.
@@ -17,28 +18,25 @@ import (
 //
 // Returns:
 //   - A byte slice containing the file's data if the operation is successful.
-//   - A boolean indicating whether an error occurred (true if there was an error, false otherwise).
+//   - An *apperror.Error describing what went wrong otherwise.
 //
 // This function performs the following steps:
 //  1. Retrieves the uploaded file from the HTTP form using the specified parameter name.
 //  2. Reads the file's contents into memory as a byte slice.
 //  3. Validates the file's format by decoding it as an image.
-//  4. If any step fails, it sends an appropriate error response via the Gin context and returns `nil` along with `true`.
 //
 // Notes:
 //   - The function ensures the file is closed after reading its contents.
-//   - If the image format is invalid, an error response is returned with the "Invalid image format" message.
-func RetrieveImageFromHTTPForm(c *gin.Context, paramName string) ([]byte, bool) {
+//   - It never writes to the response, the caller decides how to report the error.
+func RetrieveImageFromHTTPForm(c *gin.Context, paramName string) ([]byte, error) {
 	// Retrieve the uploaded file
 	file, _, fileErr := c.Request.FormFile(paramName)
 	if fileErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve file", "details": fileErr.Error()})
-		return nil, true
+		return nil, apperror.BadRequest(apperror.CodeInvalidFile, "Failed to retrieve file: "+fileErr.Error())
 	}
 	defer func(file multipart.File) {
-		err := file.Close()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close file", "details": err.Error()})
+		if err := file.Close(); err != nil {
+			slog.WarnContext(c.Request.Context(), "Failed to close uploaded file", "error", err)
 		}
 	}(file)
 
@@ -47,16 +45,14 @@ func RetrieveImageFromHTTPForm(c *gin.Context, paramName string) ([]byte, bool)
 	// Read the file into memory
 	fileBytes, readErr := io.ReadAll(file)
 	if readErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file", "details": readErr.Error()})
-		return nil, true
+		return nil, apperror.Internal("Failed to read file", readErr)
 	}
 
 	// Decode and validate the image
 	_, _, decodeErr := image.Decode(bytes.NewReader(fileBytes))
 	if decodeErr != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image format", "details": decodeErr.Error()})
-		return nil, true
+		return nil, apperror.BadRequest(apperror.CodeInvalidFile, "Invalid image format: "+decodeErr.Error())
 	}
 
-	return fileBytes, false
+	return fileBytes, nil
 }
@@ -2,32 +2,58 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
 
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/kolesa-team/go-webp/encoder"
 	"github.com/kolesa-team/go-webp/webp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/image/draw"
+	"mirage-backend/metrics"
+	"mirage-backend/tracing"
 )
 
 // ScaleAndConvertToWebPBytes scales down an image from a byte slice to 1600x1200 and encodes it to WebP format.
 // It allows customization of the WebP quality parameter (0-100).
-func ScaleAndConvertToWebPBytes(imageData []byte, quality int) ([]byte, error) {
+// Each stage is traced as a child of the span in ctx.
+func ScaleAndConvertToWebPBytes(ctx context.Context, imageData []byte, quality int) (_ []byte, err error) {
 	if quality < 0 || quality > 100 {
 		return nil, errors.New("quality must be between 0 and 100")
 	}
 
+	ctx, span := tracing.StartSpan(ctx, "image.process", trace.WithAttributes(
+		attribute.Int("image.original_size", len(imageData)),
+		attribute.Int("image.quality", quality),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	metrics.UploadSize.Observe(float64(len(imageData)))
+
 	// Decode the input image
+	stage := startStage(ctx, "decode")
 	img, format, err := image.Decode(bytes.NewReader(imageData))
+	stage.end()
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttributes(attribute.String("image.format", format))
 
-	log.Println("Image format:", format)
+	slog.Debug("Decoded image", "format", format, "size", len(imageData))
 
 	// Get original image dimensions
 	bounds := img.Bounds()
@@ -43,25 +69,100 @@ func ScaleAndConvertToWebPBytes(imageData []byte, quality int) ([]byte, error) {
 	}
 
 	// Scale down the image
+	stage = startStage(ctx, "scale")
 	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
 	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	stage.end()
+
+	// Encode scaled image to WebP format
+	output, err := encodeWebP(ctx, dst, quality)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("image.compressed_size", len(output)))
+	if ratio, err := compareImageFileSizes(imageData, output); err == nil {
+		metrics.CompressionRatio.Observe(ratio)
+	}
+
+	return output, nil
+}
+
+// CreateAvatar crops the center square of an image, scales it down to size x size pixels and encodes it
+// to WebP with the given quality, producing the small rendition of profile pictures used in list views.
+func CreateAvatar(ctx context.Context, imageData []byte, size int, quality int) (_ []byte, err error) {
+	if size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	if quality < 0 || quality > 100 {
+		return nil, errors.New("quality must be between 0 and 100")
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "image.avatar", trace.WithAttributes(attribute.Int("image.size", size)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
-	// Prepare WebP encoding options
+	stage := startStage(ctx, "decode")
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	stage.end()
+	if err != nil {
+		return nil, err
+	}
+
+	// Crop the largest centered square
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	stage = startStage(ctx, "scale")
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Over, nil)
+	stage.end()
+
+	return encodeWebP(ctx, dst, quality)
+}
+
+// encodeWebP encodes img to lossy WebP as the traced encode stage
+func encodeWebP(ctx context.Context, img image.Image, quality int) ([]byte, error) {
 	options, err := encoder.NewLossyEncoderOptions(encoder.PresetDefault, float32(quality))
 	if err != nil {
-		log.Fatalf("Failed to create encoder options: %v", err)
+		return nil, fmt.Errorf("failed to create encoder options: %v", err)
 	}
 
-	// Encode scaled image to WebP format
+	stage := startStage(ctx, "encode")
 	var output bytes.Buffer
-	if err := webp.Encode(&output, dst, options); err != nil {
+	err = webp.Encode(&output, img, options)
+	stage.end()
+	if err != nil {
 		return nil, err
 	}
+	return output.Bytes(), nil
+}
 
-	log.Println("Original image size:", len(imageData)/1024, "KB")
-	log.Println("Compressed image size:", output.Len()/1024, "KB")
+// pipelineStage is a running image pipeline stage, traced and timed
+type pipelineStage struct {
+	name  string
+	start time.Time
+	span  trace.Span
+}
 
-	return output.Bytes(), nil
+func startStage(ctx context.Context, name string) pipelineStage {
+	_, span := tracing.StartSpan(ctx, "image."+name)
+	return pipelineStage{name: name, start: time.Now(), span: span}
+}
+
+// end closes the span of the stage and records its duration
+func (s pipelineStage) end() {
+	s.span.End()
+	metrics.ImageProcessingDuration.WithLabelValues(s.name).Observe(time.Since(s.start).Seconds())
 }
 
 // compareImageFileSizes compares the sizes of two images.
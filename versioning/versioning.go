@@ -0,0 +1,14 @@
+// Package versioning stamps the versions of the resources whose update time serves as their ETag.
+package versioning
+
+import "time"
+
+// NextUpdatedAt returns the update time of a new version, always after the previous one so that every version has
+// its own ETag. It keeps the millisecond precision MongoDB stores.
+func NextUpdatedAt(previous time.Time) time.Time {
+	now := time.Now().Truncate(time.Millisecond)
+	if !now.After(previous) {
+		now = previous.Truncate(time.Millisecond).Add(time.Millisecond)
+	}
+	return now
+}
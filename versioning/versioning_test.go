@@ -0,0 +1,19 @@
+package versioning
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextUpdatedAt(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	if next := NextUpdatedAt(past); !next.After(past) || next.Truncate(time.Millisecond) != next {
+		t.Errorf("NextUpdatedAt(%v) = %v, want a later time in milliseconds", past, next)
+	}
+
+	// a version stamped in the future, or within the same millisecond, is still followed by a later one
+	future := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if next := NextUpdatedAt(future); !next.Equal(future.Add(time.Millisecond)) {
+		t.Errorf("NextUpdatedAt(%v) = %v, want %v", future, next, future.Add(time.Millisecond))
+	}
+}